@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+	"github.com/smell-of-curry/gobds/gobds/service"
+	"github.com/smell-of-curry/gobds/gobds/session"
+)
+
+// runClaim implements `gobds claim`: tools to check what claim policy decides.
+func runClaim(args []string, output io.Writer) error {
+	usage := errors.New("usage: gobds claim explain|cases [flags]")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "explain":
+		return runClaimExplain(args[1:], output)
+	case "cases":
+		return runClaimCases(args[1:], output)
+	default:
+		return usage
+	}
+}
+
+// runClaimExplain implements `gobds claim explain`: it loads a claim
+// snapshot and prints how the proxy decides one action in it, and why.
+func runClaimExplain(args []string, output io.Writer) error {
+	flags := flag.NewFlagSet("claim explain", flag.ContinueOnError)
+	flags.SetOutput(output)
+	url := flags.String("url", "", "claim service `url` to fetch the claims from")
+	key := flags.String("key", "", "authorization `key` of the claim service")
+	persisted := flags.String("persisted", "", "persisted snapshot `file` to load the claims from")
+	maxAge := flags.Duration("max-age", claim.DefaultPersistedMaxAge, "how long a persisted snapshot is trusted, as PersistedMaxAge")
+	dump := flags.String("dump", "", "saved claim service response `file` to load the claims from")
+	xuid := flags.String("xuid", "", "`XUID` of the player")
+	operator := flags.Bool("op", false, "the player is an operator")
+	actionName := flags.String("action", "blockBreak", "claim `action`, such as blockBreak, blockInteract or itemDrop")
+	dimensionName := flags.String("dimension", "overworld", "`dimension` of the position")
+	positionValue := flags.String("pos", "", "position as `x,y,z`")
+	typeID := flags.String("type", "", "block, entity or item `type` ID acted on, such as minecraft:chest")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(output, "usage: gobds claim explain (-url url [-key key] | -persisted file | -dump file) -xuid xuid -pos x,y,z [flags]")
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	sources := 0
+	for _, source := range []string{*url, *persisted, *dump} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one of -url, -persisted and -dump")
+	}
+	action, ok := session.ParseClaimAction(*actionName)
+	if !ok {
+		return fmt.Errorf("unknown claim action %q", *actionName)
+	}
+	dimension, ok := claim.CanonicalDimension(*dimensionName)
+	if !ok {
+		return fmt.Errorf("unknown dimension %q", *dimensionName)
+	}
+	position, err := parsePosition(*positionValue)
+	if err != nil {
+		return err
+	}
+	if *xuid == "" {
+		return errors.New("expected -xuid")
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	factory := claim.NewFactory(service.Config{
+		Enabled: *url != "",
+		URL:     *url,
+		Key:     *key,
+	}, "explain", claim.DefaultPollInterval, claim.DefaultMaxSnapshotAge, log)
+	switch {
+	case *url != "":
+		err = factory.Fetch()
+	case *persisted != "":
+		factory.SetPersistence(*persisted, *maxAge)
+		err = factory.Restore()
+	default:
+		err = publishDump(factory, *dump)
+	}
+	if err != nil {
+		return err
+	}
+	snapshot, status := factory.Snapshot(time.Now())
+	if snapshot == nil {
+		return fmt.Errorf("no claim snapshot to explain with (%s)", status)
+	}
+
+	_, _ = fmt.Fprintf(output, "snapshot: generation %d, %d claims, %s old, %s\n",
+		snapshot.Generation, snapshot.ClaimCount, snapshot.Age(time.Now()).Round(time.Second), status)
+	explanation := session.ExplainClaimAction(snapshot, status, session.ClaimQuery{
+		Actor:     session.ClaimActor{XUID: *xuid, Operator: *operator},
+		Action:    action,
+		Dimension: dimension,
+		Position:  position,
+		TypeID:    *typeID,
+	})
+	_, _ = fmt.Fprintf(output, "claims at %v, %v, %v in %s: %d\n", position.X(), position.Y(), position.Z(), dimension, len(explanation.Matched))
+	for _, cl := range explanation.Matched {
+		marker := " "
+		if explanation.Claim != nil && cl.ID == explanation.Claim.ID {
+			marker = "*"
+		}
+		_, _ = fmt.Fprintf(output, "  %s %s, owner %s%s\n", marker, cl.ID, cl.OwnerXUID, nestedIn(cl))
+	}
+	if explanation.Feature != nil {
+		_, _ = fmt.Fprintf(output, "feature: %s of claim %s\n", explanation.Feature.Type, explanation.FeatureClaim.ID)
+	}
+	verdict := "denied"
+	if explanation.Permitted {
+		verdict = "permitted"
+	}
+	_, _ = fmt.Fprintf(output, "policy: %s %s, %s\n", action, verdict, explanation.Reason)
+	switch {
+	case !explanation.Forwarded() && action == session.ClaimActionItemPickup:
+		// BDS makes pickups before the proxy hears of them.
+		_, _ = fmt.Fprintf(output, "proxy: cannot stop %s, records it as pickup_unblocked\n", action)
+	case !explanation.Forwarded():
+		_, _ = fmt.Fprintf(output, "proxy: denies %s\n", action)
+	case !explanation.Permitted:
+		_, _ = fmt.Fprintf(output, "proxy: forwards %s to the server, failing open while the snapshot is %s\n", action, explanation.Status)
+	default:
+		_, _ = fmt.Fprintf(output, "proxy: forwards %s to the server\n", action)
+	}
+	return nil
+}
+
+// runClaimCases implements `gobds claim cases`: it checks that claim policy
+// decides every case in the case files as they expect.
+func runClaimCases(args []string, output io.Writer) error {
+	flags := flag.NewFlagSet("claim cases", flag.ContinueOnError)
+	flags.SetOutput(output)
+	verbose := flags.Bool("v", false, "print every case, not only cases that failed")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(output, "usage: gobds claim cases [-v] file...")
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("expected at least one case file")
+	}
+
+	var total, failed int
+	for _, path := range flags.Args() {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var cases session.ClaimPolicyCases
+		if err := json.Unmarshal(raw, &cases); err != nil {
+			return fmt.Errorf("decode %s: %w", path, err)
+		}
+		if cases.SchemaVersion != claim.SchemaVersion || cases.PolicyVersion != claim.PolicyVersion {
+			return fmt.Errorf("%s is for schema version %d and policy version %d, this build supports %d and %d",
+				path, cases.SchemaVersion, cases.PolicyVersion, claim.SchemaVersion, claim.PolicyVersion)
+		}
+		for _, c := range cases.Cases {
+			total++
+			explanation, err := c.Explain()
+			if err != nil {
+				return fmt.Errorf("%s: case %q: %w", path, c.Name, err)
+			}
+			result := "ok  "
+			if explanation.Permitted != c.Permitted {
+				failed++
+				result = "FAIL"
+			} else if !*verbose {
+				continue
+			}
+			_, _ = fmt.Fprintf(output, "%s %s: %s, want permitted=%v: %s\n", result, path, c.Name, c.Permitted, explanation.Reason)
+		}
+	}
+	_, _ = fmt.Fprintf(output, "%d cases, %d failed\n", total, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cases failed", failed, total)
+	}
+	return nil
+}
+
+// publishDump publishes the claims of a saved claim service response in
+// factory.
+func publishDump(factory *claim.Factory, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	claims, err := claim.DecodeClaims(f)
+	if err != nil {
+		return err
+	}
+	return factory.Publish(claims)
+}
+
+// parsePosition parses a position written as x,y,z.
+func parsePosition(value string) (mgl32.Vec3, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return mgl32.Vec3{}, fmt.Errorf("invalid position %q, expected x,y,z", value)
+	}
+	var position mgl32.Vec3
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return mgl32.Vec3{}, fmt.Errorf("invalid position %q: %w", value, err)
+		}
+		position[i] = float32(f)
+	}
+	return position, nil
+}
+
+// nestedIn describes the claim cl is nested in, if any.
+func nestedIn(cl *claim.PlayerClaim) string {
+	if cl.ParentID == "" {
+		return ""
+	}
+	return ", nested in " + cl.ParentID
+}
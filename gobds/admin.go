@@ -0,0 +1,461 @@
+package gobds
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/ban"
+	"github.com/smell-of-curry/gobds/gobds/pool"
+	"github.com/smell-of-curry/gobds/gobds/session"
+)
+
+// AdminConfig configures the local admin HTTP API.
+type AdminConfig struct {
+	// Address is the HTTP address the API listens on.
+	Address string
+	// Key must be sent verbatim in the authorization header of every request.
+	Key string
+}
+
+// adminMaxBodyBytes bounds admin request bodies; they only carry short texts.
+const adminMaxBodyBytes = 16 << 10
+
+// adminServerInfo describes one Server and its live sessions.
+type adminServerInfo struct {
+	Name          string             `json:"name"`
+	LocalAddress  string             `json:"local_address"`
+	RemoteAddress string             `json:"remote_address"`
+	PlayerCount   int                `json:"player_count"`
+	MaxPlayers    int                `json:"max_players"`
+	Queued        int                `json:"queued"`
+	Backends      []adminBackendInfo `json:"backends"`
+	Sessions      []adminSessionInfo `json:"sessions"`
+}
+
+// adminBackendInfo describes one backend of a Server's pool.
+type adminBackendInfo struct {
+	Address    string `json:"address"`
+	Weight     int    `json:"weight"`
+	MaxPlayers int    `json:"max_players"`
+	Sessions   int    `json:"sessions"`
+	Draining   bool   `json:"draining"`
+	Healthy    bool   `json:"healthy"`
+	// State, LatencyMS, ConsecutiveFailures and LastError are the results of
+	// health probing. State is "unknown" while probing is disabled.
+	State               string `json:"state"`
+	LatencyMS           int64  `json:"latency_ms"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+// adminSessionInfo describes one live session.
+type adminSessionInfo struct {
+	XUID      string                  `json:"xuid"`
+	Name      string                  `json:"name"`
+	Backend   string                  `json:"backend"`
+	PingMS    int64                   `json:"ping_ms"`
+	Dimension int32                   `json:"dimension"`
+	GameMode  int32                   `json:"game_mode"`
+	Operator  bool                    `json:"operator"`
+	AFKMS     int64                   `json:"afk_ms"`
+	Capturing bool                    `json:"capturing"`
+	Traffic   session.TrafficCounters `json:"traffic"`
+}
+
+// adminTextRequest is the body of kick, message and broadcast requests.
+type adminTextRequest struct {
+	// Server optionally limits a broadcast to one server by name.
+	Server  string `json:"server,omitempty"`
+	Message string `json:"message"`
+}
+
+// adminActionResponse reports how many sessions an action reached.
+type adminActionResponse struct {
+	Sessions int `json:"sessions"`
+}
+
+// adminCaptureResponse lists the capture files an action started or stopped.
+type adminCaptureResponse struct {
+	Sessions int      `json:"sessions"`
+	Files    []string `json:"files"`
+}
+
+// serveAdmin runs the admin API until the proxy closes.
+func (gb *GoBDS) serveAdmin() {
+	gb.serveHTTP("admin api", gb.config().Admin.Address, gb.adminHandler())
+}
+
+// adminHandler returns the authenticated admin API routes.
+func (gb *GoBDS) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/servers", gb.handleAdminServers)
+	mux.HandleFunc("GET /v1/servers/{server}/sessions", gb.handleAdminServerSessions)
+	mux.HandleFunc("GET /v1/servers/{server}/claims/history", gb.handleAdminClaimHistory)
+	mux.HandleFunc("POST /v1/servers/{server}/backends/{backend}/drain", gb.handleAdminDrain(true))
+	mux.HandleFunc("POST /v1/servers/{server}/backends/{backend}/undrain", gb.handleAdminDrain(false))
+	mux.HandleFunc("POST /v1/sessions/{xuid}/kick", gb.handleAdminKick)
+	mux.HandleFunc("POST /v1/sessions/{xuid}/message", gb.handleAdminMessage)
+	mux.HandleFunc("POST /v1/sessions/{xuid}/capture/start", gb.handleAdminCaptureStart)
+	mux.HandleFunc("POST /v1/sessions/{xuid}/capture/stop", gb.handleAdminCaptureStop)
+	mux.HandleFunc("POST /v1/broadcast", gb.handleAdminBroadcast)
+	mux.HandleFunc("GET /v1/bans", gb.handleAdminBans)
+	mux.HandleFunc("POST /v1/bans", gb.handleAdminBan)
+	mux.HandleFunc("DELETE /v1/bans/{id}", gb.handleAdminUnban)
+	return gb.adminAuthenticated(mux)
+}
+
+// adminAuthenticated rejects requests that do not carry the configured key.
+func (gb *GoBDS) adminAuthenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := gb.config().Admin.Key
+		provided := r.Header.Get("authorization")
+		if key == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(key)) != 1 {
+			writeAdminError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminServers lists every server with its sessions.
+func (gb *GoBDS) handleAdminServers(w http.ResponseWriter, _ *http.Request) {
+	servers := make([]adminServerInfo, 0, len(gb.servers))
+	for _, srv := range gb.servers {
+		servers = append(servers, adminServerInfoOf(srv))
+	}
+	writeAdminJSON(w, http.StatusOK, servers)
+}
+
+// handleAdminServerSessions lists the sessions of a single server.
+func (gb *GoBDS) handleAdminServerSessions(w http.ResponseWriter, r *http.Request) {
+	srv, ok := gb.serverByName(r.PathValue("server"))
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, adminServerInfoOf(srv).Sessions)
+}
+
+// handleAdminClaimHistory lists the latest changes to the claims of a
+// server, newest first, optionally only of the claim in the id query
+// parameter.
+func (gb *GoBDS) handleAdminClaimHistory(w http.ResponseWriter, r *http.Request) {
+	srv, ok := gb.serverByName(r.PathValue("server"))
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, srv.claimHistory.list(r.URL.Query().Get("id")))
+}
+
+// handleAdminDrain returns a handler that stops or resumes sending new
+// sessions to a backend. Sessions already on it are left alone.
+func (gb *GoBDS) handleAdminDrain(drain bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv, ok := gb.serverByName(r.PathValue("server"))
+		if !ok {
+			writeAdminError(w, http.StatusNotFound, "server not found")
+			return
+		}
+		if srv.Backends == nil {
+			writeAdminError(w, http.StatusNotFound, "backend not found")
+			return
+		}
+		backend, ok := srv.Backends.Backend(r.PathValue("backend"))
+		if !ok {
+			writeAdminError(w, http.StatusNotFound, "backend not found")
+			return
+		}
+		backend.SetDraining(drain)
+		srv.Log.Info("backend drain changed", "backend", backend.Address(), "draining", drain)
+		writeAdminJSON(w, http.StatusOK, adminBackendInfoOf(backend))
+	}
+}
+
+// handleAdminKick disconnects every session of a XUID.
+func (gb *GoBDS) handleAdminKick(w http.ResponseWriter, r *http.Request) {
+	request, ok := readAdminTextRequest(w, r, false)
+	if !ok {
+		return
+	}
+	sessions := gb.sessionsByXUID(r.PathValue("xuid"))
+	if len(sessions) == 0 {
+		writeAdminError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	for _, s := range sessions {
+		s.Disconnect(request.Message)
+	}
+	writeAdminJSON(w, http.StatusOK, adminActionResponse{Sessions: len(sessions)})
+}
+
+// handleAdminCaptureStart starts capturing every session of a XUID.
+func (gb *GoBDS) handleAdminCaptureStart(w http.ResponseWriter, r *http.Request) {
+	if gb.config().Capture == nil {
+		writeAdminError(w, http.StatusConflict, errCaptureDisabled.Error())
+		return
+	}
+	var response adminCaptureResponse
+	xuid := r.PathValue("xuid")
+	for _, srv := range gb.servers {
+		for _, s := range srv.Sessions() {
+			if xuid == "" || s.IdentityData().XUID != xuid {
+				continue
+			}
+			path, err := gb.startCapture(srv, s)
+			if err != nil {
+				writeAdminError(w, http.StatusConflict, err.Error())
+				return
+			}
+			response.Files = append(response.Files, path)
+			response.Sessions++
+		}
+	}
+	if response.Sessions == 0 {
+		writeAdminError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, response)
+}
+
+// handleAdminCaptureStop stops capturing every session of a XUID.
+func (gb *GoBDS) handleAdminCaptureStop(w http.ResponseWriter, r *http.Request) {
+	sessions := gb.sessionsByXUID(r.PathValue("xuid"))
+	if len(sessions) == 0 {
+		writeAdminError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	var stopped int
+	for _, s := range sessions {
+		if ok, _ := s.StopCapture(); ok {
+			stopped++
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, adminActionResponse{Sessions: stopped})
+}
+
+// handleAdminMessage sends a raw chat message to every session of a XUID.
+func (gb *GoBDS) handleAdminMessage(w http.ResponseWriter, r *http.Request) {
+	request, ok := readAdminTextRequest(w, r, true)
+	if !ok {
+		return
+	}
+	sessions := gb.sessionsByXUID(r.PathValue("xuid"))
+	if len(sessions) == 0 {
+		writeAdminError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	for _, s := range sessions {
+		s.Message(request.Message)
+	}
+	writeAdminJSON(w, http.StatusOK, adminActionResponse{Sessions: len(sessions)})
+}
+
+// handleAdminBroadcast sends a raw chat message to every session, optionally on one server.
+func (gb *GoBDS) handleAdminBroadcast(w http.ResponseWriter, r *http.Request) {
+	request, ok := readAdminTextRequest(w, r, true)
+	if !ok {
+		return
+	}
+	servers := gb.servers
+	if request.Server != "" {
+		srv, found := gb.serverByName(request.Server)
+		if !found {
+			writeAdminError(w, http.StatusNotFound, "server not found")
+			return
+		}
+		servers = []*Server{srv}
+	}
+	var count int
+	for _, srv := range servers {
+		for _, s := range srv.Sessions() {
+			s.Message(request.Message)
+			count++
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, adminActionResponse{Sessions: count})
+}
+
+// handleAdminBans lists every active ban.
+func (gb *GoBDS) handleAdminBans(w http.ResponseWriter, _ *http.Request) {
+	bans, ok := gb.adminBanStore(w)
+	if !ok {
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, bans.Entries(time.Now()))
+}
+
+// handleAdminBan adds a ban and disconnects the players it matches.
+func (gb *GoBDS) handleAdminBan(w http.ResponseWriter, r *http.Request) {
+	bans, ok := gb.adminBanStore(w)
+	if !ok {
+		return
+	}
+	var request ban.Request
+	if !readAdminJSON(w, r, &request) {
+		return
+	}
+	entry, err := request.Entry(time.Now())
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if entry, err = bans.Add(entry); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusCreated, entry)
+}
+
+// handleAdminUnban removes a ban by ID.
+func (gb *GoBDS) handleAdminUnban(w http.ResponseWriter, r *http.Request) {
+	bans, ok := gb.adminBanStore(w)
+	if !ok {
+		return
+	}
+	removed, err := bans.Remove(ban.Selector{ID: r.PathValue("id")})
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(removed) == 0 {
+		writeAdminError(w, http.StatusNotFound, "ban not found")
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, removed[0])
+}
+
+// adminBanStore returns the ban store, writing an error response when bans
+// are disabled.
+func (gb *GoBDS) adminBanStore(w http.ResponseWriter) (*ban.Store, bool) {
+	bans := gb.config().Bans
+	if bans == nil {
+		writeAdminError(w, http.StatusNotFound, "bans are disabled")
+		return nil, false
+	}
+	return bans, true
+}
+
+// serverByName returns the configured server with the name passed.
+func (gb *GoBDS) serverByName(name string) (*Server, bool) {
+	for _, srv := range gb.servers {
+		if srv.Name == name {
+			return srv, true
+		}
+	}
+	return nil, false
+}
+
+// sessionsByXUID returns every live session of a XUID across all servers.
+// More than one is possible when duplicate XUID protection is disabled.
+func (gb *GoBDS) sessionsByXUID(xuid string) []*session.Session {
+	if xuid == "" {
+		return nil
+	}
+	var sessions []*session.Session
+	for _, srv := range gb.servers {
+		for _, s := range srv.Sessions() {
+			if s.IdentityData().XUID == xuid {
+				sessions = append(sessions, s)
+			}
+		}
+	}
+	return sessions
+}
+
+// adminServerInfoOf reads the current state of a server and its sessions.
+func adminServerInfoOf(srv *Server) adminServerInfo {
+	sessions := srv.Sessions()
+	info := adminServerInfo{
+		Name:          srv.Name,
+		LocalAddress:  srv.LocalAddress,
+		RemoteAddress: srv.RemoteAddress,
+		PlayerCount:   len(sessions),
+		Sessions:      make([]adminSessionInfo, 0, len(sessions)),
+	}
+	if srv.StatusProvider != nil {
+		info.MaxPlayers = srv.StatusProvider.ServerStatus(-1, -1).MaxPlayers
+	}
+	if srv.Queue != nil {
+		info.Queued = srv.Queue.Len()
+	}
+	if srv.Backends != nil {
+		for _, backend := range srv.Backends.Backends() {
+			info.Backends = append(info.Backends, adminBackendInfoOf(backend))
+		}
+	}
+	for _, s := range sessions {
+		identityData := s.IdentityData()
+		info.Sessions = append(info.Sessions, adminSessionInfo{
+			XUID:      identityData.XUID,
+			Name:      identityData.DisplayName,
+			Backend:   s.Backend(),
+			PingMS:    s.Ping(),
+			Dimension: s.Data().Dimension(),
+			GameMode:  s.Data().GameMode(),
+			Operator:  s.Data().Operator(),
+			AFKMS:     s.AFKDuration().Milliseconds(),
+			Capturing: s.Capturing(),
+			Traffic:   s.TrafficCounters(),
+		})
+	}
+	return info
+}
+
+// adminBackendInfoOf reads the current state of a backend.
+func adminBackendInfoOf(backend *pool.Backend) adminBackendInfo {
+	status := backend.Health().Status()
+	return adminBackendInfo{
+		Address:             backend.Address(),
+		Weight:              backend.Weight(),
+		MaxPlayers:          backend.MaxPlayers(),
+		Sessions:            backend.Sessions(),
+		Draining:            backend.Draining(),
+		Healthy:             backend.Healthy(),
+		State:               status.State.String(),
+		LatencyMS:           status.Latency.Milliseconds(),
+		ConsecutiveFailures: status.ConsecutiveFailures,
+		LastError:           status.LastError,
+	}
+}
+
+// readAdminTextRequest decodes a bounded JSON text request, writing an error
+// response and returning false when it is invalid.
+func readAdminTextRequest(w http.ResponseWriter, r *http.Request, messageRequired bool) (adminTextRequest, bool) {
+	var request adminTextRequest
+	if !readAdminJSON(w, r, &request) {
+		return request, false
+	}
+	if messageRequired && request.Message == "" {
+		writeAdminError(w, http.StatusBadRequest, "message is required")
+		return request, false
+	}
+	return request, true
+}
+
+// readAdminJSON decodes a bounded JSON request body into v, writing an error
+// response and returning false when it is invalid. An empty body is allowed.
+func readAdminJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminMaxBodyBytes)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeAdminError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	return true
+}
+
+// writeAdminJSON writes a JSON response with the status passed.
+func writeAdminJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// writeAdminError writes a JSON error response.
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	writeAdminJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,178 @@
+package gobds
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/ban"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+	"github.com/smell-of-curry/gobds/gobds/pool"
+)
+
+func testAdminProxy() *GoBDS {
+	srv := &Server{Name: "lobby", LocalAddress: "127.0.0.1:19132", RemoteAddress: "127.0.0.1:19133"}
+	srv.StatusProvider = newProxyStatusProvider(srv, "Lobby", 50)
+	srv.Backends, _ = pool.New(pool.LeastConnections, pool.NewBackend(srv.RemoteAddress, 1, 0))
+	gb := &GoBDS{servers: []*Server{srv}}
+	gb.conf.Store(&Config{Admin: &AdminConfig{Key: "secret"}})
+	return gb
+}
+
+func adminRequest(t *testing.T, handler http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		request.Header.Set("authorization", key)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminRejectsMissingOrWrongKey(t *testing.T) {
+	handler := testAdminProxy().adminHandler()
+	for _, key := range []string{"", "wrong"} {
+		if got := adminRequest(t, handler, http.MethodGet, "/v1/servers", key, "").Code; got != http.StatusUnauthorized {
+			t.Fatalf("key %q returned %d", key, got)
+		}
+	}
+	empty := testAdminProxy()
+	empty.config().Admin.Key = ""
+	if got := adminRequest(t, empty.adminHandler(), http.MethodGet, "/v1/servers", "", "").Code; got != http.StatusUnauthorized {
+		t.Fatalf("empty configured key must never authenticate, got %d", got)
+	}
+}
+
+func TestAdminListsServers(t *testing.T) {
+	response := adminRequest(t, testAdminProxy().adminHandler(), http.MethodGet, "/v1/servers", "secret", "")
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d", response.Code)
+	}
+	var servers []adminServerInfo
+	if err := json.Unmarshal(response.Body.Bytes(), &servers); err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Name != "lobby" || servers[0].MaxPlayers != 50 ||
+		servers[0].PlayerCount != 0 || servers[0].Sessions == nil {
+		t.Fatalf("unexpected servers: %+v", servers)
+	}
+}
+
+func TestAdminActionsReportMissingTargets(t *testing.T) {
+	handler := testAdminProxy().adminHandler()
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/v1/servers/unknown/sessions", "", http.StatusNotFound},
+		{http.MethodGet, "/v1/servers/lobby/sessions", "", http.StatusOK},
+		{http.MethodPost, "/v1/sessions/123/kick", `{"message":"bye"}`, http.StatusNotFound},
+		{http.MethodPost, "/v1/sessions/123/message", `{}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/sessions/123/capture/start", "", http.StatusConflict},
+		{http.MethodPost, "/v1/sessions/123/capture/stop", "", http.StatusNotFound},
+		{http.MethodPost, "/v1/broadcast", `{"message":"hi","server":"unknown"}`, http.StatusNotFound},
+		{http.MethodPost, "/v1/broadcast", `{"message":`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/broadcast", `{"message":"hi"}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		if got := adminRequest(t, handler, test.method, test.path, "secret", test.body).Code; got != test.want {
+			t.Fatalf("%s %s returned %d, want %d", test.method, test.path, got, test.want)
+		}
+	}
+}
+
+func TestAdminBans(t *testing.T) {
+	gb := testAdminProxy()
+	handler := gb.adminHandler()
+	if got := adminRequest(t, handler, http.MethodGet, "/v1/bans", "secret", "").Code; got != http.StatusNotFound {
+		t.Fatalf("disabled bans returned %d", got)
+	}
+
+	bans, err := ban.NewStore(filepath.Join(t.TempDir(), "bans.json"), slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gb.config().Bans = bans
+	if got := adminRequest(t, handler, http.MethodPost, "/v1/bans", "secret", `{"reason":"x"}`).Code; got != http.StatusBadRequest {
+		t.Fatalf("ban without identifier returned %d", got)
+	}
+	response := adminRequest(t, handler, http.MethodPost, "/v1/bans", "secret",
+		`{"xuid":"123","reason":"griefing","issuer":"ops","duration":"24h"}`)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("ban returned %d: %s", response.Code, response.Body)
+	}
+	var entry ban.Entry
+	if err = json.Unmarshal(response.Body.Bytes(), &entry); err != nil || entry.ID == "" || entry.Expires.IsZero() {
+		t.Fatalf("unexpected ban %+v err=%v", entry, err)
+	}
+
+	response = adminRequest(t, handler, http.MethodGet, "/v1/bans", "secret", "")
+	var entries []ban.Entry
+	if err = json.Unmarshal(response.Body.Bytes(), &entries); err != nil || len(entries) != 1 {
+		t.Fatalf("unexpected bans %s err=%v", response.Body, err)
+	}
+	if got := adminRequest(t, handler, http.MethodDelete, "/v1/bans/"+entry.ID, "secret", "").Code; got != http.StatusOK {
+		t.Fatalf("unban returned %d", got)
+	}
+	if got := adminRequest(t, handler, http.MethodDelete, "/v1/bans/"+entry.ID, "secret", "").Code; got != http.StatusNotFound {
+		t.Fatalf("second unban returned %d", got)
+	}
+}
+
+func TestAdminDrainsBackends(t *testing.T) {
+	gb := testAdminProxy()
+	handler := gb.adminHandler()
+	path := "/v1/servers/lobby/backends/127.0.0.1:19133/"
+
+	if got := adminRequest(t, handler, http.MethodPost, "/v1/servers/lobby/backends/unknown/drain", "secret", "").Code; got != http.StatusNotFound {
+		t.Fatalf("unknown backend returned %d", got)
+	}
+	response := adminRequest(t, handler, http.MethodPost, path+"drain", "secret", "")
+	var info adminBackendInfo
+	if err := json.Unmarshal(response.Body.Bytes(), &info); err != nil || response.Code != http.StatusOK || !info.Draining {
+		t.Fatalf("drain: status=%d info=%+v err=%v", response.Code, info, err)
+	}
+	if _, err := gb.servers[0].Backends.Acquire(); err == nil {
+		t.Fatal("a drained backend must not take new sessions")
+	}
+	if got := adminRequest(t, handler, http.MethodPost, path+"undrain", "secret", "").Code; got != http.StatusOK {
+		t.Fatalf("undrain returned %d", got)
+	}
+	if _, err := gb.servers[0].Backends.Acquire(); err != nil {
+		t.Fatalf("undrained backend rejected a session: %v", err)
+	}
+}
+
+func TestAdminListsClaimHistory(t *testing.T) {
+	gb := testAdminProxy()
+	spawn := claim.PlayerClaim{ID: "spawn", OwnerXUID: "*"}
+	gb.servers[0].claimHistory.add(claim.Diff{From: 1, To: 2, Time: time.Now(), Changes: []claim.ClaimChange{
+		{ID: "base", Owner: "owner", Kinds: []claim.ChangeKind{claim.ChangeAdded}},
+	}})
+	gb.servers[0].claimHistory.add(claim.Diff{From: 2, To: 3, Time: time.Now(), Changes: []claim.ClaimChange{
+		{ID: "spawn", Owner: "*", Kinds: []claim.ChangeKind{claim.ChangeTrustChanged}, Before: &spawn, After: &spawn},
+	}})
+	handler := gb.adminHandler()
+
+	response := adminRequest(t, handler, http.MethodGet, "/v1/servers/lobby/claims/history", "secret", "")
+	var entries []claimHistoryEntry
+	if err := json.Unmarshal(response.Body.Bytes(), &entries); err != nil || len(entries) != 2 {
+		t.Fatalf("unexpected history: %s (%v)", response.Body, err)
+	}
+	if entries[0].ID != "spawn" || entries[0].Generation != 3 || entries[0].After == nil {
+		t.Fatalf("history not newest first: %+v", entries)
+	}
+	response = adminRequest(t, handler, http.MethodGet, "/v1/servers/lobby/claims/history?id=base", "secret", "")
+	if err := json.Unmarshal(response.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].ID != "base" {
+		t.Fatalf("unexpected filtered history: %s (%v)", response.Body, err)
+	}
+	if got := adminRequest(t, handler, http.MethodGet, "/v1/servers/missing/claims/history", "secret", "").Code; got != http.StatusNotFound {
+		t.Fatalf("missing server returned %d", got)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/sandertv/gophertunnel/minecraft/text"
+	"github.com/smell-of-curry/gobds/gobds/audit"
 	"github.com/smell-of-curry/gobds/gobds/infra"
+	"github.com/smell-of-curry/gobds/gobds/pool"
 	"github.com/smell-of-curry/gobds/gobds/session"
 )
 
@@ -17,20 +19,62 @@ const afkEvaluatorInterval = 2 * time.Second
 // afkCandidate pairs a session with its current idle duration so the evaluator
 // can sort and filter without re-reading the session state more than once.
 type afkCandidate struct {
-	s   *session.Session
-	dur time.Duration
+	s       *session.Session
+	dur     time.Duration
+	backend *pool.Backend
+}
+
+// afkCounts tracks how full a server and each of its backends are while the
+// evaluator kicks. The status provider and the backend counters only change
+// once kicked sessions have closed, so kicks are counted here instead.
+type afkCounts struct {
+	threshold   float64
+	players     int
+	maxPlayers  int
+	backendSeen map[*pool.Backend]int
+}
+
+// full reports whether a session on backend counts as being on a crowded
+// server: either the whole server or its own backend is at the threshold.
+func (c *afkCounts) full(backend *pool.Backend) bool {
+	if atFullness(c.players, c.maxPlayers, c.threshold) {
+		return true
+	}
+	if backend == nil || backend.MaxPlayers() == 0 {
+		return false
+	}
+	return atFullness(c.backendPlayers(backend), backend.MaxPlayers(), c.threshold)
+}
+
+// kicked counts a session on backend as gone.
+func (c *afkCounts) kicked(backend *pool.Backend) {
+	c.players--
+	if backend != nil {
+		c.backendSeen[backend] = c.backendPlayers(backend) - 1
+	}
+}
+
+func (c *afkCounts) backendPlayers(backend *pool.Backend) int {
+	count, ok := c.backendSeen[backend]
+	if !ok {
+		count = backend.Sessions()
+		c.backendSeen[backend] = count
+	}
+	return count
+}
+
+// atFullness reports whether players out of maxPlayers is at or above the
+// fullness threshold.
+func atFullness(players, maxPlayers int, threshold float64) bool {
+	return maxPlayers > 0 && float64(players)/float64(maxPlayers) >= threshold
 }
 
 // afkEvaluator runs per-Server for the lifetime of the listen loop. It sends
 // soft warnings regardless of fullness, and only escalates to the final
-// warning and actual kicks when the server is at or above the configured
-// fullness threshold. When kicking, the longest-AFK sessions go first.
+// warning and actual kicks when the server, or the pooled backend a session is
+// on, is at or above the configured fullness threshold. When kicking, the longest-AFK sessions go first. The
+// timer is read on every tick so a config reload can enable or retune it.
 func (gb *GoBDS) afkEvaluator(srv *Server, ctx context.Context) {
-	timer := gb.conf.AFKTimer
-	if timer == nil {
-		return
-	}
-
 	t := time.NewTicker(afkEvaluatorInterval)
 	defer t.Stop()
 
@@ -48,7 +92,10 @@ func (gb *GoBDS) afkEvaluator(srv *Server, ctx context.Context) {
 
 // evaluateAFK performs a single pass over the server's sessions.
 func (gb *GoBDS) evaluateAFK(srv *Server) {
-	timer := gb.conf.AFKTimer
+	timer := gb.config().AFKTimer
+	if timer == nil {
+		return
+	}
 	sessions := srv.Sessions()
 	if len(sessions) == 0 {
 		return
@@ -56,7 +103,12 @@ func (gb *GoBDS) evaluateAFK(srv *Server) {
 
 	cands := make([]afkCandidate, 0, len(sessions))
 	for _, s := range sessions {
-		cands = append(cands, afkCandidate{s: s, dur: s.AFKDuration()})
+		if s.InLimbo() {
+			// Players waiting for their backend cannot move.
+			continue
+		}
+		backend, _ := srv.backendOf(s)
+		cands = append(cands, afkCandidate{s: s, dur: s.AFKDuration(), backend: backend})
 	}
 
 	gb.warnAFKSessions(cands, timer)
@@ -64,21 +116,31 @@ func (gb *GoBDS) evaluateAFK(srv *Server) {
 	if srv.StatusProvider == nil {
 		return
 	}
+	// Kicks happen when the server as a whole is full, or only for sessions
+	// on a pooled backend that is full by its own limit.
 	status := srv.StatusProvider.ServerStatus(-1, -1)
-	if status.MaxPlayers <= 0 {
-		return
+	counts := &afkCounts{
+		threshold:   timer.FullnessThreshold,
+		players:     status.PlayerCount,
+		maxPlayers:  status.MaxPlayers,
+		backendSeen: make(map[*pool.Backend]int),
 	}
-	fullness := float64(status.PlayerCount) / float64(status.MaxPlayers)
-	if fullness < timer.FullnessThreshold {
+	crowded := cands[:0:0]
+	for _, c := range cands {
+		if counts.full(c.backend) {
+			crowded = append(crowded, c)
+		}
+	}
+	if len(crowded) == 0 {
 		return
 	}
 
-	gb.warnFinalAFKSessions(cands, timer)
+	gb.warnFinalAFKSessions(crowded, timer)
 
 	// Only sessions that are past the kick threshold are eligible, sorted
 	// longest-AFK first so the most-idle players go before the borderline ones.
-	eligible := cands[:0:0]
-	for _, c := range cands {
+	eligible := crowded[:0:0]
+	for _, c := range crowded {
 		if c.dur >= timer.TimeoutDuration {
 			eligible = append(eligible, c)
 		}
@@ -88,17 +150,15 @@ func (gb *GoBDS) evaluateAFK(srv *Server) {
 	}
 	sort.Slice(eligible, func(i, j int) bool { return eligible[i].dur > eligible[j].dur })
 
-	// Use a local counter because the upstream StatusProvider is foreign and
+	// Count kicks locally because the upstream StatusProvider is foreign and
 	// only refreshes periodically; without this we'd keep kicking until every
 	// eligible AFK player is gone.
-	threshold := int(float64(status.MaxPlayers) * timer.FullnessThreshold)
-	remaining := status.PlayerCount
 	for _, c := range eligible {
-		if remaining < threshold {
-			return
+		if !counts.full(c.backend) {
+			continue
 		}
-		c.s.Disconnect(text.Colourf("<red>You've been kicked for being AFK.</red>"))
-		remaining--
+		c.s.Kick(audit.KickAFK, text.Colourf("<red>You've been kicked for being AFK.</red>"))
+		counts.kicked(c.backend)
 	}
 }
 
@@ -0,0 +1,37 @@
+package gobds
+
+import (
+	"testing"
+
+	"github.com/smell-of-curry/gobds/gobds/pool"
+)
+
+func TestAFKCountsUseBackendLimits(t *testing.T) {
+	limited, unlimited := pool.NewBackend("a", 1, 2), pool.NewBackend("b", 1, 0)
+	p, err := pool.New(pool.LeastConnections, limited, unlimited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 4 {
+		if _, err = p.Acquire(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts := &afkCounts{threshold: 0.9, players: 4, maxPlayers: 10, backendSeen: make(map[*pool.Backend]int)}
+	if counts.full(unlimited) {
+		t.Fatal("a backend without a limit only counts as full with its server")
+	}
+	if !counts.full(limited) {
+		t.Fatal("a backend at its own limit must count as full")
+	}
+	counts.kicked(limited)
+	if counts.full(limited) {
+		t.Fatal("kicks must be counted against the backend")
+	}
+
+	counts = &afkCounts{threshold: 0.9, players: 9, maxPlayers: 10, backendSeen: make(map[*pool.Backend]int)}
+	if !counts.full(nil) {
+		t.Fatal("every session counts as crowded on a full server")
+	}
+}
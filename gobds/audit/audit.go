@@ -0,0 +1,143 @@
+// Package audit records moderation evidence: one structured event for every
+// player action the proxy inspected or acted on.
+package audit
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// Event types.
+const (
+	// TypeSignEdit is a player changing the text of a sign.
+	TypeSignEdit = "sign_edit"
+	// TypeClaimDenied is a player action refused by claim policy.
+	TypeClaimDenied = "claim_denied"
+	// TypeTrafficEnforced is a client packet dropped by a traffic protection
+	// rate limit.
+	TypeTrafficEnforced = "traffic_enforced"
+	// TypeKick is a player disconnected by the proxy.
+	TypeKick = "kick"
+	// TypePickupUnblocked is an item pickup claim policy denies, which BDS
+	// had already made before the proxy saw it.
+	TypePickupUnblocked = "pickup_unblocked"
+	// TypeClaimChanged is a claim added, removed or changed by the claim
+	// service or a claim file.
+	TypeClaimChanged = "claim_changed"
+)
+
+// Kick reasons.
+const (
+	// KickAFK is a player kicked for being AFK on a full server.
+	KickAFK = "afk"
+	// KickMalformedPacket is a player that sent a packet the proxy could not
+	// handle.
+	KickMalformedPacket = "malformed_packet"
+	// KickDuplicateXUID is a player refused because their account was already
+	// connected.
+	KickDuplicateXUID = "duplicate_xuid"
+)
+
+// Event is a single audit record. Fields that do not apply to an event type
+// are left empty.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	Server string `json:"server,omitempty"`
+	XUID   string `json:"xuid,omitempty"`
+	Name   string `json:"name,omitempty"`
+
+	Dimension string    `json:"dimension,omitempty"`
+	Position  *[3]int32 `json:"position,omitempty"`
+
+	// Action is what the player attempted: the claim action of a
+	// TypeClaimDenied or TypePickupUnblocked event, or the traffic category
+	// of a TypeTrafficEnforced event.
+	Action string `json:"action,omitempty"`
+	// Target is the block, entity or item type the action was aimed at, if
+	// known.
+	Target string `json:"target,omitempty"`
+	// Reason is why a TypeKick event happened, one of the Kick reasons.
+	Reason string `json:"reason,omitempty"`
+	// Dropped is how many packets a TypeTrafficEnforced event stands for.
+	Dropped int `json:"dropped,omitempty"`
+
+	Claim       *ClaimDecision `json:"claim,omitempty"`
+	ClaimChange *ClaimChange   `json:"claim_change,omitempty"`
+	Sign        *SignEdit      `json:"sign,omitempty"`
+}
+
+// ClaimDecision describes the claim that decided a TypeClaimDenied or
+// TypePickupUnblocked event.
+type ClaimDecision struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	// Status is the claim query status the decision was made with.
+	Status string `json:"status"`
+	// Generation is the generation of the claim snapshot the claim was
+	// found in.
+	Generation uint64 `json:"generation"`
+}
+
+// ClaimChange describes a TypeClaimChanged event.
+type ClaimChange struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	// Kinds are how the claim changed, such as added, resized or
+	// trust_changed.
+	Kinds []string `json:"kinds"`
+	// Generation is the generation of the first claim snapshot with the
+	// change.
+	Generation uint64 `json:"generation"`
+}
+
+// SignText is the text on both sides of a sign.
+type SignText struct {
+	Front string `json:"front"`
+	Back  string `json:"back"`
+}
+
+// SignEdit describes a TypeSignEdit event.
+type SignEdit struct {
+	// Old is the text the sign had, or nil if the proxy had not seen it.
+	Old *SignText `json:"old,omitempty"`
+	// New is the text the player submitted.
+	New SignText `json:"new"`
+	// Filter is the sign filter action taken on the edit, if any, and Rule
+	// the filter rule that decided it.
+	Filter string `json:"filter,omitempty"`
+	Rule   string `json:"rule,omitempty"`
+	// Stored is the text forwarded to the backend when the filter rewrote
+	// it.
+	Stored *SignText `json:"stored,omitempty"`
+}
+
+// Sink receives audit events. Implementations must be safe for concurrent
+// use and must not block for long, since events are recorded while packets
+// are handled.
+type Sink interface {
+	Record(e Event)
+}
+
+// Logger is a Sink writing every event as a JSON attribute of an info log
+// line.
+type Logger struct {
+	log *slog.Logger
+}
+
+// NewLogger returns a Sink writing to log.
+func NewLogger(log *slog.Logger) *Logger {
+	return &Logger{log: log}
+}
+
+// Record ...
+func (l *Logger) Record(e Event) {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		l.log.Error("failed to encode audit event", "type", e.Type, "err", err)
+		return
+	}
+	l.log.Info("audit", "type", e.Type, "event", string(raw))
+}
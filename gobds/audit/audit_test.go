@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerWritesEventAsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	sink.Record(Event{
+		Time:     time.Unix(0, 0).UTC(),
+		Type:     TypeSignEdit,
+		XUID:     "1",
+		Position: &[3]int32{1, 2, 3},
+		Sign:     &SignEdit{New: SignText{Front: "hi"}},
+	})
+	var line struct {
+		Msg   string `json:"msg"`
+		Type  string `json:"type"`
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	var event Event
+	if err := json.NewDecoder(strings.NewReader(line.Event)).Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+	if line.Msg != "audit" || line.Type != TypeSignEdit || event.XUID != "1" ||
+		*event.Position != [3]int32{1, 2, 3} || event.Sign.New.Front != "hi" || event.Sign.Old != nil {
+		t.Fatalf("unexpected audit line %s", buf.String())
+	}
+}
@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedLayout is the time layout rotated files are named with.
+const rotatedLayout = "2006-01-02T15-04-05.000"
+
+// File is a Sink appending every event as a line of JSON to a file. The file
+// is rotated once it would grow past its maximum size, or once its first event
+// is older than its maximum age: it is renamed after the time of rotation and
+// the next event starts a new file. Only the newest maxFiles rotated files are
+// kept; older ones are deleted after a rotation.
+type File struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	log      *slog.Logger
+	// now is the clock the age of the file is measured by.
+	now func() time.Time
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	started time.Time
+}
+
+// NewFile returns a Sink appending to the file at path. The file is only
+// opened once the first event is recorded. Failures to write are logged to log
+// and the event is dropped.
+func NewFile(path string, maxSize int64, maxAge time.Duration, maxFiles int, log *slog.Logger) *File {
+	return &File{path: path, maxSize: maxSize, maxAge: maxAge, maxFiles: maxFiles, log: log, now: time.Now}
+}
+
+// Record ...
+func (f *File) Record(e Event) {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		f.log.Error("failed to encode audit event", "type", e.Type, "err", err)
+		return
+	}
+	raw = append(raw, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.prepare(int64(len(raw))); err != nil {
+		f.log.Error("failed to open audit log", "path", f.path, "err", err)
+		return
+	}
+	n, err := f.f.Write(raw)
+	f.size += int64(n)
+	if err != nil {
+		f.log.Error("failed to write audit event", "path", f.path, "type", e.Type, "err", err)
+	}
+}
+
+// Close closes the file. A later event opens it again.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return nil
+	}
+	err := f.f.Close()
+	f.f = nil
+	return err
+}
+
+// prepare makes sure a file that can take n more bytes is open, rotating the
+// current one if it is full or too old.
+func (f *File) prepare(n int64) error {
+	now := f.now()
+	if f.f != nil && f.size > 0 && (f.size+n > f.maxSize || now.Sub(f.started) >= f.maxAge) {
+		if err := f.rotate(now); err != nil {
+			return err
+		}
+		f.prune()
+	}
+	if f.f != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.f, f.size, f.started = file, info.Size(), now
+	if f.size > 0 {
+		// The file was left by an earlier run, so its age counts from its
+		// first event rather than from now.
+		if started, ok := firstEventTime(f.path); ok {
+			f.started = started
+		}
+	}
+	return nil
+}
+
+// rotate closes the current file and moves it aside, named after now.
+func (f *File) rotate(now time.Time) error {
+	err := f.f.Close()
+	f.f = nil
+	if err != nil {
+		return err
+	}
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext) + "-" + now.UTC().Format(rotatedLayout)
+	name := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	return os.Rename(f.path, name)
+}
+
+// prune deletes the oldest rotated files beyond the newest maxFiles.
+func (f *File) prune() {
+	rotated, err := f.rotated()
+	if err != nil {
+		f.log.Error("failed to list rotated audit logs", "path", f.path, "err", err)
+		return
+	}
+	if len(rotated) <= f.maxFiles {
+		return
+	}
+	for _, name := range rotated[:len(rotated)-f.maxFiles] {
+		if err = os.Remove(name); err != nil {
+			f.log.Error("failed to delete rotated audit log", "path", name, "err", err)
+		}
+	}
+}
+
+// rotated returns the files the file was rotated to, oldest first.
+func (f *File) rotated() ([]string, error) {
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(f.path, ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+	type rotatedFile struct {
+		name    string
+		modTime time.Time
+	}
+	var files []rotatedFile
+	for _, entry := range entries {
+		name := filepath.Join(filepath.Dir(f.path), entry.Name())
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || !strings.HasSuffix(stamp, ext) || len(stamp) < len(rotatedLayout) || entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(rotatedLayout, stamp[:len(rotatedLayout)]); err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, rotatedFile{name: name, modTime: info.ModTime()})
+	}
+	slices.SortFunc(files, func(a, b rotatedFile) int {
+		return cmp.Or(a.modTime.Compare(b.modTime), cmp.Compare(a.name, b.name))
+	})
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.name
+	}
+	return names, nil
+}
+
+// firstEventTime returns the time of the first event in the file at path.
+func firstEventTime(path string) (time.Time, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		return time.Time{}, false
+	}
+	var e struct {
+		Time time.Time `json:"time"`
+	}
+	if json.Unmarshal(line, &e) != nil || e.Time.IsZero() {
+		return time.Time{}, false
+	}
+	return e.Time, true
+}
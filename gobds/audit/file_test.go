@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func readEvents(t *testing.T, path string) []Event {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	sink := NewFile(path, 200, time.Hour, 100, slog.Default())
+	defer sink.Close()
+	for range 5 {
+		sink.Record(Event{Time: time.Unix(0, 0).UTC(), Type: TypeKick, XUID: "1", Reason: KickAFK})
+	}
+
+	rotated, err := filepath.Glob(filepath.Join(filepath.Dir(path), "audit-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) == 0 {
+		t.Fatal("audit log not rotated")
+	}
+	total := len(readEvents(t, path))
+	for _, name := range rotated {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 200 {
+			t.Fatalf("rotated file %s is %d bytes, over the limit", name, info.Size())
+		}
+		total += len(readEvents(t, name))
+	}
+	if total != 5 {
+		t.Fatalf("found %d events across files, want 5", total)
+	}
+}
+
+func TestFileRotatesByAgeAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	sink := NewFile(path, 1<<20, time.Hour, 100, slog.Default())
+	sink.now = func() time.Time { return now }
+	sink.Record(Event{Time: now, Type: TypeTrafficEnforced, Action: "chat"})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted proxy measures the age from the first event in the file.
+	now = start.Add(30 * time.Minute)
+	sink = NewFile(path, 1<<20, time.Hour, 100, slog.Default())
+	sink.now = func() time.Time { return now }
+	defer sink.Close()
+	sink.Record(Event{Time: now, Type: TypeTrafficEnforced, Action: "chat"})
+	if events := readEvents(t, path); len(events) != 2 {
+		t.Fatalf("file has %d events before it is an hour old, want 2", len(events))
+	}
+
+	now = start.Add(time.Hour)
+	sink.Record(Event{Time: now, Type: TypeClaimDenied, Claim: &ClaimDecision{ID: "c", Generation: 3}})
+	events := readEvents(t, path)
+	if len(events) != 1 || events[0].Claim == nil || events[0].Claim.Generation != 3 {
+		t.Fatalf("unexpected events after rotation %+v", events)
+	}
+	if old := readEvents(t, path[:len(path)-len(".jsonl")]+"-2026-01-01T01-00-00.000.jsonl"); len(old) != 2 {
+		t.Fatalf("rotated file has %d events, want 2", len(old))
+	}
+}
+
+func TestFileKeepsNewestRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+	other := filepath.Join(dir, "audit-archive.jsonl")
+	if err := os.WriteFile(other, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink := NewFile(path, 1<<20, time.Hour, 2, slog.Default())
+	sink.now = func() time.Time { return now }
+	defer sink.Close()
+	for range 5 {
+		sink.Record(Event{Time: now, Type: TypeKick, Reason: KickAFK})
+		now = now.Add(time.Hour)
+	}
+
+	rotated, err := sink.rotated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "audit-2026-01-01T03-00-00.000.jsonl"),
+		filepath.Join(dir, "audit-2026-01-01T04-00-00.000.jsonl"),
+	}
+	if !slices.Equal(rotated, want) {
+		t.Fatalf("rotated files = %v, want %v", rotated, want)
+	}
+	if _, err = os.Stat(other); err != nil {
+		t.Fatal("file not written by the sink was deleted")
+	}
+}
@@ -0,0 +1,135 @@
+// Package ban provides persistent player bans for the GoBDS proxy.
+package ban
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Entry is a single ban. It matches a player when any of its XUID, Name, IP
+// or DeviceID fields match; empty fields are ignored.
+type Entry struct {
+	ID string `json:"id"`
+
+	XUID string `json:"xuid,omitempty"`
+	Name string `json:"name,omitempty"`
+	// IP is a single address or a CIDR range.
+	IP       string `json:"ip,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+
+	Reason  string    `json:"reason"`
+	Issuer  string    `json:"issuer"`
+	Created time.Time `json:"created"`
+	// Expires is the zero time for permanent bans.
+	Expires time.Time `json:"expires,omitzero"`
+
+	prefix netip.Prefix
+}
+
+// Target identifies a connecting or connected player.
+type Target struct {
+	XUID     string
+	Name     string
+	DeviceID string
+	Addr     netip.Addr
+}
+
+// Permanent ...
+func (e Entry) Permanent() bool {
+	return e.Expires.IsZero()
+}
+
+// Active reports whether the ban is still in effect at now.
+func (e Entry) Active(now time.Time) bool {
+	return e.Permanent() || now.Before(e.Expires)
+}
+
+// Matches reports whether the ban applies to t, ignoring expiry.
+func (e Entry) Matches(t Target) bool {
+	switch {
+	case e.XUID != "" && e.XUID == t.XUID:
+		return true
+	case e.Name != "" && strings.EqualFold(e.Name, t.Name):
+		return true
+	case e.DeviceID != "" && e.DeviceID == t.DeviceID:
+		return true
+	case e.prefix.IsValid() && t.Addr.IsValid():
+		return e.prefix.Contains(t.Addr.Unmap())
+	}
+	return false
+}
+
+// Remaining describes how long the ban still lasts at now, such as
+// "1 day 2 hours", or "permanent".
+func (e Entry) Remaining(now time.Time) string {
+	if e.Permanent() {
+		return "permanent"
+	}
+	return formatRemaining(e.Expires.Sub(now))
+}
+
+// validate checks that the entry can match a player and parses its IP.
+func (e *Entry) validate() error {
+	if e.XUID == "" && e.Name == "" && e.IP == "" && e.DeviceID == "" {
+		return fmt.Errorf("ban must match on at least one of xuid, name, ip or device id")
+	}
+	e.prefix = netip.Prefix{}
+	if e.IP == "" {
+		return nil
+	}
+	prefix, err := parsePrefix(e.IP)
+	if err != nil {
+		return fmt.Errorf("invalid ban ip %q: %w", e.IP, err)
+	}
+	e.prefix = prefix
+	return nil
+}
+
+// parsePrefix parses an address or CIDR range. A single address becomes a
+// prefix that only contains itself.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// formatRemaining formats a positive duration as days, hours and minutes.
+func formatRemaining(d time.Duration) string {
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+
+	var parts []string
+	if days > 0 {
+		parts = append(parts, plural(days, "day"))
+	}
+	if hours > 0 {
+		parts = append(parts, plural(hours, "hour"))
+	}
+	if minutes > 0 && days == 0 {
+		parts = append(parts, plural(minutes, "minute"))
+	}
+	return strings.Join(parts, " ")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,256 @@
+package ban
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// file is the on-disk layout of a Store.
+type file struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Request describes a ban to add. It is the body of admin API and BDS script
+// ban requests.
+type Request struct {
+	XUID     string `json:"xuid,omitempty"`
+	Name     string `json:"name,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+	Reason   string `json:"reason"`
+	Issuer   string `json:"issuer"`
+	// Duration is a Go duration such as "72h". Empty means permanent.
+	Duration string `json:"duration,omitempty"`
+}
+
+// Entry converts the request into a ban issued at now.
+func (r Request) Entry(now time.Time) (Entry, error) {
+	e := Entry{
+		XUID:     r.XUID,
+		Name:     r.Name,
+		IP:       r.IP,
+		DeviceID: r.DeviceID,
+		Reason:   r.Reason,
+		Issuer:   r.Issuer,
+		Created:  now,
+	}
+	if r.Duration != "" {
+		d, err := time.ParseDuration(r.Duration)
+		if err != nil || d <= 0 {
+			return Entry{}, fmt.Errorf("ban duration must be a positive duration")
+		}
+		e.Expires = now.Add(d)
+	}
+	return e, e.validate()
+}
+
+// Selector selects bans to remove, either by ID or by any of the identifiers
+// they were issued for.
+type Selector struct {
+	ID       string `json:"id,omitempty"`
+	XUID     string `json:"xuid,omitempty"`
+	Name     string `json:"name,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+// selects reports whether the selector covers e.
+func (s Selector) selects(e Entry) bool {
+	return (s.ID != "" && s.ID == e.ID) ||
+		(s.XUID != "" && s.XUID == e.XUID) ||
+		(s.Name != "" && strings.EqualFold(s.Name, e.Name)) ||
+		(s.IP != "" && s.IP == e.IP) ||
+		(s.DeviceID != "" && s.DeviceID == e.DeviceID)
+}
+
+// Store is a set of bans persisted as JSON. It is safe for concurrent use.
+type Store struct {
+	path string
+	log  *slog.Logger
+
+	mu      sync.RWMutex
+	entries []Entry
+	onAdd   []func(Entry)
+}
+
+// NewStore loads the bans stored at path. A missing file is an empty store;
+// it is created on the first change.
+func NewStore(path string, log *slog.Logger) (*Store, error) {
+	s := &Store{path: path, log: log}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err = json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("decode bans: %w", err)
+	}
+	for _, e := range f.Entries {
+		if err = e.validate(); err != nil {
+			log.Error("skipping invalid ban", "id", e.ID, "err", err)
+			continue
+		}
+		s.entries = append(s.entries, e)
+	}
+	return s, nil
+}
+
+// OnAdd registers f to be called after every ban added to the store.
+func (s *Store) OnAdd(f func(Entry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onAdd = append(s.onAdd, f)
+}
+
+// Match returns the first ban active at now that matches t.
+func (s *Store) Match(t Target, now time.Time) (Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.entries {
+		if e.Active(now) && e.Matches(t) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Entries returns every ban active at now.
+func (s *Store) Entries(now time.Time) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if e.Active(now) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// duplicateExpirySlack is how far apart the expiries of two bans on the same
+// identifiers may be for them to be the same ban. A ban BDS scripts send to
+// every player reaches the store once per session, each a moment later.
+const duplicateExpirySlack = 5 * time.Second
+
+// duplicates reports whether e bans the same identifiers as other until about
+// the same time.
+func (e Entry) duplicates(other Entry) bool {
+	if e.XUID != other.XUID || !strings.EqualFold(e.Name, other.Name) || e.IP != other.IP || e.DeviceID != other.DeviceID {
+		return false
+	}
+	if e.Expires.IsZero() || other.Expires.IsZero() {
+		return e.Expires.IsZero() && other.Expires.IsZero()
+	}
+	return e.Expires.Sub(other.Expires).Abs() <= duplicateExpirySlack
+}
+
+// Add validates and stores e, assigning an ID if it has none, and returns
+// the stored entry. If an active ban on the same identifiers expiring at about
+// the same time is stored already, Add returns that ban instead.
+func (s *Store) Add(e Entry) (Entry, error) {
+	if err := e.validate(); err != nil {
+		return Entry{}, err
+	}
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+
+	s.mu.Lock()
+	entries := s.prune(time.Now())
+	for _, existing := range entries {
+		if existing.duplicates(e) {
+			s.mu.Unlock()
+			return existing, nil
+		}
+	}
+	entries = append(entries, e)
+	if err := s.save(entries); err != nil {
+		s.mu.Unlock()
+		return Entry{}, err
+	}
+	s.entries = entries
+	onAdd := s.onAdd
+	s.mu.Unlock()
+
+	s.log.Info("player banned", "id", e.ID, "xuid", e.XUID, "name", e.Name, "issuer", e.Issuer, "reason", e.Reason)
+	for _, f := range onAdd {
+		f(e)
+	}
+	return e, nil
+}
+
+// Remove deletes every ban the selector covers and returns them.
+func (s *Store) Remove(sel Selector) ([]Entry, error) {
+	if sel == (Selector{}) {
+		return nil, fmt.Errorf("unban must select on at least one of id, xuid, name, ip or device id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept, removed []Entry
+	for _, e := range s.prune(time.Now()) {
+		if sel.selects(e) {
+			removed = append(removed, e)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	if err := s.save(kept); err != nil {
+		return nil, err
+	}
+	s.entries = kept
+	for _, e := range removed {
+		s.log.Info("player unbanned", "id", e.ID, "xuid", e.XUID, "name", e.Name)
+	}
+	return removed, nil
+}
+
+// prune returns a copy of the entries without expired bans. s.mu must be held.
+func (s *Store) prune(now time.Time) []Entry {
+	entries := make([]Entry, 0, len(s.entries)+1)
+	for _, e := range s.entries {
+		if e.Active(now) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// save atomically replaces the ban file with entries. s.mu must be held.
+func (s *Store) save(entries []Entry) error {
+	raw, err := json.MarshalIndent(file{Entries: entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+			return fmt.Errorf("save bans: %w", err)
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, raw, 0o644); err != nil {
+		return fmt.Errorf("save bans: %w", err)
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("save bans: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package ban
+
+import (
+	"log/slog"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEntryMatchesAnyIdentifier(t *testing.T) {
+	tests := []struct {
+		entry  Entry
+		target Target
+		want   bool
+	}{
+		{Entry{XUID: "1"}, Target{XUID: "1"}, true},
+		{Entry{XUID: "1"}, Target{XUID: "2"}, false},
+		{Entry{Name: "Steve"}, Target{Name: "steve"}, true},
+		{Entry{DeviceID: "device"}, Target{DeviceID: "device"}, true},
+		{Entry{IP: "10.0.0.0/8"}, Target{Addr: netip.MustParseAddr("10.1.2.3")}, true},
+		{Entry{IP: "10.0.0.0/8"}, Target{Addr: netip.MustParseAddr("::ffff:10.1.2.3")}, true},
+		{Entry{IP: "10.0.0.1"}, Target{Addr: netip.MustParseAddr("10.0.0.2")}, false},
+		{Entry{IP: "10.0.0.1"}, Target{}, false},
+	}
+	for _, test := range tests {
+		if err := test.entry.validate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := test.entry.Matches(test.target); got != test.want {
+			t.Fatalf("%+v matching %+v = %v, want %v", test.entry, test.target, got, test.want)
+		}
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	now := time.Now()
+	for _, request := range []Request{
+		{Reason: "nothing to match"},
+		{XUID: "1", Duration: "-1h"},
+		{XUID: "1", Duration: "soon"},
+		{IP: "not an ip"},
+	} {
+		if _, err := request.Entry(now); err == nil {
+			t.Fatalf("request %+v must be rejected", request)
+		}
+	}
+	e, err := Request{XUID: "1", Duration: "2h"}.Entry(now)
+	if err != nil || !e.Expires.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("unexpected entry %+v err=%v", e, err)
+	}
+}
+
+func TestStorePersistsAndExpiresBans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans", "bans.json")
+	store, err := NewStore(path, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notified []Entry
+	store.OnAdd(func(e Entry) {
+		notified = append(notified, e)
+	})
+
+	permanent, err := store.Add(Entry{XUID: "1", Reason: "griefing", Issuer: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Add(Entry{Name: "Alex", Expires: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if permanent.ID == "" || len(notified) != 2 {
+		t.Fatalf("missing id or notification: %+v %d", permanent, len(notified))
+	}
+
+	reloaded, err := NewStore(path, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Match(Target{XUID: "1"}, time.Now()); !ok {
+		t.Fatal("persisted ban not loaded")
+	}
+	if _, ok := reloaded.Match(Target{Name: "alex"}, time.Now()); ok {
+		t.Fatal("expired ban must not match")
+	}
+	if entries := reloaded.Entries(time.Now()); len(entries) != 1 {
+		t.Fatalf("expected one active ban, got %+v", entries)
+	}
+}
+
+func TestStoreRemoveBySelector(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "bans.json"), slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := store.Add(Entry{XUID: "1"})
+	_, _ = store.Add(Entry{XUID: "1", IP: "10.0.0.1"})
+	_, _ = store.Add(Entry{Name: "Alex"})
+
+	if _, err = store.Remove(Selector{}); err == nil {
+		t.Fatal("empty selector must be rejected")
+	}
+	removed, err := store.Remove(Selector{ID: first.ID})
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("remove by id: %+v err=%v", removed, err)
+	}
+	removed, err = store.Remove(Selector{XUID: "1"})
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("remove by xuid: %+v err=%v", removed, err)
+	}
+	if entries := store.Entries(time.Now()); len(entries) != 1 || entries[0].Name != "Alex" {
+		t.Fatalf("unexpected remaining bans: %+v", entries)
+	}
+}
+
+func TestStoreAddsDuplicateBansOnce(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "bans.json"), slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notified int
+	store.OnAdd(func(Entry) { notified++ })
+
+	expires := time.Now().Add(time.Hour)
+	first, err := store.Add(Entry{XUID: "1", Name: "Steve", Expires: expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same ban, handled by another session a moment later.
+	again, err := store.Add(Entry{XUID: "1", Name: "steve", Expires: expires.Add(time.Second)})
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("duplicate ban added: %+v err=%v", again, err)
+	}
+	if _, err = store.Add(Entry{XUID: "1", Name: "Steve"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Add(Entry{XUID: "1", Name: "Steve", Expires: expires.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if entries := store.Entries(time.Now()); len(entries) != 3 || notified != 3 {
+		t.Fatalf("bans = %+v, notified %d times, want 3 of each", entries, notified)
+	}
+}
+
+func TestEntryRemaining(t *testing.T) {
+	now := time.Now()
+	tests := map[time.Duration]string{
+		26*time.Hour + 5*time.Minute: "1 day 2 hours",
+		90 * time.Minute:             "1 hour 30 minutes",
+		48 * time.Hour:               "2 days",
+		30 * time.Second:             "less than a minute",
+	}
+	for d, want := range tests {
+		if got := (Entry{Expires: now.Add(d)}).Remaining(now); got != want {
+			t.Fatalf("remaining %s = %q, want %q", d, got, want)
+		}
+	}
+	if got := (Entry{}).Remaining(now); got != "permanent" {
+		t.Fatalf("permanent ban remaining = %q", got)
+	}
+}
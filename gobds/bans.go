@@ -0,0 +1,55 @@
+package gobds
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/text"
+	"github.com/smell-of-curry/gobds/gobds/ban"
+)
+
+// banIdentity is implemented by both incoming connections and sessions.
+type banIdentity interface {
+	IdentityData() login.IdentityData
+	ClientData() login.ClientData
+	RemoteAddr() net.Addr
+}
+
+// banTarget returns every identifier of a player that a ban can match.
+func banTarget(player banIdentity) ban.Target {
+	target := ban.Target{
+		XUID:     player.IdentityData().XUID,
+		Name:     player.IdentityData().DisplayName,
+		DeviceID: player.ClientData().DeviceID,
+	}
+	if addr, err := netip.ParseAddrPort(player.RemoteAddr().String()); err == nil {
+		target.Addr = addr.Addr()
+	}
+	return target
+}
+
+// banMessage formats the disconnect message shown to a banned player.
+func banMessage(entry ban.Entry, now time.Time) string {
+	reason := entry.Reason
+	if reason == "" {
+		reason = "No reason given."
+	}
+	return text.Colourf(
+		"<red>You are banned from this server.</red>\n<grey>Reason:</grey> %s\n<grey>Remaining:</grey> %s",
+		reason, entry.Remaining(now),
+	)
+}
+
+// enforceBan disconnects every live session that a newly added ban matches.
+func (gb *GoBDS) enforceBan(entry ban.Entry) {
+	now := time.Now()
+	for _, srv := range gb.servers {
+		for _, s := range srv.Sessions() {
+			if entry.Matches(banTarget(s)) {
+				s.Disconnect(banMessage(entry, now))
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package gobds
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/session"
+)
+
+// CaptureConfig configures per-session packet capture.
+type CaptureConfig struct {
+	// Directory is where capture files are written.
+	Directory string
+	// MaxBytes is the size at which a capture is stopped.
+	MaxBytes int64
+	// XUIDs are captured from the moment they join.
+	XUIDs []string
+}
+
+// defaultCaptureMaxSize is the default capture size limit in megabytes.
+const defaultCaptureMaxSize = 64
+
+var errCaptureDisabled = errors.New("packet capture is disabled")
+
+// captureOnJoin starts capturing s if its player is listed in the capture
+// configuration.
+func (gb *GoBDS) captureOnJoin(srv *Server, s *session.Session) {
+	conf := gb.config().Capture
+	if conf == nil || !slices.Contains(conf.XUIDs, s.IdentityData().XUID) {
+		return
+	}
+	if _, err := gb.startCapture(srv, s); err != nil {
+		srv.Log.Error("failed to start packet capture", "name", s.IdentityData().DisplayName, "err", err)
+	}
+}
+
+// startCapture starts capturing s to a new file in the capture directory and
+// returns its path.
+func (gb *GoBDS) startCapture(srv *Server, s *session.Session) (string, error) {
+	conf := gb.config().Capture
+	if conf == nil {
+		return "", errCaptureDisabled
+	}
+	if err := os.MkdirAll(conf.Directory, 0o755); err != nil {
+		return "", fmt.Errorf("create capture directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.gbcap", s.IdentityData().XUID, time.Now().UTC().Format("20060102-150405.000"))
+	path := filepath.Join(conf.Directory, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("create capture file: %w", err)
+	}
+	if err = s.StartCapture(f, srv.Name, conf.MaxBytes); err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,268 @@
+// Package capture reads and writes recordings of the packets a session
+// handled, so they can be replayed offline.
+//
+// A capture file starts with an 8 byte magic, followed by a uvarint length and
+// a JSON Header. Every record after it is a direction byte, a uvarint offset
+// in microseconds since Header.Started, a uvarint payload length, and the
+// payload: a uvarint packet ID followed by the packet encoded as on the wire.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// magic identifies a capture file and its format version.
+var magic = [8]byte{'G', 'B', 'D', 'S', 'C', 'A', 'P', 1}
+
+const (
+	// maxHeaderSize and maxRecordSize bound allocations when reading a
+	// damaged or foreign file.
+	maxHeaderSize = 16 << 20
+	maxRecordSize = 64 << 20
+)
+
+// Direction is the way a captured packet was travelling.
+type Direction uint8
+
+const (
+	// Serverbound packets were sent by the client to the backend.
+	Serverbound Direction = iota
+	// Clientbound packets were sent by the backend to the client.
+	Clientbound
+)
+
+// String ...
+func (d Direction) String() string {
+	if d == Clientbound {
+		return "clientbound"
+	}
+	return "serverbound"
+}
+
+// Header describes the session a capture was taken from.
+type Header struct {
+	// Protocol is the protocol version the packets are encoded with.
+	Protocol int32 `json:"protocol"`
+	// ShieldID is the runtime ID of the shield item, which changes how item
+	// stacks are encoded.
+	ShieldID int32     `json:"shield_id"`
+	Started  time.Time `json:"started"`
+	Server   string    `json:"server"`
+	Backend  string    `json:"backend"`
+	XUID     string    `json:"xuid"`
+	Name     string    `json:"name"`
+	// Session is the state needed to rebuild the session for replay. Its
+	// shape is owned by the session package.
+	Session json.RawMessage `json:"session,omitempty"`
+}
+
+// Record is a single captured packet.
+type Record struct {
+	// Offset is the time since the capture started.
+	Offset    time.Duration
+	Direction Direction
+	Packet    packet.Packet
+}
+
+// ErrFull is returned by Writer.Write once the capture reached its size limit.
+// The record that did not fit is not written.
+var ErrFull = errors.New("capture size limit reached")
+
+// Writer writes a capture. It is safe for concurrent use.
+type Writer struct {
+	mu       sync.Mutex
+	closer   io.Closer
+	w        *bufio.Writer
+	buf      bytes.Buffer
+	shieldID int32
+	started  time.Time
+	size     int64
+	limit    int64
+	closed   bool
+}
+
+// NewWriter writes h to w and returns a Writer for records after it. A limit
+// above 0 caps the size of the capture in bytes. Closing the Writer closes w.
+func NewWriter(w io.WriteCloser, h Header, limit int64) (*Writer, error) {
+	if h.Protocol == 0 {
+		h.Protocol = protocol.CurrentProtocol
+	}
+	header, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("encode capture header: %w", err)
+	}
+	cw := &Writer{closer: w, w: bufio.NewWriter(w), shieldID: h.ShieldID, started: h.Started, limit: limit}
+	prefix := binary.AppendUvarint(magic[:], uint64(len(header)))
+	_, _ = cw.w.Write(prefix)
+	_, _ = cw.w.Write(header)
+	if err = cw.w.Flush(); err != nil {
+		return nil, fmt.Errorf("write capture header: %w", err)
+	}
+	cw.size = int64(len(prefix) + len(header))
+	return cw, nil
+}
+
+// Write records pk as sent in direction d at time at.
+func (w *Writer) Write(d Direction, pk packet.Packet, at time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return io.ErrClosedPipe
+	}
+
+	w.buf.Reset()
+	if err := encode(&w.buf, pk, w.shieldID); err != nil {
+		return err
+	}
+	var prefix []byte
+	prefix = append(prefix, byte(d))
+	prefix = binary.AppendUvarint(prefix, uint64(max(at.Sub(w.started), 0).Microseconds()))
+	prefix = binary.AppendUvarint(prefix, uint64(w.buf.Len()))
+
+	size := int64(len(prefix) + w.buf.Len())
+	if w.limit > 0 && w.size+size > w.limit {
+		return ErrFull
+	}
+	w.size += size
+	_, _ = w.w.Write(prefix)
+	_, err := w.w.Write(w.buf.Bytes())
+	return err
+}
+
+// Size returns the number of bytes written so far.
+func (w *Writer) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// Close flushes the capture and closes the underlying writer.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return errors.Join(w.w.Flush(), w.closer.Close())
+}
+
+// encode writes the ID and wire encoding of pk to buf.
+func encode(buf *bytes.Buffer, pk packet.Packet, shieldID int32) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("encode packet %d: %v", pk.ID(), recovered)
+		}
+	}()
+	_, _ = buf.Write(binary.AppendUvarint(nil, uint64(pk.ID())))
+	pk.Marshal(protocol.NewWriter(buf, shieldID))
+	return nil
+}
+
+// Reader reads a capture.
+type Reader struct {
+	r      *bufio.Reader
+	header Header
+	pools  [2]packet.Pool
+}
+
+// NewReader reads the header of the capture in r. Captures taken with another
+// protocol version are rejected, since their packets would not decode.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	var m [8]byte
+	if _, err := io.ReadFull(br, m[:]); err != nil || m != magic {
+		return nil, fmt.Errorf("not a capture file")
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil || n > maxHeaderSize {
+		return nil, fmt.Errorf("read capture header: invalid length")
+	}
+	data := make([]byte, n)
+	if _, err = io.ReadFull(br, data); err != nil {
+		return nil, fmt.Errorf("read capture header: %w", err)
+	}
+	cr := &Reader{r: br, pools: [2]packet.Pool{packet.NewClientPool(), packet.NewServerPool()}}
+	if err = json.Unmarshal(data, &cr.header); err != nil {
+		return nil, fmt.Errorf("decode capture header: %w", err)
+	}
+	if cr.header.Protocol != protocol.CurrentProtocol {
+		return nil, fmt.Errorf("capture uses protocol %d, this build speaks %d", cr.header.Protocol, protocol.CurrentProtocol)
+	}
+	return cr, nil
+}
+
+// Header returns the header of the capture.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next reads the next record. It returns io.EOF after the last one. A packet
+// with an ID this build does not know is returned as a *packet.Unknown.
+func (r *Reader) Next() (Record, error) {
+	d, err := r.r.ReadByte()
+	if err != nil {
+		return Record{}, err
+	}
+	if Direction(d) > Clientbound {
+		return Record{}, fmt.Errorf("invalid record direction %d", d)
+	}
+	offset, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Record{}, fmt.Errorf("read record: %w", noEOF(err))
+	}
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil || n > maxRecordSize {
+		return Record{}, fmt.Errorf("read record: invalid length")
+	}
+	payload := make([]byte, n)
+	if _, err = io.ReadFull(r.r, payload); err != nil {
+		return Record{}, fmt.Errorf("read record: %w", noEOF(err))
+	}
+	pk, err := r.decode(Direction(d), payload)
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Offset: time.Duration(offset) * time.Microsecond, Direction: Direction(d), Packet: pk}, nil
+}
+
+// decode decodes a record payload sent in direction d.
+func (r *Reader) decode(d Direction, payload []byte) (pk packet.Packet, err error) {
+	buf := bytes.NewBuffer(payload)
+	id, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return nil, fmt.Errorf("read packet id: %w", noEOF(err))
+	}
+	if newPacket, ok := r.pools[d][uint32(id)]; ok {
+		pk = newPacket()
+	} else {
+		pk = &packet.Unknown{PacketID: uint32(id)}
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("decode packet %d: %v", id, recovered)
+		}
+	}()
+	pk.Marshal(protocol.NewReader(buf, r.header.ShieldID, false))
+	return pk, nil
+}
+
+// noEOF turns an io.EOF in the middle of a record into io.ErrUnexpectedEOF,
+// so only a clean end of the file reads as io.EOF.
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+type closingBuffer struct {
+	bytes.Buffer
+}
+
+func (*closingBuffer) Close() error { return nil }
+
+func TestCaptureRoundTrip(t *testing.T) {
+	started := time.Unix(1700000000, 0)
+	var buf closingBuffer
+	w, err := NewWriter(&buf, Header{Started: started, XUID: "1", Name: "Steve"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write(Serverbound, &packet.Text{TextType: packet.TextTypeChat, Message: "hello"}, started.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write(Clientbound, &packet.SetTime{Time: 42}, started.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := r.Header(); h.XUID != "1" || h.Name != "Steve" || !h.Started.Equal(started) {
+		t.Fatalf("unexpected header %+v", h)
+	}
+	first, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, ok := first.Packet.(*packet.Text); !ok || text.Message != "hello" || first.Direction != Serverbound || first.Offset != time.Second {
+		t.Fatalf("unexpected first record %+v", first)
+	}
+	second, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setTime, ok := second.Packet.(*packet.SetTime); !ok || setTime.Time != 42 || second.Direction != Clientbound {
+		t.Fatalf("unexpected second record %+v", second)
+	}
+	if _, err = r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF after the last record, got %v", err)
+	}
+}
+
+func TestCaptureStopsAtLimit(t *testing.T) {
+	var buf closingBuffer
+	w, err := NewWriter(&buf, Header{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write(Clientbound, &packet.SetTime{}, time.Now()); !errors.Is(err, ErrFull) {
+		t.Fatalf("expected ErrFull, got %v", err)
+	}
+}
+
+func TestReaderRejectsForeignFiles(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture"))); err == nil {
+		t.Fatal("a file without the magic must be rejected")
+	}
+}
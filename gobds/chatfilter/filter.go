@@ -0,0 +1,261 @@
+package chatfilter
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// maxHistory bounds the messages kept per player for repeat detection.
+const maxHistory = 32
+
+// Filter holds the ruleset in effect for a server. The ruleset can be swapped
+// while sessions are using it. The zero value, like a nil *Filter, lets every
+// message through.
+type Filter struct {
+	rules atomic.Pointer[Ruleset]
+}
+
+// Rules returns the ruleset in effect, or nil if there is none.
+func (f *Filter) Rules() *Ruleset {
+	if f == nil {
+		return nil
+	}
+	return f.rules.Load()
+}
+
+// SetRules replaces the ruleset in effect. A nil ruleset disables filtering.
+func (f *Filter) SetRules(r *Ruleset) {
+	f.rules.Store(r)
+}
+
+// Check checks a message sent by p at now against the ruleset in effect.
+func (f *Filter) Check(p *Player, message string, now time.Time) Verdict {
+	return f.Rules().Check(p, message, now)
+}
+
+// Player is the filter state of a single player: their recent messages and
+// mute. The zero value is ready to use.
+type Player struct {
+	mu         sync.Mutex
+	mutedUntil time.Time
+	history    []sentMessage
+}
+
+// sentMessage is a message in a player's history, in its normalized form.
+type sentMessage struct {
+	key string
+	at  time.Time
+}
+
+// MutedUntil returns when the player's mute expires. It is the zero time if
+// the player was never muted.
+func (p *Player) MutedUntil() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mutedUntil
+}
+
+// Verdict is the outcome of checking a message.
+type Verdict struct {
+	// Action is the most severe action of the rules the message broke.
+	Action Action
+	// Rule is the rule that decided Action: "words", "patterns", "repeats",
+	// "caps", "links", or "muted" for a player who is still muted.
+	Rule string
+	// Message is the message to forward. It differs from the original only
+	// for ActionReplace.
+	Message string
+	// Notice is shown to the player, if not empty.
+	Notice string
+}
+
+// Ruleset is a compiled set of Rules. It is safe for concurrent use.
+type Ruleset struct {
+	words    []wordList
+	patterns []patternList
+	repeats  *repeatRule
+	caps     *capsRule
+	links    *linkRule
+
+	muteDuration time.Duration
+	warnMessage  string
+	muteMessage  string
+}
+
+type wordList struct {
+	action  Action
+	phrases [][][]rune
+}
+
+type patternList struct {
+	action   Action
+	patterns []*regexp.Regexp
+}
+
+type repeatRule struct {
+	action Action
+	max    int
+	window time.Duration
+}
+
+type capsRule struct {
+	action     Action
+	minLetters int
+	ratio      float64
+}
+
+type linkRule struct {
+	action Action
+	allow  []allowedLink
+}
+
+type allowedLink struct {
+	host, path string
+}
+
+// Check checks a message sent by p at now. Dropped messages still count
+// towards repeat detection, and a message that leads to a mute starts it. A
+// nil Ruleset lets every message through.
+func (r *Ruleset) Check(p *Player, message string, now time.Time) Verdict {
+	verdict := Verdict{Message: message}
+	if r == nil {
+		return verdict
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now.Before(p.mutedUntil) {
+		verdict.Action, verdict.Rule = ActionMute, "muted"
+		verdict.Notice = r.muteNotice(p.mutedUntil.Sub(now))
+		return verdict
+	}
+
+	var spans [][2]int
+	apply := func(action Action, rule string, matched [][2]int) {
+		if len(matched) == 0 {
+			return
+		}
+		if action > verdict.Action {
+			verdict.Action, verdict.Rule = action, rule
+		}
+		if action == ActionReplace {
+			spans = append(spans, matched...)
+		}
+	}
+
+	tokens := tokenize(message)
+	for _, list := range r.words {
+		for _, phrase := range list.phrases {
+			apply(list.action, "words", matchPhrase(tokens, phrase))
+		}
+	}
+	for _, list := range r.patterns {
+		for _, re := range list.patterns {
+			var matched [][2]int
+			for _, loc := range re.FindAllStringIndex(message, -1) {
+				matched = append(matched, [2]int{loc[0], loc[1]})
+			}
+			apply(list.action, "patterns", matched)
+		}
+	}
+	if r.links != nil {
+		apply(r.links.action, "links", r.links.match(message))
+	}
+	if r.caps != nil && r.caps.matches(message) {
+		apply(r.caps.action, "caps", [][2]int{{0, len(message)}})
+	}
+	if r.repeats != nil {
+		key := repeatKey(tokens)
+		if r.repeats.record(p, key, now) {
+			apply(r.repeats.action, "repeats", [][2]int{{0, len(message)}})
+		}
+	}
+
+	switch verdict.Action {
+	case ActionReplace:
+		verdict.Message = censor(message, spans)
+	case ActionWarn:
+		verdict.Notice = r.warnMessage
+	case ActionMute:
+		p.mutedUntil = now.Add(r.muteDuration)
+		verdict.Notice = r.muteNotice(r.muteDuration)
+	}
+	return verdict
+}
+
+// muteNotice returns the message shown to a player muted for remaining.
+func (r *Ruleset) muteNotice(remaining time.Duration) string {
+	return strings.ReplaceAll(r.muteMessage, "{remaining}", max(remaining.Round(time.Second), time.Second).String())
+}
+
+// record adds the message with key to the history of p and reports whether
+// it was sent more often than allowed.
+func (r *repeatRule) record(p *Player, key string, now time.Time) bool {
+	if key == "" {
+		return false
+	}
+	p.history = slices.DeleteFunc(p.history, func(m sentMessage) bool {
+		return now.Sub(m.at) > r.window
+	})
+	var count int
+	for _, m := range p.history {
+		if m.key == key {
+			count++
+		}
+	}
+	if len(p.history) == maxHistory {
+		p.history = slices.Delete(p.history, 0, 1)
+	}
+	p.history = append(p.history, sentMessage{key: key, at: now})
+	return count >= r.max
+}
+
+// matches reports whether message is written mostly in capitals.
+func (r *capsRule) matches(message string) bool {
+	var letters, upper int
+	forEachRune(message, func(_ int, c rune) {
+		if unicode.IsUpper(c) {
+			letters++
+			upper++
+		} else if unicode.IsLower(c) {
+			letters++
+		}
+	})
+	return letters >= r.minLetters && float64(upper) >= r.ratio*float64(letters)
+}
+
+// match returns the spans of the links in message that are not allowed.
+func (r *linkRule) match(message string) [][2]int {
+	var matched [][2]int
+	for _, loc := range findLinks(message) {
+		host, path := splitLink(message[loc[0]:loc[1]])
+		allowed := slices.ContainsFunc(r.allow, func(a allowedLink) bool {
+			return (host == a.host || strings.HasSuffix(host, "."+a.host)) && strings.HasPrefix(path, a.path)
+		})
+		if !allowed {
+			matched = append(matched, loc)
+		}
+	}
+	return matched
+}
+
+// censor replaces every character of message inside spans, other than
+// spaces, with '*'.
+func censor(message string, spans [][2]int) string {
+	var b strings.Builder
+	for i, c := range message {
+		inside := slices.ContainsFunc(spans, func(span [2]int) bool {
+			return i >= span[0] && i < span[1]
+		})
+		if inside && c != ' ' {
+			b.WriteByte('*')
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
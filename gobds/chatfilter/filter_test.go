@@ -0,0 +1,191 @@
+package chatfilter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func compile(t *testing.T, rules Rules) *Ruleset {
+	t.Helper()
+	set, err := rules.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestWordsMatchNormalizedWholeWords(t *testing.T) {
+	set := compile(t, Rules{Words: []ListRule{
+		{Action: ActionReplace, Entries: []string{"bad", "very mean"}},
+		{Action: ActionMute, Entries: []string{"slur"}},
+	}})
+	tests := []struct {
+		message string
+		action  Action
+		want    string
+	}{
+		{"hello there", ActionNone, "hello there"},
+		{"that is bad", ActionReplace, "that is ***"},
+		{"that is B4AAD!", ActionReplace, "that is *****!"},
+		{"b§cad idea", ActionReplace, "***** idea"},
+		{"a badge", ActionNone, "a badge"},
+		{"you are very  mean", ActionReplace, "you are ****  ****"},
+		{"bad and very mean", ActionReplace, "*** and **** ****"},
+		{"s1ur", ActionMute, "s1ur"},
+	}
+	for _, test := range tests {
+		verdict := set.Check(&Player{}, test.message, time.Now())
+		if verdict.Action != test.action || verdict.Message != test.want {
+			t.Fatalf("%q: got %v %q, want %v %q", test.message, verdict.Action, verdict.Message, test.action, test.want)
+		}
+	}
+}
+
+func TestMatchStretchedKeepsDoubledLetters(t *testing.T) {
+	tests := []struct {
+		text, word string
+		want       bool
+	}{
+		{"bad", "bad", true},
+		{"baaaddd", "bad", true},
+		{"bd", "bad", false},
+		{"pass", "pass", true},
+		{"pas", "pass", false},
+		{"passss", "pass", true},
+		{"bads", "bad", false},
+	}
+	for _, test := range tests {
+		if got := matchStretched([]rune(test.text), []rune(test.word)); got != test.want {
+			t.Fatalf("matchStretched(%q, %q) = %v, want %v", test.text, test.word, got, test.want)
+		}
+	}
+}
+
+func TestPatternsUseTheMostSevereAction(t *testing.T) {
+	set := compile(t, Rules{
+		Words:    []ListRule{{Action: ActionReplace, Entries: []string{"bad"}}},
+		Patterns: []ListRule{{Action: ActionWarn, Entries: []string{`(?i)free\s+coins`}}},
+	})
+	verdict := set.Check(&Player{}, "bad FREE coins", time.Now())
+	if verdict.Action != ActionWarn || verdict.Rule != "patterns" || verdict.Notice != defaultWarnMessage {
+		t.Fatalf("unexpected verdict %+v", verdict)
+	}
+}
+
+func TestLinksHonourAllowlist(t *testing.T) {
+	set := compile(t, Rules{Links: &LinkRule{
+		Action: ActionReplace,
+		Allow:  []string{"example.com", "https://discord.gg/ours"},
+	}})
+	tests := []struct {
+		message, want string
+	}{
+		{"see example.com", "see example.com"},
+		{"see shop.example.com/page", "see shop.example.com/page"},
+		{"join discord.gg/ours", "join discord.gg/ours"},
+		{"join discord.gg/theirs", "join *****************"},
+		{"play at evil.net:19132", "play at **************"},
+		{"play at 10.0.0.1", "play at ********"},
+		{"https://anything.example", "************************"},
+		{"ok.so what", "ok.so what"},
+	}
+	for _, test := range tests {
+		if got := set.Check(&Player{}, test.message, time.Now()).Message; got != test.want {
+			t.Fatalf("%q: got %q, want %q", test.message, got, test.want)
+		}
+	}
+}
+
+func TestCapsNeedsEnoughLetters(t *testing.T) {
+	set := compile(t, Rules{Caps: &CapsRule{Action: ActionDrop}})
+	for message, want := range map[string]Action{
+		"OK":                   ActionNone,
+		"WHY IS EVERYONE HERE": ActionDrop,
+		"Why Is Everyone Here": ActionNone,
+		"§aHELLO there friend": ActionNone,
+	} {
+		if got := set.Check(&Player{}, message, time.Now()).Action; got != want {
+			t.Fatalf("%q: got %v, want %v", message, got, want)
+		}
+	}
+}
+
+func TestRepeatsWithinWindow(t *testing.T) {
+	set := compile(t, Rules{Repeats: &RepeatRule{Action: ActionDrop, Max: 2, Window: "10s"}})
+	var p Player
+	now := time.Now()
+	for i, want := range []Action{ActionNone, ActionNone, ActionDrop} {
+		if got := set.Check(&p, "Buy  my stuff", now.Add(time.Duration(i)*time.Second)).Action; got != want {
+			t.Fatalf("message %d: got %v, want %v", i, got, want)
+		}
+	}
+	if got := set.Check(&p, "buy my stuff!", now.Add(3*time.Second)).Action; got != ActionDrop {
+		t.Fatalf("normalized repeat got %v", got)
+	}
+	if got := set.Check(&p, "buy my stuff", now.Add(time.Minute)).Action; got != ActionNone {
+		t.Fatalf("repeat after window got %v", got)
+	}
+}
+
+func TestMuteDropsUntilExpiry(t *testing.T) {
+	set := compile(t, Rules{
+		Words:        []ListRule{{Action: ActionMute, Entries: []string{"bad"}}},
+		MuteDuration: "1m",
+		MuteMessage:  "muted for {remaining}",
+	})
+	var p Player
+	now := time.Now()
+	if verdict := set.Check(&p, "bad", now); verdict.Action != ActionMute || verdict.Notice != "muted for 1m0s" {
+		t.Fatalf("unexpected verdict %+v", verdict)
+	}
+	verdict := set.Check(&p, "hello", now.Add(30*time.Second))
+	if verdict.Action != ActionMute || verdict.Rule != "muted" || verdict.Notice != "muted for 30s" {
+		t.Fatalf("muted player verdict %+v", verdict)
+	}
+	if got := set.Check(&p, "hello", now.Add(time.Minute)).Action; got != ActionNone {
+		t.Fatalf("expired mute got %v", got)
+	}
+}
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	for name, rules := range map[string]Rules{
+		"missing action": {Words: []ListRule{{Entries: []string{"bad"}}}},
+		"no letters":     {Words: []ListRule{{Action: ActionDrop, Entries: []string{"!!"}}}},
+		"bad pattern":    {Patterns: []ListRule{{Action: ActionDrop, Entries: []string{"("}}}},
+		"replace caps":   {Caps: &CapsRule{Action: ActionReplace}},
+		"caps ratio":     {Caps: &CapsRule{Action: ActionDrop, Ratio: 2}},
+		"repeat window":  {Repeats: &RepeatRule{Action: ActionDrop, Window: "soon"}},
+		"mute duration":  {MuteDuration: "-1m"},
+	} {
+		if _, err := rules.Compile(); err == nil {
+			t.Fatalf("%s: rules must be rejected", name)
+		}
+	}
+}
+
+func TestLoadAndSwapRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.json")
+	if err := os.WriteFile(path, []byte(`{"words": [{"action": "drop", "entries": ["bad"]}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f Filter
+	if got := f.Check(&Player{}, "bad", time.Now()).Action; got != ActionNone {
+		t.Fatalf("empty filter got %v", got)
+	}
+	f.SetRules(set)
+	if got := f.Check(&Player{}, "bad", time.Now()).Action; got != ActionDrop {
+		t.Fatalf("loaded filter got %v", got)
+	}
+	if err = os.WriteFile(path, []byte(`{"words": [{"action": "shout"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Load(path); err == nil {
+		t.Fatal("unknown action must be rejected")
+	}
+}
@@ -0,0 +1,185 @@
+package chatfilter
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// leet maps the digits and symbols commonly used in place of letters to the
+// letters they may stand for.
+var leet = map[rune]string{
+	'0': "o", '1': "il", '3': "e", '4': "a", '5': "s",
+	'7': "t", '8': "b", '9': "g", '@': "a", '$': "s",
+}
+
+// token is a lower case word of a message, along with the byte span it covers
+// in the message.
+type token struct {
+	start, end int
+	text       []rune
+}
+
+// forEachRune calls fn with the byte offset of every rune of message, skipping
+// Minecraft formatting codes ('§' and the character after it).
+func forEachRune(message string, fn func(i int, c rune)) {
+	var code bool
+	for i, c := range message {
+		switch {
+		case code:
+			code = false
+		case c == '§':
+			code = true
+		default:
+			fn(i, c)
+		}
+	}
+}
+
+// tokenize splits message into lower case words. Formatting codes are skipped
+// without splitting a word, so they cannot be used to break one up.
+func tokenize(message string) []token {
+	var (
+		tokens  []token
+		current *token
+	)
+	forEachRune(message, func(i int, c rune) {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '@' && c != '$' {
+			current = nil
+			return
+		}
+		if current == nil {
+			tokens = append(tokens, token{start: i})
+			current = &tokens[len(tokens)-1]
+		}
+		current.text = append(current.text, unicode.ToLower(c))
+		current.end = i + len(string(c))
+	})
+	return tokens
+}
+
+// normalize returns the letter a lower case c stands for.
+func normalize(c rune) rune {
+	if letters, ok := leet[c]; ok {
+		return rune(letters[0])
+	}
+	return c
+}
+
+// same reports whether the lower case c, as typed, may stand for letter.
+func same(c, letter rune) bool {
+	return c == letter || strings.ContainsRune(leet[c], letter)
+}
+
+// normalizeTokens returns the normalized text of tokens.
+func normalizeTokens(tokens []token) [][]rune {
+	words := make([][]rune, 0, len(tokens))
+	for _, t := range tokens {
+		word := make([]rune, 0, len(t.text))
+		for _, c := range t.text {
+			word = append(word, normalize(c))
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+// repeatKey returns the form of a message compared to spot repeats.
+func repeatKey(tokens []token) string {
+	words := make([]string, 0, len(tokens))
+	for _, word := range normalizeTokens(tokens) {
+		words = append(words, string(word))
+	}
+	return strings.Join(words, " ")
+}
+
+// matchPhrase returns the spans of every occurrence of phrase in tokens.
+func matchPhrase(tokens []token, phrase [][]rune) [][2]int {
+	var matched [][2]int
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		found := true
+		for j, word := range phrase {
+			if !matchStretched(tokens[i+j].text, word) {
+				found = false
+				break
+			}
+		}
+		if found {
+			matched = append(matched, [2]int{tokens[i].start, tokens[i+len(phrase)-1].end})
+		}
+	}
+	return matched
+}
+
+// matchStretched reports whether the typed text is the normalized word with
+// any of its letters repeated, such as "b44ad" for "bad". Letters that word
+// itself doubles must appear at least as often in text.
+func matchStretched(text, word []rune) bool {
+	var i int
+	for j, c := range word {
+		if i >= len(text) || !same(text[i], c) {
+			return false
+		}
+		i++
+		if j+1 < len(word) && word[j+1] == c {
+			continue
+		}
+		for i < len(text) && same(text[i], c) {
+			i++
+		}
+	}
+	return i == len(text)
+}
+
+var (
+	// domainPattern matches host names with an optional scheme, port and
+	// path.
+	domainPattern = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://)?(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+([a-z]{2,63})\b(?::\d{1,5})?(?:/\S*)?`)
+	// ipPattern matches IPv4 addresses with an optional port and path.
+	ipPattern = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b(?::\d{1,5})?(?:/\S*)?`)
+)
+
+// linkTLDs are the top level domains that make a bare host name, without a
+// scheme or "www.", count as a link. Without this list any two words joined
+// by a full stop would.
+var linkTLDs = map[string]struct{}{}
+
+func init() {
+	for _, tld := range strings.Fields(`com net org gg io me co tk ml ga cf gq xyz ru de uk us ca eu
+		info biz pl fr nl tv cc to ly su br in au es it jp cn kr top live link shop icu vip win
+		club online site store fun pro app dev`) {
+		linkTLDs[tld] = struct{}{}
+	}
+}
+
+// findLinks returns the spans of the links in message.
+func findLinks(message string) [][2]int {
+	var links [][2]int
+	for _, loc := range domainPattern.FindAllStringSubmatchIndex(message, -1) {
+		link := strings.ToLower(message[loc[0]:loc[1]])
+		_, known := linkTLDs[strings.ToLower(message[loc[2]:loc[3]])]
+		if known || strings.Contains(link, "://") || strings.HasPrefix(link, "www.") {
+			links = append(links, [2]int{loc[0], loc[1]})
+		}
+	}
+	for _, loc := range ipPattern.FindAllStringIndex(message, -1) {
+		links = append(links, [2]int{loc[0], loc[1]})
+	}
+	return links
+}
+
+// splitLink returns the lower case host and path of link, without scheme,
+// "www." or port.
+func splitLink(link string) (host, path string) {
+	link = strings.ToLower(strings.TrimSpace(link))
+	if _, rest, ok := strings.Cut(link, "://"); ok {
+		link = rest
+	}
+	link = strings.TrimPrefix(link, "www.")
+	host, path, _ = strings.Cut(link, "/")
+	if path != "" {
+		path = "/" + path
+	}
+	host, _, _ = strings.Cut(host, ":")
+	return strings.TrimSuffix(host, "."), path
+}
@@ -0,0 +1,259 @@
+// Package chatfilter checks chat messages against configurable rules before
+// they are forwarded: word and pattern blocklists, repeated messages, messages
+// in capitals and links.
+package chatfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Action is what happens to a message that breaks a rule. Actions are ordered
+// by severity: when a message breaks several rules, the most severe applies.
+type Action uint8
+
+const (
+	// ActionNone forwards the message unchanged.
+	ActionNone Action = iota
+	// ActionReplace forwards the message with the offending text replaced by
+	// '*'.
+	ActionReplace
+	// ActionDrop silently drops the message.
+	ActionDrop
+	// ActionWarn drops the message and tells the player why.
+	ActionWarn
+	// ActionMute drops the message and every message the player sends until
+	// the mute expires.
+	ActionMute
+)
+
+// actionNames are the names of actions in rule files, indexed by Action.
+var actionNames = [...]string{"none", "replace", "drop", "warn", "mute"}
+
+// String ...
+func (a Action) String() string {
+	if int(a) < len(actionNames) {
+		return actionNames[a]
+	}
+	return fmt.Sprintf("Action(%d)", a)
+}
+
+// MarshalText ...
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText ...
+func (a *Action) UnmarshalText(b []byte) error {
+	for i, name := range actionNames {
+		if strings.EqualFold(string(b), name) {
+			*a = Action(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown action %q", b)
+}
+
+// Rules is the contents of a rule file. Rules that are left out do not apply.
+type Rules struct {
+	// Words are blocked words and phrases. They are matched as whole words
+	// after case, leetspeak and stretched letters are normalized, so "b4aad"
+	// matches "bad" but "badge" does not.
+	Words []ListRule `json:"words,omitempty"`
+	// Patterns are regular expressions matched against the message as sent.
+	Patterns []ListRule `json:"patterns,omitempty"`
+	// Repeats catches players sending the same message over and over.
+	Repeats *RepeatRule `json:"repeats,omitempty"`
+	// Caps catches messages written mostly in capitals.
+	Caps *CapsRule `json:"caps,omitempty"`
+	// Links catches web addresses and IP addresses that are not allowed.
+	Links *LinkRule `json:"links,omitempty"`
+
+	// MuteDuration is how long the mute action mutes a player for.
+	MuteDuration string `json:"mute_duration,omitempty"`
+	// WarnMessage is shown to players whose message was dropped by the warn
+	// action.
+	WarnMessage string `json:"warn_message,omitempty"`
+	// MuteMessage is shown to muted players. {remaining} is replaced with
+	// the time left on the mute.
+	MuteMessage string `json:"mute_message,omitempty"`
+}
+
+// ListRule is a list of words or patterns sharing an action.
+type ListRule struct {
+	Action  Action   `json:"action"`
+	Entries []string `json:"entries"`
+}
+
+// RepeatRule triggers when the same message is sent more than Max times
+// within Window.
+type RepeatRule struct {
+	Action Action `json:"action"`
+	Max    int    `json:"max,omitempty"`
+	Window string `json:"window,omitempty"`
+}
+
+// CapsRule triggers when at least Ratio of the letters of a message with at
+// least MinLetters letters are capitals.
+type CapsRule struct {
+	Action     Action  `json:"action"`
+	MinLetters int     `json:"min_letters,omitempty"`
+	Ratio      float64 `json:"ratio,omitempty"`
+}
+
+// LinkRule triggers on links to hosts that are not in Allow. An entry allows
+// its host and every subdomain of it; an entry with a path, such as
+// "discord.gg/example", only allows links starting with it.
+type LinkRule struct {
+	Action Action   `json:"action"`
+	Allow  []string `json:"allow,omitempty"`
+}
+
+const (
+	defaultMuteDuration = 5 * time.Minute
+	defaultRepeatMax    = 2
+	defaultRepeatWindow = 30 * time.Second
+	defaultCapsLetters  = 8
+	defaultCapsRatio    = 0.7
+	defaultWarnMessage  = "Please keep the chat clean."
+	defaultMuteMessage  = "You are muted for {remaining}."
+)
+
+// Load reads and compiles the rule file at path.
+func Load(path string) (*Ruleset, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules Rules
+	if err = json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	ruleset, err := rules.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ruleset, nil
+}
+
+// Compile validates the rules, fills in defaults and prepares them for
+// matching.
+func (r Rules) Compile() (*Ruleset, error) {
+	set := &Ruleset{
+		muteDuration: defaultMuteDuration,
+		warnMessage:  r.WarnMessage,
+		muteMessage:  r.MuteMessage,
+	}
+	if set.warnMessage == "" {
+		set.warnMessage = defaultWarnMessage
+	}
+	if set.muteMessage == "" {
+		set.muteMessage = defaultMuteMessage
+	}
+	var err error
+	if set.muteDuration, err = positiveDuration(r.MuteDuration, defaultMuteDuration); err != nil {
+		return nil, fmt.Errorf("mute duration: %w", err)
+	}
+
+	for i, list := range r.Words {
+		if list.Action == ActionNone {
+			return nil, fmt.Errorf("words[%d]: action is required", i)
+		}
+		words := wordList{action: list.Action}
+		for _, entry := range list.Entries {
+			phrase := normalizeTokens(tokenize(entry))
+			if len(phrase) == 0 {
+				return nil, fmt.Errorf("words[%d]: %q has no letters", i, entry)
+			}
+			words.phrases = append(words.phrases, phrase)
+		}
+		set.words = append(set.words, words)
+	}
+	for i, list := range r.Patterns {
+		if list.Action == ActionNone {
+			return nil, fmt.Errorf("patterns[%d]: action is required", i)
+		}
+		patterns := patternList{action: list.Action}
+		for _, entry := range list.Entries {
+			re, err := regexp.Compile(entry)
+			if err != nil {
+				return nil, fmt.Errorf("patterns[%d]: %w", i, err)
+			}
+			patterns.patterns = append(patterns.patterns, re)
+		}
+		set.patterns = append(set.patterns, patterns)
+	}
+	if r.Repeats != nil {
+		if err = spanless("repeats", r.Repeats.Action); err != nil {
+			return nil, err
+		}
+		rule := repeatRule{action: r.Repeats.Action, max: r.Repeats.Max}
+		if rule.max <= 0 {
+			rule.max = defaultRepeatMax
+		}
+		if rule.window, err = positiveDuration(r.Repeats.Window, defaultRepeatWindow); err != nil {
+			return nil, fmt.Errorf("repeats window: %w", err)
+		}
+		set.repeats = &rule
+	}
+	if r.Caps != nil {
+		if err = spanless("caps", r.Caps.Action); err != nil {
+			return nil, err
+		}
+		rule := capsRule{action: r.Caps.Action, minLetters: r.Caps.MinLetters, ratio: r.Caps.Ratio}
+		if rule.minLetters <= 0 {
+			rule.minLetters = defaultCapsLetters
+		}
+		if rule.ratio == 0 {
+			rule.ratio = defaultCapsRatio
+		}
+		if rule.ratio < 0 || rule.ratio > 1 {
+			return nil, fmt.Errorf("caps ratio must be between 0 and 1")
+		}
+		set.caps = &rule
+	}
+	if r.Links != nil {
+		if r.Links.Action == ActionNone {
+			return nil, fmt.Errorf("links: action is required")
+		}
+		rule := linkRule{action: r.Links.Action}
+		for _, entry := range r.Links.Allow {
+			host, path := splitLink(entry)
+			if host == "" {
+				return nil, fmt.Errorf("links: invalid allowed link %q", entry)
+			}
+			rule.allow = append(rule.allow, allowedLink{host: host, path: path})
+		}
+		set.links = &rule
+	}
+	return set, nil
+}
+
+// spanless checks the action of a rule that matches a whole message rather
+// than part of it, which therefore cannot replace anything.
+func spanless(rule string, action Action) error {
+	switch action {
+	case ActionNone:
+		return fmt.Errorf("%s: action is required", rule)
+	case ActionReplace:
+		return fmt.Errorf("%s: the replace action only applies to words, patterns and links", rule)
+	}
+	return nil
+}
+
+// positiveDuration parses value as a positive duration, or returns fallback if
+// it is empty.
+func positiveDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("must be a positive duration")
+	}
+	return duration, nil
+}
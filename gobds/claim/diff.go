@@ -0,0 +1,174 @@
+package claim
+
+import (
+	"cmp"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ChangeKind is a way a claim changed between two snapshots.
+type ChangeKind string
+
+// Change kinds.
+const (
+	// ChangeAdded is a claim that was not in the previous snapshot.
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved is a claim that is not in the next snapshot.
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeResized is a claim that covers another area or dimension.
+	ChangeResized ChangeKind = "resized"
+	// ChangeTrustChanged is a claim that trusts other players, or trusts
+	// them with other levels, including by a new owner.
+	ChangeTrustChanged ChangeKind = "trust_changed"
+	// ChangeFeaturesChanged is a claim that allows other actions to everyone.
+	ChangeFeaturesChanged ChangeKind = "features_changed"
+	// ChangeOther is a claim that changed only in other ways, such as its
+	// parent or owner name.
+	ChangeOther ChangeKind = "changed"
+)
+
+// ClaimChange is how one claim, by ID, differs between two snapshots.
+type ClaimChange struct {
+	ID    string       `json:"id"`
+	Owner string       `json:"owner"`
+	Kinds []ChangeKind `json:"kinds"`
+	// Before and After are the claim in the previous and the next snapshot,
+	// nil when it was added or removed. They must not be changed.
+	Before *PlayerClaim `json:"before,omitempty"`
+	After  *PlayerClaim `json:"after,omitempty"`
+}
+
+// Diff is what changed when a factory published a new snapshot.
+type Diff struct {
+	// From and To are the generations of the previous and the next snapshot.
+	// From is 0 for the first snapshot, whose claims are all added.
+	From, To uint64
+	Time     time.Time
+	// Changes are sorted by claim ID. They are shared by every subscriber and
+	// must not be changed.
+	Changes []ClaimChange
+	// Missed is set when diffs published before this one were dropped
+	// because the subscriber did not keep up, so Changes is incomplete.
+	Missed bool
+}
+
+// DiffSnapshots returns the claims that differ between previous and next. A
+// nil previous snapshot has no claims.
+func DiffSnapshots(previous, next *Snapshot) []ClaimChange {
+	var changes []ClaimChange
+	before, after := map[string]*PlayerClaim{}, map[string]*PlayerClaim{}
+	if previous != nil {
+		before = previous.byID()
+	}
+	if next != nil {
+		after = next.byID()
+	}
+	for id, old := range before {
+		cl, ok := after[id]
+		if !ok {
+			changes = append(changes, ClaimChange{ID: id, Owner: old.OwnerXUID, Kinds: []ChangeKind{ChangeRemoved}, Before: old})
+			continue
+		}
+		// Claims that changes did not touch are shared between snapshots.
+		if cl == old {
+			continue
+		}
+		if kinds := changeKinds(*old, *cl); len(kinds) > 0 {
+			changes = append(changes, ClaimChange{ID: id, Owner: cl.OwnerXUID, Kinds: kinds, Before: old, After: cl})
+		}
+	}
+	for id, cl := range after {
+		if _, ok := before[id]; !ok {
+			changes = append(changes, ClaimChange{ID: id, Owner: cl.OwnerXUID, Kinds: []ChangeKind{ChangeAdded}, After: cl})
+		}
+	}
+	slices.SortFunc(changes, func(a, b ClaimChange) int { return cmp.Compare(a.ID, b.ID) })
+	return changes
+}
+
+// byID returns the claims of s by their IDs.
+func (s *Snapshot) byID() map[string]*PlayerClaim {
+	claims := make(map[string]*PlayerClaim, len(s.ids))
+	for id, key := range s.ids {
+		claims[id] = s.claims[key]
+	}
+	return claims
+}
+
+// changeKinds returns how cl differs from old, a claim with the same ID.
+func changeKinds(old, cl PlayerClaim) []ChangeKind {
+	var kinds []ChangeKind
+	if !reflect.DeepEqual(old.Location, cl.Location) {
+		kinds = append(kinds, ChangeResized)
+	}
+	if old.OwnerXUID != cl.OwnerXUID || old.InheritTrusts != cl.InheritTrusts ||
+		!slices.Equal(old.TrustedXUIDS, cl.TrustedXUIDS) || !maps.Equal(old.TrustLevels, cl.TrustLevels) {
+		kinds = append(kinds, ChangeTrustChanged)
+	}
+	if old.InheritFeatures != cl.InheritFeatures || len(old.Features)+len(cl.Features) > 0 && !reflect.DeepEqual(old.Features, cl.Features) {
+		kinds = append(kinds, ChangeFeaturesChanged)
+	}
+	if len(kinds) == 0 && !reflect.DeepEqual(old, cl) {
+		kinds = append(kinds, ChangeOther)
+	}
+	return kinds
+}
+
+// subscriber is a channel diffs are published to.
+type subscriber struct {
+	diffs chan Diff
+	// missed is set once a diff could not be sent because diffs was full.
+	missed bool
+}
+
+// Subscribe returns a channel receiving the Diff of every snapshot f
+// publishes with other claims from now on, holding up to buffer diffs not yet
+// received, and a function ending the subscription and closing the channel.
+// Diffs are dropped while the channel is full, and the next diff sent is then
+// marked Missed.
+func (f *Factory) Subscribe(buffer int) (<-chan Diff, func()) {
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+	sub := &subscriber{diffs: make(chan Diff, buffer)}
+	if f.subscribers == nil {
+		f.subscribers = make(map[*subscriber]struct{})
+	}
+	f.subscribers[sub] = struct{}{}
+	var once sync.Once
+	return sub.diffs, func() {
+		once.Do(func() {
+			f.refreshMu.Lock()
+			defer f.refreshMu.Unlock()
+			delete(f.subscribers, sub)
+			close(sub.diffs)
+		})
+	}
+}
+
+// announce publishes the diff between previous and next to the subscribers
+// of f, unless they hold the same claims. f.refreshMu must be held.
+func (f *Factory) announce(previous, next *Snapshot) {
+	if len(f.subscribers) == 0 {
+		return
+	}
+	changes := DiffSnapshots(previous, next)
+	if len(changes) == 0 {
+		return
+	}
+	diff := Diff{To: next.Generation, Time: time.Now(), Changes: changes}
+	if previous != nil {
+		diff.From = previous.Generation
+	}
+	for sub := range f.subscribers {
+		diff.Missed = sub.missed
+		select {
+		case sub.diffs <- diff:
+			sub.missed = false
+		default:
+			sub.missed = true
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package claim
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/service"
+)
+
+func testDiffClaim(id string, x float32) PlayerClaim {
+	return PlayerClaim{ID: id, OwnerXUID: "owner", Location: Location{
+		Dimension: "minecraft:overworld",
+		Pos1:      Vector2{X: x, Z: 0},
+		Pos2:      Vector2{X: x + 15, Z: 15},
+	}}
+}
+
+func TestDiffSnapshotsNamesChangedClaims(t *testing.T) {
+	previous, err := BuildSnapshot(map[string]PlayerClaim{
+		"kept":     testDiffClaim("kept", 0),
+		"removed":  testDiffClaim("removed", 32),
+		"resized":  testDiffClaim("resized", 64),
+		"trusted":  testDiffClaim("trusted", 96),
+		"featured": testDiffClaim("featured", 128),
+	}, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resized := testDiffClaim("resized", 64)
+	resized.Location.Pos2.X += 16
+	trusted := testDiffClaim("trusted", 96)
+	trusted.TrustedXUIDS = []string{"friend"}
+	featured := testDiffClaim("featured", 128)
+	featured.Features = []Feature{{Type: FeatureTypeMineable}}
+	next, err := BuildSnapshot(map[string]PlayerClaim{
+		"kept":     testDiffClaim("kept", 0),
+		"resized":  resized,
+		"trusted":  trusted,
+		"featured": featured,
+		"added":    testDiffClaim("added", 160),
+	}, 2, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string][]ChangeKind)
+	for _, change := range DiffSnapshots(previous, next) {
+		got[change.ID] = change.Kinds
+	}
+	want := map[string][]ChangeKind{
+		"added":    {ChangeAdded},
+		"removed":  {ChangeRemoved},
+		"resized":  {ChangeResized},
+		"trusted":  {ChangeTrustChanged},
+		"featured": {ChangeFeaturesChanged},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	for id, kinds := range want {
+		if !slices.Equal(got[id], kinds) {
+			t.Fatalf("changes of %s = %v, want %v", id, got[id], kinds)
+		}
+	}
+	if changes := DiffSnapshots(next, next.revalidated(3, time.Now())); len(changes) != 0 {
+		t.Fatalf("revalidated snapshot changed: %v", changes)
+	}
+}
+
+func TestFactorySubscribersReceiveDiffs(t *testing.T) {
+	factory := NewFactory(service.Config{}, "test", time.Minute, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	diffs, unsubscribe := factory.Subscribe(1)
+	publish := func(claims ...PlayerClaim) {
+		t.Helper()
+		keyed := make(map[string]PlayerClaim)
+		for _, cl := range claims {
+			keyed[cl.ID] = cl
+		}
+		if err := factory.Publish(keyed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publish(testDiffClaim("one", 0))
+	first := <-diffs
+	if first.From != 0 || len(first.Changes) != 1 || first.Changes[0].Kinds[0] != ChangeAdded || first.Missed {
+		t.Fatalf("unexpected first diff: %+v", first)
+	}
+
+	publish(testDiffClaim("one", 0), testDiffClaim("two", 32))
+	publish(testDiffClaim("two", 32))
+	second := <-diffs
+	if second.From != first.To || len(second.Changes) != 1 || second.Changes[0].ID != "two" {
+		t.Fatalf("unexpected second diff: %+v", second)
+	}
+	publish(testDiffClaim("two", 32))
+	publish()
+	if third := <-diffs; !third.Missed || third.Changes[0].Kinds[0] != ChangeRemoved {
+		t.Fatalf("diff after a dropped one not marked missed: %+v", third)
+	}
+
+	unsubscribe()
+	if _, open := <-diffs; open {
+		t.Fatal("channel still open after unsubscribing")
+	}
+	publish(testDiffClaim("one", 0))
+}
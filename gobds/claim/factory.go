@@ -2,8 +2,12 @@
 package claim
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -29,6 +33,28 @@ type Factory struct {
 	maxSnapshotAge time.Duration
 	metrics        *Metrics
 	log            *slog.Logger
+
+	// sources are merged with the claim service into every snapshot.
+	sources []Source
+
+	// persistPath is where fetched snapshots are saved, and persistedMaxAge
+	// how long after its fetch a snapshot restored from there is trusted.
+	// serviceSync is what the claim service sent along with the last fetch,
+	// saved along so that the first fetch after a restart can be a delta.
+	// persisted is what was last saved there.
+	persistPath     string
+	persistedMaxAge time.Duration
+	serviceSync     syncState
+	persisted       persistedState
+
+	// subscribers receive the diff of every snapshot published with other
+	// claims. They are guarded by refreshMu.
+	subscribers map[*subscriber]struct{}
+
+	// streaming is set while an update stream keeps the snapshot current,
+	// and stopStream ends that stream.
+	streaming  atomic.Bool
+	stopStream context.CancelCauseFunc
 }
 
 // NewFactory ...
@@ -69,7 +95,11 @@ func (f *Factory) Snapshot(now time.Time) (*Snapshot, QueryStatus) {
 	if !snapshot.Supported() {
 		return snapshot, QueryUnsupported
 	}
-	if snapshot.Age(now) > f.maxSnapshotAge {
+	maxAge := f.maxSnapshotAge
+	if snapshot.Restored {
+		maxAge = f.persistedMaxAge
+	}
+	if snapshot.Age(now) > maxAge {
 		if status := QueryStatus(f.failureStatus.Load()); status != QueryReady {
 			return snapshot, status
 		}
@@ -78,45 +108,335 @@ func (f *Factory) Snapshot(now time.Time) (*Snapshot, QueryStatus) {
 	return snapshot, QueryReady
 }
 
-// Fetch ...
-func (f *Factory) Fetch() error {
-	if f.service == nil || !f.service.Enabled {
+// SetService replaces the claim service used by later fetches. The current
+// snapshot stays published until the new service answers or it goes stale. A
+// running update stream is closed so it reconnects to the new service.
+func (f *Factory) SetService(c service.Config) {
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+	f.service = NewService(c, f.log)
+	if f.stopStream != nil {
+		f.stopStream(errServiceChanged)
+	}
+}
+
+// Streaming reports whether an update stream is keeping the snapshot current,
+// so that polling can be skipped.
+func (f *Factory) Streaming() bool {
+	return f.streaming.Load()
+}
+
+// Stream keeps the snapshot current from the claim service's update stream.
+// Once the stream is open, a full fetch gives the changes a base to apply to.
+// Stream returns ErrNoStream if the service has no stream, nil if the stream
+// was closed because the service changed, and otherwise the reason the stream
+// dropped. The service must send something at least every poll interval; a
+// stream silent for twice as long is treated as dropped.
+func (f *Factory) Stream(ctx context.Context) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	f.refreshMu.Lock()
+	svc := f.service
+	f.stopStream = cancel
+	f.refreshMu.Unlock()
+	if svc == nil {
+		return ErrNoStream
+	}
+
+	defer f.setStreaming(false)
+	err := svc.Stream(ctx, 2*f.pollInterval, func() error {
+		if err := f.Fetch(); err != nil {
+			return err
+		}
+		f.setStreaming(true)
+		return nil
+	}, f.applyUpdate)
+	if errors.Is(err, errServiceChanged) {
 		return nil
 	}
+	return err
+}
+
+func (f *Factory) setStreaming(streaming bool) {
+	f.streaming.Store(streaming)
+	f.metrics.Streaming(streaming)
+}
+
+// applyUpdate publishes the next snapshot generation with update applied. A
+// heartbeat only refreshes the snapshot once it is a poll interval old, as a
+// poll answered with 304 would have.
+func (f *Factory) applyUpdate(update Update) error {
 	f.refreshMu.Lock()
 	defer f.refreshMu.Unlock()
-	f.metrics.RefreshAttempt()
-
-	result, err := f.service.FetchClaims()
-	if err != nil {
-		f.failureStatus.Store(uint32(QueryRefreshFailed))
-		f.metrics.RefreshFailure()
-		return err
+	current := f.snapshot.Load()
+	if current == nil {
+		return fmt.Errorf("claim stream update without a snapshot")
 	}
 	now := time.Now()
-	if result.NotModified {
-		current := f.snapshot.Load()
-		if current == nil {
-			f.failureStatus.Store(uint32(QueryRefreshFailed))
-			f.metrics.RefreshFailure()
-			return fmt.Errorf("claims service returned 304 without a snapshot")
+	if update.empty() {
+		if current.Age(now) >= f.pollInterval {
+			f.storeRevalidated(current.revalidated(f.generation.Add(1), now))
 		}
-		revalidated := *current
-		revalidated.Generation = f.generation.Add(1)
-		revalidated.FetchedAt = now
-		f.snapshot.Store(&revalidated)
-		f.failureStatus.Store(uint32(QueryReady))
-		f.metrics.RefreshSuccess()
 		return nil
 	}
-	next, err := BuildSnapshot(result.Claims, f.generation.Add(1), now)
+	f.metrics.StreamUpdate()
+	deletes := make([]string, len(update.Deletes))
+	for i, key := range update.Deletes {
+		deletes[i] = sourceKey(serviceSourceName, key)
+	}
+	next, err := current.apply(fromSource(serviceSourceName, update.Upserts), deletes, f.generation.Add(1), now)
 	if err != nil {
 		f.failureStatus.Store(uint32(QueryInvalid))
-		f.metrics.RefreshFailure()
+		return fmt.Errorf("apply claim update: %w", err)
+	}
+	f.store(next)
+	f.announce(current, next)
+	return nil
+}
+
+// store publishes a snapshot the claim service confirmed and saves it.
+// f.refreshMu must be held.
+func (f *Factory) store(snapshot *Snapshot) {
+	f.snapshot.Store(snapshot)
+	f.failureStatus.Store(uint32(QueryReady))
+	f.persist(snapshot)
+}
+
+// storeRevalidated publishes a snapshot the claim service confirmed
+// unchanged. Only its claims' fetch time changed, so it is saved once the
+// saved fetch time is persistedMaxAge/persistRevalidatedFraction old.
+// f.refreshMu must be held.
+func (f *Factory) storeRevalidated(snapshot *Snapshot) {
+	f.snapshot.Store(snapshot)
+	f.failureStatus.Store(uint32(QueryReady))
+	if f.serviceSync == f.persisted.sync &&
+		snapshot.FetchedAt.Sub(f.persisted.fetchedAt) < f.persistedMaxAge/persistRevalidatedFraction {
+		return
+	}
+	f.persist(snapshot)
+}
+
+// Publish replaces the snapshot with one built from claims, as if the claim
+// service had just returned them.
+func (f *Factory) Publish(claims map[string]PlayerClaim) error {
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+	next, err := BuildSnapshot(fromSource(serviceSourceName, claims), f.generation.Add(1), time.Now())
+	if err != nil {
 		return fmt.Errorf("build claim snapshot: %w", err)
 	}
-	f.snapshot.Store(next)
+	previous := f.snapshot.Swap(next)
 	f.failureStatus.Store(uint32(QueryReady))
+	f.announce(previous, next)
+	return nil
+}
+
+// AddSource adds a source whose claims are merged with those of the claim
+// service into every snapshot, from the next fetch on.
+func (f *Factory) AddSource(source Source) error {
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+	if err := validateSourceName(source.Name(), f.sources); err != nil {
+		return err
+	}
+	f.sources = append(f.sources, source)
+	return nil
+}
+
+// Fetch asks every source, the claim service first, for its claims and
+// publishes them merged into one snapshot. A source that fails keeps the
+// claims it last returned.
+func (f *Factory) Fetch() error {
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+	sources := f.allSources()
+	if len(sources) == 0 {
+		return nil
+	}
+	return f.refresh(sources, sources)
+}
+
+// Refresh asks only source, one added with AddSource, for its claims, as when
+// its file changed, and publishes them merged with the claims the other
+// sources last returned. The snapshot keeps the time of the last fetch, so it
+// still goes stale if the other sources stop answering. Until a snapshot is
+// published, Refresh asks every source.
+func (f *Factory) Refresh(source Source) error {
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+	if !slices.Contains(f.sources, source) {
+		return fmt.Errorf("unknown claim source %q", source.Name())
+	}
+	sources := f.allSources()
+	if f.snapshot.Load() == nil {
+		return f.refresh(sources, sources)
+	}
+	return f.refresh(sources, []Source{source})
+}
+
+// allSources returns the claim service, if it is enabled, followed by the
+// sources added with AddSource. f.refreshMu must be held.
+func (f *Factory) allSources() []Source {
+	if f.service == nil || !f.service.Enabled {
+		return f.sources
+	}
+	return append([]Source{f.service}, f.sources...)
+}
+
+// refresh asks the sources in ask for their claims and publishes them merged
+// with the claims of the other sources in the current snapshot. A DeltaSource
+// is asked for its changes first, and if every source answered with changes,
+// they are applied to the current snapshot instead of building a new one. A
+// source that fails keeps the claims it last returned, and its error is
+// returned once the other sources are published. Only a failing claim service
+// keeps the snapshot from being revalidated, so that its claims still go
+// stale. f.refreshMu must be held.
+func (f *Factory) refresh(sources, ask []Source) error {
+	f.metrics.RefreshAttempt()
+	current := f.snapshot.Load()
+	merged := make(map[string]PlayerClaim)
+	// changes are the changes returned by the sources in changed, by snapshot
+	// key. rebuild is set once a source returns all of its claims.
+	var (
+		changes       Update
+		changed       []DeltaSource
+		modified      bool
+		rebuild       bool
+		kept          int
+		failures      []error
+		serviceFailed bool
+	)
+	fail := func(status QueryStatus, err error) error {
+		// The changes are lost, so the sources must send every claim again.
+		for _, source := range changed {
+			source.Resync()
+		}
+		f.failureStatus.Store(uint32(status))
+		f.metrics.RefreshFailure()
+		return errors.Join(append(failures, err)...)
+	}
+	sourceFailed := func(name string, err error) {
+		f.metrics.SourceFailure()
+		failures = append(failures, fmt.Errorf("claim source %q: %w", name, err))
+		serviceFailed = serviceFailed || name == serviceSourceName
+	}
+	for _, source := range sources {
+		name := source.Name()
+		previous := current.sourceClaims(name)
+		kept += len(previous)
+		if !slices.Contains(ask, source) {
+			maps.Copy(merged, previous)
+			continue
+		}
+		if delta, ok := source.(DeltaSource); ok && current != nil {
+			update, ok, err := delta.Changes()
+			if err != nil {
+				maps.Copy(merged, previous)
+				sourceFailed(name, err)
+				continue
+			}
+			if ok {
+				maps.Copy(merged, previous)
+				if !update.empty() {
+					changed = append(changed, delta)
+					addChanges(&changes, merged, name, update)
+					modified = true
+				}
+				continue
+			}
+		}
+		claims, err := source.Claims()
+		if errors.Is(err, ErrNotModified) && current == nil {
+			err = fmt.Errorf("returned not modified without a snapshot")
+		}
+		if errors.Is(err, ErrNotModified) {
+			maps.Copy(merged, previous)
+			continue
+		}
+		if err != nil {
+			maps.Copy(merged, previous)
+			sourceFailed(name, err)
+			continue
+		}
+		if delta, ok := source.(DeltaSource); ok {
+			changed = append(changed, delta)
+		}
+		maps.Copy(merged, fromSource(name, claims))
+		modified, rebuild = true, true
+	}
+	if f.service != nil {
+		f.serviceSync = f.service.sync
+	}
+
+	now := time.Now()
+	fresh := len(ask) == len(sources) && !serviceFailed
+	// A source that is no longer asked, such as a claim service disabled on
+	// reload, leaves claims behind that the next snapshot must drop.
+	orphaned := current != nil && kept != current.ClaimCount
+	if !modified && !orphaned {
+		if fresh {
+			f.storeRevalidated(current.revalidated(f.generation.Add(1), now))
+		}
+		return f.refreshed(serviceFailed, failures)
+	}
+	var (
+		next *Snapshot
+		err  error
+	)
+	if rebuild || orphaned {
+		next, err = BuildSnapshot(merged, f.generation.Add(1), now)
+	} else {
+		next, err = current.apply(changes.Upserts, changes.Deletes, f.generation.Add(1), now)
+	}
+	if err != nil {
+		return fail(QueryInvalid, fmt.Errorf("build claim snapshot: %w", err))
+	}
+	if fresh {
+		f.store(next)
+	} else {
+		// Not every source answered, so neither the age of the snapshot nor
+		// the outcome of the last fetch changes. A first snapshot without
+		// the claim service is stale until the service answers.
+		next.FetchedAt = time.Time{}
+		if current != nil {
+			next.FetchedAt = current.FetchedAt
+			next.Restored = current.Restored
+		}
+		f.snapshot.Store(next)
+		f.persist(next)
+	}
+	f.announce(current, next)
+	return f.refreshed(serviceFailed, failures)
+}
+
+// refreshed records the outcome of a refresh that published what the sources
+// that answered returned, and returns the errors of the sources that failed.
+// f.refreshMu must be held.
+func (f *Factory) refreshed(serviceFailed bool, failures []error) error {
+	if serviceFailed || (len(failures) > 0 && f.snapshot.Load() == nil) {
+		f.failureStatus.Store(uint32(QueryRefreshFailed))
+	}
+	if len(failures) > 0 {
+		f.metrics.RefreshFailure()
+		return errors.Join(failures...)
+	}
 	f.metrics.RefreshSuccess()
 	return nil
 }
+
+// addChanges adds update, the changes of the source named name, to changes
+// and applies them to merged, both keyed by snapshot key.
+func addChanges(changes *Update, merged map[string]PlayerClaim, name string, update Update) {
+	for _, key := range update.Deletes {
+		key = sourceKey(name, key)
+		delete(merged, key)
+		changes.Deletes = append(changes.Deletes, key)
+	}
+	if changes.Upserts == nil {
+		changes.Upserts = make(map[string]PlayerClaim)
+	}
+	for key, cl := range fromSource(name, update.Upserts) {
+		merged[key] = cl
+		changes.Upserts[key] = cl
+	}
+}
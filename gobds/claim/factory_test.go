@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -78,3 +79,22 @@ func TestFactoryMissingAndUnsupportedSnapshotsFailOpen(t *testing.T) {
 		t.Fatalf("unsupported snapshot status = %v", status)
 	}
 }
+
+func TestFactoryPublishesDecodedClaims(t *testing.T) {
+	claims, err := DecodeClaims(strings.NewReader(`[{"_key":"one","data":{"claimId":"one","playerXUID":"owner","location":{"dimension":"minecraft:overworld","pos1":{"x":0,"z":0},"pos2":{"x":1,"z":1}}}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := NewFactory(service.Config{}, "test", time.Second, time.Minute, slog.Default())
+	if err = factory.Publish(claims); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, status := factory.Snapshot(time.Now())
+	if status != QueryReady || snapshot.ClaimCount != 1 {
+		t.Fatalf("published snapshot status=%v snapshot=%+v", status, snapshot)
+	}
+
+	if _, err = DecodeClaims(strings.NewReader(`[{"_key":"one"},{"_key":"one"}]`)); err == nil {
+		t.Fatal("duplicate keys must be rejected")
+	}
+}
@@ -0,0 +1,102 @@
+package claim
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/json"
+	"github.com/restartfu/gophig"
+)
+
+// FileSource is a Source that reads claims from a local JSON or TOML file,
+// for servers without a claim service or for claims an admin keeps by hand,
+// such as spawn. The file lists claims under "claims", keyed by claim ID.
+type FileSource struct {
+	path string
+
+	mu      sync.Mutex
+	read    bool
+	modTime time.Time
+	size    int64
+}
+
+// fileClaims is the layout of a claim file.
+type fileClaims struct {
+	Claims []PlayerClaim `json:"claims"`
+}
+
+// NewFileSource returns a source reading the claim file at path. Files ending
+// in .toml are read as TOML, any other file as JSON.
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: filepath.Clean(path)}
+}
+
+// Name returns the path of the file, escaped so that it holds no slashes.
+func (s *FileSource) Name() string {
+	return "file:" + url.PathEscape(filepath.ToSlash(s.path))
+}
+
+// Path returns the path of the claim file.
+func (s *FileSource) Path() string {
+	return s.path
+}
+
+// Claims reads the claim file, or returns ErrNotModified if its size and
+// modification time did not change since it was last read.
+func (s *FileSource) Claims() (map[string]PlayerClaim, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if s.read && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil, ErrNotModified
+	}
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := decodeClaimFile(s.path, raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", s.path, err)
+	}
+	s.read, s.modTime, s.size = true, info.ModTime(), info.Size()
+	return claims, nil
+}
+
+// decodeClaimFile decodes the claim file at path, keying its claims by ID.
+func decodeClaimFile(path string, raw []byte) (map[string]PlayerClaim, error) {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		var document map[string]any
+		if err := (gophig.TOMLMarshaler{}).Unmarshal(raw, &document); err != nil {
+			return nil, err
+		}
+		// Claims only carry JSON field names, so TOML is decoded through
+		// JSON to name the fields the same way in both formats.
+		var err error
+		if raw, err = json.Marshal(document); err != nil {
+			return nil, err
+		}
+	}
+	var file fileClaims
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, err
+	}
+	claims := make(map[string]PlayerClaim, len(file.Claims))
+	for i, cl := range file.Claims {
+		if cl.ID == "" {
+			return nil, fmt.Errorf("claim %d has no claimId", i+1)
+		}
+		if _, exists := claims[cl.ID]; exists {
+			return nil, fmt.Errorf("duplicate claim id %q", cl.ID)
+		}
+		claims[cl.ID] = cl
+	}
+	return claims, nil
+}
@@ -0,0 +1,204 @@
+package claim
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/service"
+)
+
+func TestFileSourceReadsJSONAndTOML(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"spawn.json": `{"claims":[{"claimId":"spawn","playerXUID":"admin","location":{"dimension":"overworld","pos1":{"x":-50,"z":-50},"pos2":{"x":50,"z":50},"minY":60},"features":[{"type":"blockIntractable"}],"trustLevels":{"helper":"build"}}]}`,
+		"spawn.toml": `
+[[claims]]
+claimId = "spawn"
+playerXUID = "admin"
+location = { dimension = "overworld", pos1 = { x = -50, z = -50 }, pos2 = { x = 50, z = 50 }, minY = 60 }
+features = [{ type = "blockIntractable" }]
+trustLevels = { helper = "build" }
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		claims, err := NewFileSource(path).Claims()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		spawn, ok := claims["spawn"]
+		if !ok || spawn.OwnerXUID != "admin" || spawn.Location.Pos1.X != -50 ||
+			spawn.Location.MinY == nil || *spawn.Location.MinY != 60 ||
+			len(spawn.Features) != 1 || spawn.TrustLevelOf("helper") != TrustBuild {
+			t.Fatalf("%s: unexpected claims %+v", name, claims)
+		}
+	}
+}
+
+func TestFileSourceReportsUnchangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claims.json")
+	if err := os.WriteFile(path, []byte(`{"claims":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source := NewFileSource(path)
+	if _, err := source.Claims(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Claims(); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("unchanged file read again, err %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"claims":[{"claimId":"spawn","playerXUID":"admin"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := source.Claims(); err != nil || len(claims) != 1 {
+		t.Fatalf("changed file not read: claims=%v err=%v", claims, err)
+	}
+
+	for _, content := range []string{
+		`{"claims":[{"playerXUID":"admin"}]}`,
+		`{"claims":[{"claimId":"a","playerXUID":"admin"},{"claimId":"a","playerXUID":"admin"}]}`,
+		`{`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := source.Claims(); err == nil || errors.Is(err, ErrNotModified) {
+			t.Fatalf("accepted %s, err %v", content, err)
+		}
+	}
+}
+
+func TestFactoryMergesFileAndServiceClaims(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(writer, "[%s]", testClaimRow("base", 100))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "spawn.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"claims":[{"claimId":"spawn","playerXUID":"admin","location":{"dimension":"overworld","pos1":{"x":0,"z":0},"pos2":{"x":15,"z":15}}}]}`)
+
+	factory := NewFactory(service.Config{Enabled: true, URL: server.URL}, "test", time.Second, time.Minute, slog.Default())
+	source := NewFileSource(path)
+	if err := factory.AddSource(source); err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.AddSource(NewFileSource(path)); err == nil {
+		t.Fatal("the same file was added twice")
+	}
+	if err := factory.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, status := factory.Snapshot(time.Now())
+	if status != QueryReady || snapshot.ClaimCount != 2 ||
+		len(snapshot.Candidates("minecraft:overworld", 8, 8)) != 1 ||
+		len(snapshot.Candidates("minecraft:overworld", 108, 108)) != 1 {
+		t.Fatalf("sources not merged: status=%v snapshot=%+v", status, snapshot)
+	}
+
+	// A changed file is refreshed on its own, keeping the claims of the
+	// service and the age of the snapshot.
+	write(`{"claims":[{"claimId":"spawn","playerXUID":"admin","location":{"dimension":"overworld","pos1":{"x":0,"z":0},"pos2":{"x":15,"z":15}}},{"claimId":"market","playerXUID":"admin","location":{"dimension":"overworld","pos1":{"x":32,"z":32},"pos2":{"x":47,"z":47}}}]}`)
+	if err := factory.Refresh(source); err != nil {
+		t.Fatal(err)
+	}
+	refreshed, _ := factory.Snapshot(time.Now())
+	if refreshed.ClaimCount != 3 || !refreshed.FetchedAt.Equal(snapshot.FetchedAt) ||
+		len(refreshed.Candidates("minecraft:overworld", 108, 108)) != 1 {
+		t.Fatalf("unexpected refresh %+v", refreshed)
+	}
+
+	// Claim IDs must be unique across sources.
+	write(`{"claims":[{"claimId":"base","playerXUID":"admin","location":{"dimension":"overworld","pos1":{"x":0,"z":0},"pos2":{"x":15,"z":15}}}]}`)
+	if err := factory.Fetch(); err == nil {
+		t.Fatal("a claim ID used by two sources was accepted")
+	}
+	if current, _ := factory.Snapshot(time.Now()); current != refreshed {
+		t.Fatal("an invalid merge replaced the snapshot")
+	}
+}
+
+func TestFactoryKeepsClaimsOfAFailingSource(t *testing.T) {
+	up, position := true, 100
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		if !up {
+			writer.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = fmt.Fprintf(writer, "[%s]", testClaimRow("base", position))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "spawn.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"claims":[{"claimId":"spawn","playerXUID":"admin","location":{"dimension":"overworld","pos1":{"x":0,"z":0},"pos2":{"x":15,"z":15}}}]}`)
+	factory := NewFactory(service.Config{Enabled: true, URL: server.URL}, "test", time.Second, time.Minute, slog.Default())
+	if err := factory.AddSource(NewFileSource(path)); err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := factory.Snapshot(time.Now())
+
+	// A broken file keeps its claims, and the service is still published.
+	write(`{"claims":[`)
+	position = 200
+	if err := factory.Fetch(); err == nil {
+		t.Fatal("a broken file was not reported")
+	}
+	snapshot, status := factory.Snapshot(time.Now())
+	if status != QueryReady || snapshot.ClaimCount != 2 || !snapshot.FetchedAt.After(first.FetchedAt) ||
+		len(snapshot.Candidates("minecraft:overworld", 8, 8)) != 1 ||
+		len(snapshot.Candidates("minecraft:overworld", 208, 208)) != 1 {
+		t.Fatalf("unexpected snapshot with a broken file: status=%v snapshot=%+v", status, snapshot)
+	}
+
+	// A failing service keeps its claims, and the file is still published,
+	// but the snapshot is not revalidated.
+	up = false
+	write(`{"claims":[{"claimId":"spawn","playerXUID":"admin","location":{"dimension":"overworld","pos1":{"x":32,"z":32},"pos2":{"x":47,"z":47}}}]}`)
+	if err := factory.Fetch(); err == nil {
+		t.Fatal("a failing service was not reported")
+	}
+	current, _ := factory.Snapshot(time.Now())
+	if current.ClaimCount != 2 || !current.FetchedAt.Equal(snapshot.FetchedAt) ||
+		len(current.Candidates("minecraft:overworld", 40, 40)) != 1 ||
+		len(current.Candidates("minecraft:overworld", 208, 208)) != 1 {
+		t.Fatalf("unexpected snapshot with a failing service: %+v", current)
+	}
+	if _, status = factory.Snapshot(current.FetchedAt.Add(2 * time.Minute)); status != QueryRefreshFailed {
+		t.Fatalf("stale snapshot status = %v, want refresh failed", status)
+	}
+	if counts := factory.Metrics().counts(); counts.Sources != 2 || counts.Refresh != [3]uint64{3, 1, 2} {
+		t.Fatalf("unexpected refresh metrics %+v", counts)
+	}
+}
+
+func TestSourceNamesCannotContainSlashes(t *testing.T) {
+	if err := validateSourceName("a/b", nil); err == nil {
+		t.Fatal("a source name with a slash was accepted")
+	}
+	source := NewFileSource(filepath.Join("claims", "spawn.json"))
+	if err := validateSourceName(source.Name(), nil); err != nil {
+		t.Fatalf("file source name rejected: %v", err)
+	}
+}
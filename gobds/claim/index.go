@@ -0,0 +1,312 @@
+package claim
+
+import (
+	"cmp"
+	"maps"
+	"math"
+	"slices"
+)
+
+const (
+	// nodeCapacity is how many entries each node of a claim index groups.
+	nodeCapacity = 16
+	// maxIndexOverlay is how many claims may be added to or removed from a
+	// dimension's index by updates before its tree is packed again.
+	maxIndexOverlay = 64
+)
+
+// bounds is the area a claim or index node covers on the X and Z axes,
+// inclusive.
+type bounds struct {
+	minX, minZ, maxX, maxZ float64
+}
+
+// claimBounds returns the area cl covers.
+func claimBounds(cl *PlayerClaim) bounds {
+	return bounds{
+		minX: float64(min(cl.Location.Pos1.X, cl.Location.Pos2.X)),
+		minZ: float64(min(cl.Location.Pos1.Z, cl.Location.Pos2.Z)),
+		maxX: float64(max(cl.Location.Pos1.X, cl.Location.Pos2.X)),
+		maxZ: float64(max(cl.Location.Pos1.Z, cl.Location.Pos2.Z)),
+	}
+}
+
+// cellBounds returns the cellSize by cellSize cell containing x, z. Its
+// maximum is exclusive, see touches.
+func cellBounds(x, z float32) bounds {
+	minX := math.Floor(float64(x)/cellSize) * cellSize
+	minZ := math.Floor(float64(z)/cellSize) * cellSize
+	return bounds{minX: minX, minZ: minZ, maxX: minX + cellSize, maxZ: minZ + cellSize}
+}
+
+// touches reports whether b shares a point with the cell, whose maximum is
+// exclusive.
+func (b bounds) touches(cell bounds) bool {
+	return b.minX < cell.maxX && b.maxX >= cell.minX && b.minZ < cell.maxZ && b.maxZ >= cell.minZ
+}
+
+// union returns the smallest bounds covering b and o.
+func (b bounds) union(o bounds) bounds {
+	return bounds{
+		minX: min(b.minX, o.minX),
+		minZ: min(b.minZ, o.minZ),
+		maxX: max(b.maxX, o.maxX),
+		maxZ: max(b.maxZ, o.maxZ),
+	}
+}
+
+func (b bounds) centreX() float64 { return (b.minX + b.maxX) / 2 }
+func (b bounds) centreZ() float64 { return (b.minZ + b.maxZ) / 2 }
+
+// claimTree is a packed R-tree of the claims of one dimension. It is built
+// once with Sort-Tile-Recursive packing and never changed, so its memory
+// grows with the number of claims, not with their area.
+type claimTree struct {
+	entries []treeEntry
+	// levels[0] groups entries, every next level groups the level below,
+	// and the last level holds at most nodeCapacity nodes.
+	levels [][]treeNode
+}
+
+type treeEntry struct {
+	bounds
+	claim *PlayerClaim
+}
+
+// treeNode covers the nodeCapacity entries or nodes of the level below it
+// starting at first, or fewer at the end of the level.
+type treeNode struct {
+	bounds
+	first int
+}
+
+// newClaimTree packs claims into a tree.
+func newClaimTree(claims []*PlayerClaim) *claimTree {
+	tree := &claimTree{entries: make([]treeEntry, len(claims))}
+	for i, cl := range claims {
+		tree.entries[i] = treeEntry{bounds: claimBounds(cl), claim: cl}
+	}
+	packOrder(tree.entries, func(e treeEntry) bounds { return e.bounds })
+	level := groupNodes(len(tree.entries), func(i int) bounds { return tree.entries[i].bounds })
+	tree.levels = append(tree.levels, level)
+	for len(level) > nodeCapacity {
+		packOrder(level, func(n treeNode) bounds { return n.bounds })
+		below := level
+		level = groupNodes(len(below), func(i int) bounds { return below[i].bounds })
+		tree.levels = append(tree.levels, level)
+	}
+	return tree
+}
+
+// packOrder sorts items for Sort-Tile-Recursive packing: into vertical slabs
+// by their centre X, and each slab by centre Z, so that every run of
+// nodeCapacity items lies close together.
+func packOrder[T any](items []T, boundsOf func(T) bounds) {
+	groups := (len(items) + nodeCapacity - 1) / nodeCapacity
+	slabSize := int(math.Ceil(math.Sqrt(float64(groups)))) * nodeCapacity
+	slices.SortFunc(items, func(a, b T) int {
+		return cmp.Compare(boundsOf(a).centreX(), boundsOf(b).centreX())
+	})
+	for start := 0; start < len(items); start += slabSize {
+		slices.SortFunc(items[start:min(start+slabSize, len(items))], func(a, b T) int {
+			return cmp.Compare(boundsOf(a).centreZ(), boundsOf(b).centreZ())
+		})
+	}
+}
+
+// groupNodes returns a node for every run of nodeCapacity of the count
+// items whose bounds boundsOf returns.
+func groupNodes(count int, boundsOf func(int) bounds) []treeNode {
+	nodes := make([]treeNode, 0, (count+nodeCapacity-1)/nodeCapacity)
+	for first := 0; first < count; first += nodeCapacity {
+		node := treeNode{bounds: boundsOf(first), first: first}
+		for i := first + 1; i < min(first+nodeCapacity, count); i++ {
+			node.bounds = node.bounds.union(boundsOf(i))
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// search appends the claims touching cell to found.
+func (t *claimTree) search(cell bounds, found []*PlayerClaim) []*PlayerClaim {
+	top := len(t.levels) - 1
+	for i := range t.levels[top] {
+		found = t.searchNode(top, i, cell, found)
+	}
+	return found
+}
+
+func (t *claimTree) searchNode(level, i int, cell bounds, found []*PlayerClaim) []*PlayerClaim {
+	node := t.levels[level][i]
+	if !node.touches(cell) {
+		return found
+	}
+	if level == 0 {
+		for _, entry := range t.entries[node.first:min(node.first+nodeCapacity, len(t.entries))] {
+			if entry.touches(cell) {
+				found = append(found, entry.claim)
+			}
+		}
+		return found
+	}
+	for child := node.first; child < min(node.first+nodeCapacity, len(t.levels[level-1])); child++ {
+		found = t.searchNode(level-1, child, cell, found)
+	}
+	return found
+}
+
+// size returns the number of nodes in t.
+func (t *claimTree) size() int {
+	var size int
+	for _, level := range t.levels {
+		size += len(level)
+	}
+	return size
+}
+
+// dimensionIndex indexes the claims of one dimension: a packed tree, and the
+// claims added to and removed from it by updates since it was packed. It is
+// never changed once published.
+type dimensionIndex struct {
+	tree    *claimTree
+	added   []*PlayerClaim
+	removed map[*PlayerClaim]struct{}
+}
+
+// newDimensionIndex packs claims into an index without updates.
+func newDimensionIndex(claims []*PlayerClaim) *dimensionIndex {
+	return &dimensionIndex{tree: newClaimTree(claims)}
+}
+
+// candidates returns the claims touching cell.
+func (d *dimensionIndex) candidates(cell bounds) []*PlayerClaim {
+	var found []*PlayerClaim
+	if d.tree != nil {
+		found = d.tree.search(cell, found)
+	}
+	if len(d.removed) > 0 {
+		found = slices.DeleteFunc(found, func(cl *PlayerClaim) bool {
+			_, removed := d.removed[cl]
+			return removed
+		})
+	}
+	for _, cl := range d.added {
+		if claimBounds(cl).touches(cell) {
+			found = append(found, cl)
+		}
+	}
+	return found
+}
+
+// claims returns every claim in d.
+func (d *dimensionIndex) claims() []*PlayerClaim {
+	var claims []*PlayerClaim
+	if d.tree != nil {
+		claims = make([]*PlayerClaim, 0, len(d.tree.entries)+len(d.added))
+		for _, entry := range d.tree.entries {
+			if _, removed := d.removed[entry.claim]; !removed {
+				claims = append(claims, entry.claim)
+			}
+		}
+	}
+	return append(claims, d.added...)
+}
+
+// with returns a copy of d with added and removed, claims that were in d,
+// applied. Once too many updates have piled up, the claims are packed into a
+// new tree instead. with returns nil if no claims are left.
+func (d *dimensionIndex) with(added, removed []*PlayerClaim) *dimensionIndex {
+	next := &dimensionIndex{}
+	if d != nil {
+		next.tree = d.tree
+		next.added = slices.Clone(d.added)
+		next.removed = maps.Clone(d.removed)
+	}
+	for _, cl := range removed {
+		if i := slices.Index(next.added, cl); i >= 0 {
+			next.added = slices.Delete(next.added, i, i+1)
+			continue
+		}
+		if next.removed == nil {
+			next.removed = make(map[*PlayerClaim]struct{})
+		}
+		next.removed[cl] = struct{}{}
+	}
+	next.added = append(next.added, added...)
+	if len(next.added)+len(next.removed) <= maxIndexOverlay {
+		return next
+	}
+	claims := next.claims()
+	if len(claims) == 0 {
+		return nil
+	}
+	return newDimensionIndex(claims)
+}
+
+// size returns the number of tree nodes and updated claims in d.
+func (d *dimensionIndex) size() int {
+	size := len(d.added) + len(d.removed)
+	if d.tree != nil {
+		size += d.tree.size()
+	}
+	return size
+}
+
+// spatialIndex indexes claims by dimension.
+type spatialIndex map[string]*dimensionIndex
+
+// newSpatialIndex packs claims into an index.
+func newSpatialIndex(claims map[string]*PlayerClaim) spatialIndex {
+	byDimension := make(map[string][]*PlayerClaim)
+	for _, cl := range claims {
+		byDimension[cl.Location.Dimension] = append(byDimension[cl.Location.Dimension], cl)
+	}
+	index := make(spatialIndex, len(byDimension))
+	for dimension, claims := range byDimension {
+		index[dimension] = newDimensionIndex(claims)
+	}
+	return index
+}
+
+// with returns a copy of x with added and removed, claims that were in x,
+// applied. Dimensions without changes are shared with x.
+func (x spatialIndex) with(added, removed []*PlayerClaim) spatialIndex {
+	type changes struct{ added, removed []*PlayerClaim }
+	byDimension := make(map[string]*changes)
+	changesOf := func(dimension string) *changes {
+		if byDimension[dimension] == nil {
+			byDimension[dimension] = &changes{}
+		}
+		return byDimension[dimension]
+	}
+	for _, cl := range added {
+		c := changesOf(cl.Location.Dimension)
+		c.added = append(c.added, cl)
+	}
+	for _, cl := range removed {
+		c := changesOf(cl.Location.Dimension)
+		c.removed = append(c.removed, cl)
+	}
+	next := maps.Clone(x)
+	if next == nil {
+		next = make(spatialIndex)
+	}
+	for dimension, c := range byDimension {
+		if index := x[dimension].with(c.added, c.removed); index != nil {
+			next[dimension] = index
+		} else {
+			delete(next, dimension)
+		}
+	}
+	return next
+}
+
+// size returns the number of nodes and updated claims in x.
+func (x spatialIndex) size() int {
+	var size int
+	for _, index := range x {
+		size += index.size()
+	}
+	return size
+}
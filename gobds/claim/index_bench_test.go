@@ -0,0 +1,153 @@
+package claim
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// cellMap is the index snapshots used before the packed tree: every claim is
+// listed in each 16 by 16 cell it covers. It is kept to benchmark against.
+type cellMap map[string]map[[2]int32][]*PlayerClaim
+
+func newCellMap(claims map[string]*PlayerClaim) cellMap {
+	cells := make(cellMap)
+	for _, cl := range claims {
+		b := claimBounds(cl)
+		dimensionCells := cells[cl.Location.Dimension]
+		if dimensionCells == nil {
+			dimensionCells = make(map[[2]int32][]*PlayerClaim)
+			cells[cl.Location.Dimension] = dimensionCells
+		}
+		for x := int32(math.Floor(b.minX / cellSize)); x <= int32(math.Floor(b.maxX/cellSize)); x++ {
+			for z := int32(math.Floor(b.minZ / cellSize)); z <= int32(math.Floor(b.maxZ/cellSize)); z++ {
+				dimensionCells[[2]int32{x, z}] = append(dimensionCells[[2]int32{x, z}], cl)
+			}
+		}
+	}
+	return cells
+}
+
+func (m cellMap) candidates(dimension string, x, z float32) []*PlayerClaim {
+	return m[dimension][[2]int32{int32(math.Floor(float64(x) / cellSize)), int32(math.Floor(float64(z) / cellSize))}]
+}
+
+// benchmarkClaimSets are claim sets of realistic shapes: mostly player
+// claims a chunk or a few across, spread around spawn, plus a few large
+// admin claims. The largest admin claims are sized so that the cell map
+// still accepts them.
+var benchmarkClaimSets = []struct {
+	name    string
+	players int
+	admins  int
+	radius  float32
+}{
+	{"1k", 1_000, 5, 5_000},
+	{"10k", 10_000, 20, 20_000},
+	{"50k", 50_000, 50, 50_000},
+}
+
+func benchmarkClaims(players, admins int, radius float32) map[string]*PlayerClaim {
+	rng := rand.New(rand.NewPCG(7, 11))
+	claims := make(map[string]*PlayerClaim, players+admins)
+	add := func(id string, x, z, width, depth float32) {
+		claims[id] = &PlayerClaim{ID: id, OwnerXUID: "owner", Location: Location{
+			Dimension: "minecraft:overworld",
+			Pos1:      Vector2{X: x, Z: z},
+			Pos2:      Vector2{X: x + width, Z: z + depth},
+		}}
+	}
+	for i := range players {
+		add(fmt.Sprintf("player-%d", i),
+			(rng.Float32()*2-1)*radius, (rng.Float32()*2-1)*radius,
+			float32(16+rng.IntN(96)), float32(16+rng.IntN(96)))
+	}
+	for i := range admins {
+		size := float32(256 + rng.IntN(7_000))
+		add(fmt.Sprintf("admin-%d", i), (rng.Float32()*2-1)*radius, (rng.Float32()*2-1)*radius, size, size)
+	}
+	return claims
+}
+
+func BenchmarkIndexBuild(b *testing.B) {
+	for _, set := range benchmarkClaimSets {
+		claims := benchmarkClaims(set.players, set.admins, set.radius)
+		b.Run(set.name+"/cells", func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				newCellMap(claims)
+			}
+		})
+		b.Run(set.name+"/tree", func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				newSpatialIndex(claims)
+			}
+		})
+	}
+}
+
+func BenchmarkIndexCandidates(b *testing.B) {
+	for _, set := range benchmarkClaimSets {
+		claims := benchmarkClaims(set.players, set.admins, set.radius)
+		// Players mostly stand in or near claims, so look up around them.
+		rng := rand.New(rand.NewPCG(3, 5))
+		positions := make([][2]float32, 0, 1024)
+		for _, cl := range claims {
+			if len(positions) == cap(positions) {
+				break
+			}
+			positions = append(positions, [2]float32{
+				cl.Location.Pos1.X + (rng.Float32()*2-0.5)*64,
+				cl.Location.Pos1.Z + (rng.Float32()*2-0.5)*64,
+			})
+		}
+		cells, index := newCellMap(claims), newSpatialIndex(claims)
+		b.Run(set.name+"/cells", func(b *testing.B) {
+			b.ReportAllocs()
+			var i int
+			for b.Loop() {
+				position := positions[i%len(positions)]
+				cells.candidates("minecraft:overworld", position[0], position[1])
+				i++
+			}
+		})
+		b.Run(set.name+"/tree", func(b *testing.B) {
+			b.ReportAllocs()
+			var i int
+			for b.Loop() {
+				position := positions[i%len(positions)]
+				index["minecraft:overworld"].candidates(cellBounds(position[0], position[1]))
+				i++
+			}
+		})
+	}
+}
+
+func BenchmarkSnapshotApply(b *testing.B) {
+	claims := benchmarkClaims(10_000, 20, 20_000)
+	source := make(map[string]PlayerClaim, len(claims))
+	for key, cl := range claims {
+		source[key] = *cl
+	}
+	now := time.Now()
+	snapshot, err := BuildSnapshot(source, 1, now)
+	if err != nil {
+		b.Fatal(err)
+	}
+	// A stream update moving the same claim, generation after generation.
+	b.ReportAllocs()
+	var generation uint64 = 1
+	for b.Loop() {
+		generation++
+		moved := source["player-1"]
+		moved.Location.Pos1.X += float32(generation % 32)
+		next, err := snapshot.apply(map[string]PlayerClaim{"player-1": moved}, nil, generation, now)
+		if err != nil {
+			b.Fatal(err)
+		}
+		snapshot = next
+	}
+}
@@ -0,0 +1,132 @@
+package claim
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testIndexClaims returns count claims in the overworld and nether, from a
+// few blocks to a few thousand blocks wide.
+func testIndexClaims(rng *rand.Rand, count int) map[string]PlayerClaim {
+	claims := make(map[string]PlayerClaim, count)
+	for i := range count {
+		x, z := rng.Float32()*4000-2000, rng.Float32()*4000-2000
+		size := float32(4 + rng.IntN(60))
+		if rng.IntN(50) == 0 {
+			size = float32(500 + rng.IntN(3000))
+		}
+		dimension := "minecraft:overworld"
+		if i%5 == 0 {
+			dimension = "minecraft:nether"
+		}
+		id := fmt.Sprintf("claim-%d", i)
+		claims[id] = PlayerClaim{ID: id, OwnerXUID: "owner", Location: Location{
+			Dimension: dimension,
+			Pos1:      Vector2{X: x, Z: z},
+			Pos2:      Vector2{X: x + size, Z: z - size},
+		}}
+	}
+	return claims
+}
+
+// bruteCandidates returns the IDs of the claims of s touching the cell
+// containing x,z, found without the index.
+func bruteCandidates(s *Snapshot, dimension string, x, z float32) []string {
+	var ids []string
+	for _, cl := range s.claims {
+		if cl.Location.Dimension == dimension && claimBounds(cl).touches(cellBounds(x, z)) {
+			ids = append(ids, cl.ID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func candidateIDs(claims []*PlayerClaim) []string {
+	ids := make([]string, len(claims))
+	for i, cl := range claims {
+		ids[i] = cl.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestSnapshotIndexMatchesBruteForceAcrossUpdates(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	claims := testIndexClaims(rng, 2000)
+	snapshot, err := BuildSnapshot(claims, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(snapshot *Snapshot) {
+		t.Helper()
+		for range 200 {
+			dimension := "minecraft:overworld"
+			if rng.IntN(3) == 0 {
+				dimension = "minecraft:nether"
+			}
+			x, z := rng.Float32()*5000-2500, rng.Float32()*5000-2500
+			want := bruteCandidates(snapshot, dimension, x, z)
+			if got := candidateIDs(snapshot.Candidates(dimension, x, z)); !slices.Equal(got, want) {
+				t.Fatalf("candidates at %s %v,%v = %v, want %v", dimension, x, z, got, want)
+			}
+		}
+	}
+	check(snapshot)
+
+	// Enough updates to pack the trees again several times, moving claims
+	// between dimensions too.
+	for generation := uint64(2); generation < 40; generation++ {
+		upserts := make(map[string]PlayerClaim)
+		var deletes []string
+		for range 10 {
+			id := fmt.Sprintf("claim-%d", rng.IntN(2000))
+			if _, ok := snapshot.ids[id]; !ok {
+				continue
+			}
+			if rng.IntN(2) == 0 {
+				deletes = append(deletes, id)
+				continue
+			}
+			moved := testIndexClaims(rng, 1)["claim-0"]
+			moved.ID = id
+			upserts[id] = moved
+		}
+		previous := snapshot
+		before := bruteCandidates(previous, "minecraft:overworld", 0, 0)
+		if snapshot, err = previous.apply(upserts, deletes, generation, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if got := candidateIDs(previous.Candidates("minecraft:overworld", 0, 0)); !slices.Equal(got, before) {
+			t.Fatal("an update changed the previous snapshot")
+		}
+		check(snapshot)
+	}
+}
+
+func TestBuildSnapshotIndexesHugeClaims(t *testing.T) {
+	snapshot, err := BuildSnapshot(map[string]PlayerClaim{
+		"world": {ID: "world", OwnerXUID: "*", Location: Location{
+			Dimension: "minecraft:overworld",
+			Pos1:      Vector2{X: -30_000_000, Z: -30_000_000},
+			Pos2:      Vector2{X: 30_000_000, Z: 30_000_000},
+		}},
+	}, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.IndexSize != 1 {
+		t.Fatalf("index of one claim has size %d", snapshot.IndexSize)
+	}
+	for _, position := range [][2]float32{{0, 0}, {-29_999_999, 29_999_999}} {
+		if got := snapshot.Candidates("minecraft:overworld", position[0], position[1]); len(got) != 1 {
+			t.Fatalf("candidates at %v = %v", position, got)
+		}
+	}
+	if got := snapshot.Candidates("minecraft:overworld", 30_000_100, 0); len(got) != 0 {
+		t.Fatalf("candidates outside the claim = %v", got)
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/util/exposition"
 )
 
 const (
-	metricActions  = 9
+	metricActions  = 10
 	metricReasons  = 8
 	latencyBuckets = 5
 )
@@ -17,7 +20,7 @@ const (
 var (
 	actionMetricNames = [metricActions]string{
 		"render", "block_break", "block_place", "block_interact", "entity_interact",
-		"entity_hurt", "item_release", "item_throw", "item_drop",
+		"entity_hurt", "item_release", "item_throw", "item_drop", "item_pickup",
 	}
 	reasonMetricNames = [metricReasons]string{
 		"ready", "missing", "stale", "unsupported", "unknown_dimension", "invalid",
@@ -25,13 +28,31 @@ var (
 	}
 )
 
+// ActionName returns the name claim action indexes are reported under.
+func ActionName(action uint8) string {
+	if int(action) >= metricActions {
+		return "unknown"
+	}
+	return actionMetricNames[action]
+}
+
+// String ...
+func (s QueryStatus) String() string {
+	if int(s) >= metricReasons {
+		return "unknown"
+	}
+	return reasonMetricNames[s]
+}
+
 // Metrics contains per-server dependency-free atomic claim proxy counters.
+// Counters are cumulative; WriteDelta reports the change since its last call.
 type Metrics struct {
 	server string
 
 	refreshAttempts atomic.Uint64
 	refreshSuccess  atomic.Uint64
 	refreshFailure  atomic.Uint64
+	sourceFailure   atomic.Uint64
 	packets         atomic.Uint64
 	seen            [metricActions]atomic.Uint64
 	forwarded       [metricActions]atomic.Uint64
@@ -39,11 +60,18 @@ type Metrics struct {
 	reasons         [metricReasons]atomic.Uint64
 	candidates      atomic.Uint64
 	latency         [latencyBuckets]atomic.Uint64
+	latencySum      atomic.Uint64
 	correctionsSent atomic.Uint64
 	correctionsSkip atomic.Uint64
+	pickupUnblocked atomic.Uint64
 	subchunkDecode  atomic.Uint64
 	subchunkModify  atomic.Uint64
 	subchunkError   atomic.Uint64
+	streamUpdates   atomic.Uint64
+	streaming       atomic.Bool
+
+	deltaMu  sync.Mutex
+	reported metricCounts
 }
 
 // NewMetrics creates metrics isolated to one configured server.
@@ -60,6 +88,9 @@ func (m *Metrics) RefreshSuccess() { m.refreshSuccess.Add(1) }
 // RefreshFailure records one failed claim refresh.
 func (m *Metrics) RefreshFailure() { m.refreshFailure.Add(1) }
 
+// SourceFailure records one claim source failing during a refresh.
+func (m *Metrics) SourceFailure() { m.sourceFailure.Add(1) }
+
 // Packet records one processed claim-related packet.
 func (m *Metrics) Packet() { m.packets.Add(1) }
 
@@ -108,6 +139,7 @@ func (m *Metrics) Latency(elapsed time.Duration) {
 		index = 3
 	}
 	m.latency[index].Add(1)
+	m.latencySum.Add(uint64(max(elapsed, 0)))
 }
 
 // Correction records whether a corrective packet was sent or skipped.
@@ -119,6 +151,10 @@ func (m *Metrics) Correction(sent bool) {
 	m.correctionsSkip.Add(1)
 }
 
+// PickupUnblocked records one item pickup by a player that claim policy
+// denies but that BDS had already made.
+func (m *Metrics) PickupUnblocked() { m.pickupUnblocked.Add(1) }
+
 // SubchunkDecoded records one successfully decoded subchunk payload.
 func (m *Metrics) SubchunkDecoded() { m.subchunkDecode.Add(1) }
 
@@ -128,14 +164,16 @@ func (m *Metrics) SubchunkModified() { m.subchunkModify.Add(1) }
 // SubchunkError records one subchunk decode or index failure.
 func (m *Metrics) SubchunkError() { m.subchunkError.Add(1) }
 
-type metricRecord struct {
-	Type        string                 `json:"type"`
-	Server      string                 `json:"server"`
-	PeriodMS    int64                  `json:"period_ms"`
-	ActionNames [metricActions]string  `json:"action_names"`
-	ReasonNames [metricReasons]string  `json:"reason_names"`
+// StreamUpdate records one batch of changes applied from the update stream.
+func (m *Metrics) StreamUpdate() { m.streamUpdates.Add(1) }
+
+// Streaming records whether the update stream is connected.
+func (m *Metrics) Streaming(connected bool) { m.streaming.Store(connected) }
+
+// metricCounts is a copy of every cumulative counter of Metrics.
+type metricCounts struct {
 	Refresh     [3]uint64              `json:"refresh"`
-	Snapshot    snapshotMetric         `json:"snapshot"`
+	Sources     uint64                 `json:"source_failures"`
 	Packets     uint64                 `json:"packets"`
 	Seen        [metricActions]uint64  `json:"seen"`
 	Forwarded   [metricActions]uint64  `json:"forwarded"`
@@ -144,55 +182,109 @@ type metricRecord struct {
 	Candidates  uint64                 `json:"candidates"`
 	Latency     [latencyBuckets]uint64 `json:"latency_us"`
 	Corrections [2]uint64              `json:"corrections"`
+	Unblocked   uint64                 `json:"pickups_unblocked"`
 	Subchunk    [3]uint64              `json:"subchunk"`
+	Stream      uint64                 `json:"stream_updates"`
+}
+
+// counts loads every counter without resetting it.
+func (m *Metrics) counts() metricCounts {
+	c := metricCounts{
+		Refresh:     [3]uint64{m.refreshAttempts.Load(), m.refreshSuccess.Load(), m.refreshFailure.Load()},
+		Sources:     m.sourceFailure.Load(),
+		Packets:     m.packets.Load(),
+		Candidates:  m.candidates.Load(),
+		Corrections: [2]uint64{m.correctionsSent.Load(), m.correctionsSkip.Load()},
+		Unblocked:   m.pickupUnblocked.Load(),
+		Subchunk:    [3]uint64{m.subchunkDecode.Load(), m.subchunkModify.Load(), m.subchunkError.Load()},
+		Stream:      m.streamUpdates.Load(),
+	}
+	for i := range metricActions {
+		c.Seen[i] = m.seen[i].Load()
+		c.Forwarded[i] = m.forwarded[i].Load()
+		c.Denied[i] = m.denied[i].Load()
+	}
+	for i := range metricReasons {
+		c.Reasons[i] = m.reasons[i].Load()
+	}
+	for i := range latencyBuckets {
+		c.Latency[i] = m.latency[i].Load()
+	}
+	return c
+}
+
+// minus returns the element-wise difference c-previous.
+func (c metricCounts) minus(previous metricCounts) metricCounts {
+	subtract(c.Refresh[:], previous.Refresh[:])
+	subtract(c.Seen[:], previous.Seen[:])
+	subtract(c.Forwarded[:], previous.Forwarded[:])
+	subtract(c.Denied[:], previous.Denied[:])
+	subtract(c.Reasons[:], previous.Reasons[:])
+	subtract(c.Latency[:], previous.Latency[:])
+	subtract(c.Corrections[:], previous.Corrections[:])
+	subtract(c.Subchunk[:], previous.Subchunk[:])
+	c.Sources -= previous.Sources
+	c.Packets -= previous.Packets
+	c.Candidates -= previous.Candidates
+	c.Unblocked -= previous.Unblocked
+	c.Stream -= previous.Stream
+	return c
+}
+
+func subtract(values, previous []uint64) {
+	for i := range values {
+		values[i] -= previous[i]
+	}
+}
+
+type metricRecord struct {
+	Type        string                `json:"type"`
+	Server      string                `json:"server"`
+	PeriodMS    int64                 `json:"period_ms"`
+	ActionNames [metricActions]string `json:"action_names"`
+	ReasonNames [metricReasons]string `json:"reason_names"`
+	Snapshot    snapshotMetric        `json:"snapshot"`
+	Streaming   bool                  `json:"streaming"`
+	metricCounts
 }
 
 type snapshotMetric struct {
 	AgeMS      int64  `json:"age_ms"`
 	Generation uint64 `json:"generation"`
 	Claims     int    `json:"claims"`
-	Cells      int    `json:"cells"`
+	IndexSize  int    `json:"index_size"`
+	Restored   bool   `json:"restored"`
 }
 
-// WriteDelta emits one compact JSON record and resets interval counters.
+// WriteDelta emits one compact JSON record with the counter change since the
+// previous call.
 func (m *Metrics) WriteDelta(output io.Writer, period time.Duration, snapshot *Snapshot) {
 	if m == nil {
 		return
 	}
+	m.deltaMu.Lock()
+	current := m.counts()
+	delta := current.minus(m.reported)
+	m.reported = current
+	m.deltaMu.Unlock()
+
 	record := metricRecord{
-		Type:        "claim_proxy_metrics",
-		Server:      m.server,
-		PeriodMS:    period.Milliseconds(),
-		ActionNames: actionMetricNames,
-		ReasonNames: reasonMetricNames,
-		Packets:     m.packets.Swap(0),
-		Refresh: [3]uint64{
-			m.refreshAttempts.Swap(0),
-			m.refreshSuccess.Swap(0),
-			m.refreshFailure.Swap(0),
-		},
-		Candidates:  m.candidates.Swap(0),
-		Corrections: [2]uint64{m.correctionsSent.Swap(0), m.correctionsSkip.Swap(0)},
-		Subchunk:    [3]uint64{m.subchunkDecode.Swap(0), m.subchunkModify.Swap(0), m.subchunkError.Swap(0)},
-		Snapshot:    snapshotMetric{AgeMS: -1},
-	}
-	for i := range metricActions {
-		record.Seen[i] = m.seen[i].Swap(0)
-		record.Forwarded[i] = m.forwarded[i].Swap(0)
-		record.Denied[i] = m.denied[i].Swap(0)
-	}
-	for i := range metricReasons {
-		record.Reasons[i] = m.reasons[i].Swap(0)
-	}
-	for i := range latencyBuckets {
-		record.Latency[i] = m.latency[i].Swap(0)
+		Type:         "claim_proxy_metrics",
+		Server:       m.server,
+		PeriodMS:     period.Milliseconds(),
+		ActionNames:  actionMetricNames,
+		ReasonNames:  reasonMetricNames,
+		Snapshot:     snapshotMetric{AgeMS: -1},
+		Streaming:    m.streaming.Load(),
+		metricCounts: delta,
 	}
 	if snapshot != nil {
 		record.Snapshot = snapshotMetric{
 			AgeMS:      snapshot.Age(time.Now()).Milliseconds(),
 			Generation: snapshot.Generation,
 			Claims:     snapshot.ClaimCount,
-			Cells:      snapshot.CellCount,
+			IndexSize:  snapshot.IndexSize,
+			Restored:   snapshot.Restored,
 		}
 	}
 	raw, err := json.Marshal(record)
@@ -200,3 +292,73 @@ func (m *Metrics) WriteDelta(output io.Writer, period time.Duration, snapshot *S
 		_, _ = fmt.Fprintln(output, string(raw))
 	}
 }
+
+// latencyBounds are the upper bounds in seconds of the fixed latency buckets.
+var latencyBounds = []float64{10e-6, 50e-6, 250e-6, 1e-3}
+
+// Collect adds this server's cumulative claim metrics to r.
+func (m *Metrics) Collect(r *exposition.Registry, snapshot *Snapshot) {
+	if m == nil {
+		return
+	}
+	c := m.counts()
+	server := exposition.L("server", m.server)
+	r.Counter("gobds_claim_refresh_attempts_total", "Claim refresh attempts.", c.Refresh[0], server)
+	r.Counter("gobds_claim_refresh_success_total", "Successful claim refreshes.", c.Refresh[1], server)
+	r.Counter("gobds_claim_refresh_failures_total", "Failed claim refreshes.", c.Refresh[2], server)
+	r.Counter("gobds_claim_source_failures_total", "Claim sources that failed during a refresh.", c.Sources, server)
+	r.Counter("gobds_claim_packets_total", "Claim-related packets processed.", c.Packets, server)
+	for i, name := range actionMetricNames {
+		action := exposition.L("action", name)
+		r.Counter("gobds_claim_actions_seen_total", "Claim policy decisions by action.", c.Seen[i], server, action)
+		r.Counter("gobds_claim_actions_forwarded_total", "Claim actions forwarded to BDS.", c.Forwarded[i], server, action)
+		r.Counter("gobds_claim_actions_denied_total", "Claim actions denied by the proxy.", c.Denied[i], server, action)
+	}
+	for i, name := range reasonMetricNames {
+		reason := exposition.L("reason", name)
+		r.Counter("gobds_claim_reasons_total", "Claim query statuses that failed open.", c.Reasons[i], server, reason)
+	}
+	r.Counter("gobds_claim_candidates_total", "Spatial claim candidates examined.", c.Candidates, server)
+	r.Histogram(
+		"gobds_claim_handler_latency_seconds",
+		"Claim packet handler latency.",
+		latencyBounds,
+		c.Latency[:],
+		time.Duration(m.latencySum.Load()).Seconds(),
+		server,
+	)
+	for i, outcome := range [2]string{"sent", "skipped"} {
+		r.Counter(
+			"gobds_claim_corrections_total", "Corrective packets by outcome.",
+			c.Corrections[i], server, exposition.L("outcome", outcome),
+		)
+	}
+	r.Counter(
+		"gobds_claim_pickups_unblocked_total", "Item pickups claim policy denies that BDS had already made.",
+		c.Unblocked, server,
+	)
+	for i, outcome := range [3]string{"decoded", "modified", "error"} {
+		r.Counter(
+			"gobds_claim_subchunks_total", "Subchunks processed for deny rendering by outcome.",
+			c.Subchunk[i], server, exposition.L("outcome", outcome),
+		)
+	}
+	r.Counter("gobds_claim_stream_updates_total", "Claim changes applied from the update stream.", c.Stream, server)
+	var connected float64
+	if m.streaming.Load() {
+		connected = 1
+	}
+	r.Gauge("gobds_claim_stream_connected", "Whether the claim update stream is connected.", connected, server)
+	if snapshot == nil {
+		return
+	}
+	r.Gauge("gobds_claim_snapshot_age_seconds", "Age of the current claim snapshot.", snapshot.Age(time.Now()).Seconds(), server)
+	r.Gauge("gobds_claim_snapshot_generation", "Generation of the current claim snapshot.", float64(snapshot.Generation), server)
+	r.Gauge("gobds_claim_snapshot_claims", "Claims in the current snapshot.", float64(snapshot.ClaimCount), server)
+	r.Gauge("gobds_claim_snapshot_index_size", "Nodes and pending updates in the spatial index of the current snapshot.", float64(snapshot.IndexSize), server)
+	var restored float64
+	if snapshot.Restored {
+		restored = 1
+	}
+	r.Gauge("gobds_claim_snapshot_restored", "Whether the current claim snapshot was restored from disk.", restored, server)
+}
@@ -3,8 +3,12 @@ package claim
 import (
 	"bytes"
 	"encoding/json"
+	"io"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/util/exposition"
 )
 
 func TestMetricsEmitPerServerDeltaJSON(t *testing.T) {
@@ -27,7 +31,7 @@ func TestMetricsEmitPerServerDeltaJSON(t *testing.T) {
 		Generation:    4,
 		FetchedAt:     time.Now(),
 		ClaimCount:    3,
-		CellCount:     5,
+		IndexSize:     5,
 	})
 	var record metricRecord
 	if err := json.Unmarshal(output.Bytes(), &record); err != nil {
@@ -48,3 +52,39 @@ func TestMetricsEmitPerServerDeltaJSON(t *testing.T) {
 		t.Fatal("delta counters did not reset")
 	}
 }
+
+func TestMetricsCollectStaysCumulativeAcrossDeltas(t *testing.T) {
+	metrics := NewMetrics("GOLD")
+	metrics.Action(1, false)
+	metrics.Latency(20 * time.Microsecond)
+	metrics.WriteDelta(io.Discard, time.Minute, nil)
+	metrics.Action(1, false)
+
+	registry := exposition.NewRegistry()
+	metrics.Collect(registry, &Snapshot{Generation: 4, FetchedAt: time.Now()})
+	var output bytes.Buffer
+	if _, err := registry.WriteTo(&output); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`gobds_claim_actions_denied_total{server="GOLD",action="block_break"} 2`,
+		`gobds_claim_handler_latency_seconds_bucket{server="GOLD",le="5e-05"} 1`,
+		`gobds_claim_handler_latency_seconds_count{server="GOLD"} 1`,
+		`gobds_claim_stream_connected{server="GOLD"} 0`,
+		`gobds_claim_snapshot_generation{server="GOLD"} 4`,
+	} {
+		if !strings.Contains(output.String(), want+"\n") {
+			t.Fatalf("missing %q in:\n%s", want, output.String())
+		}
+	}
+
+	output.Reset()
+	metrics.WriteDelta(&output, time.Minute, nil)
+	var record metricRecord
+	if err := json.Unmarshal(output.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Denied[1] != 1 || record.Latency[1] != 0 {
+		t.Fatalf("delta must only include changes since the previous write: %+v", record)
+	}
+}
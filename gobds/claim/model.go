@@ -10,11 +10,24 @@ type ResponseModel struct {
 
 // PlayerClaim ...
 type PlayerClaim struct {
-	ID           string    `json:"claimId"`
-	OwnerXUID    string    `json:"playerXUID"`
+	ID        string `json:"claimId"`
+	OwnerXUID string `json:"playerXUID"`
+	// OwnerName is the name of the owner shown to players entering the
+	// claim. It plays no part in claim decisions.
+	OwnerName    string    `json:"playerName,omitempty"`
 	Location     Location  `json:"location"`
 	Features     []Feature `json:"features"`
 	TrustedXUIDS []string  `json:"trusts"`
+	// TrustLevels trusts players by XUID up to a level. Players listed in
+	// TrustedXUIDS are trusted as managers.
+	TrustLevels map[string]TrustLevel `json:"trustLevels,omitempty"`
+	// ParentID is the ID of the claim this claim is nested in, if any. A
+	// nested claim lies inside its parent and decides actions inside it.
+	ParentID string `json:"parentClaimId,omitempty"`
+	// InheritTrusts and InheritFeatures make a nested claim also trust the
+	// players, or allow the features, of its parent.
+	InheritTrusts   bool `json:"inheritTrusts,omitempty"`
+	InheritFeatures bool `json:"inheritFeatures,omitempty"`
 }
 
 // Location ...
@@ -22,6 +35,10 @@ type Location struct {
 	Dimension string  `json:"dimension"`
 	Pos1      Vector2 `json:"pos1"`
 	Pos2      Vector2 `json:"pos2"`
+	// MinY and MaxY optionally bound the claim vertically, inclusive. A claim
+	// without them spans the full height of its dimension.
+	MinY *float32 `json:"minY,omitempty"`
+	MaxY *float32 `json:"maxY,omitempty"`
 }
 
 const (
@@ -37,7 +54,8 @@ const (
 	FeatureTypeEntityHurt = "entityHurt"
 	// FeatureTypeDropItems ...
 	FeatureTypeDropItems = "dropItems"
-	// FeatureTypePickupItems is stored/accepted for BEH parity; proxy does not enforce pickup yet.
+	// FeatureTypePickupItems allows picking up items. BDS decides pickups, so
+	// the proxy can only report the ones it would have denied.
 	FeatureTypePickupItems = "pickupItems"
 )
 
@@ -21,3 +21,27 @@ func TestPlayerClaimJSONMatchesBehaviorPackSchema(t *testing.T) {
 		t.Fatalf("unexpected feature bounds: %+v", cl.Features)
 	}
 }
+
+func TestPlayerClaimTrustLevels(t *testing.T) {
+	var cl PlayerClaim
+	err := json.Unmarshal([]byte(`{
+		"trusts":["partner"],
+		"trustLevels":{"guest":"access","builder":"build","partner":"access"}
+	}`), &cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for xuid, want := range map[string]TrustLevel{
+		"guest":    TrustAccess,
+		"builder":  TrustBuild,
+		"partner":  TrustManager,
+		"stranger": TrustNone,
+	} {
+		if got := cl.TrustLevelOf(xuid); got != want {
+			t.Fatalf("trust level of %s = %v, want %v", xuid, got, want)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"trustLevels":{"guest":"owner"}}`), &cl); err == nil {
+		t.Fatal("unknown trust levels must be rejected")
+	}
+}
@@ -0,0 +1,139 @@
+package claim
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/json"
+)
+
+// DefaultPersistedMaxAge is how long after it was fetched a snapshot restored
+// from disk is trusted.
+const DefaultPersistedMaxAge = time.Hour
+
+// persistRevalidatedFraction is the fraction of the persisted maximum age a
+// saved snapshot's fetch time may lag behind before a revalidation saves it
+// again. A snapshot restored after a restart is then trusted for up to that
+// much less time than it could have been, in exchange for not rewriting every
+// claim on every revalidation.
+const persistRevalidatedFraction = 10
+
+// persistVersion identifies the persisted snapshot file format. Version 2
+// keys claims by source.
+const persistVersion = 2
+
+// persistedSnapshot is the file a snapshot is saved to.
+type persistedSnapshot struct {
+	Version       int                    `json:"version"`
+	PolicyVersion int                    `json:"policy_version"`
+	SchemaVersion int                    `json:"schema_version"`
+	FetchedAt     time.Time              `json:"fetched_at"`
+	Claims        map[string]PlayerClaim `json:"claims"`
+	// syncState lets the first fetch after a restart revalidate, or fetch the
+	// changes to, the saved claims.
+	syncState
+}
+
+// persistedState is what a factory last saved to its persistence path, other
+// than the claims.
+type persistedState struct {
+	fetchedAt time.Time
+	sync      syncState
+}
+
+// SetPersistence makes f save the snapshots it fetches to path, and trust a
+// snapshot restored from there for up to maxAge after it was fetched. Every
+// snapshot with changed claims is saved; one the claim service only confirmed
+// unchanged is saved once the saved one is a tenth of maxAge old.
+func (f *Factory) SetPersistence(path string, maxAge time.Duration) {
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+	if path != f.persistPath {
+		f.persisted = persistedState{}
+	}
+	f.persistPath = path
+	f.persistedMaxAge = maxAge
+}
+
+// Restore publishes the snapshot saved at the persistence path, unless a
+// snapshot was already published. It does nothing if persistence is off or
+// nothing was saved yet. The restored snapshot is marked Restored until the
+// claim service answers.
+func (f *Factory) Restore() error {
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+	if f.persistPath == "" || f.snapshot.Load() != nil {
+		return nil
+	}
+	raw, err := os.ReadFile(f.persistPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved persistedSnapshot
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		return fmt.Errorf("decode %s: %w", f.persistPath, err)
+	}
+	if saved.Version != persistVersion || saved.PolicyVersion != PolicyVersion || saved.SchemaVersion != SchemaVersion {
+		return fmt.Errorf("%s was saved by an incompatible version", f.persistPath)
+	}
+	next, err := BuildSnapshot(saved.Claims, f.generation.Add(1), saved.FetchedAt)
+	if err != nil {
+		return fmt.Errorf("build claim snapshot from %s: %w", f.persistPath, err)
+	}
+	next.Restored = true
+	f.snapshot.Store(next)
+	f.announce(nil, next)
+	f.serviceSync = saved.syncState
+	f.persisted = persistedState{fetchedAt: saved.FetchedAt, sync: saved.syncState}
+	if f.service != nil {
+		f.service.sync = saved.syncState
+	}
+	f.log.Info("restored claim snapshot", "claims", next.ClaimCount, "age", next.Age(time.Now()).Round(time.Second).String())
+	return nil
+}
+
+// persist saves snapshot to the persistence path, if there is one. f.refreshMu
+// must be held.
+func (f *Factory) persist(snapshot *Snapshot) {
+	if f.persistPath == "" {
+		return
+	}
+	saved := persistedSnapshot{
+		Version:       persistVersion,
+		PolicyVersion: snapshot.PolicyVersion,
+		SchemaVersion: snapshot.SchemaVersion,
+		FetchedAt:     snapshot.FetchedAt,
+		Claims:        make(map[string]PlayerClaim, len(snapshot.claims)),
+		syncState:     f.serviceSync,
+	}
+	for key, cl := range snapshot.claims {
+		saved.Claims[key] = *cl
+	}
+	if err := save(f.persistPath, saved); err != nil {
+		f.log.Error("failed to persist claim snapshot", "path", f.persistPath, "err", err)
+		return
+	}
+	f.persisted = persistedState{fetchedAt: saved.FetchedAt, sync: saved.syncState}
+}
+
+// save atomically replaces the file at path with saved.
+func save(path string, saved persistedSnapshot) error {
+	raw, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
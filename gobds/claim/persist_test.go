@@ -0,0 +1,140 @@
+package claim
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/service"
+)
+
+func TestFactoryRestoresPersistedSnapshotAfterRestart(t *testing.T) {
+	const modified = "Tue, 14 Jul 2026 12:00:00 GMT"
+	up := true
+	var ifModifiedSince string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !up {
+			writer.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		ifModifiedSince = request.Header.Get("if-modified-since")
+		if ifModifiedSince == modified {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set("Last-Modified", modified)
+		_, _ = fmt.Fprintf(writer, "[%s]", testClaimRow("one", 0))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "claims", "test.json")
+	config := service.Config{Enabled: true, URL: server.URL}
+
+	first := NewFactory(config, "test", time.Second, 3*time.Second, slog.Default())
+	first.SetPersistence(path, time.Hour)
+	if err := first.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("snapshot not persisted: %v", err)
+	}
+
+	// The claim service is down when the proxy comes back.
+	up = false
+	restarted := NewFactory(config, "test", time.Second, 3*time.Second, slog.Default())
+	restarted.SetPersistence(path, time.Hour)
+	if err := restarted.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Fetch(); err == nil {
+		t.Fatal("fetch from a failing claim service succeeded")
+	}
+	snapshot, status := restarted.Snapshot(time.Now().Add(time.Minute))
+	if status != QueryReady || !snapshot.Restored ||
+		len(snapshot.Candidates("minecraft:overworld", 8, 8)) != 1 {
+		t.Fatalf("restored snapshot not trusted: status=%v snapshot=%+v", status, snapshot)
+	}
+	if _, status := restarted.Snapshot(snapshot.FetchedAt.Add(time.Hour + time.Second)); status != QueryRefreshFailed {
+		t.Fatalf("restored snapshot trusted past its maximum age, got %v", status)
+	}
+
+	// Once the service is back, the saved Last-Modified saves a download.
+	up = true
+	if err := restarted.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, status = restarted.Snapshot(time.Now())
+	if ifModifiedSince != modified || status != QueryReady || snapshot.Restored || snapshot.ClaimCount != 1 {
+		t.Fatalf("unexpected revalidation: If-Modified-Since=%q status=%v snapshot=%+v", ifModifiedSince, status, snapshot)
+	}
+}
+
+func TestFactoryRestoreIgnoresMissingAndRejectsInvalidFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.json")
+	factory := NewFactory(service.Config{}, "test", time.Second, 3*time.Second, slog.Default())
+	factory.SetPersistence(path, time.Hour)
+	if err := factory.Restore(); err != nil {
+		t.Fatalf("a missing file must be ignored: %v", err)
+	}
+	for _, content := range []string{
+		"{",
+		`{"version":1,"policy_version":1,"schema_version":99,"claims":{}}`,
+		`{"version":1,"policy_version":1,"schema_version":1,"claims":{"bad":{"claimId":"bad","playerXUID":"owner","location":{"dimension":"invalid"}}}}`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := factory.Restore(); err == nil {
+			t.Fatalf("restored from %s", content)
+		}
+	}
+	if _, status := factory.Snapshot(time.Now()); status != QueryMissing {
+		t.Fatalf("rejected file published a snapshot, status %v", status)
+	}
+}
+
+func TestFactoryPersistsRevalidationsLessOften(t *testing.T) {
+	const modified = "Tue, 14 Jul 2026 12:00:00 GMT"
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("if-modified-since") == modified {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set("Last-Modified", modified)
+		_, _ = fmt.Fprintf(writer, "[%s]", testClaimRow("one", 0))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "test.json")
+	factory := NewFactory(service.Config{Enabled: true, URL: server.URL}, "test", time.Second, 3*time.Second, slog.Default())
+	factory.SetPersistence(path, time.Hour)
+	if err := factory.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = factory.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := os.ReadFile(path); string(raw) != string(saved) {
+		t.Fatal("unchanged claims saved again right after they were saved")
+	}
+
+	// Once the saved fetch time lags behind by a tenth of the maximum age,
+	// the revalidation is saved.
+	factory.refreshMu.Lock()
+	factory.persisted.fetchedAt = factory.persisted.fetchedAt.Add(-6 * time.Minute)
+	factory.refreshMu.Unlock()
+	if err = factory.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := os.ReadFile(path); string(raw) == string(saved) {
+		t.Fatal("revalidated snapshot not saved once the saved one was old")
+	}
+}
@@ -3,8 +3,10 @@ package claim
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/go-jose/go-jose/v4/json"
@@ -14,12 +16,24 @@ import (
 // Service ...
 type Service struct {
 	*service.Service
-	lastModified string
+	streamURL string
+	sync      syncState
+}
+
+// syncState is what the claim service is told so that it only sends what
+// changed since the last fetch.
+type syncState struct {
+	// LastModified and ETag revalidate a full fetch.
+	LastModified string `json:"last_modified,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	// Cursor is where the next delta fetch continues from. It is empty until
+	// the claim service sends one.
+	Cursor string `json:"cursor,omitempty"`
 }
 
 // NewService ...
 func NewService(c service.Config, log *slog.Logger) *Service {
-	return &Service{Service: service.NewService(log, c)}
+	return &Service{Service: service.NewService(log, c), streamURL: c.StreamURL}
 }
 
 // FetchResult contains claim rows plus HTTP revalidation state.
@@ -29,30 +43,94 @@ type FetchResult struct {
 	LastModified string
 }
 
+// deltaResponse is the body of a delta fetch.
+type deltaResponse struct {
+	Cursor  string          `json:"cursor"`
+	Upserts []ResponseModel `json:"upserts"`
+	Deletes []string        `json:"deletes"`
+}
+
 // FetchClaims ...
 func (s *Service) FetchClaims() (FetchResult, error) {
 	if !s.Enabled {
 		return FetchResult{Claims: map[string]PlayerClaim{}}, nil
 	}
+	var result FetchResult
+	err := s.get(s.URL, func(request *http.Request) {
+		if s.sync.LastModified != "" {
+			request.Header.Set("if-modified-since", s.sync.LastModified)
+		}
+		if s.sync.ETag != "" {
+			request.Header.Set("if-none-match", s.sync.ETag)
+		}
+	}, func(response *http.Response) (err error, retry bool) {
+		result, err, retry = s.handleFetchResponse(response)
+		return err, retry
+	})
+	if err != nil {
+		return FetchResult{}, err
+	}
+	return result, nil
+}
+
+// FetchChanges fetches the claims changed since the cursor the claim service
+// last sent, from its URL with ?since=<cursor>. It returns false if there is
+// no cursor, or the service rejected it with 410 Gone, so every claim must be
+// fetched again.
+func (s *Service) FetchChanges() (Update, bool, error) {
+	if !s.Enabled || s.sync.Cursor == "" {
+		return Update{}, false, nil
+	}
+	target, err := url.Parse(s.URL)
+	if err != nil {
+		return Update{}, false, fmt.Errorf("invalid claim service url: %w", err)
+	}
+	query := target.Query()
+	query.Set("since", s.sync.Cursor)
+	target.RawQuery = query.Encode()
+
+	var (
+		update Update
+		ok     bool
+	)
+	err = s.get(target.String(), func(*http.Request) {}, func(response *http.Response) (err error, retry bool) {
+		update, ok, err, retry = s.handleChangesResponse(response)
+		return err, retry
+	})
+	if err != nil {
+		return Update{}, false, err
+	}
+	return update, ok, nil
+}
+
+// Resync forgets what the claim service sent before, so that the next fetch
+// downloads every claim again.
+func (s *Service) Resync() {
+	s.sync = syncState{}
+}
+
+// get sends a GET request to target, retrying temporary failures. prepare
+// adds headers to the request, and handle reads the response, returning
+// retry=true to send the request again. The response body is closed after
+// handle returns.
+func (s *Service) get(target string, prepare func(*http.Request), handle func(*http.Response) (error, bool)) error {
 	var lastErr error
 	for attempt := 0; attempt <= service.MaxRetries; attempt++ {
 		if s.Closed {
-			return FetchResult{}, fmt.Errorf("service closed")
+			return fmt.Errorf("service closed")
 		}
 		if attempt > 0 {
 			time.Sleep(service.RetryDelay)
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), service.RequestTimeout)
-		request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
 		if err != nil {
 			cancel()
-			return FetchResult{}, fmt.Errorf("failed to create request: %w", err)
+			return fmt.Errorf("failed to create request: %w", err)
 		}
 		request.Header.Set("authorization", s.Key)
-		if s.lastModified != "" {
-			request.Header.Set("if-modified-since", s.lastModified)
-		}
+		prepare(request)
 
 		response, err := s.Client.Do(request)
 		if err != nil {
@@ -61,59 +139,114 @@ func (s *Service) FetchClaims() (FetchResult, error) {
 			if service.ErrorIsTemporary(err) {
 				continue
 			}
-			return FetchResult{}, lastErr
+			return lastErr
 		}
 
-		result, err, retry := s.handleFetchResponse(response, cancel)
+		err, retry := handle(response)
+		_ = response.Body.Close()
+		cancel()
 		if retry {
 			lastErr = err
 			continue
 		}
-		if err != nil {
-			return FetchResult{}, err
-		}
-		return result, nil
+		return err
 	}
 	if lastErr == nil {
 		lastErr = fmt.Errorf("claims service unavailable")
 	}
-	return FetchResult{}, lastErr
+	return lastErr
 }
 
-// handleFetchResponse closes the body, cancels the request context, and returns
-// (result, err, retry). retry=true means the caller should continue the loop.
-func (s *Service) handleFetchResponse(response *http.Response, cancel context.CancelFunc) (FetchResult, error, bool) {
-	defer cancel()
-	defer func() { _ = response.Body.Close() }()
-
+// handleFetchResponse returns (result, err, retry). retry=true means the
+// caller should continue the loop.
+func (s *Service) handleFetchResponse(response *http.Response) (FetchResult, error, bool) {
 	switch response.StatusCode {
 	case http.StatusOK:
 		var claimResponse []ResponseModel
 		if err := json.NewDecoder(response.Body).Decode(&claimResponse); err != nil {
 			return FetchResult{}, fmt.Errorf("failed to decode response: %w", err), true
 		}
-		obj := make(map[string]PlayerClaim, len(claimResponse))
-		for _, v := range claimResponse {
-			if _, exists := obj[v.Key]; exists {
-				return FetchResult{}, fmt.Errorf("duplicate claim response key %q", v.Key), false
-			}
-			obj[v.Key] = v.Data
+		obj, err := claimsByKey(claimResponse)
+		if err != nil {
+			return FetchResult{}, err, false
 		}
-		if modified := response.Header.Get("last-modified"); modified != "" {
-			s.lastModified = modified
+		s.sync = syncState{
+			LastModified: response.Header.Get("last-modified"),
+			ETag:         response.Header.Get("etag"),
+			Cursor:       response.Header.Get("x-claims-cursor"),
 		}
 		return FetchResult{
 			Claims:       obj,
-			LastModified: s.lastModified,
+			LastModified: s.sync.LastModified,
 		}, nil, false
 	case http.StatusNotModified:
 		if modified := response.Header.Get("last-modified"); modified != "" {
-			s.lastModified = modified
+			s.sync.LastModified = modified
+		}
+		if etag := response.Header.Get("etag"); etag != "" {
+			s.sync.ETag = etag
 		}
-		return FetchResult{NotModified: true, LastModified: s.lastModified}, nil, false
+		return FetchResult{NotModified: true, LastModified: s.sync.LastModified}, nil, false
 	case http.StatusTooManyRequests:
 		return FetchResult{}, fmt.Errorf("rate limited"), true
 	default:
 		return FetchResult{}, fmt.Errorf("unexpected status code: %d", response.StatusCode), true
 	}
 }
+
+// handleChangesResponse returns (update, ok, err, retry), where ok=false
+// means the cursor was rejected.
+func (s *Service) handleChangesResponse(response *http.Response) (Update, bool, error, bool) {
+	switch response.StatusCode {
+	case http.StatusOK:
+		var delta deltaResponse
+		if err := json.NewDecoder(response.Body).Decode(&delta); err != nil {
+			return Update{}, false, fmt.Errorf("failed to decode changes: %w", err), true
+		}
+		if delta.Cursor == "" {
+			return Update{}, false, fmt.Errorf("changes without a cursor"), false
+		}
+		upserts, err := claimsByKey(delta.Upserts)
+		if err != nil {
+			return Update{}, false, err, false
+		}
+		for _, key := range delta.Deletes {
+			if _, ok := upserts[key]; ok {
+				return Update{}, false, fmt.Errorf("claim %q both changed and deleted", key), false
+			}
+		}
+		s.sync.Cursor = delta.Cursor
+		return Update{Upserts: upserts, Deletes: delta.Deletes}, true, nil, false
+	case http.StatusNotModified:
+		return Update{}, true, nil, false
+	case http.StatusGone:
+		s.sync.Cursor = ""
+		return Update{}, false, nil, false
+	case http.StatusTooManyRequests:
+		return Update{}, false, fmt.Errorf("rate limited"), true
+	default:
+		return Update{}, false, fmt.Errorf("unexpected status code: %d", response.StatusCode), true
+	}
+}
+
+// DecodeClaims decodes claims in the format the claim service responds with,
+// such as a saved response body.
+func DecodeClaims(r io.Reader) (map[string]PlayerClaim, error) {
+	var claimResponse []ResponseModel
+	if err := json.NewDecoder(r).Decode(&claimResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+	return claimsByKey(claimResponse)
+}
+
+// claimsByKey indexes claim service rows by their key.
+func claimsByKey(rows []ResponseModel) (map[string]PlayerClaim, error) {
+	obj := make(map[string]PlayerClaim, len(rows))
+	for _, v := range rows {
+		if _, exists := obj[v.Key]; exists {
+			return nil, fmt.Errorf("duplicate claim response key %q", v.Key)
+		}
+		obj[v.Key] = v.Data
+	}
+	return obj, nil
+}
@@ -1,10 +1,14 @@
 package claim
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/smell-of-curry/gobds/gobds/service"
 )
@@ -36,3 +40,99 @@ func TestServiceUsesAdvertisedLastModifiedFor304(t *testing.T) {
 		t.Fatalf("unexpected revalidation: result=%+v err=%v", second, err)
 	}
 }
+
+func TestServiceRevalidatesWithETag(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		if request.Header.Get("if-none-match") == `"v1"` {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set("ETag", `"v1"`)
+		_, _ = fmt.Fprintf(writer, "[%s]", testClaimRow("one", 0))
+	}))
+	defer server.Close()
+
+	client := NewService(service.Config{Enabled: true, URL: server.URL}, slog.Default())
+	if _, err := client.FetchClaims(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.FetchClaims()
+	if err != nil || !second.NotModified || requests != 2 {
+		t.Fatalf("unexpected revalidation: result=%+v err=%v requests=%d", second, err, requests)
+	}
+}
+
+func TestFactoryAppliesChangesSinceCursor(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		since    []string
+		rejected bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		cursor := request.URL.Query().Get("since")
+		since = append(since, cursor)
+		switch {
+		case cursor == "":
+			writer.Header().Set("X-Claims-Cursor", "c1")
+			_, _ = fmt.Fprintf(writer, "[%s,%s]", testClaimRow("one", 0), testClaimRow("two", 32))
+		case rejected:
+			writer.WriteHeader(http.StatusGone)
+		case cursor == "c1":
+			_, _ = fmt.Fprintf(writer, `{"cursor":"c2","upserts":[%s],"deletes":["two"]}`, testClaimRow("three", 64))
+		default:
+			writer.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer server.Close()
+
+	factory := NewFactory(service.Config{Enabled: true, URL: server.URL}, "test", time.Minute, 2*time.Minute, slog.Default())
+	if err := factory.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	initial, _ := factory.Snapshot(time.Now())
+
+	if err := factory.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	changed, status := factory.Snapshot(time.Now())
+	if status != QueryReady || changed.ClaimCount != 2 || changed.Generation <= initial.Generation {
+		t.Fatalf("changes not applied: status=%v snapshot=%+v", status, changed)
+	}
+	if changed.claims["service/one"] != initial.claims["service/one"] {
+		t.Fatal("unchanged claim was rebuilt instead of shared with the previous snapshot")
+	}
+	if _, ok := changed.ids["two"]; ok {
+		t.Fatal("deleted claim still in snapshot")
+	}
+	if len(changed.Candidates("minecraft:overworld", 70, 70)) != 1 {
+		t.Fatal("upserted claim not indexed")
+	}
+
+	if err := factory.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if revalidated, _ := factory.Snapshot(time.Now()); revalidated.claims["service/three"] != changed.claims["service/three"] {
+		t.Fatal("unchanged delta rebuilt the snapshot")
+	}
+
+	mu.Lock()
+	rejected = true
+	mu.Unlock()
+	if err := factory.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	full, _ := factory.Snapshot(time.Now())
+	if full.ClaimCount != 2 || full.ids["two"] == "" {
+		t.Fatalf("rejected cursor did not fall back to a full fetch: %+v", full)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"", "c1", "c2", "c2", ""}; !slices.Equal(since, want) {
+		t.Fatalf("requested cursors %q, want %q", since, want)
+	}
+}
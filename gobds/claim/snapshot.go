@@ -2,6 +2,7 @@ package claim
 
 import (
 	"fmt"
+	"maps"
 	"math"
 	"strings"
 	"time"
@@ -9,12 +10,13 @@ import (
 
 const (
 	// PolicyVersion identifies claim decision semantics shared with BEH.
-	PolicyVersion = 1
+	PolicyVersion = 3
 	// SchemaVersion identifies claim payload shape shared with BEH.
-	SchemaVersion = 1
-	cellSize      = 16
-	// ponytail: 262k-cell ceiling bounds hostile payload cost; add coarse cells if world claims exceed it.
-	maxCellsPerClaim = 1 << 18
+	SchemaVersion = 4
+	// cellSize is the width of the cells Candidates looks up claims by.
+	cellSize = 16
+	// maxClaimDepth bounds how many claims a claim may be nested in.
+	maxClaimDepth = 8
 )
 
 // Snapshot is immutable after construction and safe for concurrent lock-free reads.
@@ -25,15 +27,18 @@ type Snapshot struct {
 	GeneratedAt   time.Time
 	FetchedAt     time.Time
 	ClaimCount    int
-	CellCount     int
+	// IndexSize is the number of nodes and pending updates in the spatial
+	// index of the claims.
+	IndexSize int
+	// Restored is set on a snapshot loaded from disk on start, until the
+	// claim service confirms or replaces it.
+	Restored bool
 
-	claims []PlayerClaim
-	cells  map[string]map[cellKey][]*PlayerClaim
-}
-
-type cellKey struct {
-	x int32
-	z int32
+	// claims are keyed by their source and key in it, and ids maps claim
+	// IDs back to those keys.
+	claims map[string]*PlayerClaim
+	ids    map[string]string
+	index  spatialIndex
 }
 
 // QueryStatus explains whether proxy policy can safely act on a query.
@@ -58,12 +63,25 @@ const (
 	QueryRefreshFailed
 )
 
-// Candidates returns immutable claims from the fixed spatial cell containing x,z.
+// Candidates returns the immutable claims that cover part of the 16 by 16
+// cell containing x,z, the chunk if x,z is a block position.
 func (s *Snapshot) Candidates(dimension string, x, z float32) []*PlayerClaim {
-	if s == nil {
+	if s == nil || s.index[dimension] == nil {
 		return nil
 	}
-	return s.cells[dimension][cellFor(x, z)]
+	return s.index[dimension].candidates(cellBounds(x, z))
+}
+
+// Parent returns the claim cl is nested in, if it has one.
+func (s *Snapshot) Parent(cl *PlayerClaim) (*PlayerClaim, bool) {
+	if s == nil || cl.ParentID == "" {
+		return nil, false
+	}
+	key, ok := s.ids[cl.ParentID]
+	if !ok {
+		return nil, false
+	}
+	return s.claims[key], true
 }
 
 // Supported reports whether this process understands snapshot policy and schema.
@@ -87,60 +105,141 @@ func BuildSnapshot(claims map[string]PlayerClaim, generation uint64, now time.Ti
 		Generation:    generation,
 		GeneratedAt:   now,
 		FetchedAt:     now,
-		ClaimCount:    len(claims),
-		claims:        make([]PlayerClaim, 0, len(claims)),
-		cells:         make(map[string]map[cellKey][]*PlayerClaim),
+		claims:        make(map[string]*PlayerClaim, len(claims)),
+		ids:           make(map[string]string, len(claims)),
 	}
-	ids := make(map[string]struct{}, len(claims))
 	for key, source := range claims {
-		cl, err := cloneAndValidateClaim(key, source)
-		if err != nil {
+		if _, err := snapshot.insert(key, source); err != nil {
 			return nil, err
 		}
-		if _, exists := ids[cl.ID]; exists {
-			return nil, fmt.Errorf("duplicate claim id %q", cl.ID)
+	}
+	if err := snapshot.validateNesting(); err != nil {
+		return nil, err
+	}
+	snapshot.index = newSpatialIndex(snapshot.claims)
+	snapshot.ClaimCount = len(snapshot.claims)
+	snapshot.IndexSize = snapshot.index.size()
+	return snapshot, nil
+}
+
+// revalidated returns a copy of s the claim service confirmed unchanged at
+// now, as the next generation.
+func (s *Snapshot) revalidated(generation uint64, now time.Time) *Snapshot {
+	next := *s
+	next.Generation = generation
+	next.FetchedAt = now
+	next.Restored = false
+	return &next
+}
+
+// apply returns a copy of s with the claims keyed by deletes removed and
+// upserts added or replaced, as the next generation. s is left untouched: the
+// copy shares every claim, and the index of every dimension, the changes do
+// not affect.
+func (s *Snapshot) apply(upserts map[string]PlayerClaim, deletes []string, generation uint64, now time.Time) (*Snapshot, error) {
+	next := &Snapshot{
+		PolicyVersion: s.PolicyVersion,
+		SchemaVersion: s.SchemaVersion,
+		Generation:    generation,
+		GeneratedAt:   now,
+		FetchedAt:     now,
+		claims:        maps.Clone(s.claims),
+		ids:           maps.Clone(s.ids),
+	}
+	var added, removed []*PlayerClaim
+	for _, key := range deletes {
+		if cl, ok := next.remove(key); ok {
+			removed = append(removed, cl)
+		}
+	}
+	for key, source := range upserts {
+		if cl, ok := next.remove(key); ok {
+			removed = append(removed, cl)
 		}
-		ids[cl.ID] = struct{}{}
-		snapshot.claims = append(snapshot.claims, cl)
-	}
-	for i := range snapshot.claims {
-		cl := &snapshot.claims[i]
-		dimensionCells := snapshot.cells[cl.Location.Dimension]
-		if dimensionCells == nil {
-			dimensionCells = make(map[cellKey][]*PlayerClaim)
-			snapshot.cells[cl.Location.Dimension] = dimensionCells
+		cl, err := next.insert(key, source)
+		if err != nil {
+			return nil, err
 		}
-		minCell, ok := checkedCellFor(
-			min(cl.Location.Pos1.X, cl.Location.Pos2.X),
-			min(cl.Location.Pos1.Z, cl.Location.Pos2.Z),
-		)
-		if !ok {
-			return nil, fmt.Errorf("claim %q bounds exceed spatial index", cl.ID)
+		added = append(added, cl)
+	}
+	if err := next.validateNesting(); err != nil {
+		return nil, err
+	}
+	next.index = s.index.with(added, removed)
+	next.ClaimCount = len(next.claims)
+	next.IndexSize = next.index.size()
+	return next, nil
+}
+
+// insert validates source and stores it under key.
+func (s *Snapshot) insert(key string, source PlayerClaim) (*PlayerClaim, error) {
+	cl, err := cloneAndValidateClaim(key, source)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := s.ids[cl.ID]; exists {
+		return nil, fmt.Errorf("duplicate claim id %q", cl.ID)
+	}
+	s.claims[key] = &cl
+	s.ids[cl.ID] = key
+	return &cl, nil
+}
+
+// remove removes the claim stored under key, if there is one, and returns it.
+func (s *Snapshot) remove(key string) (*PlayerClaim, bool) {
+	cl, ok := s.claims[key]
+	if !ok {
+		return nil, false
+	}
+	delete(s.claims, key)
+	delete(s.ids, cl.ID)
+	return cl, true
+}
+
+// validateNesting checks that every nested claim has a parent it fits
+// inside, and is nested at most maxClaimDepth deep, which also rules out
+// cycles. Every claim is checked, as a change to a parent can break children
+// that did not change themselves.
+func (s *Snapshot) validateNesting() error {
+	for _, cl := range s.claims {
+		if cl.ParentID == "" {
+			continue
 		}
-		maxCell, ok := checkedCellFor(
-			max(cl.Location.Pos1.X, cl.Location.Pos2.X),
-			max(cl.Location.Pos1.Z, cl.Location.Pos2.Z),
-		)
+		parent, ok := s.Parent(cl)
 		if !ok {
-			return nil, fmt.Errorf("claim %q bounds exceed spatial index", cl.ID)
+			return fmt.Errorf("claim %q has unknown parent %q", cl.ID, cl.ParentID)
 		}
-		width := int64(maxCell.x) - int64(minCell.x) + 1
-		depth := int64(maxCell.z) - int64(minCell.z) + 1
-		if width > maxCellsPerClaim || depth > maxCellsPerClaim ||
-			width*depth > maxCellsPerClaim {
-			return nil, fmt.Errorf("claim %q spans too many spatial cells", cl.ID)
+		if !claimFits(*cl, *parent) {
+			return fmt.Errorf("claim %q does not fit inside its parent %q", cl.ID, parent.ID)
 		}
-		for x := int64(minCell.x); x <= int64(maxCell.x); x++ {
-			for z := int64(minCell.z); z <= int64(maxCell.z); z++ {
-				key := cellKey{x: int32(x), z: int32(z)}
-				if len(dimensionCells[key]) == 0 {
-					snapshot.CellCount++
-				}
-				dimensionCells[key] = append(dimensionCells[key], cl)
+		for depth := 1; parent.ParentID != ""; depth++ {
+			if depth >= maxClaimDepth {
+				return fmt.Errorf("claim %q is nested more than %d deep or in a cycle", cl.ID, maxClaimDepth)
+			}
+			if parent, ok = s.Parent(parent); !ok {
+				// The missing parent is reported for the claim naming it.
+				break
 			}
 		}
 	}
-	return snapshot, nil
+	return nil
+}
+
+// claimFits reports whether child lies entirely inside parent.
+func claimFits(child, parent PlayerClaim) bool {
+	if child.Location.Dimension != parent.Location.Dimension {
+		return false
+	}
+	if min(child.Location.Pos1.X, child.Location.Pos2.X) < min(parent.Location.Pos1.X, parent.Location.Pos2.X) ||
+		max(child.Location.Pos1.X, child.Location.Pos2.X) > max(parent.Location.Pos1.X, parent.Location.Pos2.X) ||
+		min(child.Location.Pos1.Z, child.Location.Pos2.Z) < min(parent.Location.Pos1.Z, parent.Location.Pos2.Z) ||
+		max(child.Location.Pos1.Z, child.Location.Pos2.Z) > max(parent.Location.Pos1.Z, parent.Location.Pos2.Z) {
+		return false
+	}
+	if parent.Location.MinY != nil && (child.Location.MinY == nil || *child.Location.MinY < *parent.Location.MinY) {
+		return false
+	}
+	return parent.Location.MaxY == nil || child.Location.MaxY != nil && *child.Location.MaxY <= *parent.Location.MaxY
 }
 
 func cloneAndValidateClaim(key string, source PlayerClaim) (PlayerClaim, error) {
@@ -151,6 +250,9 @@ func cloneAndValidateClaim(key string, source PlayerClaim) (PlayerClaim, error)
 	if cl.ID == "" || cl.OwnerXUID == "" {
 		return PlayerClaim{}, fmt.Errorf("claim %q missing id or owner", key)
 	}
+	if cl.ParentID == cl.ID {
+		return PlayerClaim{}, fmt.Errorf("claim %q is its own parent", cl.ID)
+	}
 	dimension, ok := CanonicalDimension(cl.Location.Dimension)
 	if !ok {
 		return PlayerClaim{}, fmt.Errorf("claim %q has invalid dimension %q", cl.ID, cl.Location.Dimension)
@@ -159,7 +261,25 @@ func cloneAndValidateClaim(key string, source PlayerClaim) (PlayerClaim, error)
 	if !finite2(cl.Location.Pos1) || !finite2(cl.Location.Pos2) {
 		return PlayerClaim{}, fmt.Errorf("claim %q has non-finite bounds", cl.ID)
 	}
+	if cl.Location.MinY != nil {
+		if float32Invalid(*cl.Location.MinY) {
+			return PlayerClaim{}, fmt.Errorf("claim %q has non-finite bounds", cl.ID)
+		}
+		minY := *cl.Location.MinY
+		cl.Location.MinY = &minY
+	}
+	if cl.Location.MaxY != nil {
+		if float32Invalid(*cl.Location.MaxY) {
+			return PlayerClaim{}, fmt.Errorf("claim %q has non-finite bounds", cl.ID)
+		}
+		maxY := *cl.Location.MaxY
+		cl.Location.MaxY = &maxY
+	}
+	if cl.Location.MinY != nil && cl.Location.MaxY != nil && *cl.Location.MinY > *cl.Location.MaxY {
+		return PlayerClaim{}, fmt.Errorf("claim %q has minY above maxY", cl.ID)
+	}
 	cl.TrustedXUIDS = append([]string(nil), source.TrustedXUIDS...)
+	cl.TrustLevels = maps.Clone(source.TrustLevels)
 	cl.Features = make([]Feature, len(source.Features))
 	for i, feature := range source.Features {
 		if err := validateFeature(cl.ID, feature); err != nil {
@@ -218,23 +338,6 @@ func CanonicalDimension(value string) (string, bool) {
 	return value, len(parts) == 2 && parts[0] != "" && parts[1] != ""
 }
 
-func cellFor(x, z float32) cellKey {
-	return cellKey{
-		x: int32(math.Floor(float64(x) / cellSize)),
-		z: int32(math.Floor(float64(z) / cellSize)),
-	}
-}
-
-func checkedCellFor(x, z float32) (cellKey, bool) {
-	cellX := math.Floor(float64(x) / cellSize)
-	cellZ := math.Floor(float64(z) / cellSize)
-	if cellX < math.MinInt32 || cellX > math.MaxInt32 ||
-		cellZ < math.MinInt32 || cellZ > math.MaxInt32 {
-		return cellKey{}, false
-	}
-	return cellKey{x: int32(cellX), z: int32(cellZ)}, true
-}
-
 func finite2(v Vector2) bool {
 	return !float32Invalid(v.X) && !float32Invalid(v.Z)
 }
@@ -27,7 +27,7 @@ func TestBuildSnapshotIndexesCanonicalCellsAndClones(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if snapshot.Generation != 7 || snapshot.ClaimCount != 1 || snapshot.CellCount != 12 {
+	if snapshot.Generation != 7 || snapshot.ClaimCount != 1 || snapshot.IndexSize != 1 {
 		t.Fatalf("unexpected metadata: %+v", snapshot)
 	}
 	if candidates := snapshot.Candidates("minecraft:overworld", -16, 0); len(candidates) != 1 {
@@ -35,8 +35,8 @@ func TestBuildSnapshotIndexesCanonicalCellsAndClones(t *testing.T) {
 	}
 	source["one"].Features[0].BlockTypeIDs[0] = "minecraft:dirt"
 	source["one"].TrustedXUIDS[0] = "changed"
-	if snapshot.claims[0].Features[0].BlockTypeIDs[0] != "minecraft:stone" ||
-		snapshot.claims[0].TrustedXUIDS[0] != "trusted" {
+	if snapshot.claims["one"].Features[0].BlockTypeIDs[0] != "minecraft:stone" ||
+		snapshot.claims["one"].TrustedXUIDS[0] != "trusted" {
 		t.Fatal("snapshot retained mutable source slices")
 	}
 }
@@ -60,7 +60,7 @@ func TestBuildSnapshotAcceptsPickupItemsWithoutEnforcement(t *testing.T) {
 	if err != nil {
 		t.Fatalf("pickupItems must be allowed for BEH parity: %v", err)
 	}
-	if len(snapshot.claims) != 1 || snapshot.claims[0].Features[0].Type != FeatureTypePickupItems {
+	if len(snapshot.claims) != 1 || snapshot.claims["one"].Features[0].Type != FeatureTypePickupItems {
 		t.Fatalf("unexpected snapshot: %+v", snapshot.claims)
 	}
 }
@@ -80,6 +80,80 @@ func TestBuildSnapshotRejectsInvalidDataAtomically(t *testing.T) {
 	}
 }
 
+func TestBuildSnapshotValidatesAndClonesVerticalBounds(t *testing.T) {
+	minY, maxY := float32(100), float32(200)
+	island := testSnapshotClaim("island", 0, 15)
+	island.Location.MinY, island.Location.MaxY = &minY, &maxY
+	snapshot, err := BuildSnapshot(map[string]PlayerClaim{"island": island}, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	minY = 0
+	if got := snapshot.claims["island"].Location.MinY; got == nil || *got != 100 {
+		t.Fatal("snapshot retained mutable source bounds")
+	}
+
+	for name, bounds := range map[string][2]float32{
+		"reversed":   {200, 100},
+		"non-finite": {float32(math.Inf(-1)), 100},
+	} {
+		bad := testSnapshotClaim("bad", 0, 15)
+		bad.Location.MinY, bad.Location.MaxY = &bounds[0], &bounds[1]
+		if _, err := BuildSnapshot(map[string]PlayerClaim{"bad": bad}, 1, time.Now()); err == nil {
+			t.Fatalf("%s vertical bounds must be rejected", name)
+		}
+	}
+}
+
+func TestBuildSnapshotValidatesNesting(t *testing.T) {
+	nested := func(id, parent string, minPosition, maxPosition float32) PlayerClaim {
+		cl := testSnapshotClaim(id, minPosition, maxPosition)
+		cl.ParentID = parent
+		return cl
+	}
+	snapshot, err := BuildSnapshot(map[string]PlayerClaim{
+		"town": testSnapshotClaim("town", 0, 63),
+		"plot": nested("plot", "town", 16, 31),
+		"room": nested("room", "plot", 20, 24),
+	}, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	plot, ok := snapshot.Parent(snapshot.claims["room"])
+	if !ok || plot.ID != "plot" {
+		t.Fatalf("room parent = %+v, want plot", plot)
+	}
+	if _, ok := snapshot.Parent(snapshot.claims["town"]); ok {
+		t.Fatal("a top-level claim has no parent")
+	}
+
+	floor := float32(64)
+	island := testSnapshotClaim("island", 0, 63)
+	island.Location.MinY = &floor
+	cycle := map[string]PlayerClaim{"a": nested("a", "b", 0, 15), "b": nested("b", "a", 0, 15)}
+	for name, claims := range map[string]map[string]PlayerClaim{
+		"child outside parent": {"town": testSnapshotClaim("town", 0, 63), "plot": nested("plot", "town", 48, 80)},
+		"unbounded child":      {"island": island, "house": nested("house", "island", 8, 15)},
+		"unknown parent":       {"plot": nested("plot", "town", 0, 15)},
+		"own parent":           {"plot": nested("plot", "plot", 0, 15)},
+		"cycle":                cycle,
+	} {
+		if _, err := BuildSnapshot(claims, 1, time.Now()); err == nil {
+			t.Fatalf("%s must be rejected", name)
+		}
+	}
+
+	if _, err := snapshot.apply(nil, []string{"plot"}, 2, time.Now()); err == nil {
+		t.Fatal("deleting a parent without its children must be rejected")
+	}
+	if _, err := snapshot.apply(map[string]PlayerClaim{"town": testSnapshotClaim("town", 0, 15)}, nil, 2, time.Now()); err == nil {
+		t.Fatal("shrinking a parent below its children must be rejected")
+	}
+	if _, err := snapshot.apply(nil, []string{"room", "plot"}, 2, time.Now()); err != nil {
+		t.Fatalf("deleting a parent with its children: %v", err)
+	}
+}
+
 func TestSnapshotCellsExposeOverlapWithoutChoosingWinner(t *testing.T) {
 	claims := map[string]PlayerClaim{
 		"one": testSnapshotClaim("one", 0, 15),
@@ -105,3 +179,65 @@ func testSnapshotClaim(id string, minPosition, maxPosition float32) PlayerClaim
 		},
 	}
 }
+
+func TestSnapshotApplyLeavesPreviousGenerationUntouched(t *testing.T) {
+	previous, err := BuildSnapshot(map[string]PlayerClaim{
+		"one": testSnapshotClaim("one", 0, 15),
+		"two": testSnapshotClaim("two", 32, 47),
+	}, 1, time.Unix(100, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := previous.apply(map[string]PlayerClaim{
+		"two":   testSnapshotClaim("two", 64, 79),
+		"three": testSnapshotClaim("three", 0, 15),
+	}, []string{"one"}, 2, time.Unix(200, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Generation != 2 || next.ClaimCount != 2 || next.IndexSize != 5 || !next.FetchedAt.Equal(time.Unix(200, 0)) {
+		t.Fatalf("unexpected metadata: %+v", next)
+	}
+	if got := next.Candidates("minecraft:overworld", 8, 8); len(got) != 1 || got[0].ID != "three" {
+		t.Fatalf("unexpected candidates at the replaced claim: %+v", got)
+	}
+	if got := next.Candidates("minecraft:overworld", 40, 40); len(got) != 0 {
+		t.Fatalf("moved claim still indexed at its old position: %+v", got)
+	}
+	if got := next.Candidates("minecraft:overworld", 70, 70); len(got) != 1 || got[0].ID != "two" {
+		t.Fatalf("moved claim not indexed at its new position: %+v", got)
+	}
+
+	if previous.ClaimCount != 2 || previous.IndexSize != 1 {
+		t.Fatalf("previous metadata changed: %+v", previous)
+	}
+	if got := previous.Candidates("minecraft:overworld", 8, 8); len(got) != 1 || got[0].ID != "one" {
+		t.Fatalf("previous snapshot changed: %+v", got)
+	}
+	if got := previous.Candidates("minecraft:overworld", 40, 40); len(got) != 1 || got[0].ID != "two" {
+		t.Fatalf("previous snapshot changed: %+v", got)
+	}
+}
+
+func TestSnapshotApplyRejectsInvalidChanges(t *testing.T) {
+	previous, err := BuildSnapshot(map[string]PlayerClaim{
+		"one": testSnapshotClaim("one", 0, 15),
+	}, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := previous.apply(map[string]PlayerClaim{
+		"other": testSnapshotClaim("one", 32, 47),
+	}, nil, 2, time.Now()); err == nil {
+		t.Fatal("a second key with an existing claim id must be rejected")
+	}
+	if _, err := previous.apply(map[string]PlayerClaim{
+		"one": {ID: "one", OwnerXUID: "owner", Location: Location{Dimension: "invalid"}},
+	}, nil, 2, time.Now()); err == nil {
+		t.Fatal("an invalid claim must be rejected")
+	}
+	if got := previous.Candidates("minecraft:overworld", 8, 8); len(got) != 1 || got[0].ID != "one" {
+		t.Fatalf("rejected changes leaked into the previous snapshot: %+v", got)
+	}
+}
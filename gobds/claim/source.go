@@ -0,0 +1,113 @@
+package claim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotModified is returned by Source.Claims when the claims did not change
+// since they were last returned.
+var ErrNotModified = errors.New("claims not modified")
+
+// serviceSourceName is the name of the claim service as a Source.
+const serviceSourceName = "service"
+
+// Source supplies claims to a Factory. The claims of every source of a
+// factory are merged into one Snapshot, so claim IDs must be unique across
+// them.
+type Source interface {
+	// Name identifies the source. It is unique among the sources of a
+	// factory, and prefixes the snapshot keys of the claims it supplies.
+	Name() string
+	// Claims returns every claim of the source by key, or ErrNotModified if
+	// they did not change since they were last returned.
+	Claims() (map[string]PlayerClaim, error)
+}
+
+// DeltaSource is a Source that can also return only the claims that changed
+// since it last returned claims.
+type DeltaSource interface {
+	Source
+	// Changes returns the claims changed since claims were last returned,
+	// keyed as Claims keys them. It returns false if the source cannot tell
+	// what changed, so Claims must be called instead.
+	Changes() (Update, bool, error)
+	// Resync makes the source return every claim on the next call to Claims,
+	// after the claims it returned could not be used.
+	Resync()
+}
+
+// Name ...
+func (s *Service) Name() string {
+	return serviceSourceName
+}
+
+// Claims fetches every claim from the claim service, or returns
+// ErrNotModified if the service answered that nothing changed.
+func (s *Service) Claims() (map[string]PlayerClaim, error) {
+	result, err := s.FetchClaims()
+	if err != nil {
+		return nil, err
+	}
+	if result.NotModified {
+		return nil, ErrNotModified
+	}
+	return result.Claims, nil
+}
+
+// Changes fetches the claims changed since the last fetch, if the claim
+// service supports delta fetches. See FetchChanges.
+func (s *Service) Changes() (Update, bool, error) {
+	return s.FetchChanges()
+}
+
+// sourceKey returns the snapshot key of the claim keyed by key in the source
+// named name.
+func sourceKey(name, key string) string {
+	return name + "/" + key
+}
+
+// fromSource returns claims keyed by their snapshot keys. A claim without an
+// ID keeps taking its key in the source as its ID.
+func fromSource(name string, claims map[string]PlayerClaim) map[string]PlayerClaim {
+	keyed := make(map[string]PlayerClaim, len(claims))
+	for key, cl := range claims {
+		if cl.ID == "" {
+			cl.ID = key
+		}
+		keyed[sourceKey(name, key)] = cl
+	}
+	return keyed
+}
+
+// sourceClaims returns the claims in s that came from the source named name,
+// keyed by their snapshot keys.
+func (s *Snapshot) sourceClaims(name string) map[string]PlayerClaim {
+	claims := make(map[string]PlayerClaim)
+	if s == nil {
+		return claims
+	}
+	prefix := sourceKey(name, "")
+	for key, cl := range s.claims {
+		if strings.HasPrefix(key, prefix) {
+			claims[key] = *cl
+		}
+	}
+	return claims
+}
+
+// validateSourceName checks that a source named name can be added next to the
+// sources already added. Names may not contain a slash, which separates the
+// source from the key in a snapshot key.
+func validateSourceName(name string, sources []Source) error {
+	if name == "" || name == serviceSourceName || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid claim source name %q", name)
+	}
+	for _, source := range sources {
+		if source.Name() == name {
+			return fmt.Errorf("duplicate claim source %q", name)
+		}
+	}
+	return nil
+}
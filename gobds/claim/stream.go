@@ -0,0 +1,167 @@
+package claim
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/json"
+)
+
+var (
+	// ErrNoStream is returned by Factory.Stream when the claim service has no
+	// update stream configured.
+	ErrNoStream = errors.New("claim service has no update stream")
+
+	errStreamIdle     = errors.New("claim stream went silent")
+	errServiceChanged = errors.New("claim service changed")
+)
+
+// maxStreamEventSize bounds a single update pushed by the claim service.
+const maxStreamEventSize = 4 << 20
+
+// Update is a batch of changes pushed by the claim service. An empty Update
+// is a heartbeat.
+type Update struct {
+	// Upserts are claims added or replaced, by claim service key.
+	Upserts map[string]PlayerClaim
+	// Deletes are the keys of removed claims.
+	Deletes []string
+}
+
+// empty reports whether u changes no claims.
+func (u Update) empty() bool {
+	return len(u.Upserts) == 0 && len(u.Deletes) == 0
+}
+
+// add records a change, replacing any earlier change to the same key.
+func (u *Update) add(event string, data []byte) error {
+	var row ResponseModel
+	if err := json.Unmarshal(data, &row); err != nil {
+		return fmt.Errorf("decode %s event: %w", event, err)
+	}
+	if row.Key == "" {
+		return fmt.Errorf("%s event without a key", event)
+	}
+	if u.Upserts == nil {
+		u.Upserts = make(map[string]PlayerClaim)
+	}
+	// Changes are applied deletes first, so a key that was upserted and then
+	// deleted must only be deleted, and the other way around.
+	delete(u.Upserts, row.Key)
+	if i := slices.Index(u.Deletes, row.Key); i >= 0 {
+		u.Deletes = slices.Delete(u.Deletes, i, i+1)
+	}
+	if event == "delete" {
+		u.Deletes = append(u.Deletes, row.Key)
+		return nil
+	}
+	u.Upserts[row.Key] = row.Data
+	return nil
+}
+
+// Stream opens the claim update stream as Server-Sent Events. Once the stream
+// is open, ready is called; changes sent before it returns are applied after
+// it. Every batch of events read at once, or heartbeat, is then passed to
+// apply. Stream returns when the stream ends, ready or apply fails, nothing is
+// received for idle, or ctx is cancelled.
+func (s *Service) Stream(ctx context.Context, idle time.Duration, ready func() error, apply func(Update) error) error {
+	if !s.Enabled || s.streamURL == "" {
+		return ErrNoStream
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.streamURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("authorization", s.Key)
+	request.Header.Set("accept", "text/event-stream")
+
+	// The shared client times out whole requests, which would cut the
+	// stream, so only its transport is reused.
+	client := &http.Client{Transport: s.Client.Transport}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+
+	timer := time.AfterFunc(idle, func() { cancel(errStreamIdle) })
+	defer timer.Stop()
+	if err := ready(); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(response.Body)
+	var (
+		batch Update
+		event string
+		data  []byte
+	)
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			if cause := context.Cause(ctx); cause != nil {
+				return cause
+			}
+			return fmt.Errorf("read stream: %w", err)
+		}
+		timer.Reset(idle)
+		switch name, value, _ := strings.Cut(line, ":"); {
+		case line == "":
+			// A blank line dispatches the event.
+			if event == "upsert" || event == "delete" {
+				if err := batch.add(event, data); err != nil {
+					return err
+				}
+			}
+			event, data = "", data[:0]
+		case name == "event":
+			event = strings.TrimPrefix(value, " ")
+		case name == "data":
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(value, " ")...)
+			if len(data) > maxStreamEventSize {
+				return fmt.Errorf("stream event exceeds %d bytes", maxStreamEventSize)
+			}
+		}
+		// Apply once everything that has arrived is read, so a burst of
+		// changes becomes a single snapshot.
+		if event == "" && len(data) == 0 && reader.Buffered() == 0 {
+			if err := apply(batch); err != nil {
+				return err
+			}
+			batch = Update{}
+		}
+	}
+}
+
+// readLine reads a line without its line ending, bounded by
+// maxStreamEventSize.
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxStreamEventSize {
+			return "", fmt.Errorf("stream line exceeds %d bytes", maxStreamEventSize)
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
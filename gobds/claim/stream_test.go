@@ -0,0 +1,120 @@
+package claim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/service"
+)
+
+func testClaimRow(key string, position int) string {
+	return fmt.Sprintf(
+		`{"_key":%q,"data":{"claimId":%q,"playerXUID":"owner","location":{"dimension":"minecraft:overworld","pos1":{"x":%d,"z":%d},"pos2":{"x":%d,"z":%d}}}}`,
+		key, key, position, position, position+15, position+15,
+	)
+}
+
+func TestUpdateKeepsLastChangePerKey(t *testing.T) {
+	var update Update
+	for _, change := range []struct{ event, data string }{
+		{"upsert", testClaimRow("one", 0)},
+		{"delete", `{"_key":"one"}`},
+		{"delete", `{"_key":"two"}`},
+		{"upsert", testClaimRow("two", 32)},
+	} {
+		if err := update.add(change.event, []byte(change.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(update.Deletes) != 1 || update.Deletes[0] != "one" || len(update.Upserts) != 1 || update.Upserts["two"].ID != "two" {
+		t.Fatalf("unexpected update %+v", update)
+	}
+	if err := update.add("delete", []byte(`{}`)); err == nil {
+		t.Fatal("changes without a key must be rejected")
+	}
+}
+
+func TestFactoryStreamsUpdatesAfterFullFetch(t *testing.T) {
+	send := make(chan string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/claims", func(writer http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(writer, "[%s]", testClaimRow("one", 0))
+	})
+	mux.HandleFunc("/stream", func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("authorization") != "key" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writer.Header().Set("content-type", "text/event-stream")
+		writer.WriteHeader(http.StatusOK)
+		writer.(http.Flusher).Flush()
+		for {
+			select {
+			case <-request.Context().Done():
+				return
+			case event := <-send:
+				_, _ = fmt.Fprint(writer, event)
+				writer.(http.Flusher).Flush()
+			}
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	factory := NewFactory(service.Config{
+		Enabled:   true,
+		URL:       server.URL + "/claims",
+		Key:       "key",
+		StreamURL: server.URL + "/stream",
+	}, "test", time.Minute, 2*time.Minute, slog.Default())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- factory.Stream(ctx) }()
+
+	send <- ": connected\n\n"
+	waitFor(t, "stream to open", factory.Streaming)
+	initial, _ := factory.Snapshot(time.Now())
+	if initial == nil || initial.ClaimCount != 1 {
+		t.Fatalf("stream did not start from a full fetch: %+v", initial)
+	}
+
+	send <- "event: upsert\ndata: " + testClaimRow("two", 32) + "\n\nevent: delete\ndata: {\"_key\":\"one\"}\n\n"
+	waitFor(t, "streamed changes", func() bool {
+		snapshot, status := factory.Snapshot(time.Now())
+		return status == QueryReady && snapshot.Generation > initial.Generation &&
+			len(snapshot.Candidates("minecraft:overworld", 40, 40)) == 1 &&
+			len(snapshot.Candidates("minecraft:overworld", 8, 8)) == 0
+	})
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("stream ended with %v, want context.Canceled", err)
+	}
+	if factory.Streaming() {
+		t.Fatal("factory still streaming after the stream ended")
+	}
+}
+
+func TestFactoryStreamRequiresStreamURL(t *testing.T) {
+	factory := NewFactory(service.Config{Enabled: true, URL: "http://127.0.0.1:1"}, "test", time.Minute, 2*time.Minute, slog.Default())
+	if err := factory.Stream(context.Background()); !errors.Is(err, ErrNoStream) {
+		t.Fatalf("Stream without a stream URL returned %v", err)
+	}
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,63 @@
+package claim
+
+import (
+	"fmt"
+	"slices"
+)
+
+// TrustLevel is how far a claim trusts a player. Every level allows what the
+// levels below it allow.
+type TrustLevel uint8
+
+const (
+	// TrustNone is the level of players a claim does not trust.
+	TrustNone TrustLevel = iota
+	// TrustAccess allows using doors, trapdoors, fence gates, buttons, levers
+	// and beds, and dropping items.
+	TrustAccess
+	// TrustContainer allows interacting with every other block, such as
+	// chests and furnaces, interacting with entities and picking up items.
+	TrustContainer
+	// TrustBuild allows breaking and placing blocks and hurting entities.
+	TrustBuild
+	// TrustManager allows everything the owner may do, as a plain trust does.
+	TrustManager
+)
+
+var trustLevelNames = [...]string{"none", "access", "container", "build", "manager"}
+
+// String ...
+func (l TrustLevel) String() string {
+	if int(l) >= len(trustLevelNames) {
+		return "unknown"
+	}
+	return trustLevelNames[l]
+}
+
+// MarshalText ...
+func (l TrustLevel) MarshalText() ([]byte, error) {
+	if int(l) >= len(trustLevelNames) {
+		return nil, fmt.Errorf("unknown trust level %d", l)
+	}
+	return []byte(trustLevelNames[l]), nil
+}
+
+// UnmarshalText ...
+func (l *TrustLevel) UnmarshalText(text []byte) error {
+	for level, name := range trustLevelNames {
+		if level != int(TrustNone) && name == string(text) {
+			*l = TrustLevel(level)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown trust level %q", text)
+}
+
+// TrustLevelOf returns how far cl trusts the player with xuid, on its own:
+// the players listed in its trusts are managers.
+func (cl PlayerClaim) TrustLevelOf(xuid string) TrustLevel {
+	if slices.Contains(cl.TrustedXUIDS, xuid) {
+		return TrustManager
+	}
+	return cl.TrustLevels[xuid]
+}
@@ -0,0 +1,111 @@
+package gobds
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+)
+
+const (
+	// claimDiffBuffer is how many claim diffs of a server may wait to be
+	// handled before later ones are dropped.
+	claimDiffBuffer = 16
+	// claimHistorySize is how many claim changes of each server the admin API
+	// keeps.
+	claimHistorySize = 512
+)
+
+// claimHistoryEntry is a claim change as listed by the admin API.
+type claimHistoryEntry struct {
+	Time       time.Time `json:"time"`
+	Generation uint64    `json:"generation"`
+	claim.ClaimChange
+}
+
+// claimHistory holds the latest claim changes of a server.
+type claimHistory struct {
+	mu      sync.Mutex
+	entries []claimHistoryEntry
+}
+
+// add records the changes of diff, dropping the oldest changes beyond
+// claimHistorySize.
+func (h *claimHistory) add(diff claim.Diff) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, change := range diff.Changes {
+		h.entries = append(h.entries, claimHistoryEntry{Time: diff.Time, Generation: diff.To, ClaimChange: change})
+	}
+	if excess := len(h.entries) - claimHistorySize; excess > 0 {
+		h.entries = slices.Delete(h.entries, 0, excess)
+	}
+}
+
+// list returns the recorded changes, newest first, only of the claim with
+// the ID id unless it is empty.
+func (h *claimHistory) list(id string) []claimHistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries := make([]claimHistoryEntry, 0, len(h.entries))
+	for _, entry := range slices.Backward(h.entries) {
+		if id == "" || entry.ID == id {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// claimChangeWatching passes every claim diff of srv on to its sessions, its
+// claim history and the audit log, until the proxy closes.
+func (gb *GoBDS) claimChangeWatching(srv *Server, diffs <-chan claim.Diff) {
+	for {
+		select {
+		case <-gb.ctx.Done():
+			return
+		case diff, ok := <-diffs:
+			if !ok {
+				return
+			}
+			for _, s := range srv.Sessions() {
+				s.ClaimsChanged(diff)
+			}
+			// The claims of the first snapshot are not news.
+			if diff.From == 0 {
+				continue
+			}
+			srv.claimHistory.add(diff)
+			if sink := gb.config().Audit; sink != nil {
+				for _, change := range diff.Changes {
+					sink.Record(claimChangeEvent(srv, diff, change))
+				}
+			}
+		}
+	}
+}
+
+// claimChangeEvent returns the audit event of a change in a claim of srv.
+func claimChangeEvent(srv *Server, diff claim.Diff, change claim.ClaimChange) audit.Event {
+	kinds := make([]string, len(change.Kinds))
+	for i, kind := range change.Kinds {
+		kinds[i] = string(kind)
+	}
+	cl := change.After
+	if cl == nil {
+		cl = change.Before
+	}
+	return audit.Event{
+		Time:      diff.Time,
+		Type:      audit.TypeClaimChanged,
+		Server:    srv.Name,
+		Dimension: cl.Location.Dimension,
+		ClaimChange: &audit.ClaimChange{
+			ID:         change.ID,
+			Owner:      change.Owner,
+			Kinds:      kinds,
+			Generation: diff.To,
+		},
+	}
+}
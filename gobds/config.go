@@ -4,11 +4,17 @@ package gobds
 import (
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/ban"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
 	"github.com/smell-of-curry/gobds/gobds/claim"
 	"github.com/smell-of-curry/gobds/gobds/infra"
+	"github.com/smell-of-curry/gobds/gobds/queue"
 	"github.com/smell-of-curry/gobds/gobds/service"
 	"github.com/smell-of-curry/gobds/gobds/service/authentication"
 	"github.com/smell-of-curry/gobds/gobds/service/vpn"
@@ -26,54 +32,50 @@ type Config struct {
 	VPNService            *vpn.Service
 	AFKTimer              *infra.AFKTimer
 	Whitelist             *whitelist.Whitelist
+	Bans                  *ban.Store
+	Queue                 *QueueConfig
 	Border                *area.Area2D
 	ClaimPrefilter        bool
 	ClaimDenyRendering    bool
+	ClaimNotify           *session.ClaimNotifyConfig
 	ClaimPollInterval     time.Duration
 	ClaimMaxSnapshotAge   time.Duration
 	TrafficProtection     session.TrafficConfig
+	Reconnect             *session.ReconnectConfig
+	HealthCheck           *HealthCheckConfig
+	Capture               *CaptureConfig
+	Audit                 audit.Sink
 	DuplicateXUIDEnabled  bool
+	Admin                 *AdminConfig
+	Metrics               *MetricsConfig
+	WatchConfig           bool
 	Log                   *slog.Logger
+
+	// user is the configuration this Config was built from, kept to diff
+	// against on reload.
+	user UserConfig
 }
 
 // Config converts the user configuration into a runtime configuration.
 func (c UserConfig) Config(log *slog.Logger) (Config, error) {
-	if len(c.Network.Servers) == 0 {
-		return Config{}, fmt.Errorf("no servers configured")
+	conf, err := c.settings(log)
+	if err != nil {
+		return Config{}, err
 	}
-
-	pollInterval, err := claimDuration(c.Claims.PollInterval, claim.DefaultPollInterval)
+	persistDirectory, persistedMaxAge, err := c.claimPersistence()
 	if err != nil {
-		return Config{}, fmt.Errorf("claims poll interval: %w", err)
+		return Config{}, fmt.Errorf("claims: %w", err)
 	}
-	maxSnapshotAge, err := claimDuration(c.Claims.MaxSnapshotAge, claim.DefaultMaxSnapshotAge)
+	conf.Bans, err = c.banStore(log)
 	if err != nil {
-		return Config{}, fmt.Errorf("claims max snapshot age: %w", err)
+		return Config{}, fmt.Errorf("bans: %w", err)
 	}
-	if maxSnapshotAge < pollInterval {
-		return Config{}, fmt.Errorf("claims max snapshot age must be at least poll interval")
+	conf.Audit, err = c.auditSink(log)
+	if err != nil {
+		return Config{}, fmt.Errorf("audit: %w", err)
 	}
+	pollInterval, maxSnapshotAge := conf.ClaimPollInterval, conf.ClaimMaxSnapshotAge
 
-	conf := Config{
-		SecuredSlots:          c.Network.SecuredSlots,
-		EncryptionKey:         c.Encryption.Key,
-		AuthenticationService: authentication.NewService(log, c.AuthenticationService),
-		VPNService: vpn.NewService(log, service.Config{
-			Enabled: c.VPNService.Enabled,
-			URL:     c.VPNService.URL,
-			Key:     c.VPNService.Key,
-		}, c.VPNService.WhitelistedCIDRs),
-		AFKTimer:             c.afkTimer(),
-		Whitelist:            c.whiteList(log),
-		Border:               c.makeBorder(),
-		ClaimPrefilter:       c.Claims.PrefilterEnabled,
-		ClaimDenyRendering:   c.Claims.DenyRenderingEnabled,
-		ClaimPollInterval:    pollInterval,
-		ClaimMaxSnapshotAge:  maxSnapshotAge,
-		TrafficProtection:    c.TrafficProtection.WithDefaults(),
-		DuplicateXUIDEnabled: c.DuplicateXUID.Enabled,
-		Log:                  log,
-	}
 	session.SetCommandPath(c.Resources.CommandPath)
 
 	err = c.loadCommands(log)
@@ -81,7 +83,16 @@ func (c UserConfig) Config(log *slog.Logger) (Config, error) {
 		return conf, fmt.Errorf("error loading commands: %w", err)
 	}
 
+	dialer := c.dialerFunc(log)
 	for _, server := range c.Network.Servers {
+		backends, err := server.pool()
+		if err != nil {
+			return Config{}, fmt.Errorf("server %s: %w", server.Name, err)
+		}
+		chatRules, signRules, err := server.filters()
+		if err != nil {
+			return Config{}, err
+		}
 		srv := &Server{
 			Name:          server.Name,
 			LocalAddress:  server.LocalAddress,
@@ -95,11 +106,27 @@ func (c UserConfig) Config(log *slog.Logger) (Config, error) {
 				log.With(slog.String("srv", server.Name)),
 			),
 			TrafficMetrics: &session.TrafficMetrics{},
+			Queue:          queue.New(),
+			ChatFilter:     &chatfilter.Filter{},
+			SignFilter:     &chatfilter.Filter{},
 
-			DialerFunc: c.dialerFunc(server.RemoteAddress, log),
+			Backends:   backends,
+			DialerFunc: dialer,
 
 			Log: log.With(slog.String("srv", server.Name)),
 		}
+		for _, path := range server.ClaimFiles {
+			source := claim.NewFileSource(path)
+			if err := srv.ClaimFactory.AddSource(source); err != nil {
+				return Config{}, fmt.Errorf("server %s: claim files: %w", server.Name, err)
+			}
+			srv.ClaimFiles = append(srv.ClaimFiles, source)
+		}
+		if persistDirectory != "" {
+			srv.ClaimFactory.SetPersistence(claimSnapshotPath(persistDirectory, server.Name), persistedMaxAge)
+		}
+		srv.ChatFilter.SetRules(chatRules)
+		srv.SignFilter.SetRules(signRules)
 		motd := server.MOTD
 		if motd == "" {
 			motd = server.Name
@@ -109,7 +136,14 @@ func (c UserConfig) Config(log *slog.Logger) (Config, error) {
 			maxPlayers = 85
 		}
 		srv.StatusProviderFunc = func() (minecraft.ServerStatusProvider, error) {
-			return newProxyStatusProvider(srv, motd, maxPlayers), nil
+			status := newProxyStatusProvider(srv, motd, maxPlayers)
+			if server.OfflineMOTD != "" {
+				status.offlineMOTD = server.OfflineMOTD
+			}
+			if server.MaintenanceMOTD != "" {
+				status.maintenanceMOTD = server.MaintenanceMOTD
+			}
+			return status, nil
 		}
 		srv.ListenerFunc = func() (Listener, error) {
 			return c.listenerFunc(srv)
@@ -119,7 +153,114 @@ func (c UserConfig) Config(log *slog.Logger) (Config, error) {
 	return conf, nil
 }
 
-func claimDuration(value string, fallback time.Duration) (time.Duration, error) {
+// settings converts the settings of c that may change while the proxy runs
+// into a runtime configuration, without servers, ban store or audit log.
+// Unlike Config, it has no side effects, so reloads can call it.
+func (c UserConfig) settings(log *slog.Logger) (Config, error) {
+	if len(c.Network.Servers) == 0 {
+		return Config{}, fmt.Errorf("no servers configured")
+	}
+
+	pollInterval, err := positiveDuration(c.Claims.PollInterval, claim.DefaultPollInterval)
+	if err != nil {
+		return Config{}, fmt.Errorf("claims poll interval: %w", err)
+	}
+	maxSnapshotAge, err := positiveDuration(c.Claims.MaxSnapshotAge, claim.DefaultMaxSnapshotAge)
+	if err != nil {
+		return Config{}, fmt.Errorf("claims max snapshot age: %w", err)
+	}
+	if maxSnapshotAge < pollInterval {
+		return Config{}, fmt.Errorf("claims max snapshot age must be at least poll interval")
+	}
+	claimNotify, err := c.claimNotifyConfig()
+	if err != nil {
+		return Config{}, fmt.Errorf("claims: %w", err)
+	}
+	queueConfig, err := c.queueConfig()
+	if err != nil {
+		return Config{}, fmt.Errorf("queue: %w", err)
+	}
+	reconnect, err := c.reconnectConfig()
+	if err != nil {
+		return Config{}, fmt.Errorf("reconnect: %w", err)
+	}
+	healthCheck, err := c.healthCheckConfig()
+	if err != nil {
+		return Config{}, fmt.Errorf("health check: %w", err)
+	}
+	whiteList, err := c.whiteList()
+	if err != nil {
+		return Config{}, fmt.Errorf("whitelist: %w", err)
+	}
+
+	return Config{
+		SecuredSlots:  c.Network.SecuredSlots,
+		EncryptionKey: c.Encryption.Key,
+		AuthenticationService: authentication.NewService(log, service.Config{
+			Enabled: c.AuthenticationService.Enabled,
+			URL:     c.AuthenticationService.URL,
+			Key:     c.AuthenticationService.Key,
+		}),
+		VPNService: vpn.NewService(log, service.Config{
+			Enabled: c.VPNService.Enabled,
+			URL:     c.VPNService.URL,
+			Key:     c.VPNService.Key,
+		}, c.VPNService.WhitelistedCIDRs),
+		AFKTimer:             c.afkTimer(),
+		Whitelist:            whiteList,
+		Queue:                queueConfig,
+		Border:               c.makeBorder(),
+		ClaimPrefilter:       c.Claims.PrefilterEnabled,
+		ClaimDenyRendering:   c.Claims.DenyRenderingEnabled,
+		ClaimNotify:          claimNotify,
+		ClaimPollInterval:    pollInterval,
+		ClaimMaxSnapshotAge:  maxSnapshotAge,
+		TrafficProtection:    c.TrafficProtection.WithDefaults(),
+		Reconnect:            reconnect,
+		HealthCheck:          healthCheck,
+		DuplicateXUIDEnabled: c.DuplicateXUID.Enabled,
+		Capture:              c.captureConfig(),
+		Admin:                c.adminConfig(),
+		Metrics:              c.metricsConfig(),
+		WatchConfig:          c.Reload.WatchFile,
+		Log:                  log,
+		user:                 c,
+	}, nil
+}
+
+// sessionConfig returns the per-session settings of c. Connections and
+// factories are filled in by the caller.
+func (c *Config) sessionConfig() session.Config {
+	return session.Config{
+		AFKTimer:           c.AFKTimer,
+		Border:             c.Border,
+		ClaimPrefilter:     c.ClaimPrefilter,
+		ClaimDenyRendering: c.ClaimDenyRendering,
+		ClaimNotify:        c.ClaimNotify,
+		Traffic:            c.TrafficProtection,
+		Reconnect:          c.Reconnect,
+		Bans:               c.Bans,
+		Audit:              c.Audit,
+		Log:                c.Log,
+	}
+}
+
+// claimSnapshotPath returns the file the claim snapshot of the server named
+// name is saved to in directory. Characters that are not safe in a file name
+// are replaced.
+func claimSnapshotPath(directory, name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+	return filepath.Join(directory, safe+".json")
+}
+
+// positiveDuration parses value as a positive duration, or returns fallback if
+// it is empty.
+func positiveDuration(value string, fallback time.Duration) (time.Duration, error) {
 	if value == "" {
 		return fallback, nil
 	}
@@ -50,3 +50,15 @@ func TestClaimDurationsDefaultDuringConfigConversion(t *testing.T) {
 		t.Fatalf("missing traffic section did not receive defaults: %+v", runtime.TrafficProtection)
 	}
 }
+
+func TestClaimSnapshotPathIsSafe(t *testing.T) {
+	for name, want := range map[string]string{
+		"Survival":     filepath.Join("claims", "Survival.json"),
+		"Skyblock 2.0": filepath.Join("claims", "Skyblock_2.0.json"),
+		"../../etc":    filepath.Join("claims", ".._.._etc.json"),
+	} {
+		if got := claimSnapshotPath("claims", name); got != want {
+			t.Errorf("claimSnapshotPath(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -3,11 +3,15 @@ package entity
 
 import "github.com/go-gl/mathgl/mgl32"
 
+// ItemActorType is the actor type of item entities lying in the world.
+const ItemActorType = "minecraft:item"
+
 // Entity ...
 type Entity struct {
 	uniqueID  int64
 	runtimeID uint64
 	actorType string
+	itemType  string
 	position  mgl32.Vec3
 }
 
@@ -21,6 +25,14 @@ func NewEntity(uniqueID int64, runtimeID uint64, actorType string, position mgl3
 	}
 }
 
+// NewItem returns an item entity holding an item of itemType, which is empty
+// if the item is not known.
+func NewItem(uniqueID int64, runtimeID uint64, itemType string, position mgl32.Vec3) Entity {
+	e := NewEntity(uniqueID, runtimeID, ItemActorType, position)
+	e.itemType = itemType
+	return e
+}
+
 // UniqueID ...
 func (e Entity) UniqueID() int64 {
 	return e.uniqueID
@@ -40,3 +52,8 @@ func (e Entity) ActorType() string {
 func (e Entity) Position() mgl32.Vec3 {
 	return e.position
 }
+
+// ItemType returns the type of the item an item entity holds.
+func (e Entity) ItemType() string {
+	return e.itemType
+}
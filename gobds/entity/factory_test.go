@@ -27,3 +27,13 @@ func TestFactoryUpdatesPartialPosition(t *testing.T) {
 		t.Fatalf("unexpected entity position: %v", entity.Position())
 	}
 }
+
+func TestFactoryKeepsItemTypeAcrossMoves(t *testing.T) {
+	factory := NewFactory()
+	factory.Add(NewItem(7, 42, "minecraft:diamond", mgl32.Vec3{1, 2, 3}))
+	factory.UpdatePosition(42, mgl32.Vec3{1, 1, 3}, false, true, false)
+	item, ok := factory.ByRuntimeID(42)
+	if !ok || item.ActorType() != ItemActorType || item.ItemType() != "minecraft:diamond" {
+		t.Fatalf("unexpected item entity: %+v", item)
+	}
+}
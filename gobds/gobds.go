@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"net/netip"
 	"os"
 	"os/signal"
@@ -17,6 +19,7 @@ import (
 	"github.com/sandertv/gophertunnel/minecraft"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/text"
+	"github.com/smell-of-curry/gobds/gobds/audit"
 	_ "github.com/smell-of-curry/gobds/gobds/block"
 	"github.com/smell-of-curry/gobds/gobds/entity"
 	"github.com/smell-of-curry/gobds/gobds/service/authentication"
@@ -26,7 +29,9 @@ import (
 
 // GoBDS ...
 type GoBDS struct {
-	conf *Config
+	conf     atomic.Pointer[Config]
+	reloadMu sync.Mutex
+	watch    configWatch
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -46,19 +51,28 @@ func (c *Config) New() (*GoBDS, error) {
 	session.SetupRuntimeIDs()
 
 	gobds := &GoBDS{
-		conf:   c,
 		ctx:    ctx,
 		cancel: cancel,
 	}
+	gobds.conf.Store(c)
 
 	if len(c.Servers) == 0 {
 		return nil, fmt.Errorf("start gobds: no servers configured")
 	}
 	gobds.servers = c.Servers
+	if c.Bans != nil {
+		c.Bans.OnAdd(gobds.enforceBan)
+	}
 
 	return gobds, nil
 }
 
+// config returns the configuration currently in effect. It is replaced as a
+// whole on reload, so callers should read it once per operation.
+func (gb *GoBDS) config() *Config {
+	return gb.conf.Load()
+}
+
 // Listen ...
 func (gb *GoBDS) Listen() error {
 	t := time.Now()
@@ -66,7 +80,14 @@ func (gb *GoBDS) Listen() error {
 		return fmt.Errorf("start gobds: already started")
 	}
 
-	gb.conf.Log.Info("starting gobds", "mc-version", protocol.CurrentVersion)
+	gb.config().Log.Info("starting gobds", "mc-version", protocol.CurrentVersion)
+
+	if gb.config().Admin != nil {
+		go gb.serveAdmin()
+	}
+	if gb.config().Metrics != nil {
+		go gb.serveMetrics()
+	}
 
 	gb.wg.Add(len(gb.servers))
 	for _, srv := range gb.servers {
@@ -74,7 +95,10 @@ func (gb *GoBDS) Listen() error {
 	}
 
 	gb.wg.Wait()
-	gb.conf.Log.Info("proxy closed.", "uptime", time.Since(*gb.started.Load()).String())
+	if closer, ok := gb.config().Audit.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	gb.config().Log.Info("proxy closed.", "uptime", time.Since(*gb.started.Load()).String())
 
 	return nil
 }
@@ -85,12 +109,25 @@ func (gb *GoBDS) listen(srv *Server) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Subscribing first makes sure no change to the claims goes unseen.
+	diffs, unsubscribe := srv.ClaimFactory.Subscribe(claimDiffBuffer)
+	defer unsubscribe()
+	go gb.claimChangeWatching(srv, diffs)
+
+	// A saved snapshot enforces claims until the claim service answers.
+	if err := srv.ClaimFactory.Restore(); err != nil {
+		srv.Log.Error("failed to restore claim snapshot", "err", err)
+	}
 	if !gb.initServer(srv) {
 		gb.wg.Done()
 		return
 	}
 	go gb.claimFetching(srv)
+	go gb.claimStreaming(srv)
+	go gb.claimFileWatching(srv)
 	go gb.afkEvaluator(srv, ctx)
+	go gb.queueDispatcher(srv, ctx)
+	go gb.healthProber(srv, ctx)
 
 	go func() {
 		<-gb.ctx.Done()
@@ -110,8 +147,18 @@ func (gb *GoBDS) listen(srv *Server) {
 		go func() {
 			defer wg.Done()
 			xuid := conn.IdentityData().XUID
-			if gb.conf.DuplicateXUIDEnabled {
+			if gb.config().DuplicateXUIDEnabled {
 				if !srv.ReserveXUID(xuid) {
+					if sink := gb.config().Audit; sink != nil {
+						sink.Record(audit.Event{
+							Time:   time.Now(),
+							Type:   audit.TypeKick,
+							Server: srv.Name,
+							XUID:   xuid,
+							Name:   conn.IdentityData().DisplayName,
+							Reason: audit.KickDuplicateXUID,
+						})
+					}
 					_ = srv.Listener.Disconnect(conn, "This account is already connected.")
 					return
 				}
@@ -119,12 +166,17 @@ func (gb *GoBDS) listen(srv *Server) {
 			}
 
 			s, err := gb.accept(conn, srv, ctx)
+			if errors.Is(err, errTransferred) || errors.Is(err, errLeftQueue) {
+				_ = conn.Close()
+				return
+			}
 			if err != nil {
 				_ = srv.Listener.Disconnect(conn, err.Error())
 				return
 			}
 
 			srv.AddSession(s)
+			gb.captureOnJoin(srv, s)
 			srv.Log.Info("player connected", "name", conn.IdentityData().DisplayName)
 			s.ReadPackets(ctx)
 			srv.RemoveSession(s)
@@ -137,14 +189,21 @@ var errInvalidJoinPath = errors.New("you must join through the server hub to pla
 
 // accept accepts new connection.
 func (gb *GoBDS) accept(conn session.Conn, srv *Server, ctx context.Context) (*session.Session, error) {
+	conf := gb.config()
+	if conf.Bans != nil {
+		if entry, banned := conf.Bans.Match(banTarget(conn), time.Now()); banned {
+			return nil, errors.New(banMessage(entry, time.Now()))
+		}
+	}
 	identityData := conn.IdentityData()
-	if gb.conf.VPNService != nil {
-		if reason, allowed := gb.handleVPN(conn.LocalAddr(), ctx); !allowed {
+	if conf.VPNService != nil {
+		if reason, allowed := gb.handleVPN(conf.VPNService, conn.LocalAddr(), ctx); !allowed {
 			return nil, errors.New(reason)
 		}
 	}
-	if gb.conf.AuthenticationService != nil {
-		response, err := gb.conf.AuthenticationService.AuthenticationOf(identityData.XUID, ctx)
+	var auth *authentication.ResponseModel
+	if conf.AuthenticationService != nil {
+		response, err := conf.AuthenticationService.AuthenticationOf(identityData.XUID, ctx)
 		if err != nil {
 			disconnectionMessage := err.Error()
 			if errors.Is(err, authentication.ErrRecordNotFound) {
@@ -155,6 +214,7 @@ func (gb *GoBDS) accept(conn session.Conn, srv *Server, ctx context.Context) (*s
 		if !response.Allowed {
 			return nil, errInvalidJoinPath
 		}
+		auth = response
 	}
 
 	identityData = conn.IdentityData()
@@ -162,38 +222,68 @@ func (gb *GoBDS) accept(conn session.Conn, srv *Server, ctx context.Context) (*s
 	clientData.SelfSignedID = selfSignedIDFromXUID(identityData.XUID)
 
 	displayName := identityData.DisplayName
-	if !gb.handleWhitelisted(displayName) {
+	if !handleWhitelisted(conf, displayName) {
 		return nil, fmt.Errorf("you're not whitelisted")
 	}
-	if auth := gb.conf.AuthenticationService; auth != nil && !auth.Enabled {
-		if !gb.handleSecureSlots(srv, displayName) {
+	if err := admissionError(srv); err != nil {
+		return nil, err
+	}
+	if conf.Queue != nil {
+		if err := gb.waitForSlot(conf, conn, srv, auth, ctx); err != nil {
+			return nil, err
+		}
+	} else if securedSlotsApply(conf) {
+		if !handleSecureSlots(conf, srv, displayName) {
 			return nil, fmt.Errorf("the server is at full capacity")
 		}
 	}
 
+	backend, err := srv.Backends.Acquire()
+	if err != nil {
+		srv.Log.Warn("no backend available", "name", displayName)
+		if err := admissionError(srv); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no server is available right now, please try again later")
+	}
+	dial := func(ctx context.Context) (session.Conn, error) {
+		return srv.DialerFunc(backend.Address(), identityData, clientData, ctx)
+	}
 	ctx2, cancel := context.WithTimeout(ctx, time.Minute)
 
 	defer cancel()
-	serverConn, err := srv.DialerFunc(identityData, clientData, ctx2)
+	serverConn, err := dial(ctx2)
 	if err != nil {
-		srv.Log.Error("error dialing connection", "err", err)
+		backend.Release()
+		srv.Log.Error("error dialing connection", "backend", backend.Address(), "err", err)
 		return nil, fmt.Errorf("error dialing connection")
 	}
 
-	return gb.startGame(conn, serverConn, srv, ctx)
+	s, err := gb.startGame(conf, conn, serverConn, backend.Address(), dial, srv, ctx)
+	if err != nil {
+		backend.Release()
+	}
+	return s, err
 }
 
 // handleWhitelisted ensures that only whitelisted players can join.
-func (gb *GoBDS) handleWhitelisted(displayName string) bool {
-	if gb.conf.Whitelist == nil {
+func handleWhitelisted(conf *Config, displayName string) bool {
+	if conf.Whitelist == nil {
 		return true
 	}
-	return gb.conf.Whitelist.Has(displayName)
+	return conf.Whitelist.Has(displayName)
+}
+
+// securedSlotsApply reports whether slots are secured for whitelisted
+// players: only with the whitelist on and the authentication service off.
+func securedSlotsApply(conf *Config) bool {
+	service := conf.AuthenticationService
+	return conf.Whitelist != nil && service != nil && !service.Enabled
 }
 
 // handleSecureSlots secures slots for some whitelisted players.
-func (gb *GoBDS) handleSecureSlots(srv *Server, displayName string) bool {
-	if gb.conf.Whitelist == nil {
+func handleSecureSlots(conf *Config, srv *Server, displayName string) bool {
+	if conf.Whitelist == nil {
 		// We depend on the whitelist config to handle secured slots.
 		return true
 	}
@@ -204,23 +294,23 @@ func (gb *GoBDS) handleSecureSlots(srv *Server, displayName string) bool {
 		return false
 	}
 
-	securedSlots := gb.conf.SecuredSlots
+	securedSlots := conf.SecuredSlots
 	securedLimit := limit - securedSlots
 	if current < securedLimit {
 		return true
 	}
-	return gb.conf.Whitelist.Has(displayName)
+	return conf.Whitelist.Has(displayName)
 }
 
 // handleVPN protects proxy from vpn/proxy users.
-func (gb *GoBDS) handleVPN(netAddr net.Addr, ctx context.Context) (reason string, allowed bool) {
+func (gb *GoBDS) handleVPN(vpnService *vpn.Service, netAddr net.Addr, ctx context.Context) (reason string, allowed bool) {
 	addr, _ := netip.ParseAddrPort(netAddr.String())
 	addrString := addr.Addr().String()
 	if addrString == "127.0.0.1" || addrString == "0.0.0.0" || addrString == "localhost" {
 		return "", true
 	}
 
-	m, err := gb.conf.VPNService.CheckIP(addrString, ctx)
+	m, err := vpnService.CheckIP(addrString, ctx)
 	if err != nil {
 		return err.Error(), false
 	}
@@ -230,8 +320,16 @@ func (gb *GoBDS) handleVPN(netAddr net.Addr, ctx context.Context) (reason string
 	return "VPN/Proxy connections are not allowed.", !m.Proxy
 }
 
-// startGame starts game for new connection.
-func (gb *GoBDS) startGame(conn, serverConn session.Conn, srv *Server, ctx context.Context) (*session.Session, error) {
+// startGame starts game for new connection to backend. dial is used to
+// reattach the session if its backend connection is lost.
+func (gb *GoBDS) startGame(
+	conf *Config,
+	conn, serverConn session.Conn,
+	backend string,
+	dial func(ctx context.Context) (session.Conn, error),
+	srv *Server,
+	ctx context.Context,
+) (*session.Session, error) {
 	gameData := serverConn.GameData()
 	gameData.WorldSeed = 0
 	gameData.ClientSideGeneration = false
@@ -243,7 +341,7 @@ func (gb *GoBDS) startGame(conn, serverConn session.Conn, srv *Server, ctx conte
 		if err := conn.StartGameContext(ctx, gameData); err != nil {
 			var disc minecraft.DisconnectError
 			if ok := errors.As(err, &disc); !ok {
-				gb.conf.Log.Error("start game failed", "err", err)
+				conf.Log.Error("start game failed", "err", err)
 			}
 			failed = true
 		}
@@ -253,7 +351,7 @@ func (gb *GoBDS) startGame(conn, serverConn session.Conn, srv *Server, ctx conte
 		if err := serverConn.DoSpawnContext(ctx); err != nil {
 			var disc minecraft.DisconnectError
 			if ok := errors.As(err, &disc); !ok {
-				gb.conf.Log.Error("spawn failed", "err", err)
+				conf.Log.Error("spawn failed", "err", err)
 			}
 			failed = true
 		}
@@ -266,31 +364,46 @@ func (gb *GoBDS) startGame(conn, serverConn session.Conn, srv *Server, ctx conte
 		return nil, fmt.Errorf("failed to start game")
 	}
 
-	s := session.Config{
-		Client: conn,
-		Server: serverConn,
-
-		AFKTimer: gb.conf.AFKTimer,
-
-		// EntityFactory must be per-session: each session has its own backend connection
-		// and BDS issues runtime IDs scoped to that connection. Sharing this map between
-		// sessions causes runtime-ID collisions where one session's lookup returns another
-		// session's entity, swapping Pokémon/item names on SetActorData (issue #53).
-		EntityFactory: entity.NewFactory(),
-		ClaimFactory:  srv.ClaimFactory,
-
-		Border:             gb.conf.Border,
-		ClaimPrefilter:     gb.conf.ClaimPrefilter,
-		ClaimDenyRendering: gb.conf.ClaimDenyRendering,
-		Traffic:            gb.conf.TrafficProtection,
-		TrafficMetrics:     srv.TrafficMetrics,
-		Log:                gb.conf.Log,
-	}.New()
-
-	s.ForwardXUID(gb.conf.EncryptionKey)
+	c := conf.sessionConfig()
+	c.Client = conn
+	c.Server = serverConn
+	c.ServerName = srv.Name
+	c.Backend = backend
+	c.Redial = dial
+	c.EncryptionKey = conf.EncryptionKey
+
+	// EntityFactory must be per-session: each session has its own backend connection
+	// and BDS issues runtime IDs scoped to that connection. Sharing this map between
+	// sessions causes runtime-ID collisions where one session's lookup returns another
+	// session's entity, swapping Pokémon/item names on SetActorData (issue #53).
+	c.EntityFactory = entity.NewFactory()
+	c.ClaimFactory = srv.ClaimFactory
+	c.TrafficMetrics = srv.TrafficMetrics
+	c.ChatFilter = srv.ChatFilter
+	c.SignFilter = srv.SignFilter
+	s := c.New()
+
+	s.ForwardXUID(conf.EncryptionKey)
 	return s, nil
 }
 
+// serveHTTP runs an HTTP server on addr until the proxy closes.
+func (gb *GoBDS) serveHTTP(name, addr string, handler http.Handler) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-gb.ctx.Done()
+		_ = srv.Close()
+	}()
+	gb.config().Log.Info(name+" running.", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		gb.config().Log.Error(name+" stopped", "err", err)
+	}
+}
+
 // Close closes all listeners.
 func (gb *GoBDS) Close() error {
 	gb.cancel()
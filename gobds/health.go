@@ -0,0 +1,138 @@
+package gobds
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/health"
+	"github.com/smell-of-curry/gobds/gobds/pool"
+)
+
+// HealthCheckConfig configures how backends are probed.
+type HealthCheckConfig struct {
+	// Interval is the delay between probes of a backend.
+	Interval time.Duration
+	// Timeout is how long a probe waits for the backend to answer.
+	Timeout time.Duration
+	// FailureThreshold is the number of failed probes in a row after which a
+	// backend is considered down.
+	FailureThreshold int
+}
+
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultFailureThreshold    = 3
+	// healthCheckIdleInterval is how often a disabled prober checks whether a
+	// reload enabled it.
+	healthCheckIdleInterval = 5 * time.Second
+)
+
+// healthProber pings every backend of srv until ctx is done and marks those
+// that stop answering as unhealthy, so admission and the server list stop
+// offering them. The config is read on every round so a reload can enable,
+// disable or retune probing.
+func (gb *GoBDS) healthProber(srv *Server, ctx context.Context) {
+	for {
+		interval := healthCheckIdleInterval
+		if conf := gb.config().HealthCheck; conf != nil {
+			probeBackends(ctx, srv, conf)
+			interval = conf.Interval
+		} else {
+			for _, backend := range srv.Backends.Backends() {
+				backend.Health().Reset()
+				backend.SetHealthy(true)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// probeBackends pings every backend of srv at once and records the results.
+func probeBackends(ctx context.Context, srv *Server, conf *HealthCheckConfig) {
+	var wg sync.WaitGroup
+	for _, backend := range srv.Backends.Backends() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, conf.Timeout)
+			latency, err := health.Ping(probeCtx, backend.Address())
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if !backend.Health().Record(latency, err, conf.FailureThreshold, time.Now()) {
+				return
+			}
+			status := backend.Health().Status()
+			backend.SetHealthy(status.State != health.StateDown)
+			if status.State == health.StateDown {
+				srv.Log.Warn("backend is down", "backend", backend.Address(), "failures", status.ConsecutiveFailures, "err", err)
+			} else {
+				srv.Log.Info("backend is up", "backend", backend.Address(), "latency", status.Latency)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+var (
+	errServerOffline     = errors.New("the server is offline right now, please try again later")
+	errServerMaintenance = errors.New("the server is under maintenance, please try again later")
+)
+
+// availability is whether a server can take new players.
+type availability int
+
+const (
+	available availability = iota
+	// maintenance is a server whose reachable backends are all draining.
+	maintenance
+	// offline is a server whose backends are all down.
+	offline
+)
+
+// availabilityOf returns the availability of a pool of backends. Full
+// backends still count as available; the queue or capacity checks handle
+// those.
+func availabilityOf(p *pool.Pool) availability {
+	if p == nil {
+		return available
+	}
+	up, draining := 0, 0
+	for _, backend := range p.Backends() {
+		if !backend.Healthy() {
+			continue
+		}
+		up++
+		if backend.Draining() {
+			draining++
+		}
+	}
+	switch {
+	case up == 0:
+		return offline
+	case draining == up:
+		return maintenance
+	}
+	return available
+}
+
+// admissionError returns the error players joining srv are disconnected with
+// while it cannot take them, or nil if it can.
+func admissionError(srv *Server) error {
+	switch availabilityOf(srv.Backends) {
+	case offline:
+		return errServerOffline
+	case maintenance:
+		return errServerMaintenance
+	}
+	return nil
+}
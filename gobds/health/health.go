@@ -0,0 +1,115 @@
+// Package health tracks whether backend servers are up by pinging them over
+// RakNet.
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sandertv/go-raknet"
+)
+
+// State is the health of a backend as last determined by probing.
+type State int
+
+const (
+	// StateUnknown is the state of a backend that has not answered or failed
+	// enough probes to be judged yet. It is treated as up.
+	StateUnknown State = iota
+	// StateUp is the state of a backend that answered its last probe.
+	StateUp
+	// StateDown is the state of a backend that failed as many probes in a row
+	// as the failure threshold.
+	StateDown
+)
+
+// String ...
+func (s State) String() string {
+	switch s {
+	case StateUp:
+		return "up"
+	case StateDown:
+		return "down"
+	}
+	return "unknown"
+}
+
+// Status is a snapshot of the probe results of a backend.
+type Status struct {
+	State State
+	// Latency is the round trip time of the last successful probe.
+	Latency time.Duration
+	// ConsecutiveFailures is the number of probes that failed since the last
+	// one that succeeded.
+	ConsecutiveFailures int
+	// LastProbe is when the backend was last probed, or zero if it never was.
+	LastProbe time.Time
+	// LastError is the error of the last failed probe, if the last probe
+	// failed.
+	LastError string
+}
+
+// Tracker accumulates the probe results of a single backend. It is safe for
+// concurrent use.
+type Tracker struct {
+	mu     sync.Mutex
+	status Status
+}
+
+// Status returns the current status of the backend.
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// Reset forgets every probe result, returning the backend to StateUnknown.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = Status{}
+}
+
+// Record records the result of a probe made at now. A nil err is a success
+// with the latency passed. The backend goes down once failureThreshold probes
+// in a row have failed, and back up on the next success. Record reports
+// whether the state of the backend changed.
+func (t *Tracker) Record(latency time.Duration, err error, failureThreshold int, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous := t.status.State
+	t.status.LastProbe = now
+	if err == nil {
+		t.status.State = StateUp
+		t.status.Latency = latency
+		t.status.ConsecutiveFailures = 0
+		t.status.LastError = ""
+		return previous != StateUp
+	}
+	t.status.ConsecutiveFailures++
+	t.status.LastError = err.Error()
+	if t.status.ConsecutiveFailures >= max(failureThreshold, 1) {
+		t.status.State = StateDown
+	}
+	return previous != t.status.State
+}
+
+// Ping sends a RakNet unconnected ping to address and returns the round trip
+// time. ctx should carry a deadline, as a lost ping is otherwise waited for
+// indefinitely.
+//
+// Any pong counts as an answer. Some BDS builds reply with a pong that carries
+// no server list payload, which go-raknet fails to decode, but the backend is
+// still up.
+func Ping(ctx context.Context, address string) (time.Duration, error) {
+	start := time.Now()
+	_, err := raknet.PingContext(ctx, address)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,79 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTrackerGoesDownAfterThreshold(t *testing.T) {
+	var tr Tracker
+	now := time.Now()
+	failure := errors.New("timeout")
+
+	if tr.Status().State != StateUnknown {
+		t.Fatalf("new tracker must be unknown, got %s", tr.Status().State)
+	}
+	for i := 1; i < 3; i++ {
+		if tr.Record(0, failure, 3, now) {
+			t.Fatalf("failure %d changed the state before the threshold", i)
+		}
+	}
+	if !tr.Record(0, failure, 3, now) || tr.Status().State != StateDown {
+		t.Fatalf("expected the third failure to take the backend down, got %+v", tr.Status())
+	}
+	if status := tr.Status(); status.ConsecutiveFailures != 3 || status.LastError != "timeout" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if tr.Record(0, failure, 3, now) {
+		t.Fatal("further failures must not report a change")
+	}
+
+	if !tr.Record(20*time.Millisecond, nil, 3, now) {
+		t.Fatal("a success must bring the backend back up")
+	}
+	status := tr.Status()
+	if status.State != StateUp || status.ConsecutiveFailures != 0 || status.Latency != 20*time.Millisecond || status.LastError != "" {
+		t.Fatalf("unexpected status after recovery %+v", status)
+	}
+}
+
+func TestPingAcceptsPongWithoutPayload(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp unavailable: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		_, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// A pong with its ID but without a payload, as sent by BDS builds
+		// that are not visible on LAN.
+		_, _ = conn.WriteTo([]byte{0x1c}, addr)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := Ping(ctx, conn.LocalAddr().String()); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+}
+
+func TestPingFailsWithoutAnswer(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := Ping(ctx, conn.LocalAddr().String()); err == nil {
+		t.Fatal("ping of a silent address must fail")
+	}
+}
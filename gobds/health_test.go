@@ -0,0 +1,71 @@
+package gobds
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/health"
+	"github.com/smell-of-curry/gobds/gobds/pool"
+)
+
+func TestAvailabilityFollowsBackends(t *testing.T) {
+	a, b := pool.NewBackend("a", 1, 0), pool.NewBackend("b", 1, 0)
+	p, err := pool.New(pool.LeastConnections, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Backends: p}
+	status := newProxyStatusProvider(srv, "Lobby", 10)
+
+	if got := availabilityOf(p); got != available || admissionError(srv) != nil {
+		t.Fatalf("healthy pool reported %v", got)
+	}
+	a.SetHealthy(false)
+	b.SetDraining(true)
+	if got := availabilityOf(p); got != maintenance || !errors.Is(admissionError(srv), errServerMaintenance) {
+		t.Fatalf("pool with only draining reachable backends reported %v", got)
+	}
+	if name := status.ServerStatus(-1, -1).ServerName; name != status.maintenanceMOTD {
+		t.Fatalf("server list shows %q during maintenance", name)
+	}
+	b.SetHealthy(false)
+	if got := availabilityOf(p); got != offline || !errors.Is(admissionError(srv), errServerOffline) {
+		t.Fatalf("pool with every backend down reported %v", got)
+	}
+	if name := status.ServerStatus(-1, -1).ServerName; name != status.offlineMOTD {
+		t.Fatalf("server list shows %q while offline", name)
+	}
+	a.SetHealthy(true)
+	if name := status.ServerStatus(-1, -1).ServerName; name != "Lobby" {
+		t.Fatalf("server list shows %q once a backend is back", name)
+	}
+}
+
+func TestProbeBackendsMarksSilentBackendsDown(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	backend := pool.NewBackend(conn.LocalAddr().String(), 1, 0)
+	p, err := pool.New(pool.LeastConnections, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Backends: p, Log: slog.Default()}
+	conf := &HealthCheckConfig{Timeout: 50 * time.Millisecond, FailureThreshold: 2}
+
+	probeBackends(context.Background(), srv, conf)
+	if !backend.Healthy() || backend.Health().Status().ConsecutiveFailures != 1 {
+		t.Fatalf("backend went down before the threshold: %+v", backend.Health().Status())
+	}
+	probeBackends(context.Background(), srv, conf)
+	if backend.Healthy() || backend.Health().Status().State != health.StateDown {
+		t.Fatalf("backend still up after reaching the threshold: %+v", backend.Health().Status())
+	}
+}
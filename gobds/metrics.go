@@ -0,0 +1,95 @@
+package gobds
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/smell-of-curry/gobds/gobds/util/exposition"
+)
+
+// MetricsConfig configures the Prometheus metrics endpoint.
+type MetricsConfig struct {
+	// Address is the HTTP address serving /metrics.
+	Address string
+	// Key, if set, must be sent as a bearer token in the authorization header
+	// of every scrape.
+	Key string
+}
+
+// serveMetrics runs the metrics endpoint until the proxy closes.
+func (gb *GoBDS) serveMetrics() {
+	conf := gb.config()
+	if conf.Metrics.Key == "" && !loopbackAddress(conf.Metrics.Address) {
+		conf.Log.Warn("metrics endpoint has no key and is reachable beyond this host", "address", conf.Metrics.Address)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", gb.metricsAuthenticated(http.HandlerFunc(gb.handleMetrics)))
+	gb.serveHTTP("metrics endpoint", conf.Metrics.Address, mux)
+}
+
+// metricsAuthenticated rejects scrapes that do not carry the configured key,
+// if there is one.
+func (gb *GoBDS) metricsAuthenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := gb.config().Metrics.Key
+		provided := r.Header.Get("authorization")
+		if key != "" && subtle.ConstantTimeCompare([]byte(provided), []byte("Bearer "+key)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopbackAddress reports whether the host of the listen address addr only
+// accepts connections from this host.
+func loopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+// handleMetrics writes the cumulative claim, traffic and session metrics of
+// every server in the Prometheus text format.
+func (gb *GoBDS) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	r := exposition.NewRegistry()
+	for _, srv := range gb.servers {
+		r.Gauge("gobds_sessions", "Live sessions.", float64(len(srv.Sessions())), exposition.L("server", srv.Name))
+		if srv.Backends != nil {
+			for _, backend := range srv.Backends.Backends() {
+				labels := []exposition.Label{exposition.L("server", srv.Name), exposition.L("backend", backend.Address())}
+				r.Gauge("gobds_backend_sessions", "Live sessions per backend.", float64(backend.Sessions()), labels...)
+				r.Gauge("gobds_backend_draining", "Whether a backend is refusing new sessions.", boolGauge(backend.Draining()), labels...)
+				status := backend.Health().Status()
+				r.Gauge("gobds_backend_up", "Whether a backend is answering health probes.", boolGauge(backend.Healthy()), labels...)
+				r.Gauge("gobds_backend_latency_seconds", "Round trip time of the last answered health probe.", status.Latency.Seconds(), labels...)
+				r.Gauge("gobds_backend_probe_failures", "Health probes failed in a row.", float64(status.ConsecutiveFailures), labels...)
+			}
+		}
+		if srv.Queue != nil {
+			r.Gauge("gobds_queue_waiting", "Players waiting in the join queue.", float64(srv.Queue.Len()), exposition.L("server", srv.Name))
+		}
+		if srv.ClaimFactory != nil {
+			srv.ClaimFactory.Metrics().Collect(r, snapshotOf(srv.ClaimFactory))
+		}
+		srv.TrafficMetrics.Collect(r, srv.Name)
+	}
+	w.Header().Set("content-type", exposition.ContentType)
+	_, _ = r.WriteTo(w)
+}
+
+// boolGauge returns 1 for true and 0 for false.
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
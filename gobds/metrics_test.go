@@ -0,0 +1,104 @@
+package gobds
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/claim"
+	"github.com/smell-of-curry/gobds/gobds/pool"
+	"github.com/smell-of-curry/gobds/gobds/queue"
+	"github.com/smell-of-curry/gobds/gobds/service"
+	"github.com/smell-of-curry/gobds/gobds/session"
+)
+
+func TestMetricsEndpointExposesEveryServer(t *testing.T) {
+	gb := &GoBDS{servers: []*Server{
+		{
+			Name:           "A",
+			ClaimFactory:   claim.NewFactory(service.Config{}, "A", time.Second, time.Minute, slog.Default()),
+			TrafficMetrics: &session.TrafficMetrics{},
+			Queue:          queue.New(),
+		},
+		{Name: "B", TrafficMetrics: &session.TrafficMetrics{}, Backends: testMetricsPool(t)},
+	}}
+	recorder := httptest.NewRecorder()
+	gb.handleMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`gobds_sessions{server="A"} 0`,
+		`gobds_sessions{server="B"} 0`,
+		`gobds_queue_waiting{server="A"} 0`,
+		`gobds_backend_sessions{server="B",backend="127.0.0.1:19133"} 0`,
+		`gobds_backend_draining{server="B",backend="127.0.0.1:19133"} 0`,
+		`gobds_backend_up{server="B",backend="127.0.0.1:19133"} 1`,
+		`gobds_backend_probe_failures{server="B",backend="127.0.0.1:19133"} 0`,
+		`gobds_claim_refresh_attempts_total{server="A"} 0`,
+		`gobds_traffic_observed_total{server="B",category="chat"} 0`,
+		`gobds_chat_filter_actions_total{server="B",action="mute"} 0`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Fatalf("missing %q in:\n%s", want, body)
+		}
+	}
+	if strings.Count(body, "# TYPE gobds_sessions gauge") != 1 {
+		t.Fatal("metric family written more than once")
+	}
+}
+
+func testMetricsPool(t *testing.T) *pool.Pool {
+	t.Helper()
+	p, err := pool.New(pool.LeastConnections, pool.NewBackend("127.0.0.1:19133", 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestMetricsEndpointRequiresConfiguredKey(t *testing.T) {
+	gb := &GoBDS{}
+	gb.conf.Store(&Config{Metrics: &MetricsConfig{Address: "0.0.0.0:9100", Key: "scrape"}})
+	handler := gb.metricsAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for authorization, want := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"scrape":        http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Bearer scrape": http.StatusOK,
+	} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		request.Header.Set("authorization", authorization)
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != want {
+			t.Fatalf("authorization %q: status %d, want %d", authorization, recorder.Code, want)
+		}
+	}
+
+	gb.conf.Store(&Config{Metrics: &MetricsConfig{Address: "127.0.0.1:9100"}})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("endpoint without a key refused a scrape: %d", recorder.Code)
+	}
+}
+
+func TestLoopbackAddress(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:9100": true,
+		"[::1]:9100":     true,
+		"localhost:9100": true,
+		"0.0.0.0:9100":   false,
+		":9100":          false,
+		"10.0.0.5:9100":  false,
+		"invalid":        false,
+	} {
+		if got := loopbackAddress(addr); got != want {
+			t.Fatalf("loopbackAddress(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package pool selects the backend server a new session is sent to when one
+// listener fronts several identical backends.
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/smell-of-curry/gobds/gobds/health"
+)
+
+// Strategy decides which available backend receives the next session.
+type Strategy string
+
+const (
+	// LeastConnections picks the backend with the fewest sessions. Ties go to
+	// the backend with the higher weight, then to the one listed first.
+	LeastConnections Strategy = "least-connections"
+	// Weighted spreads sessions across backends in proportion to their weights
+	// using smooth weighted round-robin.
+	Weighted Strategy = "weighted"
+)
+
+// ParseStrategy returns the strategy named s. An empty name is
+// LeastConnections.
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case "", LeastConnections:
+		return LeastConnections, nil
+	case Weighted:
+		return Weighted, nil
+	}
+	return "", fmt.Errorf("unknown balancing strategy %q, expected %q or %q", s, LeastConnections, Weighted)
+}
+
+// ErrNoBackend is returned by Acquire when every backend is draining,
+// unhealthy or full.
+var ErrNoBackend = errors.New("no backend available")
+
+// Backend is a single backend server in a Pool. Its state is safe for
+// concurrent use.
+type Backend struct {
+	address    string
+	maxPlayers int
+
+	weight    atomic.Int32
+	draining  atomic.Bool
+	unhealthy atomic.Bool
+	sessions  atomic.Int32
+
+	health health.Tracker
+
+	// current is the smooth weighted round-robin state. Pool.mu must be held.
+	current int
+}
+
+// NewBackend returns a healthy backend at address. A weight below 1 is 1, and
+// a maxPlayers of 0 or less means the backend has no session limit of its own.
+func NewBackend(address string, weight, maxPlayers int) *Backend {
+	b := &Backend{address: address, maxPlayers: maxPlayers}
+	b.SetWeight(weight)
+	return b
+}
+
+// Address returns the address the backend is dialed at.
+func (b *Backend) Address() string {
+	return b.address
+}
+
+// MaxPlayers returns the session limit of the backend, or 0 if it has none.
+func (b *Backend) MaxPlayers() int {
+	return max(b.maxPlayers, 0)
+}
+
+// Weight returns the share of new sessions the backend receives relative to
+// the other backends of its pool.
+func (b *Backend) Weight() int {
+	return int(b.weight.Load())
+}
+
+// SetWeight changes the weight of the backend. A weight below 1 is 1.
+func (b *Backend) SetWeight(weight int) {
+	b.weight.Store(int32(max(weight, 1)))
+}
+
+// Draining reports whether the backend is refusing new sessions.
+func (b *Backend) Draining() bool {
+	return b.draining.Load()
+}
+
+// SetDraining stops or resumes sending new sessions to the backend. Sessions
+// already on it are left alone.
+func (b *Backend) SetDraining(draining bool) {
+	b.draining.Store(draining)
+}
+
+// Healthy reports whether the backend was last seen up.
+func (b *Backend) Healthy() bool {
+	return !b.unhealthy.Load()
+}
+
+// SetHealthy marks the backend up or down. Down backends receive no new
+// sessions.
+func (b *Backend) SetHealthy(healthy bool) {
+	b.unhealthy.Store(!healthy)
+}
+
+// Health returns the probe results of the backend.
+func (b *Backend) Health() *health.Tracker {
+	return &b.health
+}
+
+// Sessions returns the number of sessions acquired on the backend and not yet
+// released.
+func (b *Backend) Sessions() int {
+	return int(b.sessions.Load())
+}
+
+// Release gives back a session acquired on the backend.
+func (b *Backend) Release() {
+	b.sessions.Add(-1)
+}
+
+// available reports whether the backend can take a new session.
+func (b *Backend) available() bool {
+	return !b.Draining() && b.Healthy() && (b.maxPlayers <= 0 || b.Sessions() < b.maxPlayers)
+}
+
+// Pool is a set of interchangeable backends. It is safe for concurrent use.
+type Pool struct {
+	strategy Strategy
+	backends []*Backend
+
+	mu sync.Mutex
+}
+
+// New returns a pool of backends using strategy. Backend addresses must be
+// unique.
+func New(strategy Strategy, backends ...*Backend) (*Pool, error) {
+	if _, err := ParseStrategy(string(strategy)); err != nil {
+		return nil, err
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("pool needs at least one backend")
+	}
+	seen := make(map[string]struct{}, len(backends))
+	for _, b := range backends {
+		if _, ok := seen[b.address]; ok {
+			return nil, fmt.Errorf("duplicate backend %s", b.address)
+		}
+		seen[b.address] = struct{}{}
+	}
+	return &Pool{strategy: strategy, backends: backends}, nil
+}
+
+// Strategy returns the strategy the pool selects backends with.
+func (p *Pool) Strategy() Strategy {
+	return p.strategy
+}
+
+// Backends returns every backend in the pool in configuration order.
+func (p *Pool) Backends() []*Backend {
+	return append([]*Backend(nil), p.backends...)
+}
+
+// Backend returns the backend at address.
+func (p *Pool) Backend(address string) (*Backend, bool) {
+	for _, b := range p.backends {
+		if b.address == address {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// Acquire selects an available backend and counts a new session on it. The
+// caller must Release the backend once the session ends or fails to start.
+func (p *Pool) Acquire() (*Backend, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var picked *Backend
+	switch p.strategy {
+	case Weighted:
+		picked = p.nextWeighted()
+	default:
+		picked = p.leastConnections()
+	}
+	if picked == nil {
+		return nil, ErrNoBackend
+	}
+	picked.sessions.Add(1)
+	return picked, nil
+}
+
+// leastConnections returns the available backend with the fewest sessions.
+// p.mu must be held.
+func (p *Pool) leastConnections() *Backend {
+	var picked *Backend
+	for _, b := range p.backends {
+		if !b.available() {
+			continue
+		}
+		if picked == nil ||
+			b.Sessions() < picked.Sessions() ||
+			b.Sessions() == picked.Sessions() && b.Weight() > picked.Weight() {
+			picked = b
+		}
+	}
+	return picked
+}
+
+// nextWeighted returns the next available backend in smooth weighted
+// round-robin order. p.mu must be held.
+func (p *Pool) nextWeighted() *Backend {
+	var picked *Backend
+	total := 0
+	for _, b := range p.backends {
+		if !b.available() {
+			continue
+		}
+		b.current += b.Weight()
+		total += b.Weight()
+		if picked == nil || b.current > picked.current {
+			picked = b
+		}
+	}
+	if picked != nil {
+		picked.current -= total
+	}
+	return picked
+}
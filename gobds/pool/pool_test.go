@@ -0,0 +1,84 @@
+package pool
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestLeastConnectionsBalancesSessions(t *testing.T) {
+	a, b := NewBackend("a", 1, 0), NewBackend("b", 2, 0)
+	p, err := New(LeastConnections, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for range 4 {
+		picked, err := p.Acquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, picked.Address())
+	}
+	// Ties go to the heavier backend.
+	if want := []string{"b", "a", "b", "a"}; !slices.Equal(order, want) {
+		t.Fatalf("picked %v, want %v", order, want)
+	}
+	a.Release()
+	if picked, _ := p.Acquire(); picked != a {
+		t.Fatalf("picked %s after a released a session, want a", picked.Address())
+	}
+}
+
+func TestWeightedFollowsWeights(t *testing.T) {
+	a, b := NewBackend("a", 3, 0), NewBackend("b", 1, 0)
+	p, err := New(Weighted, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for range 8 {
+		picked, err := p.Acquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[picked.Address()]++
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Fatalf("unexpected distribution %v", counts)
+	}
+}
+
+func TestAcquireSkipsUnavailableBackends(t *testing.T) {
+	draining, down, full := NewBackend("draining", 1, 0), NewBackend("down", 1, 0), NewBackend("full", 1, 1)
+	p, err := New(LeastConnections, draining, down, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draining.SetDraining(true)
+	down.SetHealthy(false)
+
+	if picked, err := p.Acquire(); err != nil || picked != full {
+		t.Fatalf("picked %v err=%v, want full", picked, err)
+	}
+	if _, err = p.Acquire(); !errors.Is(err, ErrNoBackend) {
+		t.Fatalf("expected ErrNoBackend once every backend is unavailable, got %v", err)
+	}
+
+	draining.SetDraining(false)
+	if picked, err := p.Acquire(); err != nil || picked != draining {
+		t.Fatalf("picked %v err=%v after undraining, want draining", picked, err)
+	}
+}
+
+func TestNewRejectsInvalidPools(t *testing.T) {
+	if _, err := New(LeastConnections); err == nil {
+		t.Fatal("an empty pool must be rejected")
+	}
+	if _, err := New(LeastConnections, NewBackend("a", 1, 0), NewBackend("a", 1, 0)); err == nil {
+		t.Fatal("duplicate backends must be rejected")
+	}
+	if _, err := ParseStrategy("random"); err == nil {
+		t.Fatal("unknown strategies must be rejected")
+	}
+}
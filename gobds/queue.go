@@ -0,0 +1,260 @@
+package gobds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sandertv/gophertunnel/minecraft/text"
+	"github.com/smell-of-curry/gobds/gobds/queue"
+	"github.com/smell-of-curry/gobds/gobds/service/authentication"
+	"github.com/smell-of-curry/gobds/gobds/session"
+)
+
+// QueueConfig configures the join queue of full servers.
+type QueueConfig struct {
+	// UpdateInterval is how often waiting players are told their position.
+	UpdateInterval time.Duration
+	// ReservationTimeout is how long an admitted player's slot is held while
+	// they reconnect.
+	ReservationTimeout time.Duration
+	// WhitelistPriority is the priority of whitelisted players.
+	WhitelistPriority int
+	// RolePriorities maps authentication service roles to priorities.
+	RolePriorities map[string]int
+}
+
+// priority returns the queue priority of a player: the highest of the
+// whitelist, role and authentication service priorities that apply.
+func (c *QueueConfig) priority(whitelisted bool, auth *authentication.ResponseModel) int {
+	var priority int
+	if whitelisted {
+		priority = c.WhitelistPriority
+	}
+	if auth != nil {
+		priority = max(priority, auth.QueuePriority)
+		for _, role := range auth.Roles {
+			priority = max(priority, c.RolePriorities[role])
+		}
+	}
+	return priority
+}
+
+const (
+	// defaultQueueUpdateInterval is how often queued players are told their
+	// position when no interval is configured.
+	defaultQueueUpdateInterval = 2 * time.Second
+	// defaultReservationTimeout is how long an admitted player's slot is held
+	// when no timeout is configured.
+	defaultReservationTimeout = 30 * time.Second
+	// queueDispatchInterval is how often free slots are handed to queued players.
+	queueDispatchInterval = time.Second
+)
+
+var (
+	// errTransferred is returned by accept once a queued player has been sent
+	// back to the proxy to take their reserved slot.
+	errTransferred = errors.New("transferred to a reserved slot")
+	// errLeftQueue is returned by accept when a queued player disconnects.
+	errLeftQueue = errors.New("left the queue")
+)
+
+// queueDispatcher admits queued players as slots free up, for the lifetime of
+// the listen loop.
+func (gb *GoBDS) queueDispatcher(srv *Server, ctx context.Context) {
+	t := time.NewTicker(queueDispatchInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			gb.admitQueued(srv)
+		}
+	}
+}
+
+// admitQueued hands every free slot of srv to the first queued player that may
+// take it. When the queue is disabled by a reload, everyone still waiting is
+// admitted.
+func (gb *GoBDS) admitQueued(srv *Server) {
+	if srv.Queue.Len() == 0 {
+		return
+	}
+	conf := gb.config()
+	now := time.Now()
+	hold := defaultReservationTimeout
+	if conf.Queue != nil {
+		hold = conf.Queue.ReservationTimeout
+	}
+
+	status := srv.StatusProvider.ServerStatus(-1, -1)
+	occupied := status.PlayerCount + srv.Queue.Reserved(now)
+	admitted := srv.Queue.Admit(now, hold, func(t *queue.Ticket) bool {
+		if conf.Queue != nil && occupied >= slotLimit(conf, status.MaxPlayers, t.Secured) {
+			return false
+		}
+		occupied++
+		return true
+	})
+	for _, t := range admitted {
+		srv.Log.Info("admitting queued player", "name", t.Name, "priority", t.Priority)
+	}
+}
+
+// waitForSlot returns once conn may join srv. If the server is full the
+// player waits in the queue, held in an empty world, and is transferred back
+// to the proxy once a slot is reserved for them; errTransferred is returned
+// in that case.
+func (gb *GoBDS) waitForSlot(
+	conf *Config,
+	conn session.Conn,
+	srv *Server,
+	auth *authentication.ResponseModel,
+	ctx context.Context,
+) error {
+	identityData := conn.IdentityData()
+	now := time.Now()
+	if srv.Queue.Claim(identityData.XUID, now) {
+		return nil
+	}
+	secured := conf.Whitelist != nil && conf.Whitelist.Has(identityData.DisplayName)
+	status := srv.StatusProvider.ServerStatus(-1, -1)
+	if srv.Queue.Len() == 0 && status.PlayerCount+srv.Queue.Reserved(now) < slotLimit(conf, status.MaxPlayers, secured) {
+		return nil
+	}
+
+	ticket := queue.NewTicket(
+		identityData.XUID,
+		identityData.DisplayName,
+		conf.Queue.priority(secured, auth),
+		secured,
+	)
+	srv.Queue.Join(ticket)
+	defer srv.Queue.Leave(ticket)
+	srv.Log.Info("player queued", "name", ticket.Name, "position", srv.Queue.Position(ticket))
+
+	if err := startLimbo(conn, ctx); err != nil {
+		return fmt.Errorf("failed to join the queue")
+	}
+	// Drain the client so the connection stays healthy and a disconnect is
+	// noticed while the player waits.
+	left := make(chan struct{})
+	go func() {
+		defer close(left)
+		for {
+			if _, err := conn.ReadPacket(); err != nil {
+				return
+			}
+		}
+	}()
+
+	_ = conn.WritePacket(&packet.SetTitle{
+		ActionType: packet.TitleActionSetTitle,
+		Text:       text.Colourf("<yellow>Server full</yellow>"),
+	})
+	updates := time.NewTicker(conf.Queue.UpdateInterval)
+	defer updates.Stop()
+	for {
+		sendQueuePosition(conn, srv.Queue, ticket)
+		select {
+		case <-ctx.Done():
+			return errors.New("proxy closed")
+		case <-left:
+			srv.Log.Info("player left the queue", "name", ticket.Name)
+			return errLeftQueue
+		case <-ticket.Admitted():
+			host, port, ok := transferAddress(conn, srv)
+			if !ok {
+				return fmt.Errorf("a slot is free, please reconnect")
+			}
+			_ = conn.WritePacket(&packet.Transfer{Address: host, Port: port})
+			return errTransferred
+		case <-updates.C:
+		}
+	}
+}
+
+// slotLimit returns how many players may be on a server before a player is
+// queued. Only secured players may use the secured slots, which apply when
+// they do without the queue, see securedSlotsApply.
+func slotLimit(conf *Config, maxPlayers int, secured bool) int {
+	if secured || !securedSlotsApply(conf) {
+		return maxPlayers
+	}
+	return maxPlayers - conf.SecuredSlots
+}
+
+// sendQueuePosition shows a queued player their position and estimated wait.
+func sendQueuePosition(conn session.Conn, q *queue.Queue, t *queue.Ticket) {
+	position := q.Position(t)
+	if position == 0 {
+		return
+	}
+	message := text.Colourf("<grey>Position in queue:</grey> <yellow>%d</yellow><grey>/%d</grey>", position, q.Len())
+	if eta, ok := q.ETA(position); ok {
+		message += text.Colourf(" <grey>(%s)</grey>", formatQueueETA(eta))
+	}
+	_ = conn.WritePacket(&packet.SetTitle{
+		ActionType: packet.TitleActionSetActionBar,
+		Text:       message,
+	})
+}
+
+// formatQueueETA formats a wait estimate in whole minutes.
+func formatQueueETA(eta time.Duration) string {
+	if eta < time.Minute {
+		return "less than a minute"
+	}
+	if minutes := int(eta.Round(time.Minute) / time.Minute); minutes > 1 {
+		return fmt.Sprintf("about %d minutes", minutes)
+	}
+	return "about a minute"
+}
+
+// transferAddress returns the address a queued player is sent back to: the
+// address they dialed, or the server's listen address if that is usable.
+func transferAddress(conn session.Conn, srv *Server) (host string, port uint16, ok bool) {
+	for _, address := range []string{conn.ClientData().ServerAddress, srv.LocalAddress} {
+		h, p, err := net.SplitHostPort(address)
+		if err != nil || h == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(h); err == nil && addr.IsUnspecified() {
+			continue
+		}
+		portNumber, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			continue
+		}
+		return h, uint16(portNumber), true
+	}
+	return "", 0, false
+}
+
+// startLimbo spawns a queued player in an empty world.
+func startLimbo(conn session.Conn, ctx context.Context) error {
+	position := mgl32.Vec3{0, session.LimboY, 0}
+	err := conn.StartGameContext(ctx, minecraft.GameData{
+		WorldName:       "Queue",
+		EntityUniqueID:  1,
+		EntityRuntimeID: 1,
+		PlayerGameMode:  packet.GameTypeAdventure,
+		WorldGameMode:   packet.GameTypeAdventure,
+		PlayerPosition:  position,
+		Time:            6000,
+	})
+	if err != nil {
+		return err
+	}
+	session.SendVoid(conn, 0, position)
+	return nil
+}
@@ -0,0 +1,168 @@
+// Package queue orders players waiting for a slot on a full server.
+package queue
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// etaSamples is how many recent admissions the ETA estimate is based on.
+const etaSamples = 20
+
+// Ticket is a single player's place in a Queue.
+type Ticket struct {
+	XUID string
+	Name string
+	// Priority orders tickets: higher priorities are admitted first and equal
+	// priorities in join order.
+	Priority int
+	// Secured tickets may be admitted into secured slots.
+	Secured bool
+
+	admitted chan struct{}
+}
+
+// NewTicket ...
+func NewTicket(xuid, name string, priority int, secured bool) *Ticket {
+	return &Ticket{
+		XUID:     xuid,
+		Name:     name,
+		Priority: priority,
+		Secured:  secured,
+		admitted: make(chan struct{}),
+	}
+}
+
+// Admitted is closed once the ticket has been admitted and its slot reserved.
+func (t *Ticket) Admitted() <-chan struct{} {
+	return t.admitted
+}
+
+// Queue is a priority queue of tickets plus the slots reserved for admitted
+// players until they reconnect. It is safe for concurrent use.
+type Queue struct {
+	mu           sync.Mutex
+	waiting      []*Ticket
+	reservations map[string]time.Time
+	admissions   []time.Time
+}
+
+// New ...
+func New() *Queue {
+	return &Queue{reservations: make(map[string]time.Time)}
+}
+
+// Join adds t to the queue.
+func (q *Queue) Join(t *Ticket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Insert after every ticket of the same or a higher priority.
+	i := sort.Search(len(q.waiting), func(i int) bool {
+		return q.waiting[i].Priority < t.Priority
+	})
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[i+1:], q.waiting[i:])
+	q.waiting[i] = t
+}
+
+// Leave removes t from the queue if it is still waiting.
+func (q *Queue) Leave(t *Ticket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if i := q.index(t); i >= 0 {
+		q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+	}
+}
+
+// Position returns the 1-based position of t, or 0 if it is not waiting.
+func (q *Queue) Position(t *Ticket) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.index(t) + 1
+}
+
+// Len returns the number of waiting tickets.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
+
+// Admit admits the tickets claim accepts, in queue order. claim reports
+// whether a slot is free for the ticket and takes it if so; a ticket it
+// refuses keeps its place, and the tickets behind it are still offered a slot,
+// since some slots may only be taken by some tickets. Each admitted ticket
+// gets a slot reserved for its XUID until now+hold, and its Admitted channel
+// is closed.
+func (q *Queue) Admit(now time.Time, hold time.Duration, claim func(t *Ticket) bool) []*Ticket {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var admitted []*Ticket
+	waiting := q.waiting[:0]
+	for _, t := range q.waiting {
+		if !claim(t) {
+			waiting = append(waiting, t)
+			continue
+		}
+		if t.XUID != "" {
+			q.reservations[t.XUID] = now.Add(hold)
+		}
+		q.admissions = append(q.admissions, now)
+		if len(q.admissions) > etaSamples {
+			q.admissions = q.admissions[len(q.admissions)-etaSamples:]
+		}
+		close(t.admitted)
+		admitted = append(admitted, t)
+	}
+	clear(q.waiting[len(waiting):])
+	q.waiting = waiting
+	return admitted
+}
+
+// Claim consumes the slot reserved for xuid, reporting whether there was one.
+func (q *Queue) Claim(xuid string, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	until, ok := q.reservations[xuid]
+	delete(q.reservations, xuid)
+	return ok && now.Before(until)
+}
+
+// Reserved returns the number of slots still reserved at now.
+func (q *Queue) Reserved(now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for xuid, until := range q.reservations {
+		if !now.Before(until) {
+			delete(q.reservations, xuid)
+		}
+	}
+	return len(q.reservations)
+}
+
+// ETA estimates how long the ticket at position will wait, based on the rate
+// of recent admissions. ok is false until there is enough history.
+func (q *Queue) ETA(position int) (eta time.Duration, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if position <= 0 || len(q.admissions) < 2 {
+		return 0, false
+	}
+	span := q.admissions[len(q.admissions)-1].Sub(q.admissions[0])
+	if span <= 0 {
+		return 0, false
+	}
+	perAdmission := span / time.Duration(len(q.admissions)-1)
+	return perAdmission * time.Duration(position), true
+}
+
+// index returns the index of t in the waiting list, or -1. q.mu must be held.
+func (q *Queue) index(t *Ticket) int {
+	for i, waiting := range q.waiting {
+		if waiting == t {
+			return i
+		}
+	}
+	return -1
+}
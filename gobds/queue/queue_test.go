@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueueOrdersByPriorityThenJoinOrder(t *testing.T) {
+	q := New()
+	first := NewTicket("1", "first", 0, false)
+	second := NewTicket("2", "second", 0, false)
+	vip := NewTicket("3", "vip", 5, false)
+	staff := NewTicket("4", "staff", 10, true)
+	for _, ticket := range []*Ticket{first, second, vip, staff} {
+		q.Join(ticket)
+	}
+
+	for want, ticket := range []*Ticket{staff, vip, first, second} {
+		if got := q.Position(ticket); got != want+1 {
+			t.Fatalf("%s at position %d, want %d", ticket.Name, got, want+1)
+		}
+	}
+	q.Leave(vip)
+	if q.Position(vip) != 0 || q.Position(first) != 2 || q.Len() != 3 {
+		t.Fatal("leaving did not shift the queue")
+	}
+}
+
+func TestQueueAdmitReservesSlots(t *testing.T) {
+	q := New()
+	now := time.Now()
+	secured := NewTicket("1", "staff", 1, true)
+	regular := NewTicket("2", "player", 0, false)
+	q.Join(regular)
+	q.Join(secured)
+
+	// One slot free, and only secured tickets may take it.
+	free := 1
+	admitted := q.Admit(now, time.Minute, func(t *Ticket) bool {
+		if free == 0 || !t.Secured {
+			return false
+		}
+		free--
+		return true
+	})
+	if len(admitted) != 1 || admitted[0] != secured {
+		t.Fatalf("unexpected admissions %+v", admitted)
+	}
+	select {
+	case <-secured.Admitted():
+	default:
+		t.Fatal("admitted ticket was not signalled")
+	}
+	select {
+	case <-regular.Admitted():
+		t.Fatal("waiting ticket was signalled")
+	default:
+	}
+
+	if q.Reserved(now) != 1 || q.Reserved(now.Add(time.Minute)) != 0 {
+		t.Fatal("reservation must last exactly for the hold duration")
+	}
+	q.Admit(now, time.Minute, func(*Ticket) bool { return true })
+	if q.Claim("2", now.Add(2*time.Minute)) {
+		t.Fatal("expired reservation must not be claimable")
+	}
+	q.Admit(now, time.Minute, func(*Ticket) bool { return true })
+	if q.Len() != 0 || q.Reserved(now) != 0 {
+		t.Fatal("queue must be empty after admitting everyone")
+	}
+}
+
+func TestQueueAdmitSkipsRefusedTickets(t *testing.T) {
+	q := New()
+	regular := NewTicket("1", "player", 1, false)
+	secured := NewTicket("2", "staff", 0, true)
+	last := NewTicket("3", "other", 0, false)
+	q.Join(regular)
+	q.Join(secured)
+	q.Join(last)
+
+	// The only free slot is secured, and the regular ticket at the head of the
+	// queue may not take it.
+	admitted := q.Admit(time.Now(), time.Minute, func(t *Ticket) bool { return t.Secured })
+	if len(admitted) != 1 || admitted[0] != secured {
+		t.Fatalf("unexpected admissions %+v", admitted)
+	}
+	if q.Len() != 2 || q.Position(regular) != 1 || q.Position(last) != 2 {
+		t.Fatal("refused tickets did not keep their order")
+	}
+}
+
+func TestQueueClaimConsumesReservation(t *testing.T) {
+	q := New()
+	now := time.Now()
+	q.Join(NewTicket("1", "player", 0, false))
+	q.Admit(now, time.Minute, func(*Ticket) bool { return true })
+	if !q.Claim("1", now) || q.Claim("1", now) {
+		t.Fatal("a reservation must be claimable exactly once")
+	}
+}
+
+func TestQueueETA(t *testing.T) {
+	q := New()
+	now := time.Now()
+	if _, ok := q.ETA(1); ok {
+		t.Fatal("ETA without history must be unknown")
+	}
+	for i := range 3 {
+		q.Join(NewTicket("", "player", 0, false))
+		q.Admit(now.Add(time.Duration(i)*10*time.Second), time.Minute, func(*Ticket) bool { return true })
+	}
+	if eta, ok := q.ETA(3); !ok || eta != 30*time.Second {
+		t.Fatalf("eta = %s ok=%v, want 30s", eta, ok)
+	}
+}
@@ -0,0 +1,66 @@
+package gobds
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/service"
+	"github.com/smell-of-curry/gobds/gobds/service/authentication"
+	"github.com/smell-of-curry/gobds/gobds/whitelist"
+)
+
+func TestQueuePriority(t *testing.T) {
+	c := &QueueConfig{WhitelistPriority: 10, RolePriorities: map[string]int{"vip": 5, "staff": 20}}
+	tests := []struct {
+		whitelisted bool
+		auth        *authentication.ResponseModel
+		want        int
+	}{
+		{false, nil, 0},
+		{true, nil, 10},
+		{false, &authentication.ResponseModel{Roles: []string{"vip"}}, 5},
+		{true, &authentication.ResponseModel{Roles: []string{"vip", "staff"}}, 20},
+		{false, &authentication.ResponseModel{Roles: []string{"unknown"}, QueuePriority: 7}, 7},
+	}
+	for _, test := range tests {
+		if got := c.priority(test.whitelisted, test.auth); got != test.want {
+			t.Fatalf("priority(%v, %+v) = %d, want %d", test.whitelisted, test.auth, got, test.want)
+		}
+	}
+}
+
+func TestSlotLimitKeepsSecuredSlots(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	conf := &Config{SecuredSlots: 5, AuthenticationService: authentication.NewService(log, service.Config{})}
+	if got := slotLimit(conf, 50, false); got != 50 {
+		t.Fatalf("limit without whitelist = %d, want 50", got)
+	}
+	conf.Whitelist = whitelist.NewWhitelist(nil)
+	if got := slotLimit(conf, 50, false); got != 45 {
+		t.Fatalf("unsecured limit = %d, want 45", got)
+	}
+	if got := slotLimit(conf, 50, true); got != 50 {
+		t.Fatalf("secured limit = %d, want 50", got)
+	}
+	// Like without the queue, slots are only secured while the
+	// authentication service is off.
+	conf.AuthenticationService = authentication.NewService(log, service.Config{Enabled: true})
+	if got := slotLimit(conf, 50, false); got != 50 {
+		t.Fatalf("limit with authentication = %d, want 50", got)
+	}
+}
+
+func TestFormatQueueETA(t *testing.T) {
+	tests := map[time.Duration]string{
+		20 * time.Second: "less than a minute",
+		70 * time.Second: "about a minute",
+		5 * time.Minute:  "about 5 minutes",
+	}
+	for eta, want := range tests {
+		if got := formatQueueETA(eta); got != want {
+			t.Fatalf("formatQueueETA(%s) = %q, want %q", eta, got, want)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package gobds
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
+)
+
+// configReloadDebounce groups the burst of file events an editor produces
+// while saving into a single reload.
+const configReloadDebounce = 500 * time.Millisecond
+
+// restartOnlyKeys are the UserConfig keys that are bound when the proxy
+// starts: listeners, dialers, resource packs, claim polling, the audit log and
+// the HTTP endpoints. Per-server claim services are the exception, see
+// restartOnly.
+var restartOnlyKeys = []string{
+	"Network.ServerRegion",
+	"Network.Servers",
+	"Network.MaxRenderDistance",
+	"Network.FlushRate",
+	"Network.SentryDSN",
+	"Bans",
+	"Claims.PollInterval",
+	"Claims.MaxSnapshotAge",
+	"Claims.PersistEnabled",
+	"Claims.PersistDirectory",
+	"Claims.PersistedMaxAge",
+	"Resources",
+	"Admin",
+	"Metrics",
+	"Reload",
+	"Audit",
+}
+
+// secretKeys are field names whose values are never logged.
+var secretKeys = []string{"Key", "SentryDSN"}
+
+// configChange is a single setting that differs between two user configs.
+type configChange struct {
+	Key      string
+	Old, New string
+	// Restart is true when the change can only take effect after a restart.
+	Restart bool
+}
+
+// ReloadOnChange reloads the configuration on SIGHUP and, when enabled, on
+// every change to config.toml or a chat or sign filter rule file. Failed
+// reloads are logged and leave the running configuration untouched.
+func (gb *GoBDS) ReloadOnChange() {
+	log := gb.config().Log
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	if gb.config().WatchConfig {
+		w, err := fsnotify.NewWatcher()
+		if err == nil {
+			err = gb.watch.start(w, gb.config().user)
+		}
+		if err != nil {
+			log.Error("failed to watch config, only SIGHUP reloads", "err", err)
+		} else {
+			events, errs = w.Events, w.Errors
+		}
+	}
+
+	go func() {
+		defer signal.Stop(signals)
+		defer gb.watch.close()
+		var pending *time.Timer
+		for {
+			select {
+			case <-gb.ctx.Done():
+				if pending != nil {
+					pending.Stop()
+				}
+				return
+			case <-signals:
+				gb.reload("signal")
+			case event := <-events:
+				if !gb.watch.watches(event.Name) ||
+					!(event.Has(fsnotify.Write) || event.Has(fsnotify.Create)) {
+					continue
+				}
+				if pending != nil {
+					pending.Stop()
+				}
+				pending = time.AfterFunc(configReloadDebounce, func() {
+					gb.reload("file change")
+				})
+			case err := <-errs:
+				log.Error("config watch error", "err", err)
+			}
+		}
+	}()
+}
+
+// configWatch holds the files whose changes trigger a reload: config.toml and
+// the chat and sign filter rule files it names, which are reloaded along with
+// it.
+type configWatch struct {
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	files   map[string]struct{}
+	dirs    map[string]struct{}
+}
+
+// start watches the files of user with watcher. The watcher is closed along
+// with the watch, or right away if watching fails.
+func (w *configWatch) start(watcher *fsnotify.Watcher, user UserConfig) error {
+	w.mu.Lock()
+	w.watcher, w.dirs = watcher, make(map[string]struct{})
+	w.mu.Unlock()
+	if err := w.update(user); err != nil {
+		w.close()
+		return err
+	}
+	return nil
+}
+
+// update replaces the watched files with those of user. It does nothing
+// unless the watch was started.
+func (w *configWatch) update(user UserConfig) error {
+	files := map[string]struct{}{filepath.Clean(configPath): {}}
+	for _, server := range user.Network.Servers {
+		for _, path := range []string{server.ChatFilterPath, server.SignFilterPath} {
+			if path != "" {
+				files[filepath.Clean(path)] = struct{}{}
+			}
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watcher == nil {
+		return nil
+	}
+	w.files = files
+	// Editors usually replace a file rather than write it in place, which
+	// drops a watch on the file itself, so watch its directory.
+	for path := range files {
+		dir := filepath.Dir(path)
+		if _, ok := w.dirs[dir]; ok {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			return err
+		}
+		w.dirs[dir] = struct{}{}
+	}
+	return nil
+}
+
+// watches reports whether a change to the file at path triggers a reload.
+func (w *configWatch) watches(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.files[filepath.Clean(path)]
+	return ok
+}
+
+// close stops watching files.
+func (w *configWatch) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watcher != nil {
+		_ = w.watcher.Close()
+		w.watcher, w.files, w.dirs = nil, nil, nil
+	}
+}
+
+// reload runs Reload and logs its outcome.
+func (gb *GoBDS) reload(trigger string) {
+	if err := gb.Reload(); err != nil {
+		gb.config().Log.Error("config reload failed", "trigger", trigger, "err", err)
+	}
+}
+
+// Reload reads config.toml again and applies it to the running proxy.
+func (gb *GoBDS) Reload() error {
+	user, err := ReadConfig()
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	return gb.applyUserConfig(user)
+}
+
+// applyUserConfig rebuilds the runtime configuration from user and applies it
+// to every server and live session. The reload is refused as a whole when a
+// restart-only setting changed, so an edit is never half applied.
+func (gb *GoBDS) applyUserConfig(user UserConfig) error {
+	gb.reloadMu.Lock()
+	defer gb.reloadMu.Unlock()
+
+	current := gb.config()
+	changes := diffUserConfig(current.user, user)
+	var restart []string
+	for _, change := range changes {
+		if change.Restart {
+			restart = append(restart, change.Key)
+		}
+	}
+	if len(restart) > 0 {
+		return fmt.Errorf("restart required to change %s", strings.Join(restart, ", "))
+	}
+
+	next, err := user.settings(current.Log)
+	if err != nil {
+		return fmt.Errorf("rebuild config: %w", err)
+	}
+	// Rule files are loaded before anything is applied, so a broken one
+	// leaves every server as it was.
+	chatRules := make([]*chatfilter.Ruleset, len(user.Network.Servers))
+	signRules := make([]*chatfilter.Ruleset, len(user.Network.Servers))
+	for i, server := range user.Network.Servers {
+		if chatRules[i], signRules[i], err = server.filters(); err != nil {
+			return fmt.Errorf("rebuild config: %w", err)
+		}
+	}
+	// Servers own the listeners, sessions and claim snapshots, so the running
+	// ones are kept and only their claim services, backends and chat and sign
+	// filter rules are updated. The ban store is kept too, since it holds bans
+	// added at runtime, and so is the audit log, which may have a file open.
+	next.Servers = current.Servers
+	next.Bans = current.Bans
+	next.Audit = current.Audit
+	for i, srv := range next.Servers {
+		claimService := user.Network.Servers[i].ClaimService
+		if claimService != current.user.Network.Servers[i].ClaimService && srv.ClaimFactory != nil {
+			srv.ClaimFactory.SetService(claimService)
+		}
+		if srv.ChatFilter != nil {
+			srv.ChatFilter.SetRules(chatRules[i])
+			srv.SignFilter.SetRules(signRules[i])
+		}
+		reconfigureBackends(srv, current.user.Network.Servers[i].Backends, user.Network.Servers[i].Backends)
+	}
+	gb.conf.Store(&next)
+	// Rule files named for the first time are watched from now on.
+	if err := gb.watch.update(user); err != nil {
+		next.Log.Error("failed to watch filter rule files", "err", err)
+	}
+
+	settings := next.sessionConfig()
+	var sessions int
+	for _, srv := range gb.servers {
+		for _, s := range srv.Sessions() {
+			s.Reconfigure(settings)
+			sessions++
+		}
+	}
+	for _, change := range changes {
+		next.Log.Info("config changed", "key", change.Key, "old", change.Old, "new", change.New)
+	}
+	next.Log.Info("config reloaded", "changes", len(changes), "sessions", sessions)
+	return nil
+}
+
+// reconfigureBackends applies changed drain and weight settings to the pool of
+// srv. Settings that did not change in the file are left alone, so a backend
+// drained through the admin API stays drained across unrelated reloads.
+func reconfigureBackends(srv *Server, old, updated []BackendConfig) {
+	if srv.Backends == nil {
+		return
+	}
+	for i, c := range updated {
+		backend, ok := srv.Backends.Backend(c.Address)
+		if !ok || i >= len(old) {
+			continue
+		}
+		if c.Drain != old[i].Drain {
+			backend.SetDraining(c.Drain)
+		}
+		if c.Weight != old[i].Weight {
+			backend.SetWeight(c.Weight)
+		}
+	}
+}
+
+// diffUserConfig lists every setting that differs between old and updated,
+// sorted by key. Secret values are redacted.
+func diffUserConfig(old, updated UserConfig) []configChange {
+	before, after := make(map[string]string), make(map[string]string)
+	flattenConfig("", reflect.ValueOf(old), before)
+	flattenConfig("", reflect.ValueOf(updated), after)
+
+	keys := make([]string, 0, len(after))
+	for key := range after {
+		keys = append(keys, key)
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	var changes []configChange
+	for _, key := range keys {
+		oldValue, hadOld := before[key]
+		newValue, hasNew := after[key]
+		if hadOld == hasNew && oldValue == newValue {
+			continue
+		}
+		changes = append(changes, configChange{
+			Key:     key,
+			Old:     displayConfigValue(key, oldValue, hadOld),
+			New:     displayConfigValue(key, newValue, hasNew),
+			Restart: restartOnly(key),
+		})
+	}
+	return changes
+}
+
+// flattenConfig writes every leaf of v into out, keyed by its dotted path.
+func flattenConfig(prefix string, v reflect.Value, out map[string]string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			key := field.Name
+			if prefix != "" {
+				key = prefix + "." + field.Name
+			}
+			flattenConfig(key, v.Field(i), out)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			flattenConfig(prefix+"["+strconv.Itoa(i)+"]", v.Index(i), out)
+		}
+	case reflect.String:
+		out[prefix] = strconv.Quote(v.String())
+	default:
+		out[prefix] = fmt.Sprint(v.Interface())
+	}
+}
+
+// displayConfigValue returns the loggable form of a setting value.
+func displayConfigValue(key, value string, present bool) string {
+	switch {
+	case !present:
+		return "<unset>"
+	case slices.Contains(secretKeys, key[strings.LastIndex(key, ".")+1:]):
+		return "<redacted>"
+	}
+	return value
+}
+
+// restartOnly reports whether a change to key needs a restart.
+func restartOnly(key string) bool {
+	if strings.HasPrefix(key, "Network.Servers[") && strings.Contains(key, "].ClaimService.") {
+		// A new server index still needs a restart; its other keys catch that.
+		return false
+	}
+	if strings.HasPrefix(key, "Network.Servers[") &&
+		(strings.HasSuffix(key, "].ChatFilterPath") || strings.HasSuffix(key, "].SignFilterPath")) {
+		return false
+	}
+	if strings.HasPrefix(key, "Network.Servers[") && strings.Contains(key, "].Backends[") &&
+		(strings.HasSuffix(key, ".Drain") || strings.HasSuffix(key, ".Weight")) {
+		// Likewise, a new backend is caught by its address.
+		return false
+	}
+	for _, prefix := range restartOnlyKeys {
+		if key == prefix || strings.HasPrefix(key, prefix+".") || strings.HasPrefix(key, prefix+"[") {
+			return true
+		}
+	}
+	return false
+}
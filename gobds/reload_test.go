@@ -0,0 +1,272 @@
+package gobds
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func testReloadUserConfig(t *testing.T) UserConfig {
+	t.Helper()
+	config := DefaultConfig()
+	config.Resources.CommandPath = filepath.Join(t.TempDir(), "commands.json")
+	if err := os.WriteFile(config.Resources.CommandPath, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func testReloadProxy(t *testing.T, user UserConfig) *GoBDS {
+	t.Helper()
+	conf, err := user.Config(slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gb := &GoBDS{servers: conf.Servers}
+	gb.conf.Store(&conf)
+	return gb
+}
+
+func TestDiffUserConfigClassifiesAndRedactsChanges(t *testing.T) {
+	old := DefaultConfig()
+	updated := DefaultConfig()
+	updated.Border.MaxX = 1000
+	updated.Network.Servers[0].LocalAddress = "0.0.0.0:19132"
+	updated.Network.Servers[0].ClaimService.URL = "http://claims.internal/fetch"
+	updated.AuthenticationService.Key = "rotated"
+	updated.VPNService.WhitelistedCIDRs = nil
+
+	changes := make(map[string]configChange)
+	for _, change := range diffUserConfig(old, updated) {
+		changes[change.Key] = change
+	}
+	if len(changes) != 5 {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	want := map[string]bool{
+		"Border.MaxX":                         false,
+		"Network.Servers[0].LocalAddress":     true,
+		"Network.Servers[0].ClaimService.URL": false,
+		"AuthenticationService.Key":           false,
+		"VPNService.WhitelistedCIDRs[0]":      false,
+	}
+	for key, restart := range want {
+		change, ok := changes[key]
+		if !ok || change.Restart != restart {
+			t.Fatalf("%s: got %+v, want restart=%v", key, change, restart)
+		}
+	}
+	if key := changes["AuthenticationService.Key"]; key.Old != "<redacted>" || key.New != "<redacted>" {
+		t.Fatalf("key leaked into diff: %+v", key)
+	}
+	if cidr := changes["VPNService.WhitelistedCIDRs[0]"]; cidr.New != "<unset>" {
+		t.Fatalf("removed entry not reported as unset: %+v", cidr)
+	}
+	if border := changes["Border.MaxX"]; border.Old != "0" || border.New != "1000" {
+		t.Fatalf("unexpected border change: %+v", border)
+	}
+}
+
+func TestReloadAppliesLiveSettings(t *testing.T) {
+	user := testReloadUserConfig(t)
+	gb := testReloadProxy(t, user)
+	servers := gb.config().Servers
+
+	user.Border.Enabled = true
+	user.Border.MaxX, user.Border.MaxZ = 100, 100
+	user.Claims.DenyRenderingEnabled = true
+	user.AFKTimer.Enabled = false
+	user.Network.SecuredSlots = 5
+	user.TrafficProtection.Enforce = true
+	user.Network.Servers[0].ClaimService.URL = "http://claims.internal/fetch"
+	if err := gb.applyUserConfig(user); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := gb.config()
+	if conf.Border == nil || !conf.ClaimDenyRendering || conf.AFKTimer != nil ||
+		conf.SecuredSlots != 5 || !conf.TrafficProtection.Enforce {
+		t.Fatalf("reload not applied: %+v", conf)
+	}
+	if len(conf.Servers) != 1 || conf.Servers[0] != servers[0] {
+		t.Fatal("reload must keep the running servers")
+	}
+	if settings := conf.sessionConfig(); settings.Border != conf.Border || !settings.Traffic.Enforce {
+		t.Fatalf("session settings not derived from the reloaded config: %+v", settings)
+	}
+}
+
+func TestReloadDoesNotRerunStartup(t *testing.T) {
+	user := testReloadUserConfig(t)
+	gb := testReloadProxy(t, user)
+	// Commands are only loaded on start, which recreates a missing file.
+	if err := os.Remove(user.Resources.CommandPath); err != nil {
+		t.Fatal(err)
+	}
+
+	user.Network.SecuredSlots = 5
+	if err := gb.applyUserConfig(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(user.Resources.CommandPath); !os.IsNotExist(err) {
+		t.Fatalf("reload loaded commands again: %v", err)
+	}
+}
+
+func TestReloadRefusesRestartOnlyChanges(t *testing.T) {
+	user := testReloadUserConfig(t)
+	gb := testReloadProxy(t, user)
+	before := gb.config()
+
+	user.Network.SecuredSlots = 5
+	user.Network.Servers[0].LocalAddress = "0.0.0.0:19132"
+	user.Metrics.Enabled = true
+	err := gb.applyUserConfig(user)
+	if err == nil {
+		t.Fatal("listener address change must be refused")
+	}
+	for _, key := range []string{"Network.Servers[0].LocalAddress", "Metrics.Enabled"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Fatalf("error %q does not name %s", err, key)
+		}
+	}
+	if gb.config() != before || gb.config().SecuredSlots != 0 {
+		t.Fatal("refused reload must leave the running config untouched")
+	}
+}
+
+func TestReloadDrainsBackends(t *testing.T) {
+	user := testReloadUserConfig(t)
+	user.Network.Servers[0].RemoteAddress = ""
+	user.Network.Servers[0].Backends = []BackendConfig{
+		{Address: "127.0.0.1:19133"},
+		{Address: "127.0.0.1:19134"},
+	}
+	gb := testReloadProxy(t, user)
+	backends := gb.config().Servers[0].Backends.Backends()
+	// Drained through the admin API, not in the file.
+	backends[1].SetDraining(true)
+
+	user.Network.Servers[0].Backends = []BackendConfig{
+		{Address: "127.0.0.1:19133", Drain: true, Weight: 3},
+		{Address: "127.0.0.1:19134"},
+	}
+	if err := gb.applyUserConfig(user); err != nil {
+		t.Fatal(err)
+	}
+	if !backends[0].Draining() || backends[0].Weight() != 3 {
+		t.Fatal("changed drain and weight settings not applied")
+	}
+	if !backends[1].Draining() {
+		t.Fatal("unchanged drain setting must not undo a drain from the admin API")
+	}
+
+	user.Network.Servers[0].Backends[1].Address = "127.0.0.1:19135"
+	if err := gb.applyUserConfig(user); err == nil {
+		t.Fatal("replacing a backend must need a restart")
+	}
+}
+
+func TestReloadSwapsChatFilterRules(t *testing.T) {
+	user := testReloadUserConfig(t)
+	gb := testReloadProxy(t, user)
+	filter := gb.config().Servers[0].ChatFilter
+	if filter.Rules() != nil {
+		t.Fatal("servers without a rule file must not filter chat")
+	}
+
+	path := filepath.Join(t.TempDir(), "chat.json")
+	if err := os.WriteFile(path, []byte(`{"words": [{"action": "drop", "entries": ["bad"]}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	user.Network.Servers[0].ChatFilterPath = path
+	if err := gb.applyUserConfig(user); err != nil {
+		t.Fatal(err)
+	}
+	rules := filter.Rules()
+	if gb.config().Servers[0].ChatFilter != filter || rules == nil {
+		t.Fatal("rule file not applied to the running server")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"words": [{"action": "shout"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := gb.applyUserConfig(user); err == nil {
+		t.Fatal("invalid rule file must fail the reload")
+	}
+	if filter.Rules() != rules {
+		t.Fatal("failed reload must keep the running rules")
+	}
+}
+
+func TestReloadWatchesNewFilterFiles(t *testing.T) {
+	user := testReloadUserConfig(t)
+	gb := testReloadProxy(t, user)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gb.watch.start(watcher, user); err != nil {
+		t.Fatal(err)
+	}
+	defer gb.watch.close()
+
+	path := filepath.Join(t.TempDir(), "chat.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if gb.watch.watches(path) {
+		t.Fatal("file watched before the config named it")
+	}
+	user.Network.Servers[0].ChatFilterPath = path
+	if err := gb.applyUserConfig(user); err != nil {
+		t.Fatal(err)
+	}
+	if !gb.watch.watches(path) {
+		t.Fatal("rule file named by a reload not watched")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"words": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-watcher.Events:
+			if filepath.Clean(event.Name) == filepath.Clean(path) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("no event for a change to the new rule file")
+		}
+	}
+}
+
+func TestReloadKeepsWhitelistWhenItFailsToLoad(t *testing.T) {
+	user := testReloadUserConfig(t)
+	user.Network.Whitelisted = true
+	user.Network.WhitelistPath = filepath.Join(t.TempDir(), "whitelist.json")
+	if err := os.WriteFile(user.Network.WhitelistPath, []byte(`{"entries": ["Steve"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	gb := testReloadProxy(t, user)
+	before := gb.config()
+	if before.Whitelist == nil || !before.Whitelist.Has("Steve") {
+		t.Fatal("whitelist not loaded on start")
+	}
+
+	if err := os.WriteFile(user.Network.WhitelistPath, []byte(`{"entries": [`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := gb.applyUserConfig(user); err == nil {
+		t.Fatal("broken whitelist must fail the reload")
+	}
+	if gb.config() != before {
+		t.Fatal("failed reload must keep the running whitelist")
+	}
+}
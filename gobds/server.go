@@ -2,14 +2,21 @@ package gobds
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/sandertv/gophertunnel/minecraft"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
 	"github.com/smell-of-curry/gobds/gobds/claim"
+	"github.com/smell-of-curry/gobds/gobds/pool"
+	"github.com/smell-of-curry/gobds/gobds/queue"
 	"github.com/smell-of-curry/gobds/gobds/session"
 )
 
@@ -21,14 +28,99 @@ type ServerConfig struct {
 	// MOTD is the name shown in the server list. Falls back to Name when empty.
 	MOTD string
 	// MaxPlayers is the player capacity advertised in the server list.
-	MaxPlayers   int
+	MaxPlayers int
+	// OfflineMOTD replaces the MOTD while every backend is down.
+	OfflineMOTD string
+	// MaintenanceMOTD replaces the MOTD while every reachable backend is
+	// draining.
+	MaintenanceMOTD string
+	// Balancing is how new sessions are spread across Backends:
+	// "least-connections" (the default) or "weighted".
+	Balancing string
+	// Backends is a pool of identical backends behind this listener, used
+	// instead of RemoteAddress.
+	Backends []BackendConfig
+	// ChatFilterPath is the JSON rule file chat on this server is filtered
+	// with. Chat is not filtered when it is empty.
+	ChatFilterPath string
+	// SignFilterPath is the rule file sign edits are filtered with, in the
+	// same format as ChatFilterPath.
+	SignFilterPath string
+	// ClaimFiles are JSON or TOML files of claims merged with those of the
+	// claim service, such as spawn claims. They are read again when they
+	// change.
+	ClaimFiles   []string
 	ClaimService struct {
 		Enabled bool
 		URL     string
 		Key     string
+		// StreamURL is an optional Server-Sent Events endpoint pushing claim
+		// changes as they happen. Claims are polled while it is unreachable.
+		StreamURL string
 	}
 }
 
+// BackendConfig ...
+type BackendConfig struct {
+	Address string
+	// Weight is the share of new sessions the backend receives. Defaults to 1.
+	Weight int
+	// MaxPlayers is the number of sessions the backend takes before it is
+	// skipped. 0 means no limit of its own.
+	MaxPlayers int
+	// Drain stops sending new sessions to the backend without disconnecting
+	// the players already on it.
+	Drain bool
+}
+
+// pool builds the pool of backends behind the server.
+func (c ServerConfig) pool() (*pool.Pool, error) {
+	strategy, err := pool.ParseStrategy(c.Balancing)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Backends) == 0 {
+		if c.RemoteAddress == "" {
+			return nil, fmt.Errorf("no remote address or backends configured")
+		}
+		return pool.New(strategy, pool.NewBackend(c.RemoteAddress, 1, 0))
+	}
+	if c.RemoteAddress != "" {
+		return nil, fmt.Errorf("remote address and backends cannot both be set")
+	}
+	backends := make([]*pool.Backend, 0, len(c.Backends))
+	for _, b := range c.Backends {
+		if b.Address == "" {
+			return nil, fmt.Errorf("backend without an address")
+		}
+		backend := pool.NewBackend(b.Address, b.Weight, b.MaxPlayers)
+		backend.SetDraining(b.Drain)
+		backends = append(backends, backend)
+	}
+	return pool.New(strategy, backends...)
+}
+
+// filters loads the chat and sign filter rule files of the server.
+func (c ServerConfig) filters() (chat, sign *chatfilter.Ruleset, err error) {
+	chat, err = filterRules(c.ChatFilterPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("server %s: chat filter: %w", c.Name, err)
+	}
+	sign, err = filterRules(c.SignFilterPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("server %s: sign filter: %w", c.Name, err)
+	}
+	return chat, sign, nil
+}
+
+// filterRules loads a chat filter rule file. It returns nil if path is empty.
+func filterRules(path string) (*chatfilter.Ruleset, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return chatfilter.Load(path)
+}
+
 // Server represents a single server instance with its own Listener, DialerFunc, and minecraft.ServerStatusProvider.
 type Server struct {
 	Name          string
@@ -38,8 +130,22 @@ type Server struct {
 	// ClaimFactory is shared across all sessions on this server because claims are world-state
 	// fetched periodically from an external service.
 	ClaimFactory *claim.Factory
+	// ClaimFiles are the claim file sources of ClaimFactory, refreshed when
+	// their files change.
+	ClaimFiles []*claim.FileSource
+	// Backends is the pool new sessions are spread across. A server with only
+	// a RemoteAddress has a pool of one.
+	Backends *pool.Pool
 	// TrafficMetrics aggregates rate and malformed-packet counters for this server.
 	TrafficMetrics *session.TrafficMetrics
+	// Queue holds players waiting for a slot while the server is full. It is
+	// always present so the queue can be enabled by a reload.
+	Queue *queue.Queue
+	// ChatFilter and SignFilter hold the chat and sign filter rules of the
+	// server. They are always present so their rules can be swapped by a
+	// reload.
+	ChatFilter *chatfilter.Filter
+	SignFilter *chatfilter.Filter
 
 	Listener       Listener
 	StatusProvider minecraft.ServerStatusProvider
@@ -55,6 +161,9 @@ type Server struct {
 	xuidMu   sync.Mutex
 	xuids    map[string]struct{}
 
+	// claimHistory holds the latest changes to the claims of the server.
+	claimHistory claimHistory
+
 	Log *slog.Logger
 }
 
@@ -91,9 +200,23 @@ func (s *Server) AddSession(sess *session.Session) {
 	s.sessions.Store(sess, struct{}{})
 }
 
-// RemoveSession deregisters a session from the server.
+// RemoveSession deregisters a session from the server and releases its slot
+// on the backend it was acquired on.
 func (s *Server) RemoveSession(sess *session.Session) {
-	s.sessions.Delete(sess)
+	if _, ok := s.sessions.LoadAndDelete(sess); !ok {
+		return
+	}
+	if backend, ok := s.backendOf(sess); ok {
+		backend.Release()
+	}
+}
+
+// backendOf returns the pool backend sess is connected to.
+func (s *Server) backendOf(sess *session.Session) (*pool.Backend, bool) {
+	if s.Backends == nil {
+		return nil, false
+	}
+	return s.Backends.Backend(sess.Backend())
 }
 
 // Sessions returns a snapshot of the server's live sessions.
@@ -114,8 +237,8 @@ type ListenerFunc func() (Listener, error)
 // StatusProviderFunc creates a status provider.
 type StatusProviderFunc func() (minecraft.ServerStatusProvider, error)
 
-// DialerFunc dials a remote server.
-type DialerFunc func(identityData login.IdentityData, clientData login.ClientData, ctx context.Context) (session.Conn, error)
+// DialerFunc dials the backend at address.
+type DialerFunc func(address string, identityData login.IdentityData, clientData login.ClientData, ctx context.Context) (session.Conn, error)
 
 const (
 	retryInterval = time.Minute
@@ -180,7 +303,10 @@ func (gb *GoBDS) claimFetching(srv *Server) {
 		case <-gb.ctx.Done():
 			return
 		case <-refresh.C:
-			fetch()
+			// A connected update stream keeps the snapshot current.
+			if !srv.ClaimFactory.Streaming() {
+				fetch()
+			}
 		case <-metrics.C:
 			srv.ClaimFactory.Metrics().WriteDelta(os.Stdout, metricPeriod, snapshotOf(srv.ClaimFactory))
 			srv.TrafficMetrics.WriteDelta(os.Stdout, srv.Name, "", metricPeriod)
@@ -191,6 +317,81 @@ func (gb *GoBDS) claimFetching(srv *Server) {
 	}
 }
 
+// claimStreaming keeps the claim update stream of srv open while its claim
+// service has one. While the stream is down, claimFetching polls instead.
+func (gb *GoBDS) claimStreaming(srv *Server) {
+	for {
+		err := srv.ClaimFactory.Stream(gb.ctx)
+		if gb.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			// The claim service was changed on reload: reconnect at once.
+			continue
+		}
+		if !errors.Is(err, claim.ErrNoStream) {
+			srv.Log.Warn("claim stream dropped, polling until it reconnects", "err", err)
+		}
+		select {
+		case <-gb.ctx.Done():
+			return
+		case <-time.After(srv.ClaimFactory.PollInterval()):
+		}
+	}
+}
+
+// claimFileWatching refreshes the claims of each claim file of srv when the
+// file changes.
+func (gb *GoBDS) claimFileWatching(srv *Server) {
+	if len(srv.ClaimFiles) == 0 {
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		srv.Log.Error("failed to watch claim files, they are only read on polls", "err", err)
+		return
+	}
+	defer func() {
+		_ = watcher.Close()
+	}()
+	// As with the config, the directory is watched so that editors replacing
+	// the file do not drop the watch.
+	sources := make(map[string]*claim.FileSource, len(srv.ClaimFiles))
+	for _, source := range srv.ClaimFiles {
+		sources[source.Path()] = source
+		if err = watcher.Add(filepath.Dir(source.Path())); err != nil {
+			srv.Log.Error("failed to watch claim file, it is only read on polls", "path", source.Path(), "err", err)
+		}
+	}
+	pending := make(map[*claim.FileSource]*time.Timer)
+	defer func() {
+		for _, timer := range pending {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-gb.ctx.Done():
+			return
+		case event := <-watcher.Events:
+			source, ok := sources[filepath.Clean(event.Name)]
+			if !ok || !(event.Has(fsnotify.Write) || event.Has(fsnotify.Create)) {
+				continue
+			}
+			if timer, ok := pending[source]; ok {
+				timer.Stop()
+			}
+			pending[source] = time.AfterFunc(configReloadDebounce, func() {
+				if err := srv.ClaimFactory.Refresh(source); err != nil {
+					srv.Log.Error("failed to refresh claim file", "path", source.Path(), "err", err)
+				}
+			})
+		case err := <-watcher.Errors:
+			srv.Log.Error("claim file watch error", "err", err)
+		}
+	}
+}
+
 func snapshotOf(factory *claim.Factory) *claim.Snapshot {
 	snapshot, _ := factory.Snapshot(time.Now())
 	return snapshot
@@ -4,4 +4,9 @@ package authentication
 // ResponseModel ...
 type ResponseModel struct {
 	Allowed bool `json:"allowed"`
+	// Roles are the roles of the player, used to look up their queue priority.
+	Roles []string `json:"roles,omitempty"`
+	// QueuePriority overrides the player's queue priority when it is higher
+	// than the one derived from their roles.
+	QueuePriority int `json:"queuePriority,omitempty"`
 }
@@ -6,4 +6,7 @@ type Config struct {
 	Enabled bool
 	URL     string
 	Key     string
+	// StreamURL is an optional endpoint pushing updates, for services that
+	// support it.
+	StreamURL string
 }
@@ -0,0 +1,145 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/smell-of-curry/gobds/gobds/capture"
+	"github.com/smell-of-curry/gobds/gobds/util/area"
+)
+
+// replayState is the session state stored in a capture header, so a replay
+// handles packets the way the captured session did.
+type replayState struct {
+	IdentityData   login.IdentityData `json:"identity_data"`
+	ThirdPartyName string             `json:"third_party_name"`
+	LanguageCode   string             `json:"language_code"`
+	// GameData only holds the fields handlers read.
+	GameData  minecraft.GameData `json:"game_data"`
+	Dimension int32              `json:"dimension"`
+	GameMode  int32              `json:"game_mode"`
+
+	Border             *area.Area2D  `json:"border,omitempty"`
+	ClaimPrefilter     bool          `json:"claim_prefilter"`
+	ClaimDenyRendering bool          `json:"claim_deny_rendering"`
+	Traffic            TrafficConfig `json:"traffic"`
+}
+
+// StartCapture records every packet the session handles, in both directions,
+// to w until StopCapture is called, the session ends, or the capture grows past
+// limit bytes. A limit of 0 or less means no limit. server is the name of the
+// server the session is on, stored in the capture header.
+func (s *Session) StartCapture(w io.WriteCloser, server string, limit int64) error {
+	header, err := s.captureHeader(server)
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+	writer, err := capture.NewWriter(w, header, limit)
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+	if !s.capture.CompareAndSwap(nil, writer) {
+		_ = writer.Close()
+		return errors.New("session is already being captured")
+	}
+	s.log.Info("packet capture started")
+	return nil
+}
+
+// StopCapture stops a capture started with StartCapture and closes its file.
+// It reports whether a capture was running.
+func (s *Session) StopCapture() (bool, error) {
+	writer := s.capture.Swap(nil)
+	if writer == nil {
+		return false, nil
+	}
+	s.log.Info("packet capture stopped", "bytes", writer.Size())
+	return true, writer.Close()
+}
+
+// Capturing reports whether the session is being captured.
+func (s *Session) Capturing() bool {
+	return s.capture.Load() != nil
+}
+
+// capturePacket records pk, read from conn, to the running capture. It must
+// run before pk is handled, since handlers may modify it.
+func (s *Session) capturePacket(pk packet.Packet, conn Conn) {
+	writer := s.capture.Load()
+	if writer == nil {
+		return
+	}
+	direction := capture.Clientbound
+	if conn == s.client {
+		direction = capture.Serverbound
+	}
+	err := writer.Write(direction, pk, time.Now())
+	if errors.Is(err, capture.ErrFull) {
+		s.log.Warn("packet capture reached its size limit")
+		if s.capture.CompareAndSwap(writer, nil) {
+			_ = writer.Close()
+		}
+		return
+	}
+	if err != nil {
+		s.log.Debug("packet not captured", "packet_id", pk.ID(), "err", err)
+	}
+}
+
+// captureHeader returns the header of a capture of s starting now.
+func (s *Session) captureHeader(server string) (capture.Header, error) {
+	gameData := s.GameData()
+	state := replayState{
+		IdentityData:   s.IdentityData(),
+		ThirdPartyName: s.ClientData().ThirdPartyName,
+		LanguageCode:   s.ClientData().LanguageCode,
+		GameData: minecraft.GameData{
+			EntityUniqueID:          gameData.EntityUniqueID,
+			EntityRuntimeID:         gameData.EntityRuntimeID,
+			PlayerPermissions:       gameData.PlayerPermissions,
+			PlayerPosition:          s.Position(),
+			Items:                   gameData.Items,
+			Dimensions:              gameData.Dimensions,
+			UseBlockNetworkIDHashes: gameData.UseBlockNetworkIDHashes,
+		},
+		Dimension:          s.Data().Dimension(),
+		GameMode:           s.Data().GameMode(),
+		Border:             s.border.Load(),
+		ClaimPrefilter:     s.claimPrefilter.Load(),
+		ClaimDenyRendering: s.claimDenyRendering.Load(),
+		Traffic:            *s.traffic.limits(),
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return capture.Header{}, fmt.Errorf("encode session state: %w", err)
+	}
+	return capture.Header{
+		ShieldID: shieldID(gameData.Items),
+		Started:  time.Now(),
+		Server:   server,
+		Backend:  s.backend,
+		XUID:     state.IdentityData.XUID,
+		Name:     state.IdentityData.DisplayName,
+		Session:  data,
+	}, nil
+}
+
+// shieldID returns the runtime ID of the shield item in items, which the
+// protocol needs to encode item stacks.
+func shieldID(items []protocol.ItemEntry) int32 {
+	for _, item := range items {
+		if item.Name == "minecraft:shield" {
+			return int32(item.RuntimeID)
+		}
+	}
+	return 0
+}
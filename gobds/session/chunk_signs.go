@@ -0,0 +1,101 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	_ "unsafe"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/sandertv/gophertunnel/minecraft/nbt"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// signMarker is part of the id of every sign block entity. Chunks whose
+// payload does not contain it have no signs, and are not decoded.
+var signMarker = []byte("Sign")
+
+// storeLevelChunkSigns remembers the signs among the block entities sent with
+// a level chunk. They follow its sub-chunks, if any, its biomes and its border
+// blocks.
+func (s *Session) storeLevelChunkSigns(pkt *packet.LevelChunk) {
+	if pkt.CacheEnabled || !bytes.Contains(pkt.RawPayload, signMarker) {
+		return
+	}
+	dimensionRange, ok := dimensionRangeByID(pkt.Dimension, s.GameData().Dimensions)
+	if !ok {
+		return
+	}
+	// With sub-chunk requests the sub-chunks are sent separately.
+	count := 0
+	if pkt.SubChunkCount < protocol.SubChunkRequestModeLimited {
+		count = int(pkt.SubChunkCount)
+	}
+	buf := bytes.NewBuffer(pkt.RawPayload)
+	c := chunk.New(world.DefaultBlockRegistry, dimensionRange)
+	for i := range count {
+		index := byte(i)
+		if _, err := decodeSubChunk(buf, c, &index, chunk.NetworkEncoding); err != nil {
+			s.log.Debug("read level chunk signs", "error", err)
+			return
+		}
+	}
+	if err := decodeBiomes(buf, c, chunk.NetworkEncoding); err != nil {
+		s.log.Debug("read level chunk signs", "error", err)
+		return
+	}
+	borders, err := buf.ReadByte()
+	if err != nil {
+		s.log.Debug("read level chunk signs", "error", err)
+		return
+	}
+	buf.Next(int(borders))
+	if err = s.signs.storeBlockEntities(pkt.Dimension, buf); err != nil {
+		s.log.Debug("read level chunk signs", "error", err)
+	}
+}
+
+// storeSubChunkSigns remembers the signs among the block entities that follow
+// the sub-chunk in entry.
+func (s *Session) storeSubChunkSigns(dimension int32, dimensionRange cube.Range, entry protocol.SubChunkEntry) {
+	rawPayload, ok := entry.RawPayload.Value()
+	if entry.Result != protocol.SubChunkResultSuccess || !ok || !bytes.Contains(rawPayload, signMarker) {
+		return
+	}
+	buf := bytes.NewBuffer(rawPayload)
+	var index byte
+	if _, err := decodeSubChunk(buf, chunk.New(world.DefaultBlockRegistry, dimensionRange), &index, chunk.NetworkEncoding); err != nil {
+		s.log.Debug("read subchunk signs", "error", err)
+		return
+	}
+	if err := s.signs.storeBlockEntities(dimension, buf); err != nil {
+		s.log.Debug("read subchunk signs", "error", err)
+	}
+}
+
+// storeBlockEntities remembers the signs among the block entities in buf, a
+// sequence of network NBT compounds.
+func (c *signCache) storeBlockEntities(dimension int32, buf *bytes.Buffer) error {
+	dec := nbt.NewDecoderWithEncoding(buf, nbt.NetworkLittleEndian)
+	for buf.Len() > 0 {
+		var data map[string]any
+		if err := dec.Decode(&data); err != nil {
+			return fmt.Errorf("decode block entity: %w", err)
+		}
+		if _, ok := signText(data); !ok {
+			continue
+		}
+		x, _ := data["x"].(int32)
+		y, _ := data["y"].(int32)
+		z, _ := data["z"].(int32)
+		c.store(dimension, protocol.BlockPos{x, y, z}, data)
+	}
+	return nil
+}
+
+// decodeBiomes links Dragonfly's unexported biome decoder.
+//
+//go:linkname decodeBiomes github.com/df-mc/dragonfly/server/world/chunk.decodeBiomes
+func decodeBiomes(buf *bytes.Buffer, c *chunk.Chunk, e chunk.Encoding) error
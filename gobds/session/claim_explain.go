@@ -0,0 +1,219 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+)
+
+// claimActionNames are the names claim actions have in claim policy case
+// files, indexed by ClaimAction: their metric names in camel case, such as
+// blockBreak for block_break.
+var claimActionNames = func() (names [ClaimActionItemPickup + 1]string) {
+	for action := range names {
+		words := strings.Split(claim.ActionName(uint8(action)), "_")
+		for i, word := range words[1:] {
+			words[i+1] = strings.ToUpper(word[:1]) + word[1:]
+		}
+		names[action] = strings.Join(words, "")
+	}
+	return names
+}()
+
+// claimActionsByName maps the names in claimActionNames back to their
+// actions.
+var claimActionsByName = func() map[string]ClaimAction {
+	actions := make(map[string]ClaimAction, len(claimActionNames))
+	for action, name := range claimActionNames {
+		actions[name] = ClaimAction(action)
+	}
+	return actions
+}()
+
+// ParseClaimAction returns the claim action named name, such as blockBreak.
+func ParseClaimAction(name string) (ClaimAction, bool) {
+	action, ok := claimActionsByName[name]
+	return action, ok
+}
+
+// String ...
+func (a ClaimAction) String() string {
+	if int(a) >= len(claimActionNames) {
+		return "unknown"
+	}
+	return claimActionNames[a]
+}
+
+// ClaimQuery is a claim action to explain: who performs it, on what, and
+// where.
+type ClaimQuery struct {
+	Actor     ClaimActor
+	Action    ClaimAction
+	Dimension string
+	Position  mgl32.Vec3
+	TypeID    string
+}
+
+// ClaimExplanation tells how claim policy decides an action, and why.
+type ClaimExplanation struct {
+	// Status is the status of the snapshot the action was looked up in. The
+	// proxy only denies actions while it is claim.QueryReady.
+	Status claim.QueryStatus
+	// Matched are the claims containing the position, and Claim the one of
+	// them deciding the action, or nil if there is none.
+	Matched []*claim.PlayerClaim
+	Claim   *claim.PlayerClaim
+	// Permitted is what the policy decides, whatever the Status.
+	Permitted bool
+	Reason    string
+	// Feature is the feature permitting the action, if one does, and
+	// FeatureClaim the claim it belongs to: Claim, or a claim Claim inherits
+	// features from.
+	Feature      *claim.Feature
+	FeatureClaim *claim.PlayerClaim
+}
+
+// Forwarded reports whether the proxy lets the action through to the server.
+// Actions fail open while the snapshot is not ready.
+func (e ClaimExplanation) Forwarded() bool {
+	return e.Permitted || e.Status != claim.QueryReady
+}
+
+// ExplainClaimAction looks up the claim deciding query in snapshot, whose
+// status is status, as a session does, and explains its decision.
+func ExplainClaimAction(snapshot *claim.Snapshot, status claim.QueryStatus, query ClaimQuery) ClaimExplanation {
+	if snapshot == nil {
+		return ClaimExplanation{Status: status, Permitted: true, Reason: "there is no claim snapshot"}
+	}
+	candidates := snapshot.Candidates(query.Dimension, query.Position.X(), query.Position.Z())
+	var matched []*claim.PlayerClaim
+	for _, candidate := range candidates {
+		if claimContains(*candidate, query.Position) {
+			matched = append(matched, candidate)
+		}
+	}
+	deciding, ambiguous := singleClaimAt(snapshot, candidates, query.Position)
+	switch {
+	case ambiguous:
+		return ClaimExplanation{
+			Status:    claim.QueryOverlap,
+			Matched:   matched,
+			Permitted: true,
+			Reason:    "claims overlap here without being nested",
+		}
+	case deciding == nil:
+		return ClaimExplanation{Status: status, Permitted: true, Reason: "there is no claim here"}
+	}
+	explanation := ExplainClaimDecision(
+		*deciding,
+		query.Actor,
+		query.Action,
+		claimActionData{position: query.Position, typeID: query.TypeID},
+		claimParents(snapshot, deciding)...,
+	)
+	explanation.Status = status
+	explanation.Matched = matched
+	return explanation
+}
+
+// ExplainClaimDecision explains how ClaimActionPermitted decides action in
+// cl, nested in parents, innermost first.
+func ExplainClaimDecision(cl claim.PlayerClaim, actor ClaimActor, action ClaimAction, data any, parents ...claim.PlayerClaim) ClaimExplanation {
+	explanation := ClaimExplanation{
+		Status:    claim.QueryReady,
+		Claim:     &cl,
+		Permitted: ClaimActionPermitted(cl, actor, action, data, parents...),
+	}
+	explanation.Reason = claimDecisionReason(&explanation, cl, actor, action, data, parents)
+	return explanation
+}
+
+// claimDecisionReason returns why ClaimActionPermitted decides action in cl
+// as it does, and sets the feature of explanation that permits it, if any.
+// It retraces the steps of ClaimActionPermitted.
+func claimDecisionReason(explanation *ClaimExplanation, cl claim.PlayerClaim, actor ClaimActor, action ClaimAction, data any, parents []claim.PlayerClaim) string {
+	if !validClaim(cl) {
+		return fmt.Sprintf("claim %q is missing its ID, owner or dimension", cl.ID)
+	}
+	if actor.XUID == "" {
+		return "the player has no XUID"
+	}
+	if actionData, ok := claimActionDataFrom(data); ok && !claimSpansY(cl, actionData.position.Y()) {
+		return fmt.Sprintf("the position is outside the vertical bounds of claim %q", cl.ID)
+	}
+	lineage := append([]claim.PlayerClaim{cl}, parents...)
+	level, required := claimTrustLevel(lineage, actor), requiredTrustLevel(action, data)
+	if level >= required {
+		if actor.Operator {
+			return "the player is an operator"
+		}
+		for _, owned := range lineage {
+			if owned.OwnerXUID == actor.XUID {
+				return fmt.Sprintf("the player owns claim %q", owned.ID)
+			}
+		}
+		return fmt.Sprintf("claim %q trusts the player with %s, %s is needed", cl.ID, level, required)
+	}
+	for i, inherited := range lineage {
+		// Claims permit some actions whatever their features are.
+		bare := inherited
+		bare.Features = nil
+		if claimFeaturesPermit(bare, action, data) {
+			return fmt.Sprintf("claim %q permits %s to everyone", inherited.ID, action)
+		}
+		for _, feature := range inherited.Features {
+			bare.Features = []claim.Feature{feature}
+			if claimFeaturesPermit(bare, action, data) {
+				explanation.Feature, explanation.FeatureClaim = &feature, &lineage[i]
+				return fmt.Sprintf("feature %s of claim %q permits %s", feature.Type, inherited.ID, action)
+			}
+		}
+		if !inherited.InheritFeatures {
+			break
+		}
+	}
+	return fmt.Sprintf("claim %q trusts the player with %s, %s is needed, and no feature permits %s", cl.ID, level, required, action)
+}
+
+// ClaimPolicyCases is a file of claim policy cases, such as
+// policy/claim_policy.v1.json, that BEH must decide alike.
+type ClaimPolicyCases struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	PolicyVersion int               `json:"policyVersion"`
+	Cases         []ClaimPolicyCase `json:"cases"`
+}
+
+// ClaimPolicyCase is an action in a claim, and whether it is permitted.
+type ClaimPolicyCase struct {
+	Name    string              `json:"name"`
+	Claim   claim.PlayerClaim   `json:"claim"`
+	Parents []claim.PlayerClaim `json:"parents,omitempty"`
+	Actor   struct {
+		XUID     string `json:"xuid"`
+		Operator bool   `json:"operator"`
+	} `json:"actor"`
+	Action    string        `json:"action"`
+	Position  claim.Vector3 `json:"position"`
+	TypeID    string        `json:"typeId"`
+	Permitted bool          `json:"permitted"`
+}
+
+// Explain explains how claim policy decides c.
+func (c ClaimPolicyCase) Explain() (ClaimExplanation, error) {
+	action, ok := ParseClaimAction(c.Action)
+	if !ok {
+		return ClaimExplanation{}, fmt.Errorf("unknown claim action %q", c.Action)
+	}
+	return ExplainClaimDecision(
+		c.Claim,
+		ClaimActor{XUID: c.Actor.XUID, Operator: c.Actor.Operator},
+		action,
+		claimActionData{
+			position: mgl32.Vec3{c.Position.X, c.Position.Y, c.Position.Z},
+			typeID:   c.TypeID,
+		},
+		c.Parents...,
+	), nil
+}
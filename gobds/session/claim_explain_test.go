@@ -0,0 +1,80 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+)
+
+func TestExplainClaimActionNamesDecidingClaimAndFeature(t *testing.T) {
+	town := testClaim()
+	town.ID = "town"
+	town.Location.Pos2 = claim.Vector2{X: 100, Z: 100}
+	town.Features = []claim.Feature{{Type: claim.FeatureTypeMineable, BlockTypeIDs: []string{"minecraft:stone"}}}
+	plot := testClaim()
+	plot.ID, plot.OwnerXUID, plot.ParentID, plot.InheritFeatures = "plot", "resident", "town", true
+	plot.Location.Pos1, plot.Location.Pos2 = claim.Vector2{X: 10, Z: 10}, claim.Vector2{X: 20, Z: 20}
+	snapshot, err := claim.BuildSnapshot(map[string]claim.PlayerClaim{"town": town, "plot": plot}, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := ClaimQuery{
+		Actor:     ClaimActor{XUID: "stranger"},
+		Action:    ClaimActionBlockBreak,
+		Dimension: "minecraft:overworld",
+		Position:  mgl32.Vec3{15, 64, 15},
+		TypeID:    "minecraft:stone",
+	}
+
+	explanation := ExplainClaimAction(snapshot, claim.QueryReady, query)
+	if !explanation.Permitted || explanation.Claim == nil || explanation.Claim.ID != "plot" || len(explanation.Matched) != 2 {
+		t.Fatalf("unexpected explanation: %+v", explanation)
+	}
+	if explanation.Feature == nil || explanation.FeatureClaim.ID != "town" || !strings.Contains(explanation.Reason, "mineable") {
+		t.Fatalf("inherited feature not named: %+v", explanation)
+	}
+
+	query.TypeID = "minecraft:dirt"
+	explanation = ExplainClaimAction(snapshot, claim.QueryReady, query)
+	if explanation.Permitted || explanation.Forwarded() || explanation.Feature != nil {
+		t.Fatalf("dirt should be denied: %+v", explanation)
+	}
+	if explanation = ExplainClaimAction(snapshot, claim.QueryStale, query); explanation.Permitted || !explanation.Forwarded() {
+		t.Fatalf("stale snapshot should fail open without changing the policy decision: %+v", explanation)
+	}
+
+	query.Actor.XUID = "owner"
+	if explanation = ExplainClaimAction(snapshot, claim.QueryReady, query); !explanation.Permitted || !strings.Contains(explanation.Reason, `owns claim "town"`) {
+		t.Fatalf("parent owner not named: %+v", explanation)
+	}
+
+	query.Position = mgl32.Vec3{500, 64, 500}
+	if explanation = ExplainClaimAction(snapshot, claim.QueryReady, query); !explanation.Permitted || explanation.Claim != nil {
+		t.Fatalf("unexpected claim outside every claim: %+v", explanation)
+	}
+}
+
+func TestClaimActionNamesRoundTrip(t *testing.T) {
+	want := []string{
+		"render", "blockBreak", "blockPlace", "blockInteract", "entityInteract",
+		"entityHurt", "itemRelease", "itemThrow", "itemDrop", "itemPickup",
+	}
+	for i, name := range want {
+		action := ClaimAction(i)
+		if action.String() != name {
+			t.Fatalf("action %d named %q, want %q", i, action.String(), name)
+		}
+		if parsed, ok := ParseClaimAction(name); !ok || parsed != action {
+			t.Fatalf("ParseClaimAction(%q) = %v, %v", name, parsed, ok)
+		}
+	}
+	if name := ClaimAction(len(want)).String(); name != "unknown" {
+		t.Fatalf("action past the last named %q", name)
+	}
+	if _, ok := ParseClaimAction("block_break"); ok {
+		t.Fatal("metric name parsed as a case file name")
+	}
+}
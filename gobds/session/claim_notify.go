@@ -0,0 +1,221 @@
+package session
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sandertv/gophertunnel/minecraft/text"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+	"github.com/smell-of-curry/gobds/gobds/util/translator"
+)
+
+const (
+	// playerEyeHeight is how far above its feet the position a player sends
+	// is.
+	playerEyeHeight = 1.62
+	// claimOutlineRadius is how far from the player the border of a claim
+	// is outlined, and maxClaimOutlineParticles how many particles are sent
+	// for it at once.
+	claimOutlineRadius       = 16
+	maxClaimOutlineParticles = 128
+	// claimOutlineParticle is the particle claim borders are outlined with.
+	claimOutlineParticle = "minecraft:villager_happy"
+)
+
+// ClaimNotifyConfig tells players when they enter or leave a claim.
+type ClaimNotifyConfig struct {
+	// Title shows notifications as a title instead of on the action bar.
+	Title bool
+	// Outline is how long the border of a claim the player enters is
+	// outlined with particles. Borders are not outlined when it is 0.
+	Outline time.Duration
+}
+
+// claimPresence tracks the claim the player was last seen in.
+type claimPresence struct {
+	mu sync.Mutex
+	// known is set once the claim the player is in was first looked up, so
+	// that joining inside a claim is not announced as entering it.
+	known bool
+	claim *claim.PlayerClaim
+	// outlineUntil is when the border of claim stops being outlined.
+	outlineUntil time.Time
+}
+
+// claimNotifyMessages are the notifications shown in languages without
+// their own, by the translation key a resource pack may translate them with.
+var claimNotifyMessages = map[string]string{
+	"gobds.claim.enter.own":     "Entering your claim",
+	"gobds.claim.enter.named":   "Entering %s's claim",
+	"gobds.claim.enter.unnamed": "Entering a claim",
+	"gobds.claim.enter.admin":   "Entering a protected area",
+	"gobds.claim.leave.own":     "Leaving your claim",
+	"gobds.claim.leave.named":   "Leaving %s's claim",
+	"gobds.claim.leave.unnamed": "Leaving a claim",
+	"gobds.claim.leave.admin":   "Leaving a protected area",
+}
+
+// updateClaimPresence looks up the claim the player, whose eyes are at
+// position, stands in. Crossing into another claim, or out of one, is shown
+// to the player. While the border of the claim entered is outlined, the
+// outline near the player is drawn again.
+func (s *Session) updateClaimPresence(position mgl32.Vec3) {
+	conf := s.claimNotify.Load()
+	if conf == nil || s.claimFactory == nil {
+		return
+	}
+	now := time.Now()
+	snapshot, status := s.claimFactory.Snapshot(now)
+	if status != claim.QueryReady {
+		return
+	}
+	dimension, ok := claimDimensionFromInt(s.Data().Dimension(), s.GameData().Dimensions)
+	if !ok {
+		return
+	}
+	feet := position.Sub(mgl32.Vec3{0, playerEyeHeight, 0})
+	current, ambiguous := singleClaimAt(snapshot, snapshot.Candidates(dimension, feet.X(), feet.Z()), feet)
+	if ambiguous {
+		return
+	}
+
+	s.claimPresence.mu.Lock()
+	previous, known := s.claimPresence.claim, s.claimPresence.known
+	s.claimPresence.claim, s.claimPresence.known = current, true
+	crossed := known && claimID(previous) != claimID(current)
+	if crossed {
+		s.claimPresence.outlineUntil = time.Time{}
+		if current != nil && conf.Outline > 0 {
+			s.claimPresence.outlineUntil = now.Add(conf.Outline)
+		}
+	}
+	outline := current != nil && now.Before(s.claimPresence.outlineUntil)
+	s.claimPresence.mu.Unlock()
+
+	if crossed {
+		s.notifyClaimCrossing(conf, previous, current)
+	}
+	if outline {
+		for _, point := range claimOutline(*current, feet) {
+			s.WriteToClient(&packet.SpawnParticleEffect{
+				Dimension:      byte(s.Data().Dimension()),
+				EntityUniqueID: -1,
+				Position:       point,
+				ParticleName:   claimOutlineParticle,
+			})
+		}
+	}
+}
+
+// notifyClaimCrossing shows the player they entered current, or left
+// previous if they are no longer in a claim.
+func (s *Session) notifyClaimCrossing(conf *ClaimNotifyConfig, previous, current *claim.PlayerClaim) {
+	direction, cl := "enter", current
+	if current == nil {
+		direction, cl = "leave", previous
+	}
+	kind, args := "unnamed", []string(nil)
+	switch {
+	case cl.OwnerXUID == "*":
+		kind = "admin"
+	case cl.OwnerXUID == s.IdentityData().XUID:
+		kind = "own"
+	case cl.OwnerName != "":
+		kind, args = "named", []string{cl.OwnerName}
+	}
+	message := text.Colourf("<yellow>%s</yellow>", s.translate("gobds.claim."+direction+"."+kind, args...))
+	action := packet.TitleActionSetActionBar
+	if conf.Title {
+		action = packet.TitleActionSetTitle
+	}
+	s.WriteToClient(&packet.SetTitle{ActionType: action, Text: message})
+}
+
+// translate returns the message under key in the player's language, falling
+// back to American English and then to claimNotifyMessages. Placeholders in
+// the message are replaced with args.
+func (s *Session) translate(key string, args ...string) string {
+	message := claimNotifyMessages[key]
+	for _, locale := range []string{s.Locale(), "en_US"} {
+		if translations, ok := translator.TranslationFor(locale); ok {
+			if translated, ok := translations[key]; ok {
+				message = translated
+				break
+			}
+		}
+	}
+	return formatTranslation(message, args...)
+}
+
+// formatTranslation replaces the %s and %1$s style placeholders of a
+// language file message with args.
+func formatTranslation(message string, args ...string) string {
+	for i, arg := range args {
+		message = strings.ReplaceAll(message, "%"+strconv.Itoa(i+1)+"$s", arg)
+	}
+	for _, arg := range args {
+		message = strings.Replace(message, "%s", arg, 1)
+	}
+	return message
+}
+
+// claimID returns the ID of cl, or an empty string if cl is nil.
+func claimID(cl *claim.PlayerClaim) string {
+	if cl == nil {
+		return ""
+	}
+	return cl.ID
+}
+
+// claimOutline returns where to draw the border of cl near a player standing
+// at feet: the centre of every border block within claimOutlineRadius of the
+// player, at their height, limited to maxClaimOutlineParticles.
+func claimOutline(cl claim.PlayerClaim, feet mgl32.Vec3) []mgl32.Vec3 {
+	// Blocks are inside a claim by their lowest corner.
+	minX := int(math.Ceil(float64(min(cl.Location.Pos1.X, cl.Location.Pos2.X))))
+	maxX := int(math.Floor(float64(max(cl.Location.Pos1.X, cl.Location.Pos2.X))))
+	minZ := int(math.Ceil(float64(min(cl.Location.Pos1.Z, cl.Location.Pos2.Z))))
+	maxZ := int(math.Floor(float64(max(cl.Location.Pos1.Z, cl.Location.Pos2.Z))))
+	if minX > maxX || minZ > maxZ {
+		return nil
+	}
+	playerX, playerZ := int(math.Floor(float64(feet.X()))), int(math.Floor(float64(feet.Z())))
+	y := float32(math.Floor(float64(feet.Y()))) + 0.5
+	if cl.Location.MinY != nil {
+		y = max(y, *cl.Location.MinY+0.5)
+	}
+	if cl.Location.MaxY != nil {
+		y = min(y, *cl.Location.MaxY+0.5)
+	}
+
+	var points []mgl32.Vec3
+	add := func(x, z int) {
+		if len(points) < maxClaimOutlineParticles {
+			points = append(points, mgl32.Vec3{float32(x) + 0.5, y, float32(z) + 0.5})
+		}
+	}
+	fromX, toX := max(minX, playerX-claimOutlineRadius), min(maxX, playerX+claimOutlineRadius)
+	fromZ, toZ := max(minZ, playerZ-claimOutlineRadius), min(maxZ, playerZ+claimOutlineRadius)
+	for x := fromX; x <= toX; x++ {
+		if minZ >= playerZ-claimOutlineRadius {
+			add(x, minZ)
+		}
+		if maxZ != minZ && maxZ <= playerZ+claimOutlineRadius {
+			add(x, maxZ)
+		}
+	}
+	for z := max(fromZ, minZ+1); z <= min(toZ, maxZ-1); z++ {
+		if minX >= playerX-claimOutlineRadius {
+			add(minX, z)
+		}
+		if maxX != minX && maxX <= playerX+claimOutlineRadius {
+			add(maxX, z)
+		}
+	}
+	return points
+}
@@ -0,0 +1,70 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+)
+
+func TestClaimOutlineTracesBorderNearPlayer(t *testing.T) {
+	minY := float32(70)
+	cl := claim.PlayerClaim{ID: "plot", OwnerXUID: "owner", Location: claim.Location{
+		Dimension: "minecraft:overworld",
+		Pos1:      claim.Vector2{X: 0, Z: 0},
+		Pos2:      claim.Vector2{X: 4, Z: 2},
+		MinY:      &minY,
+	}}
+	points := claimOutline(cl, mgl32.Vec3{1.5, 64, 1.5})
+	// A 5 by 3 block claim has 12 border blocks.
+	if len(points) != 12 {
+		t.Fatalf("outline has %d points, want 12: %v", len(points), points)
+	}
+	seen := make(map[mgl32.Vec3]bool)
+	for _, point := range points {
+		if seen[point] {
+			t.Fatalf("point %v outlined twice", point)
+		}
+		seen[point] = true
+		if point.Y() != 70.5 {
+			t.Fatalf("point %v not raised into the claim", point)
+		}
+		if point.X() != 0.5 && point.X() != 4.5 && point.Z() != 0.5 && point.Z() != 2.5 {
+			t.Fatalf("point %v is not on the border", point)
+		}
+	}
+
+	large := claim.PlayerClaim{ID: "town", OwnerXUID: "owner", Location: claim.Location{
+		Dimension: "minecraft:overworld",
+		Pos1:      claim.Vector2{X: -1000, Z: -1000},
+		Pos2:      claim.Vector2{X: 1000, Z: 1000},
+	}}
+	if points := claimOutline(large, mgl32.Vec3{0, 64, 0}); len(points) != 0 {
+		t.Fatalf("border far away outlined: %v", points)
+	}
+	points = claimOutline(large, mgl32.Vec3{995, 64, 0})
+	if len(points) != 2*claimOutlineRadius+1 {
+		t.Fatalf("near border has %d points, want %d", len(points), 2*claimOutlineRadius+1)
+	}
+	for _, point := range points {
+		if point.X() != 1000.5 {
+			t.Fatalf("point %v is not on the near border", point)
+		}
+	}
+}
+
+func TestFormatTranslationFillsPlaceholders(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		args    []string
+		want    string
+	}{
+		{"Entering %s's claim", []string{"Steve"}, "Entering Steve's claim"},
+		{"%1$s の土地に入りました", []string{"Steve"}, "Steve の土地に入りました"},
+		{"Entering a claim", nil, "Entering a claim"},
+	} {
+		if got := formatTranslation(test.message, test.args...); got != test.want {
+			t.Fatalf("formatTranslation(%q) = %q, want %q", test.message, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package session
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+)
+
+// maxClaimOverlays is how many chunks a session remembers the deny blocks of.
+// Beyond it, the chunks farthest from the player are forgotten.
+const maxClaimOverlays = 4096
+
+// claimOverlay is which blocks of the bottom layer of a chunk are painted as
+// deny blocks, bit z*16+x.
+type claimOverlay [4]uint64
+
+// set marks the block at x, z in the chunk as a deny block.
+func (o *claimOverlay) set(x, z uint8) {
+	i := uint(z)*16 + uint(x)
+	o[i/64] |= 1 << (i % 64)
+}
+
+// denied reports whether the block at x, z in the chunk is a deny block.
+func (o claimOverlay) denied(x, z uint8) bool {
+	i := uint(z)*16 + uint(x)
+	return o[i/64]&(1<<(i%64)) != 0
+}
+
+// claimOverlayOf returns the blocks of the bottom layer, at y, of the chunk at
+// chunkPos that claims, the candidates of the chunk in snapshot, deny actor
+// to see, and how many of its blocks claims overlap in without being nested.
+func claimOverlayOf(
+	snapshot *claim.Snapshot,
+	claims []*claim.PlayerClaim,
+	chunkPos protocol.ChunkPos,
+	y int32,
+	actor ClaimActor,
+) (overlay claimOverlay, overlaps int) {
+	if len(claims) == 0 {
+		return overlay, 0
+	}
+	for z := uint8(0); z < 16; z++ {
+		for x := uint8(0); x < 16; x++ {
+			position := mgl32.Vec3{
+				float32((chunkPos.X() << 4) + int32(x)), float32(y), float32((chunkPos.Z() << 4) + int32(z)),
+			}
+			matched, ambiguous := singleClaimAt(snapshot, claims, position)
+			if ambiguous {
+				overlaps++
+			}
+			if !ambiguous && matched != nil &&
+				!ClaimActionPermitted(*matched, actor, ClaimActionRender, position, claimParents(snapshot, matched)...) {
+				overlay.set(x, z)
+			}
+		}
+	}
+	return overlay, overlaps
+}
+
+// claimOverlays are the deny blocks a session painted in the chunks it sent
+// to the client, so that chunks can be sent again once other deny blocks
+// belong there.
+type claimOverlays struct {
+	mu sync.Mutex
+	// painted holds the overlay of every chunk sent while deny rendering was
+	// on, empty if no deny blocks were painted.
+	painted map[correctiveKey]claimOverlay
+	// pending are chunks whose deny blocks changed, but that could not be
+	// sent again yet.
+	pending map[correctiveKey]struct{}
+}
+
+// record remembers that the chunk at key was sent with overlay. Chunks are
+// forgotten, farthest from centre first, once there are too many.
+func (o *claimOverlays) record(key correctiveKey, overlay claimOverlay, centre protocol.ChunkPos) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.painted == nil {
+		o.painted = make(map[correctiveKey]claimOverlay)
+	}
+	o.painted[key] = overlay
+	delete(o.pending, key)
+	if len(o.painted) <= maxClaimOverlays {
+		return
+	}
+	keys := sortedByDistance(o.painted, key.dimension, centre)
+	for _, far := range keys[maxClaimOverlays*3/4:] {
+		delete(o.painted, far)
+		delete(o.pending, far)
+	}
+}
+
+// chunks returns the chunks of dimension the session remembers the overlays
+// of.
+func (o *claimOverlays) chunks(dimension int32) map[protocol.ChunkPos]claimOverlay {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	chunks := make(map[protocol.ChunkPos]claimOverlay)
+	for key, overlay := range o.painted {
+		if key.dimension == dimension {
+			chunks[protocol.ChunkPos{key.x, key.z}] = overlay
+		}
+	}
+	return chunks
+}
+
+// markPending adds the chunks of dimension to the chunks to send again.
+func (o *claimOverlays) markPending(dimension int32, chunks []protocol.ChunkPos) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.pending == nil {
+		o.pending = make(map[correctiveKey]struct{})
+	}
+	for _, chunkPos := range chunks {
+		o.pending[correctiveKey{dimension: dimension, x: chunkPos.X(), z: chunkPos.Z()}] = struct{}{}
+	}
+}
+
+// takePending removes the pending chunks of dimension for which allow
+// returns true, nearest to centre first and at most limit, and returns them.
+// Pending chunks of other dimensions are dropped: the client forgot them when
+// it changed dimension.
+func (o *claimOverlays) takePending(
+	dimension int32,
+	centre protocol.ChunkPos,
+	limit int,
+	allow func(protocol.ChunkPos) bool,
+) []protocol.ChunkPos {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var taken []protocol.ChunkPos
+	for _, key := range sortedByDistance(o.pending, dimension, centre) {
+		if key.dimension != dimension {
+			delete(o.pending, key)
+			continue
+		}
+		if len(taken) == limit {
+			break
+		}
+		chunkPos := protocol.ChunkPos{key.x, key.z}
+		if allow(chunkPos) {
+			delete(o.pending, key)
+			taken = append(taken, chunkPos)
+		}
+	}
+	return taken
+}
+
+// reset forgets every chunk, as the client does when it changes dimension.
+func (o *claimOverlays) reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	clear(o.painted)
+	clear(o.pending)
+}
+
+// sortedByDistance returns the keys of chunks, those in dimension by their
+// distance from centre followed by those in other dimensions.
+func sortedByDistance[V any](chunks map[correctiveKey]V, dimension int32, centre protocol.ChunkPos) []correctiveKey {
+	distance := func(key correctiveKey) int64 {
+		if key.dimension != dimension {
+			return math.MaxInt64
+		}
+		dx, dz := int64(key.x-centre.X()), int64(key.z-centre.Z())
+		return dx*dx + dz*dz
+	}
+	keys := make([]correctiveKey, 0, len(chunks))
+	for key := range chunks {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b correctiveKey) int {
+		return cmp.Or(cmp.Compare(distance(a), distance(b)), cmp.Compare(a.dimension, b.dimension),
+			cmp.Compare(a.x, b.x), cmp.Compare(a.z, b.z))
+	})
+	return keys
+}
@@ -0,0 +1,111 @@
+package session
+
+import (
+	"math"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+)
+
+// maxClaimRerenders is how many chunks are resent at most at once when their
+// deny blocks change, nearest to the player first. The rest are resent later.
+const maxClaimRerenders = 128
+
+// ClaimsChanged resends the chunks the client was sent with deny blocks that
+// the claims changed in diff no longer paint the same, so that the client
+// requests them again and their deny blocks are painted with the new
+// snapshot. If earlier diffs were missed, every chunk sent is checked.
+func (s *Session) ClaimsChanged(diff claim.Diff) {
+	if s.claimFactory == nil || !s.claimDenyRendering.Load() {
+		return
+	}
+	snapshot, status := s.claimFactory.Snapshot(time.Now())
+	if status != claim.QueryReady {
+		return
+	}
+	dimensionID := s.Data().Dimension()
+	dimensions := s.GameData().Dimensions
+	dimension, dimensionFound := claimDimensionFromInt(dimensionID, dimensions)
+	dimensionRange, rangeFound := dimensionRangeByID(dimensionID, dimensions)
+	if !dimensionFound || !rangeFound {
+		return
+	}
+	actor := ClaimActor{XUID: s.IdentityData().XUID, Operator: s.Data().Operator()}
+
+	var changed []protocol.ChunkPos
+	for chunkPos, painted := range claimChangeChunks(diff, dimension, s.claimOverlays.chunks(dimensionID)) {
+		candidates := snapshot.Candidates(dimension, float32(chunkPos.X()<<4), float32(chunkPos.Z()<<4))
+		if overlay, _ := claimOverlayOf(snapshot, candidates, chunkPos, int32(dimensionRange.Min()), actor); overlay != painted {
+			changed = append(changed, chunkPos)
+		}
+	}
+	s.claimOverlays.markPending(dimensionID, changed)
+	s.resendClaimOverlays()
+}
+
+// resendClaimOverlays resends the chunks whose deny blocks changed, as far as
+// allowCorrective lets it. Chunks it does not resend yet stay pending and are
+// tried again on the next call.
+func (s *Session) resendClaimOverlays() {
+	if s.claimFactory == nil {
+		return
+	}
+	dimensionID := s.Data().Dimension()
+	dimensions := s.GameData().Dimensions
+	if _, ok := correctiveLevelChunk(protocol.ChunkPos{}, dimensionID, dimensions); !ok {
+		return
+	}
+	position := s.Position()
+	centre := protocol.ChunkPos{chunkCoordinate(position.X()), chunkCoordinate(position.Z())}
+	chunks := s.claimOverlays.takePending(dimensionID, centre, maxClaimRerenders, func(chunkPos protocol.ChunkPos) bool {
+		if !s.allowCorrective(chunkPos, time.Second) {
+			s.claimFactory.Metrics().Correction(false)
+			return false
+		}
+		return true
+	})
+	for _, chunkPos := range chunks {
+		correction, _ := correctiveLevelChunk(chunkPos, dimensionID, dimensions)
+		s.WriteToClient(correction)
+		s.claimFactory.Metrics().Correction(true)
+	}
+}
+
+// claimChangeChunks returns those of the chunks in dimension the client was
+// sent that a claim changed in diff covers, before or after the change, with
+// the deny blocks they were sent with. If diff is Missed, every chunk is
+// returned.
+func claimChangeChunks(
+	diff claim.Diff,
+	dimension string,
+	chunks map[protocol.ChunkPos]claimOverlay,
+) map[protocol.ChunkPos]claimOverlay {
+	if diff.Missed {
+		return chunks
+	}
+	touched := make(map[protocol.ChunkPos]claimOverlay)
+	for _, change := range diff.Changes {
+		for _, cl := range []*claim.PlayerClaim{change.Before, change.After} {
+			if cl == nil || cl.Location.Dimension != dimension {
+				continue
+			}
+			location := cl.Location
+			minX := chunkCoordinate(min(location.Pos1.X, location.Pos2.X))
+			minZ := chunkCoordinate(min(location.Pos1.Z, location.Pos2.Z))
+			maxX := chunkCoordinate(max(location.Pos1.X, location.Pos2.X))
+			maxZ := chunkCoordinate(max(location.Pos1.Z, location.Pos2.Z))
+			for chunkPos, overlay := range chunks {
+				if chunkPos.X() >= minX && chunkPos.X() <= maxX && chunkPos.Z() >= minZ && chunkPos.Z() <= maxZ {
+					touched[chunkPos] = overlay
+				}
+			}
+		}
+	}
+	return touched
+}
+
+// chunkCoordinate returns the chunk coordinate of the block containing v.
+func chunkCoordinate(v float32) int32 {
+	return int32(math.Floor(float64(v))) >> 4
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+)
+
+func TestClaimChangeChunksOnlyIncludeSentChunksOfChangedClaims(t *testing.T) {
+	before := testClaim()
+	before.Location.Pos1, before.Location.Pos2 = claim.Vector2{X: -20, Z: 0}, claim.Vector2{X: -1, Z: 15}
+	after := before
+	after.Location.Pos2 = claim.Vector2{X: 200, Z: 15}
+	nether := testClaim()
+	nether.Location.Dimension = "minecraft:nether"
+	diff := claim.Diff{Changes: []claim.ClaimChange{
+		{ID: "claim", Kinds: []claim.ChangeKind{claim.ChangeResized}, Before: &before, After: &after},
+		{ID: "nether", Kinds: []claim.ChangeKind{claim.ChangeAdded}, After: &nether},
+	}}
+	var painted claimOverlay
+	painted.set(3, 4)
+	sent := map[protocol.ChunkPos]claimOverlay{
+		{-2, 0}: {},
+		{5, 0}:  painted,
+		{0, 1}:  {},
+		{20, 0}: {},
+	}
+
+	got := claimChangeChunks(diff, "minecraft:overworld", sent)
+	want := map[protocol.ChunkPos]claimOverlay{{-2, 0}: {}, {5, 0}: painted}
+	if !maps.Equal(got, want) {
+		t.Fatalf("chunks = %v, want %v", got, want)
+	}
+
+	diff.Missed = true
+	if got = claimChangeChunks(diff, "minecraft:overworld", sent); !maps.Equal(got, sent) {
+		t.Fatalf("missed diff did not check every chunk sent: %v", got)
+	}
+}
+
+func TestClaimOverlayFollowsTrust(t *testing.T) {
+	cl := testClaim()
+	cl.Location.Pos1, cl.Location.Pos2 = claim.Vector2{X: 2, Z: 0}, claim.Vector2{X: 5, Z: 0}
+	snapshot, err := claim.BuildSnapshot(map[string]claim.PlayerClaim{cl.ID: cl}, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates := snapshot.Candidates("minecraft:overworld", 0, 0)
+
+	stranger, overlaps := claimOverlayOf(snapshot, candidates, protocol.ChunkPos{0, 0}, -64, ClaimActor{XUID: "stranger"})
+	if overlaps != 0 {
+		t.Fatalf("overlaps = %d, want 0", overlaps)
+	}
+	for x := uint8(0); x < 16; x++ {
+		if want := x >= 2 && x <= 5; stranger.denied(x, 0) != want || stranger.denied(x, 1) {
+			t.Fatalf("deny block at %d, 0 = %v, want %v", x, stranger.denied(x, 0), want)
+		}
+	}
+	if trusted, _ := claimOverlayOf(snapshot, candidates, protocol.ChunkPos{0, 0}, -64, ClaimActor{XUID: "trusted"}); trusted != (claimOverlay{}) {
+		t.Fatalf("trusted player was painted deny blocks: %v", trusted)
+	}
+}
+
+func TestClaimOverlaysKeepThrottledChunksPending(t *testing.T) {
+	var overlays claimOverlays
+	overlays.record(correctiveKey{dimension: 0, x: 3, z: 0}, claimOverlay{}, protocol.ChunkPos{})
+	overlays.markPending(0, []protocol.ChunkPos{{3, 0}, {1, 0}, {2, 0}})
+	overlays.markPending(1, []protocol.ChunkPos{{0, 0}})
+
+	throttled := protocol.ChunkPos{1, 0}
+	allow := func(chunkPos protocol.ChunkPos) bool { return chunkPos != throttled }
+	if got := overlays.takePending(0, protocol.ChunkPos{}, 1, allow); !slices.Equal(got, []protocol.ChunkPos{{2, 0}}) {
+		t.Fatalf("first resend = %v, want [[2 0]]", got)
+	}
+	throttled = protocol.ChunkPos{}
+	if got := overlays.takePending(0, protocol.ChunkPos{}, 8, allow); !slices.Equal(got, []protocol.ChunkPos{{1, 0}, {3, 0}}) {
+		t.Fatalf("second resend = %v, want [[1 0] [3 0]]", got)
+	}
+	if got := overlays.takePending(1, protocol.ChunkPos{}, 8, allow); len(got) != 0 {
+		t.Fatalf("chunk of another dimension resent: %v", got)
+	}
+
+	overlays.markPending(0, []protocol.ChunkPos{{3, 0}})
+	overlays.record(correctiveKey{dimension: 0, x: 3, z: 0}, claimOverlay{}, protocol.ChunkPos{})
+	if got := overlays.takePending(0, protocol.ChunkPos{}, 8, allow); len(got) != 0 {
+		t.Fatalf("chunk sent again by the server still resent: %v", got)
+	}
+}
@@ -2,9 +2,13 @@
 package session
 
 import (
+	"context"
 	"log/slog"
 	"time"
 
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/ban"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
 	"github.com/smell-of-curry/gobds/gobds/claim"
 	"github.com/smell-of-curry/gobds/gobds/entity"
 	"github.com/smell-of-curry/gobds/gobds/infra"
@@ -15,17 +19,39 @@ import (
 type Config struct {
 	Client Conn
 	Server Conn
+	// ServerName is the name of the server the player joined, recorded in
+	// audit events.
+	ServerName string
+	// Redial dials a new backend connection for the same player. Sessions
+	// without it are disconnected when their backend connection is lost.
+	Redial func(ctx context.Context) (Conn, error)
+	// Backend is the address of the backend Server is connected to.
+	Backend       string
+	Reconnect     *ReconnectConfig
+	EncryptionKey string
 
 	AFKTimer *infra.AFKTimer
 	Border   *area.Area2D
 
 	ClaimPrefilter     bool
 	ClaimDenyRendering bool
-	Traffic            TrafficConfig
-	TrafficMetrics     *TrafficMetrics
+	// ClaimNotify tells players when they enter or leave a claim. It is nil
+	// if they are not told.
+	ClaimNotify    *ClaimNotifyConfig
+	Traffic        TrafficConfig
+	TrafficMetrics *TrafficMetrics
 
 	EntityFactory *entity.Factory
 	ClaimFactory  *claim.Factory
+	Bans          *ban.Store
+	// ChatFilter checks chat messages before they are forwarded. It is shared
+	// by every session on a server so its rules can be swapped in one place.
+	ChatFilter *chatfilter.Filter
+	// SignFilter checks sign edits before they are forwarded, like
+	// ChatFilter.
+	SignFilter *chatfilter.Filter
+	// Audit receives sign edits and other audit events. It may be nil.
+	Audit audit.Sink
 
 	Log *slog.Logger
 }
@@ -36,14 +62,17 @@ func (c Config) New() *Session {
 		client: c.Client,
 		server: c.Server,
 
-		afkTimer: c.AFKTimer,
-		border:   c.Border,
-
-		claimPrefilter:     c.ClaimPrefilter,
-		claimDenyRendering: c.ClaimDenyRendering,
+		serverName:    c.ServerName,
+		backend:       c.Backend,
+		redial:        c.Redial,
+		encryptionKey: c.EncryptionKey,
 
 		entityFactory: c.EntityFactory,
 		claimFactory:  c.ClaimFactory,
+		bans:          c.Bans,
+		chatFilter:    c.ChatFilter,
+		signFilter:    c.SignFilter,
+		audit:         c.Audit,
 
 		close: make(chan struct{}),
 		corrective: correctiveState{
@@ -56,6 +85,7 @@ func (c Config) New() *Session {
 		data: NewData(c.Client),
 		log:  c.Log,
 	}
+	s.Reconfigure(c)
 	s.afk.lastMoveTime = time.Now()
 	s.afk.lastPosition = c.Client.GameData().PlayerPosition
 	s.registerHandlers()
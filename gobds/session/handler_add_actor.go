@@ -15,7 +15,7 @@ type AddActorHandler struct{}
 
 // Handle ...
 func (*AddActorHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 	pkt := pk.(*packet.AddActor)
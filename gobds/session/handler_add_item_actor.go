@@ -0,0 +1,25 @@
+package session
+
+import (
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/smell-of-curry/gobds/gobds/entity"
+)
+
+// AddItemActorHandler tracks item entities, so their pickups can be checked
+// against claims.
+type AddItemActorHandler struct{}
+
+// Handle ...
+func (*AddItemActorHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
+	if ctx.Val() != s.Server() {
+		return nil
+	}
+	pkt := pk.(*packet.AddItemActor)
+	var itemType string
+	registry := s.handlers[packet.IDItemRegistry].(*ItemRegistryHandler)
+	if entry, ok := registry.Item(int16(pkt.Item.Stack.NetworkID)); ok {
+		itemType = entry.Name
+	}
+	s.entityFactory.Add(entity.NewItem(pkt.EntityUniqueID, pkt.EntityRuntimeID, itemType, pkt.Position))
+	return nil
+}
@@ -10,7 +10,7 @@ type AddPaintingHandler struct{}
 
 // Handle ...
 func (*AddPaintingHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 	pkt := pk.(*packet.AddPainting)
@@ -0,0 +1,169 @@
+package session
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sandertv/gophertunnel/minecraft/text"
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
+)
+
+// BlockActorDataHandler audits and filters sign edits sent by the client, and
+// remembers the signs sent by the server so edits can be logged with the text
+// they replaced.
+type BlockActorDataHandler struct{}
+
+// Handle ...
+func (*BlockActorDataHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
+	pkt := pk.(*packet.BlockActorData)
+	sign, ok := signText(pkt.NBTData)
+	if !ok {
+		return nil
+	}
+	if ctx.Val() != s.client {
+		s.signs.store(s.Data().Dimension(), pkt.Position, pkt.NBTData)
+		return nil
+	}
+	handleSignEdit(s, pkt, sign, ctx)
+	return nil
+}
+
+// handleSignEdit runs a sign edit through the sign filter and records it in
+// the audit log. Rejected edits are cancelled and, if the previous text is
+// known, reverted on the client.
+func handleSignEdit(s *Session, pkt *packet.BlockActorData, sign audit.SignText, ctx *Context) {
+	dimension := s.Data().Dimension()
+	edit := &audit.SignEdit{New: sign}
+	previous, known := s.signs.load(dimension, pkt.Position)
+	if known {
+		old, _ := signText(previous)
+		edit.Old = &old
+	}
+
+	now := s.traffic.now()
+	front := s.checkSignSide(sign.Front, now)
+	back := s.checkSignSide(sign.Back, now)
+	verdict := front
+	if back.Action > front.Action {
+		verdict = back
+	}
+	if verdict.Action != chatfilter.ActionNone {
+		edit.Filter, edit.Rule = verdict.Action.String(), verdict.Rule
+	}
+	if verdict.Action == chatfilter.ActionReplace {
+		stored := audit.SignText{Front: front.Message, Back: back.Message}
+		setSignText(pkt.NBTData, stored)
+		edit.Stored = &stored
+	}
+
+	name, ok := claimDimensionFromInt(dimension, s.GameData().Dimensions)
+	if !ok {
+		name = strconv.Itoa(int(dimension))
+	}
+	s.recordAudit(audit.Event{
+		Type:      audit.TypeSignEdit,
+		Dimension: name,
+		Position:  &[3]int32{pkt.Position.X(), pkt.Position.Y(), pkt.Position.Z()},
+		Sign:      edit,
+	})
+
+	if verdict.Action <= chatfilter.ActionReplace {
+		s.signs.store(dimension, pkt.Position, pkt.NBTData)
+		return
+	}
+	ctx.Cancel()
+	s.log.Debug("sign edit rejected", "rule", verdict.Rule, "action", verdict.Action)
+	if verdict.Notice != "" {
+		s.Message(text.Colourf("<red>%s</red>", verdict.Notice))
+	}
+	if known {
+		_ = s.client.WritePacket(&packet.BlockActorData{Position: pkt.Position, NBTData: previous})
+	}
+}
+
+// checkSignSide checks the text of one side of a sign against the sign
+// filter. Empty sides are not checked.
+func (s *Session) checkSignSide(side string, now time.Time) chatfilter.Verdict {
+	if side == "" {
+		return chatfilter.Verdict{}
+	}
+	return s.signFilter.Check(&s.signEditor, side, now)
+}
+
+// signText returns the text on both sides of the sign described by data. ok
+// is false if data does not describe a sign.
+func signText(data map[string]any) (sign audit.SignText, ok bool) {
+	id, _ := data["id"].(string)
+	if id != "Sign" && id != "HangingSign" {
+		return sign, false
+	}
+	front, hasFront := data["FrontText"].(map[string]any)
+	if !hasFront {
+		// Signs from before double-sided signs only have a front.
+		sign.Front, _ = data["Text"].(string)
+		return sign, true
+	}
+	sign.Front, _ = front["Text"].(string)
+	if back, ok := data["BackText"].(map[string]any); ok {
+		sign.Back, _ = back["Text"].(string)
+	}
+	return sign, true
+}
+
+// setSignText replaces the text on both sides of the sign described by data.
+func setSignText(data map[string]any, sign audit.SignText) {
+	front, hasFront := data["FrontText"].(map[string]any)
+	if !hasFront {
+		data["Text"] = sign.Front
+		return
+	}
+	front["Text"] = sign.Front
+	if back, ok := data["BackText"].(map[string]any); ok {
+		back["Text"] = sign.Back
+	}
+}
+
+// maxKnownSigns bounds the signs a session remembers.
+const maxKnownSigns = 4096
+
+// signCache remembers the last known block actor data of the signs around a
+// player.
+type signCache struct {
+	mu    sync.Mutex
+	signs map[signKey]map[string]any
+}
+
+type signKey struct {
+	dimension int32
+	pos       protocol.BlockPos
+}
+
+// load returns the last known data of the sign at pos.
+func (c *signCache) load(dimension int32, pos protocol.BlockPos) (map[string]any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.signs[signKey{dimension: dimension, pos: pos}]
+	return data, ok
+}
+
+// store remembers data as the sign at pos. When the cache is full an
+// arbitrary sign is forgotten to make room.
+func (c *signCache) store(dimension int32, pos protocol.BlockPos, data map[string]any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := signKey{dimension: dimension, pos: pos}
+	if c.signs == nil {
+		c.signs = make(map[signKey]map[string]any)
+	}
+	if _, ok := c.signs[key]; !ok && len(c.signs) >= maxKnownSigns {
+		for evict := range c.signs {
+			delete(c.signs, evict)
+			break
+		}
+	}
+	c.signs[key] = data
+}
@@ -0,0 +1,142 @@
+package session
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/nbt"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
+	"github.com/smell-of-curry/gobds/gobds/entity"
+)
+
+type auditRecorder struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (r *auditRecorder) Record(e audit.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func signNBT(front, back string) map[string]any {
+	return map[string]any{
+		"id":        "Sign",
+		"FrontText": map[string]any{"Text": front},
+		"BackText":  map[string]any{"Text": back},
+	}
+}
+
+func TestSignEditsAreAuditedAndFiltered(t *testing.T) {
+	rules, err := chatfilter.Rules{Words: []chatfilter.ListRule{
+		{Action: chatfilter.ActionReplace, Entries: []string{"darn"}},
+		{Action: chatfilter.ActionWarn, Entries: []string{"grief"}},
+	}}.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := &chatfilter.Filter{}
+	filter.SetRules(rules)
+	recorder := &auditRecorder{}
+	identity := login.IdentityData{XUID: "1", DisplayName: "Steve"}
+	client := &replayConn{identityData: identity}
+	server := &replayConn{gameData: minecraft.GameData{}, identityData: identity}
+	s := Config{
+		Client:        client,
+		Server:        server,
+		ServerName:    "lobby",
+		SignFilter:    filter,
+		Audit:         recorder,
+		EntityFactory: entity.NewFactory(),
+		Log:           slog.Default(),
+	}.New()
+	pos := protocol.BlockPos{1, 64, 2}
+
+	if forwarded, _ := s.handlePacket(&packet.BlockActorData{Position: pos, NBTData: signNBT("hello", "")}, server); !forwarded {
+		t.Fatal("signs sent by the server must be forwarded")
+	}
+	edit := &packet.BlockActorData{Position: pos, NBTData: signNBT("darn it", "ok")}
+	if forwarded, _ := s.handlePacket(edit, client); !forwarded {
+		t.Fatal("a rewritten sign edit must be forwarded")
+	}
+	if got, _ := signText(edit.NBTData); got != (audit.SignText{Front: "**** it", Back: "ok"}) {
+		t.Fatalf("sign text not rewritten: %+v", got)
+	}
+	if len(recorder.events) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(recorder.events))
+	}
+	event := recorder.events[0]
+	if event.Type != audit.TypeSignEdit || event.Server != "lobby" || event.XUID != "1" ||
+		event.Dimension != "minecraft:overworld" || *event.Position != [3]int32{1, 64, 2} {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if event.Sign.Old == nil || event.Sign.Old.Front != "hello" || event.Sign.New.Front != "darn it" ||
+		event.Sign.Filter != "replace" || event.Sign.Stored == nil || event.Sign.Stored.Front != "**** it" {
+		t.Fatalf("unexpected sign edit %+v", event.Sign)
+	}
+
+	client.drain()
+	if forwarded, _ := s.handlePacket(&packet.BlockActorData{Position: pos, NBTData: signNBT("", "grief here")}, client); forwarded {
+		t.Fatal("a rejected sign edit must not be forwarded")
+	}
+	var reverted bool
+	for _, pk := range client.drain() {
+		if revert, ok := pk.(*packet.BlockActorData); ok {
+			text, _ := signText(revert.NBTData)
+			reverted = revert.Position == pos && text.Front == "**** it"
+		}
+	}
+	if !reverted {
+		t.Fatal("rejected sign edit not reverted to the last stored text")
+	}
+	if last := recorder.events[len(recorder.events)-1]; last.Sign.Filter != "warn" || last.Sign.Stored != nil {
+		t.Fatalf("unexpected rejected edit %+v", last.Sign)
+	}
+}
+
+func TestSignTextReadsLegacySigns(t *testing.T) {
+	data := map[string]any{"id": "Sign", "Text": "old"}
+	if text, ok := signText(data); !ok || text.Front != "old" || text.Back != "" {
+		t.Fatalf("unexpected legacy sign text %+v", text)
+	}
+	setSignText(data, audit.SignText{Front: "new"})
+	if data["Text"] != "new" {
+		t.Fatal("legacy sign text not replaced")
+	}
+	if _, ok := signText(map[string]any{"id": "Chest"}); ok {
+		t.Fatal("non-sign block actors must be ignored")
+	}
+}
+
+func TestSignCacheStoresChunkBlockEntities(t *testing.T) {
+	sign := signNBT("hello", "")
+	sign["x"], sign["y"], sign["z"] = int32(1), int32(64), int32(-2)
+	var buf bytes.Buffer
+	for _, data := range []map[string]any{{"id": "Chest", "x": int32(0), "y": int32(64), "z": int32(0)}, sign} {
+		raw, err := nbt.MarshalEncoding(data, nbt.NetworkLittleEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(raw)
+	}
+
+	var cache signCache
+	if err := cache.storeBlockEntities(0, &buf); err != nil {
+		t.Fatal(err)
+	}
+	data, ok := cache.load(0, protocol.BlockPos{1, 64, -2})
+	if text, _ := signText(data); !ok || text.Front != "hello" {
+		t.Fatalf("sign from the chunk not stored: %v", data)
+	}
+	if _, ok = cache.load(0, protocol.BlockPos{0, 64, 0}); ok {
+		t.Fatal("block entity that is not a sign stored")
+	}
+}
@@ -7,8 +7,9 @@ type ChangeDimensionHandler struct{}
 
 // Handle ...
 func (*ChangeDimensionHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
-	if ctx.Val() == s.server {
+	if ctx.Val() == s.Server() {
 		s.Data().SetDimension(pk.(*packet.ChangeDimension).Dimension)
+		s.claimOverlays.reset()
 	}
 	return nil
 }
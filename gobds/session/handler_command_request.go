@@ -17,7 +17,7 @@ func (*CommandRequestHandler) Handle(s *Session, pk packet.Packet, ctx *Context)
 	if ctx.Val() != s.client {
 		return nil
 	}
-	cmd, empty, err := commandName(pkt.CommandLine, s.traffic.config.MaxCommandBytes)
+	cmd, empty, err := commandName(pkt.CommandLine, s.traffic.limits().MaxCommandBytes)
 	if err != nil {
 		s.traffic.malformed(trafficCommand)
 		return err
@@ -27,7 +27,7 @@ func (*CommandRequestHandler) Handle(s *Session, pk packet.Packet, ctx *Context)
 		ctx.Cancel()
 		return nil
 	}
-	if !s.traffic.allow(trafficCommand) {
+	if !s.allowTraffic(trafficCommand) {
 		ctx.Cancel()
 		return nil
 	}
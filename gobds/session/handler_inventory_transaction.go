@@ -18,11 +18,11 @@ type InventoryTransactionHandler struct{}
 func (h *InventoryTransactionHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
 	pkt := pk.(*packet.InventoryTransaction)
 	if ctx.Val() == s.client {
-		if len(pkt.Actions) > s.traffic.config.MaxInventoryActions {
+		if len(pkt.Actions) > s.traffic.limits().MaxInventoryActions {
 			s.traffic.malformed(trafficInventory)
 			return malformedPacketError{reason: "inventory transaction has too many actions"}
 		}
-		if !s.traffic.allow(trafficInventory) {
+		if !s.allowTraffic(trafficInventory) {
 			ctx.Cancel()
 			return nil
 		}
@@ -103,13 +103,14 @@ func (h *InventoryTransactionHandler) handleInteraction(s *Session, pkt *packet.
 
 // handleWorldBorder ...
 func (h *InventoryTransactionHandler) handleWorldBorder(s *Session, pkt *packet.InventoryTransaction, ctx *Context) {
-	if s.border == nil {
+	border := s.border.Load()
+	if border == nil {
 		return
 	}
 
 	if transaction, ok := pkt.TransactionData.(*protocol.UseItemTransactionData); ok {
 		if transaction.ActionType == protocol.UseItemActionClickBlock {
-			if !s.border.PositionInside(transaction.BlockPosition.X(), transaction.BlockPosition.Z()) {
+			if !border.PositionInside(transaction.BlockPosition.X(), transaction.BlockPosition.Z()) {
 				ctx.Cancel()
 			}
 		}
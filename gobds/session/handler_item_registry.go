@@ -15,7 +15,7 @@ type ItemRegistryHandler struct {
 
 // Handle ...
 func (h *ItemRegistryHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 	pkt := pk.(*packet.ItemRegistry)
@@ -12,7 +12,7 @@ type ItemStackRequestHandler struct{}
 func (*ItemStackRequestHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
 	pkt := pk.(*packet.ItemStackRequest)
 	if ctx.Val() == s.client {
-		drop, err := validateItemStackRequest(pkt, s.traffic.config)
+		drop, err := validateItemStackRequest(pkt, *s.traffic.limits())
 		if drop {
 			s.traffic.malformed(trafficStack)
 			ctx.Cancel()
@@ -22,7 +22,7 @@ func (*ItemStackRequestHandler) Handle(s *Session, pk packet.Packet, ctx *Contex
 			s.traffic.malformed(trafficStack)
 			return err
 		}
-		if !s.traffic.allow(trafficStack) {
+		if !s.allowTraffic(trafficStack) {
 			ctx.Cancel()
 			return nil
 		}
@@ -4,19 +4,18 @@ import (
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 )
 
-// LevelChunkHandler ...
+// LevelChunkHandler drops chunks outside the world border, and remembers the
+// signs in the chunks it forwards.
 type LevelChunkHandler struct{}
 
 // Handle ...
 func (*LevelChunkHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
 	pkt := pk.(*packet.LevelChunk)
 
-	if s.border == nil {
-		return nil
-	}
-
-	if !s.border.ChunkInside(pkt.Position) {
+	if border := s.border.Load(); border != nil && !border.ChunkInside(pkt.Position) {
 		ctx.Cancel()
+		return nil
 	}
+	s.storeLevelChunkSigns(pkt)
 	return nil
 }
@@ -12,7 +12,7 @@ type ModalFormRequestHandler struct{}
 
 // Handle ...
 func (*ModalFormRequestHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 
@@ -18,7 +18,7 @@ func (*ModalFormResponseHandler) Handle(s *Session, pk packet.Packet, ctx *Conte
 	pkt := pk.(*packet.ModalFormResponse)
 	response, present := pkt.ResponseData.Value()
 	if present {
-		if err := validateFormResponse(response, s.traffic.config); err != nil {
+		if err := validateFormResponse(response, *s.traffic.limits()); err != nil {
 			s.traffic.malformed(trafficForm)
 			return err
 		}
@@ -27,7 +27,7 @@ func (*ModalFormResponseHandler) Handle(s *Session, pk packet.Packet, ctx *Conte
 		s.traffic.malformed(trafficForm)
 		return malformedPacketError{reason: "form response has no response or cancellation"}
 	}
-	if !s.traffic.allow(trafficForm) {
+	if !s.allowTraffic(trafficForm) {
 		ctx.Cancel()
 	}
 	return nil
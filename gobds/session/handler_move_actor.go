@@ -10,7 +10,7 @@ type MoveActorHandler struct{}
 
 // Handle ...
 func (*MoveActorHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 	switch pkt := pk.(type) {
@@ -35,6 +35,8 @@ func (h *PlayerAuthInputHandler) Handle(s *Session, pk packet.Packet, _ *Context
 	if pkt.Tick%20 == 0 {
 		s.ForwardPing()
 		s.TouchMovement(pkt.Position, pkt.Yaw, pkt.Pitch)
+		s.updateClaimPresence(pkt.Position)
+		s.resendClaimOverlays()
 	}
 
 	h.handleWorldInteractions(s, pkt)
@@ -44,9 +46,10 @@ func (h *PlayerAuthInputHandler) Handle(s *Session, pk packet.Packet, _ *Context
 // handleWorldInteractions ...
 func (h *PlayerAuthInputHandler) handleWorldInteractions(s *Session, pkt *packet.PlayerAuthInput) {
 	clientData := s.Data()
+	border := s.border.Load()
 	denied := filterPlayerAuthInputPacket(pkt, func(blockAction protocol.PlayerBlockAction) bool {
 		blockPosition := blockAction.BlockPos
-		if s.border != nil && !s.border.PositionInside(blockPosition.X(), blockPosition.Z()) {
+		if border != nil && !border.PositionInside(blockPosition.X(), blockPosition.Z()) {
 			return true
 		}
 		return !s.claimActionPermitted(ClaimActionBlockBreak, blockPosToVec3(blockPosition))
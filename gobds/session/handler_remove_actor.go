@@ -9,7 +9,7 @@ type RemoveActorHandler struct{}
 
 // Handle ...
 func (*RemoveActorHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 	pkt := pk.(*packet.RemoveActor)
@@ -8,7 +8,7 @@ type SetPlayerGameTypeHandler struct{}
 // Handle ...
 func (*SetPlayerGameTypeHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
 	pkt := pk.(*packet.SetPlayerGameType)
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 	s.Data().SetGameMode(pkt.GameType)
@@ -23,7 +23,7 @@ func (*SubChunkHandler) Handle(s *Session, pk packet.Packet, ctx *Context) (err
 		start := time.Now()
 		defer func() { s.claimFactory.Metrics().Latency(time.Since(start)) }()
 	}
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 	pkt := pk.(*packet.SubChunk)
@@ -49,6 +49,11 @@ func (*SubChunkHandler) Handle(s *Session, pk packet.Packet, ctx *Context) (err
 	}
 
 	pkt.SubChunkEntries = entries
+	if rangeFound && !pkt.CacheEnabled {
+		for _, entry := range entries {
+			s.storeSubChunkSigns(pkt.Dimension, dimensionRange, entry)
+		}
+	}
 	return nil
 }
 
@@ -57,7 +62,7 @@ func resolveClaimSubChunkContext(
 	dimensionID int32,
 	dimensions []protocol.DimensionDefinition,
 ) (*claim.Snapshot, claim.QueryStatus, string, bool) {
-	if !s.claimDenyRendering || s.claimFactory == nil {
+	if !s.claimDenyRendering.Load() || s.claimFactory == nil {
 		return nil, 0, "", false
 	}
 	snapshot, snapshotStatus := s.claimFactory.Snapshot(time.Now())
@@ -88,19 +93,31 @@ func filterSubChunkEntry(
 		pkt.Position.Z() + int32(entry.Offset[2]),
 	}
 
-	if s.border != nil && !s.border.ChunkInside(chunkPos) {
+	if border := s.border.Load(); border != nil && !border.ChunkInside(chunkPos) {
 		return nil
 	}
 
-	if !s.claimDenyRendering || s.claimFactory == nil {
+	if !s.claimDenyRendering.Load() || s.claimFactory == nil {
 		return []protocol.SubChunkEntry{entry}
 	}
 
 	// GoBDS disables the backend blob cache, so successful entries normally
 	// contain the sub-chunk bytes inline. Leave cached entries untouched if
 	// that invariant changes.
-	if entry.Result != protocol.SubChunkResultSuccess || !rangeFound || !dimensionFound ||
-		snapshotStatus != claim.QueryReady || pkt.CacheEnabled {
+	if entry.Result != protocol.SubChunkResultSuccess || !rangeFound || pkt.CacheEnabled {
+		return []protocol.SubChunkEntry{entry}
+	}
+	// Deny blocks are only painted in the bottom sub-chunk, so that is the one
+	// the session remembers the deny blocks of the chunk for.
+	sectionY := pkt.Position.Y() + int32(entry.Offset[1])
+	bottom := sectionY == int32(dimensionRange.Min()>>4)
+	overlayKey := correctiveKey{dimension: pkt.Dimension, x: chunkPos.X(), z: chunkPos.Z()}
+	position := s.Position()
+	centre := protocol.ChunkPos{chunkCoordinate(position.X()), chunkCoordinate(position.Z())}
+	if !dimensionFound || snapshotStatus != claim.QueryReady {
+		if bottom {
+			s.claimOverlays.record(overlayKey, claimOverlay{}, centre)
+		}
 		return []protocol.SubChunkEntry{entry}
 	}
 	chunkX := float32(chunkPos.X() << 4)
@@ -108,39 +125,48 @@ func filterSubChunkEntry(
 	candidates := snapshot.Candidates(dimension, chunkX, chunkZ)
 	s.claimFactory.Metrics().Candidates(len(candidates))
 
-	return []protocol.SubChunkEntry{applyClaimDenyBlocks(
+	entry, overlay := applyClaimDenyBlocks(
 		s,
 		pkt,
 		entry,
 		chunkPos,
 		dimensionRange,
+		snapshot,
 		candidates,
 		denyBlockRuntimeID(s.GameData().UseBlockNetworkIDHashes),
 		ClaimActor{XUID: s.IdentityData().XUID, Operator: s.Data().Operator()},
-	)}
+	)
+	if bottom {
+		s.claimOverlays.record(overlayKey, overlay, centre)
+	}
+	return []protocol.SubChunkEntry{entry}
 }
 
+// applyClaimDenyBlocks paints the deny blocks of claims into entry if it is
+// the bottom sub-chunk of the chunk at chunkPos, and returns the entry with
+// the deny blocks it was sent with.
 func applyClaimDenyBlocks(
 	s *Session,
 	pkt *packet.SubChunk,
 	entry protocol.SubChunkEntry,
 	chunkPos protocol.ChunkPos,
 	dimensionRange cube.Range,
+	snapshot *claim.Snapshot,
 	claims []*claim.PlayerClaim,
 	denyID uint32,
 	actor ClaimActor,
-) protocol.SubChunkEntry {
+) (protocol.SubChunkEntry, claimOverlay) {
 	sectionY := pkt.Position.Y() + int32(entry.Offset[1])
 	if sectionY != int32(dimensionRange.Min()>>4) {
-		return entry
+		return entry, claimOverlay{}
 	}
 	if len(claims) == 0 {
-		return entry
+		return entry, claimOverlay{}
 	}
 
 	rawPayload, ok := entry.RawPayload.Value()
 	if !ok {
-		return entry
+		return entry, claimOverlay{}
 	}
 	virtualChunk := chunk.New(world.DefaultBlockRegistry, dimensionRange)
 	var index byte
@@ -149,39 +175,31 @@ func applyClaimDenyBlocks(
 	if err != nil {
 		s.claimFactory.Metrics().SubchunkError()
 		s.log.Error("decode subchunk entry", "error", err)
-		return entry
+		return entry, claimOverlay{}
 	}
 	s.claimFactory.Metrics().SubchunkDecoded()
 	if int(index) >= len(virtualChunk.Sub()) {
 		s.claimFactory.Metrics().SubchunkError()
 		s.log.Error("decode subchunk entry", "error", "subchunk index outside dimension range", "index", index)
-		return entry
+		return entry, claimOverlay{}
 	}
 	blockEntityPayload := bytes.Clone(buf.Bytes())
 
-	var modified bool
+	overlay, overlaps := claimOverlayOf(snapshot, claims, chunkPos, int32(dimensionRange.Min()), actor)
+	for range overlaps {
+		s.claimFactory.Metrics().Reason(claim.QueryOverlap)
+	}
 	for z := uint8(0); z < 16; z++ {
 		for x := uint8(0); x < 16; x++ {
-			blockPos := protocol.BlockPos{
-				(chunkPos.X() << 4) + int32(x), 0, (chunkPos.Z() << 4) + int32(z),
-			}
-			position := blockPosToVec3(blockPos)
-			matched, ambiguous := singleClaimAt(claims, position.X(), position.Z())
-			if ambiguous {
-				s.claimFactory.Metrics().Reason(claim.QueryOverlap)
-			}
-			denied := !ambiguous && matched != nil &&
-				!ClaimActionPermitted(*matched, actor, ClaimActionRender, position)
+			denied := overlay.denied(x, z)
 			s.claimFactory.Metrics().Action(uint8(ClaimActionRender), !denied)
-			if !denied {
-				continue
+			if denied {
+				decodedEntry.SetBlock(x, 0, z, 0, denyID)
 			}
-			decodedEntry.SetBlock(x, 0, z, 0, denyID)
-			modified = true
 		}
 	}
-	if !modified {
-		return entry
+	if overlay == (claimOverlay{}) {
+		return entry, overlay
 	}
 	s.claimFactory.Metrics().SubchunkModified()
 	virtualChunk.Sub()[index] = decodedEntry
@@ -189,7 +207,7 @@ func applyClaimDenyBlocks(
 		chunk.EncodeSubChunk(virtualChunk, chunk.NetworkEncoding, int(index)),
 		blockEntityPayload...,
 	))
-	return entry
+	return entry, overlay
 }
 
 // decodeSubChunk links Dragonfly's unexported single-subchunk decoder.
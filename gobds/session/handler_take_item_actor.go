@@ -0,0 +1,50 @@
+package session
+
+import (
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/entity"
+)
+
+// TakeItemActorHandler checks item pickups by the player against claims.
+// BDS decides pickups on its own and only reports them once the item is in
+// the player's inventory, so the proxy cannot refuse a pickup. One the claim
+// denies is counted and audited as unblocked, so that moderators can follow
+// it up, but it is neither undone nor reported as refused: blocking pickups
+// is left to the behavior pack on BDS. The item is checked at its last
+// position, kept current by MoveActorHandler.
+type TakeItemActorHandler struct{}
+
+// Handle ...
+func (*TakeItemActorHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
+	if ctx.Val() != s.Server() || s.claimFactory == nil {
+		return nil
+	}
+	pkt := pk.(*packet.TakeItemActor)
+	if pkt.TakerEntityRuntimeID != s.GameData().EntityRuntimeID {
+		return nil
+	}
+	item, ok := s.entityFactory.ByRuntimeID(pkt.ItemActorRuntimeID)
+	if !ok || item.ActorType() != entity.ItemActorType {
+		return nil
+	}
+	s.claimFactory.Metrics().Packet()
+	start := time.Now()
+	defer func() { s.claimFactory.Metrics().Latency(time.Since(start)) }()
+
+	permitted, denial := s.claimActionDecision(
+		ClaimActionItemPickup,
+		claimActionData{position: item.Position(), typeID: item.ItemType()},
+	)
+	// The pickup was forwarded either way: BDS already made it.
+	s.claimFactory.Metrics().Action(uint8(ClaimActionItemPickup), true)
+	if permitted {
+		return nil
+	}
+	s.claimFactory.Metrics().PickupUnblocked()
+	denial.Type = audit.TypePickupUnblocked
+	s.recordAudit(denial)
+	return nil
+}
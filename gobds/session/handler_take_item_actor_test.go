@@ -0,0 +1,130 @@
+package session
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+	"github.com/smell-of-curry/gobds/gobds/entity"
+	"github.com/smell-of-curry/gobds/gobds/service"
+	"github.com/smell-of-curry/gobds/gobds/util/exposition"
+)
+
+func TestUnblockedItemPickupsAreCountedAndAudited(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	factory := claim.NewFactory(service.Config{}, "TEST", time.Minute, time.Minute, log)
+	err := factory.Publish(map[string]claim.PlayerClaim{
+		"farm": {
+			ID:        "farm",
+			OwnerXUID: "owner",
+			Location: claim.Location{
+				Dimension: "minecraft:overworld",
+				Pos1:      claim.Vector2{X: 0, Z: 0},
+				Pos2:      claim.Vector2{X: 15, Z: 15},
+			},
+			Features: []claim.Feature{{
+				Type:        claim.FeatureTypePickupItems,
+				ItemTypeIDs: []string{"minecraft:wheat"},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &auditRecorder{}
+	identity := login.IdentityData{XUID: "1", DisplayName: "Steve"}
+	gameData := minecraft.GameData{
+		EntityRuntimeID: 1,
+		Items: []protocol.ItemEntry{
+			{Name: "minecraft:wheat", RuntimeID: 5},
+			{Name: "minecraft:diamond", RuntimeID: 6},
+		},
+	}
+	client := &replayConn{gameData: gameData, identityData: identity}
+	server := &replayConn{gameData: gameData, identityData: identity}
+	s := Config{
+		Client:         client,
+		Server:         server,
+		ServerName:     "lobby",
+		ClaimPrefilter: true,
+		ClaimFactory:   factory,
+		Audit:          recorder,
+		EntityFactory:  entity.NewFactory(),
+		Log:            log,
+	}.New()
+
+	inside, outside := mgl32.Vec3{4.5, 64, 5.5}, mgl32.Vec3{40.5, 64, 5.5}
+	addItem := func(runtimeID uint64, networkID int32, position mgl32.Vec3) {
+		t.Helper()
+		pk := &packet.AddItemActor{
+			EntityUniqueID:  int64(runtimeID),
+			EntityRuntimeID: runtimeID,
+			Position:        position,
+		}
+		pk.Item.Stack.NetworkID = networkID
+		if forwarded, _ := s.handlePacket(pk, server); !forwarded {
+			t.Fatal("item actors must be forwarded")
+		}
+	}
+	addItem(10, 5, inside)
+	addItem(11, 6, inside)
+	// Items are checked where they are picked up, not where they spawned.
+	addItem(12, 6, outside)
+	addItem(13, 6, inside)
+	_, _ = s.handlePacket(&packet.MoveActorAbsolute{EntityRuntimeID: 12, Position: inside}, server)
+	move := &packet.MoveActorDelta{EntityRuntimeID: 13}
+	move.PositionX = protocol.Option(outside.X())
+	_, _ = s.handlePacket(move, server)
+	for _, pk := range []*packet.TakeItemActor{
+		{ItemActorRuntimeID: 10, TakerEntityRuntimeID: 1},
+		{ItemActorRuntimeID: 11, TakerEntityRuntimeID: 2},
+		{ItemActorRuntimeID: 11, TakerEntityRuntimeID: 1},
+		{ItemActorRuntimeID: 12, TakerEntityRuntimeID: 1},
+		{ItemActorRuntimeID: 13, TakerEntityRuntimeID: 1},
+	} {
+		if forwarded, _ := s.handlePacket(pk, server); !forwarded {
+			t.Fatal("pickups must be forwarded, BDS already made them")
+		}
+	}
+
+	if len(recorder.events) != 2 {
+		t.Fatalf("recorded %d events, want 2", len(recorder.events))
+	}
+	e := recorder.events[0]
+	if e.Type != audit.TypePickupUnblocked || e.Action != "item_pickup" || e.Target != "minecraft:diamond" ||
+		e.Claim == nil || e.Claim.ID != "farm" {
+		t.Fatalf("unexpected unblocked pickup %+v", e)
+	}
+	if moved := recorder.events[1]; moved.Position == nil || *moved.Position != [3]int32{4, 64, 5} {
+		t.Fatalf("moved item not checked where it was picked up: %+v", moved)
+	}
+	for _, pk := range client.drain() {
+		if _, ok := pk.(*packet.Text); ok {
+			t.Fatal("player was told a pickup BDS made was refused")
+		}
+	}
+	registry := exposition.NewRegistry()
+	factory.Metrics().Collect(registry, nil)
+	var metrics bytes.Buffer
+	if _, err := registry.WriteTo(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`gobds_claim_actions_denied_total{server="TEST",action="item_pickup"} 0`,
+		`gobds_claim_pickups_unblocked_total{server="TEST"} 2`,
+	} {
+		if !strings.Contains(metrics.String(), line) {
+			t.Fatalf("metrics missing %q:\n%s", line, metrics.String())
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sandertv/gophertunnel/minecraft/text"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
 	"github.com/smell-of-curry/gobds/gobds/cmd"
 )
 
@@ -52,6 +54,10 @@ func (*TextHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
 		return nil
 	}
 	message := messageData.RawText[0].Text
+	if handled, err := handleProxyBanMessage(s, message); handled {
+		ctx.Cancel()
+		return err
+	}
 	if !strings.HasPrefix(message, "[PROXY_SYSTEM][COMMANDS]=") {
 		return nil
 	}
@@ -98,13 +104,13 @@ func (*TextHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
 }
 
 func handleClientText(s *Session, pkt *packet.Text, ctx *Context) error {
-	if len(pkt.Message) > s.traffic.config.MaxTextBytes || len(pkt.SourceName) > 256 ||
+	if len(pkt.Message) > s.traffic.limits().MaxTextBytes || len(pkt.SourceName) > 256 ||
 		len(pkt.Parameters) > 64 {
 		s.traffic.malformed(trafficChat)
 		return malformedPacketError{reason: "text payload exceeds maximum length"}
 	}
 	for _, parameter := range pkt.Parameters {
-		if len(parameter) > s.traffic.config.MaxTextBytes {
+		if len(parameter) > s.traffic.limits().MaxTextBytes {
 			s.traffic.malformed(trafficChat)
 			return malformedPacketError{reason: "text parameter exceeds maximum length"}
 		}
@@ -114,8 +120,26 @@ func handleClientText(s *Session, pkt *packet.Text, ctx *Context) error {
 		ctx.Cancel()
 		return nil
 	}
-	if !s.traffic.allow(trafficChat) {
+	if !s.allowTraffic(trafficChat) {
 		ctx.Cancel()
+		return nil
+	}
+	if pkt.TextType != packet.TextTypeChat {
+		return nil
+	}
+	verdict := s.chatFilter.Check(&s.chat, pkt.Message, s.traffic.now())
+	if verdict.Action == chatfilter.ActionNone {
+		return nil
+	}
+	s.traffic.filtered(verdict.Action)
+	if verdict.Notice != "" {
+		s.Message(text.Colourf("<red>%s</red>", verdict.Notice))
+	}
+	if verdict.Action == chatfilter.ActionReplace {
+		pkt.Message = verdict.Message
+		return nil
 	}
+	s.log.Debug("chat message filtered", "rule", verdict.Rule, "action", verdict.Action)
+	ctx.Cancel()
 	return nil
 }
@@ -13,7 +13,7 @@ type UpdateAbilitiesHandler struct{}
 // Handle ...
 func (*UpdateAbilitiesHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
 	pkt := pk.(*packet.UpdateAbilities)
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 	abilityData := pkt.AbilityData
@@ -8,7 +8,7 @@ type UpdatePlayerGameTypeHandler struct{}
 // Handle ...
 func (*UpdatePlayerGameTypeHandler) Handle(s *Session, pk packet.Packet, ctx *Context) error {
 	pkt := pk.(*packet.UpdatePlayerGameType)
-	if ctx.Val() != s.server {
+	if ctx.Val() != s.Server() {
 		return nil
 	}
 	if pkt.PlayerUniqueID != s.GameData().EntityUniqueID {
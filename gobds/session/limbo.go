@@ -0,0 +1,222 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sandertv/gophertunnel/minecraft/text"
+)
+
+// ReconnectConfig configures how a session waits for its backend to come back
+// after the connection to it is lost.
+type ReconnectConfig struct {
+	// Timeout is how long the player is held before they are disconnected.
+	Timeout time.Duration
+	// RetryInterval is the delay between attempts to dial the backend.
+	RetryInterval time.Duration
+}
+
+const (
+	// reconnectDialTimeout bounds a single attempt to dial and spawn on the
+	// backend, so an attempt against a half-started server cannot use up the
+	// whole reconnect timeout.
+	reconnectDialTimeout = 15 * time.Second
+	// LimboY is the height players are held at while they wait in an empty
+	// world, both in the limbo dimension and in the queue.
+	LimboY = 100
+
+	dimensionNether = 1
+	dimensionEnd    = 2
+)
+
+// backendLost reports whether err ended the backend connection without the
+// backend disconnecting the player on purpose. A backend that shuts down
+// cleanly disconnects everyone with its "server closed" message, which is
+// treated as a restart too.
+func backendLost(err error) bool {
+	var disc minecraft.DisconnectError
+	if !errors.As(err, &disc) {
+		return true
+	}
+	message := strings.ToLower(disc.Error())
+	return strings.Contains(message, "serverclosed") || strings.Contains(message, "server closed")
+}
+
+// InLimbo reports whether the session is waiting for its backend to come back.
+func (s *Session) InLimbo() bool {
+	return s.limbo.Load()
+}
+
+// reconnect holds the player in limbo while the backend is unreachable and
+// redials it until it is back, the timeout passes, or the client leaves. It
+// reports whether the player was reattached to a new backend connection.
+func (s *Session) reconnect(ctx context.Context, clientDone <-chan struct{}) bool {
+	conf := s.reconnectConfig.Load()
+	if conf == nil || s.redial == nil {
+		return false
+	}
+	s.log.Info("backend connection lost, holding player in limbo", "timeout", conf.Timeout)
+	s.enterLimbo()
+
+	deadline := time.Now().Add(conf.Timeout)
+	for attempt := 1; time.Now().Before(deadline); attempt++ {
+		s.showLimboTitle()
+		attemptCtx, cancel := context.WithTimeout(ctx, min(time.Until(deadline), reconnectDialTimeout))
+		err := s.attach(attemptCtx)
+		cancel()
+		if err == nil {
+			s.log.Info("reattached to backend", "attempts", attempt)
+			return true
+		}
+		s.log.Debug("backend still unreachable", "attempt", attempt, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-clientDone:
+			return false
+		case <-time.After(conf.RetryInterval):
+		}
+	}
+	s.log.Info("backend did not come back in time", "timeout", conf.Timeout)
+	return false
+}
+
+// enterLimbo stops forwarding and moves the player to an empty dimension, so
+// nothing of the lost backend's world stays visible or interactive.
+func (s *Session) enterLimbo() {
+	s.limbo.Store(true)
+	for _, e := range s.entityFactory.All() {
+		s.WriteToClient(&packet.RemoveActor{EntityUniqueID: e.UniqueID()})
+		s.entityFactory.RemoveFromRuntimeID(e.RuntimeID())
+	}
+	s.changeDimension(limboDimension(s.Data().Dimension()), mgl32.Vec3{0, LimboY, 0}, true)
+}
+
+// showLimboTitle tells the player their server is restarting.
+func (s *Session) showLimboTitle() {
+	s.WriteToClient(&packet.SetTitle{
+		ActionType: packet.TitleActionSetTitle,
+		Text:       text.Colourf("<yellow>Server restarting</yellow>"),
+	})
+	s.WriteToClient(&packet.SetTitle{
+		ActionType: packet.TitleActionSetSubtitle,
+		Text:       text.Colourf("<grey>You will be reconnected automatically</grey>"),
+	})
+}
+
+// attach dials and spawns on the backend, then moves the player from limbo
+// into the backend's world and resumes forwarding.
+func (s *Session) attach(ctx context.Context) error {
+	server, err := s.redial(ctx)
+	if err != nil {
+		return err
+	}
+	if err = server.DoSpawnContext(ctx); err != nil {
+		_ = server.Close()
+		return fmt.Errorf("spawn: %w", err)
+	}
+	gameData := server.GameData()
+	s.ids.Store(newIDTranslation(s.client.GameData(), gameData))
+	s.setServer(server)
+
+	if gameData.Dimension == s.Data().Dimension() {
+		// The client ignores a change to the dimension it is already in, so
+		// hop through another one first.
+		s.changeDimension(limboDimension(gameData.Dimension), gameData.PlayerPosition, true)
+	}
+	s.changeDimension(gameData.Dimension, gameData.PlayerPosition, false)
+	s.Data().SetGameMode(gameData.PlayerGameMode)
+	s.WriteToClient(&packet.SetPlayerGameType{GameType: gameData.PlayerGameMode})
+	s.WriteToClient(&packet.SetTime{Time: int32(gameData.Time)})
+	s.WriteToClient(&packet.SetDifficulty{Difficulty: uint32(gameData.Difficulty)})
+	s.WriteToClient(&packet.GameRulesChanged{GameRules: gameData.GameRules})
+	s.WriteToClient(&packet.SetTitle{ActionType: packet.TitleActionClear})
+
+	s.limbo.Store(false)
+	s.ForwardXUID(s.encryptionKey)
+	return nil
+}
+
+// changeDimension moves the player to dimension at position. The limbo
+// dimension has no backend to send chunks, so it is filled with empty ones.
+func (s *Session) changeDimension(dimension int32, position mgl32.Vec3, void bool) {
+	s.WriteToClient(&packet.ChangeDimension{
+		Dimension: dimension,
+		Position:  position,
+	})
+	s.Data().SetDimension(dimension)
+	if void {
+		SendVoid(s.client, dimension, position)
+	}
+}
+
+// limboDimension returns a vanilla dimension other than dimension.
+func limboDimension(dimension int32) int32 {
+	if dimension == dimensionEnd {
+		return dimensionNether
+	}
+	return dimensionEnd
+}
+
+// idTranslation swaps the player's own entity IDs between those the client
+// was given at login and those of the current backend connection. A backend
+// that restarted assigns the player new IDs, but the client keeps the ones
+// from its StartGame. The swap is its own inverse, so the same translation
+// applies in both directions, and an unrelated entity that happens to get
+// the client's old ID is mapped to the backend's ID instead of colliding.
+type idTranslation struct {
+	clientRuntimeID, serverRuntimeID uint64
+	clientUniqueID, serverUniqueID   int64
+}
+
+// newIDTranslation returns the translation between the client's and the
+// backend's game data, or nil if their IDs are the same.
+func newIDTranslation(client, server minecraft.GameData) *idTranslation {
+	if client.EntityRuntimeID == server.EntityRuntimeID && client.EntityUniqueID == server.EntityUniqueID {
+		return nil
+	}
+	return &idTranslation{
+		clientRuntimeID: client.EntityRuntimeID,
+		serverRuntimeID: server.EntityRuntimeID,
+		clientUniqueID:  client.EntityUniqueID,
+		serverUniqueID:  server.EntityUniqueID,
+	}
+}
+
+// translate rewrites the entity runtime and unique ID fields of pk. Only
+// top-level fields are rewritten; those cover the packets that refer to the
+// player itself.
+func (t *idTranslation) translate(pk packet.Packet) {
+	v := reflect.ValueOf(pk)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+	for i := range v.NumField() {
+		field, name := v.Field(i), v.Type().Field(i).Name
+		switch {
+		case field.Kind() == reflect.Uint64 && strings.HasSuffix(name, "RuntimeID"):
+			switch field.Uint() {
+			case t.serverRuntimeID:
+				field.SetUint(t.clientRuntimeID)
+			case t.clientRuntimeID:
+				field.SetUint(t.serverRuntimeID)
+			}
+		case field.Kind() == reflect.Int64 && strings.HasSuffix(name, "UniqueID"):
+			switch field.Int() {
+			case t.serverUniqueID:
+				field.SetInt(t.clientUniqueID)
+			case t.clientUniqueID:
+				field.SetInt(t.serverUniqueID)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func TestIDTranslationSwapsPlayerIDs(t *testing.T) {
+	ids := newIDTranslation(
+		minecraft.GameData{EntityRuntimeID: 1, EntityUniqueID: -1},
+		minecraft.GameData{EntityRuntimeID: 7, EntityUniqueID: -7},
+	)
+	if ids == nil {
+		t.Fatal("expected a translation for differing IDs")
+	}
+
+	fromServer := &packet.SetActorData{EntityRuntimeID: 7}
+	ids.translate(fromServer)
+	if fromServer.EntityRuntimeID != 1 {
+		t.Fatalf("server runtime ID translated to %d, want 1", fromServer.EntityRuntimeID)
+	}
+	// An unrelated entity given the client's old ID must not collide with
+	// the player.
+	other := &packet.AddActor{EntityRuntimeID: 1, EntityUniqueID: -1}
+	ids.translate(other)
+	if other.EntityRuntimeID != 7 || other.EntityUniqueID != -7 {
+		t.Fatalf("colliding entity translated to %d/%d, want 7/-7", other.EntityRuntimeID, other.EntityUniqueID)
+	}
+	unrelated := &packet.MoveActorAbsolute{EntityRuntimeID: 42}
+	ids.translate(unrelated)
+	if unrelated.EntityRuntimeID != 42 {
+		t.Fatalf("unrelated entity translated to %d", unrelated.EntityRuntimeID)
+	}
+
+	same := minecraft.GameData{EntityRuntimeID: 1, EntityUniqueID: -1}
+	if newIDTranslation(same, same) != nil {
+		t.Fatal("identical IDs need no translation")
+	}
+}
+
+func TestBackendLostOnConnectionFailure(t *testing.T) {
+	if !backendLost(errors.New("connection timed out")) {
+		t.Fatal("a dropped connection must count as a lost backend")
+	}
+}
+
+func TestLimboDimensionDiffers(t *testing.T) {
+	for dimension := int32(0); dimension <= dimensionEnd; dimension++ {
+		if limboDimension(dimension) == dimension {
+			t.Fatalf("limbo dimension for %d is the same dimension", dimension)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/capture"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+	"github.com/smell-of-curry/gobds/gobds/entity"
+)
+
+// ReplayResult is how a replayed session handled one captured packet.
+type ReplayResult struct {
+	capture.Record
+	// Forwarded reports whether the packet would have been sent on.
+	Forwarded bool
+	// Err is the error the handler failed with, if any.
+	Err error
+	// ToClient and ToServer are the packets the handler sent on its own, such
+	// as corrections and messages.
+	ToClient, ToServer []packet.Packet
+}
+
+// Replay feeds every packet of a capture through a session rebuilt from the
+// capture header, and calls fn with the outcome of each. Nothing is sent
+// anywhere: the session's connections only collect what handlers write.
+// Rate limits follow the captured timestamps. claims may be nil to replay
+// without a claim snapshot.
+func Replay(r *capture.Reader, claims *claim.Factory, log *slog.Logger, fn func(ReplayResult)) error {
+	header := r.Header()
+	var state replayState
+	if err := json.Unmarshal(header.Session, &state); err != nil {
+		return fmt.Errorf("decode session state: %w", err)
+	}
+	gameData := state.GameData
+	gameData.Dimension = state.Dimension
+	gameData.PlayerGameMode = state.GameMode
+	clientData := login.ClientData{ThirdPartyName: state.ThirdPartyName, LanguageCode: state.LanguageCode}
+	client := &replayConn{gameData: gameData, identityData: state.IdentityData, clientData: clientData}
+	server := &replayConn{gameData: gameData, identityData: state.IdentityData, clientData: clientData}
+
+	s := Config{
+		Client:             client,
+		Server:             server,
+		ServerName:         header.Server,
+		Backend:            header.Backend,
+		Border:             state.Border,
+		ClaimPrefilter:     state.ClaimPrefilter,
+		ClaimDenyRendering: state.ClaimDenyRendering,
+		Traffic:            state.Traffic,
+		TrafficMetrics:     &TrafficMetrics{},
+		EntityFactory:      entity.NewFactory(),
+		ClaimFactory:       claims,
+		Audit:              audit.NewLogger(log),
+		Log:                log,
+	}.New()
+	var now time.Time
+	s.traffic.now = func() time.Time { return now }
+
+	for {
+		record, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		now = header.Started.Add(record.Offset)
+		conn := server
+		if record.Direction == capture.Serverbound {
+			conn = client
+		}
+		result := ReplayResult{Record: record}
+		result.Forwarded, result.Err = s.handlePacket(record.Packet, conn)
+		result.ToClient, result.ToServer = client.drain(), server.drain()
+		fn(result)
+	}
+}
+
+// replayConn stands in for a client or backend connection during a replay. It
+// collects the packets written to it. Methods the session does not use during
+// a replay are left to the embedded Conn, which is nil.
+type replayConn struct {
+	Conn
+
+	gameData     minecraft.GameData
+	identityData login.IdentityData
+	clientData   login.ClientData
+
+	mu      sync.Mutex
+	written []packet.Packet
+}
+
+// WritePacket ...
+func (c *replayConn) WritePacket(pk packet.Packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, pk)
+	return nil
+}
+
+// ReadPacket ...
+func (c *replayConn) ReadPacket() (packet.Packet, error) {
+	return nil, io.EOF
+}
+
+// drain returns and forgets the packets written since the last call.
+func (c *replayConn) drain() []packet.Packet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	written := c.written
+	c.written = nil
+	return written
+}
+
+// GameData ...
+func (c *replayConn) GameData() minecraft.GameData { return c.gameData }
+
+// IdentityData ...
+func (c *replayConn) IdentityData() login.IdentityData { return c.identityData }
+
+// ClientData ...
+func (c *replayConn) ClientData() login.ClientData { return c.clientData }
+
+// Latency ...
+func (c *replayConn) Latency() time.Duration { return 0 }
+
+// Flush ...
+func (c *replayConn) Flush() error { return nil }
+
+// Close ...
+func (c *replayConn) Close() error { return nil }
+
+// LocalAddr ...
+func (c *replayConn) LocalAddr() net.Addr { return replayAddr{} }
+
+// RemoteAddr ...
+func (c *replayConn) RemoteAddr() net.Addr { return replayAddr{} }
+
+// replayAddr is the address of both ends of a replay.
+type replayAddr struct{}
+
+// Network ...
+func (replayAddr) Network() string { return "replay" }
+
+// String ...
+func (replayAddr) String() string { return "replay" }
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/smell-of-curry/gobds/gobds/capture"
+	"github.com/smell-of-curry/gobds/gobds/entity"
+)
+
+type captureBuffer struct {
+	bytes.Buffer
+}
+
+func (*captureBuffer) Close() error { return nil }
+
+func TestCaptureReplaysThroughHandlers(t *testing.T) {
+	identity := login.IdentityData{XUID: "1", DisplayName: "Steve"}
+	client := &replayConn{gameData: minecraft.GameData{EntityRuntimeID: 1}, identityData: identity}
+	server := &replayConn{gameData: minecraft.GameData{EntityRuntimeID: 1}, identityData: identity}
+	s := Config{
+		Client:         client,
+		Server:         server,
+		Backend:        "127.0.0.1:19133",
+		TrafficMetrics: &TrafficMetrics{},
+		EntityFactory:  entity.NewFactory(),
+		Log:            slog.Default(),
+	}.New()
+
+	var buf captureBuffer
+	if err := s.StartCapture(&buf, "lobby", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartCapture(&captureBuffer{}, "lobby", 0); err == nil {
+		t.Fatal("a second capture of the same session must be refused")
+	}
+	_, _ = s.handlePacket(&packet.Animate{}, client)
+	_, _ = s.handlePacket(&packet.SetTime{Time: 42}, server)
+	if stopped, err := s.StopCapture(); !stopped || err != nil {
+		t.Fatalf("stop capture returned %v, %v", stopped, err)
+	}
+
+	r, err := capture.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := r.Header(); h.Server != "lobby" || h.XUID != "1" || h.Backend != "127.0.0.1:19133" {
+		t.Fatalf("unexpected header %+v", h)
+	}
+	var results []ReplayResult
+	if err = Replay(r, nil, slog.Default(), func(result ReplayResult) {
+		results = append(results, result)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("replayed %d packets, want 2", len(results))
+	}
+	if results[0].Direction != capture.Serverbound || results[1].Direction != capture.Clientbound {
+		t.Fatalf("unexpected directions %v, %v", results[0].Direction, results[1].Direction)
+	}
+	if setTime, ok := results[1].Packet.(*packet.SetTime); !ok || setTime.Time != 42 || !results[1].Forwarded {
+		t.Fatalf("unexpected replay of SetTime: %+v", results[1])
+	}
+}
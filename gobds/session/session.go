@@ -7,7 +7,9 @@ import (
 	"io"
 	"log/slog"
 	"math"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/df-mc/dragonfly/server/event"
@@ -17,6 +19,10 @@ import (
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/ban"
+	"github.com/smell-of-curry/gobds/gobds/capture"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
 	"github.com/smell-of-curry/gobds/gobds/claim"
 	"github.com/smell-of-curry/gobds/gobds/entity"
 	"github.com/smell-of-curry/gobds/gobds/infra"
@@ -26,25 +32,63 @@ import (
 
 // Session ...
 type Session struct {
-	client   Conn
+	client Conn
+	// server is replaced when the session is reattached to a restarted
+	// backend, so it must be read through Server.
 	server   Conn
+	serverMu sync.RWMutex
 	handlers map[uint32]packetHandler
 
+	// serverName is the name of the server the session joined.
+	serverName string
+	// backend is the address of the backend the session is connected to.
+	backend string
+	// redial dials a new connection to the backend after the current one is
+	// lost. It is nil if the session cannot be reattached.
+	redial          func(ctx context.Context) (Conn, error)
+	reconnectConfig atomic.Pointer[ReconnectConfig]
+	encryptionKey   string
+	// limbo is set while the backend is unreachable and nothing is forwarded.
+	limbo atomic.Bool
+	// ids translates the player's own entity IDs after reattaching to a
+	// backend that assigned new ones. nil if no translation is needed.
+	ids atomic.Pointer[idTranslation]
+	// capture records handled packets while the session is being captured.
+	capture atomic.Pointer[capture.Writer]
+
 	entityFactory *entity.Factory
 	claimFactory  *claim.Factory
-
-	afkTimer *infra.AFKTimer
-	border   *area.Area2D
-
-	claimPrefilter     bool
-	claimDenyRendering bool
+	bans          *ban.Store
+	chatFilter    *chatfilter.Filter
+	signFilter    *chatfilter.Filter
+	audit         audit.Sink
+	// chat and signEditor are the player's chat and sign filter states:
+	// recent messages and mute.
+	chat       chatfilter.Player
+	signEditor chatfilter.Player
+	// signs holds the signs the player was last sent, to audit edits with
+	// the text they replace.
+	signs signCache
+
+	afkTimer atomic.Pointer[infra.AFKTimer]
+	border   atomic.Pointer[area.Area2D]
+
+	claimPrefilter     atomic.Bool
+	claimDenyRendering atomic.Bool
+	// claimNotify is nil unless players are told when they cross a claim
+	// border, and claimPresence is the claim the player was last seen in.
+	claimNotify   atomic.Pointer[ClaimNotifyConfig]
+	claimPresence claimPresence
+	// claimOverlays are the deny blocks painted in the chunks sent to the
+	// client, so that chunks are resent when the claims change them.
+	claimOverlays claimOverlays
 
 	close chan struct{}
 
 	afk afkState
 
 	corrective correctiveState
-	traffic    trafficState
+	traffic    *trafficState
 
 	// lastForwardedPing is the last client latency (ms) sent to BDS via
 	// ForwardPing. -1 means nothing has been forwarded yet.
@@ -92,7 +136,21 @@ func (e malformedPacketError) Error() string {
 
 // AFKTimer returns the session's AFK configuration, or nil if disabled.
 func (s *Session) AFKTimer() *infra.AFKTimer {
-	return s.afkTimer
+	return s.afkTimer.Load()
+}
+
+// Reconfigure applies the hot-reloadable settings of c to the live session:
+// the AFK timer, border, claim prefilter and deny rendering toggles, claim
+// notifications, and traffic limits and backend reconnect settings. Connections, factories and
+// the logger are left untouched.
+func (s *Session) Reconfigure(c Config) {
+	s.afkTimer.Store(c.AFKTimer)
+	s.border.Store(c.Border)
+	s.claimPrefilter.Store(c.ClaimPrefilter)
+	s.claimDenyRendering.Store(c.ClaimDenyRendering)
+	s.claimNotify.Store(c.ClaimNotify)
+	s.traffic.reconfigure(c.Traffic)
+	s.reconnectConfig.Store(c.Reconnect)
 }
 
 // TouchMovement updates the last movement bookkeeping for the session. When
@@ -254,56 +312,90 @@ func (s *Session) WriteToClient(pk packet.Packet) {
 
 // WriteToServer ...
 func (s *Session) WriteToServer(pk packet.Packet) {
-	err := s.server.WritePacket(pk)
+	err := s.Server().WritePacket(pk)
 	if err != nil {
 		s.log.Error("error writing to server", "error", err)
 	}
 }
 
-// ReadPackets reads and processes all packets.
+// ReadPackets reads and processes all packets. If the backend connection is
+// lost and reconnecting is enabled, the client is held in limbo until the
+// session is reattached to a new backend connection.
 func (s *Session) ReadPackets(ctx context.Context) {
 	defer close(s.close)
+	defer s.flushTrafficAudit()
+	defer func() { _, _ = s.StopCapture() }()
 	s.wait(ctx)
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-
+	clientDone := make(chan struct{})
 	go func() {
-		defer func() { _ = s.server.Close() }()
-		defer wg.Done()
+		defer func() { _ = s.Server().Close() }()
+		defer close(clientDone)
 		for {
 			pk, err := s.client.ReadPacket()
 			if err != nil {
 				return
 			}
+			if s.limbo.Load() {
+				continue
+			}
+			server := s.Server()
 			send, err := s.handlePacket(pk, s.client)
 			if err != nil {
 				return
 			}
 			if send {
-				_ = s.server.WritePacket(pk)
+				s.translateIDs(pk)
+				_ = server.WritePacket(pk)
 			}
 		}
 	}()
 
-	go func() {
-		defer func() { _ = s.client.Close() }()
-		defer wg.Done()
-		for {
-			pk, err := s.server.ReadPacket()
-			if err != nil {
-				return
-			}
-			send, err := s.handlePacket(pk, s.server)
-			if err != nil {
-				return
-			}
-			if send {
-				_ = s.client.WritePacket(pk)
+	defer func() { _ = s.client.Close() }()
+	for {
+		server := s.Server()
+		select {
+		case <-clientDone:
+			_ = server.Close()
+			return
+		default:
+		}
+		err := s.readServer(server)
+		_ = server.Close()
+		if err == nil || !backendLost(err) || !s.reconnect(ctx, clientDone) {
+			if s.limbo.Load() {
+				s.Disconnect("The server did not come back in time.")
 			}
+			return
 		}
-	}()
-	wg.Wait()
+	}
+}
+
+// readServer forwards packets from server to the client until the
+// connection fails, returning the read error, or a handler fails, returning
+// nil.
+func (s *Session) readServer(server Conn) error {
+	for {
+		pk, err := server.ReadPacket()
+		if err != nil {
+			return err
+		}
+		s.translateIDs(pk)
+		send, err := s.handlePacket(pk, server)
+		if err != nil {
+			return nil
+		}
+		if send {
+			_ = s.client.WritePacket(pk)
+		}
+	}
+}
+
+// translateIDs rewrites the player's entity IDs in pk after a reattach.
+func (s *Session) translateIDs(pk packet.Packet) {
+	if ids := s.ids.Load(); ids != nil {
+		ids.translate(pk)
+	}
 }
 
 // wait waits until the proxy closes or the client disconnects.
@@ -353,6 +445,13 @@ func (s *Session) Disconnect(message string) {
 	_ = s.client.Close()
 }
 
+// Kick records a kick for reason, one of the audit kick reasons, in the audit
+// log and disconnects the player with message.
+func (s *Session) Kick(reason, message string) {
+	s.recordAudit(audit.Event{Type: audit.TypeKick, Reason: reason})
+	s.Disconnect(message)
+}
+
 // GameData ...
 func (s *Session) GameData() minecraft.GameData {
 	return s.client.GameData()
@@ -363,6 +462,11 @@ func (s *Session) ClientData() login.ClientData {
 	return s.client.ClientData()
 }
 
+// RemoteAddr returns the address of the client.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.client.RemoteAddr()
+}
+
 // Locale ...
 func (s *Session) Locale() string {
 	return s.ClientData().LanguageCode
@@ -370,7 +474,7 @@ func (s *Session) Locale() string {
 
 // IdentityData ...
 func (s *Session) IdentityData() login.IdentityData {
-	return s.server.IdentityData()
+	return s.Server().IdentityData()
 }
 
 // Client ...
@@ -378,13 +482,28 @@ func (s *Session) Client() session.Conn {
 	return s.client
 }
 
-// Server ...
-func (s *Session) Server() session.Conn {
+// Server returns the current backend connection.
+func (s *Session) Server() Conn {
+	s.serverMu.RLock()
+	defer s.serverMu.RUnlock()
 	return s.server
 }
 
+// Backend returns the address of the backend the session is connected to.
+func (s *Session) Backend() string {
+	return s.backend
+}
+
+// setServer replaces the backend connection after a reattach.
+func (s *Session) setServer(server Conn) {
+	s.serverMu.Lock()
+	s.server = server
+	s.serverMu.Unlock()
+}
+
 // handlePacket passes packet into corresponding handler.
 func (s *Session) handlePacket(p packet.Packet, conn Conn) (send bool, err error) {
+	s.capturePacket(p, conn)
 	handler, ok := s.handlers[p.ID()]
 	if !ok {
 		return true, nil
@@ -394,7 +513,7 @@ func (s *Session) handlePacket(p packet.Packet, conn Conn) (send bool, err error
 		if recovered := recover(); recovered != nil {
 			s.traffic.malformed(trafficHandler)
 			s.log.Error("panic handling packet", "packet_id", p.ID(), "error", recovered)
-			s.Disconnect("Malformed client packet.")
+			s.Kick(audit.KickMalformedPacket, "Malformed client packet.")
 			send = false
 			err = fmt.Errorf("panic handling packet %d: %v", p.ID(), recovered)
 		}
@@ -406,7 +525,7 @@ func (s *Session) handlePacket(p packet.Packet, conn Conn) (send bool, err error
 	s.log.Error("error handling packet", "packet_id", p.ID(), "error", err)
 	var malformed malformedPacketError
 	if errors.As(err, &malformed) {
-		s.Disconnect("Malformed client packet.")
+		s.Kick(audit.KickMalformedPacket, "Malformed client packet.")
 		return false, err
 	}
 	// Handler failures drop only this packet. Claim and subchunk handlers are
@@ -419,11 +538,13 @@ func (s *Session) registerHandlers() {
 	itemRegistry := &ItemRegistryHandler{}
 	// Seed from GameData — the ItemRegistry packet itself is consumed by
 	// gophertunnel during DoSpawn and never flows through handlePacket.
-	itemRegistry.SetItems(s.server.GameData().Items)
+	itemRegistry.SetItems(s.Server().GameData().Items)
 	s.handlers = map[uint32]packetHandler{
 		packet.IDAddActor:             &AddActorHandler{},
+		packet.IDAddItemActor:         &AddItemActorHandler{},
 		packet.IDAddPainting:          &AddPaintingHandler{},
 		packet.IDAvailableCommands:    &AvailableCommandsHandler{},
+		packet.IDBlockActorData:       &BlockActorDataHandler{},
 		packet.IDChangeDimension:      &ChangeDimensionHandler{},
 		packet.IDCommandRequest:       &CommandRequestHandler{},
 		packet.IDInventoryTransaction: &InventoryTransactionHandler{},
@@ -439,12 +560,31 @@ func (s *Session) registerHandlers() {
 		packet.IDSetActorData:         &SetActorDataHandler{},
 		packet.IDSetPlayerGameType:    &SetPlayerGameTypeHandler{},
 		packet.IDSubChunk:             &SubChunkHandler{},
+		packet.IDTakeItemActor:        &TakeItemActorHandler{},
 		packet.IDText:                 &TextHandler{},
 		packet.IDUpdateAbilities:      &UpdateAbilitiesHandler{},
 		packet.IDUpdatePlayerGameType: &UpdatePlayerGameTypeHandler{},
 	}
 }
 
+// recordAudit fills in the player and server of e and records it in the audit
+// sink, if there is one.
+func (s *Session) recordAudit(e audit.Event) {
+	if s.audit == nil {
+		return
+	}
+	e.Time = s.traffic.now()
+	e.Server = s.serverName
+	e.XUID = s.IdentityData().XUID
+	e.Name = s.IdentityData().DisplayName
+	s.audit.Record(e)
+}
+
+// TrafficCounters returns this session's cumulative traffic counters.
+func (s *Session) TrafficCounters() TrafficCounters {
+	return s.traffic.session.Counters()
+}
+
 // WriteTrafficMetrics emits and resets this session's traffic metric delta.
 func (s *Session) WriteTrafficMetrics(output io.Writer, server string, period time.Duration) {
 	s.traffic.session.WriteDelta(output, server, s.IdentityData().XUID, period)
@@ -7,6 +7,10 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
+	"github.com/smell-of-curry/gobds/gobds/util/exposition"
 )
 
 const trafficCategories = 6
@@ -24,6 +28,17 @@ var trafficCategoryNames = [trafficCategories]string{
 	"chat", "command", "form", "inventory", "item_stack", "handler",
 }
 
+// filterActions is the number of chat filter actions that are counted: every
+// chatfilter.Action but ActionNone.
+const filterActions = int(chatfilter.ActionMute)
+
+var filterActionNames = func() (names [filterActions]string) {
+	for i := range names {
+		names[i] = chatfilter.Action(i + 1).String()
+	}
+	return names
+}()
+
 // RateLimit configures one per-session token bucket.
 type RateLimit struct {
 	Rate  float64
@@ -117,6 +132,16 @@ func newTokenBucket(limit RateLimit, now time.Time) tokenBucket {
 	return tokenBucket{rate: limit.Rate, burst: float64(limit.Burst), tokens: float64(limit.Burst), last: now}
 }
 
+// setLimit changes the rate and burst of the bucket, keeping at most burst
+// tokens so that a lowered limit takes effect immediately.
+func (b *tokenBucket) setLimit(limit RateLimit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate = limit.Rate
+	b.burst = float64(limit.Burst)
+	b.tokens = min(b.tokens, b.burst)
+}
+
 func (b *tokenBucket) allow(now time.Time) bool {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -132,12 +157,17 @@ func (b *tokenBucket) allow(now time.Time) bool {
 	return true
 }
 
-// TrafficMetrics contains dependency-free atomic traffic counters.
+// TrafficMetrics contains dependency-free atomic traffic counters. Counters
+// are cumulative; WriteDelta reports the change since its last call.
 type TrafficMetrics struct {
 	observed  [trafficCategories]atomic.Uint64
 	exceeded  [trafficCategories]atomic.Uint64
 	enforced  [trafficCategories]atomic.Uint64
 	malformed [trafficCategories]atomic.Uint64
+	filtered  [filterActions]atomic.Uint64
+
+	deltaMu  sync.Mutex
+	reported TrafficCounters
 }
 
 func (m *TrafficMetrics) observe(category int, exceeded, enforced bool) {
@@ -159,35 +189,77 @@ func (m *TrafficMetrics) malformedPacket(category int) {
 	}
 }
 
+func (m *TrafficMetrics) filteredMessage(action chatfilter.Action) {
+	if m != nil && action > chatfilter.ActionNone && int(action) <= filterActions {
+		m.filtered[action-1].Add(1)
+	}
+}
+
+// TrafficCounters is a point-in-time copy of TrafficMetrics indexed by category,
+// and by action for chat filter counters.
+type TrafficCounters struct {
+	Categories    [trafficCategories]string `json:"categories"`
+	Observed      [trafficCategories]uint64 `json:"observed"`
+	Exceeded      [trafficCategories]uint64 `json:"exceeded"`
+	Enforced      [trafficCategories]uint64 `json:"enforced"`
+	Malformed     [trafficCategories]uint64 `json:"malformed"`
+	FilterActions [filterActions]string     `json:"filter_actions"`
+	Filtered      [filterActions]uint64     `json:"filtered"`
+}
+
+// Counters reads the cumulative counters.
+func (m *TrafficMetrics) Counters() TrafficCounters {
+	counters := TrafficCounters{Categories: trafficCategoryNames, FilterActions: filterActionNames}
+	if m == nil {
+		return counters
+	}
+	for i := range trafficCategories {
+		counters.Observed[i] = m.observed[i].Load()
+		counters.Exceeded[i] = m.exceeded[i].Load()
+		counters.Enforced[i] = m.enforced[i].Load()
+		counters.Malformed[i] = m.malformed[i].Load()
+	}
+	for i := range filterActions {
+		counters.Filtered[i] = m.filtered[i].Load()
+	}
+	return counters
+}
+
 type trafficMetricRecord struct {
-	Type       string                    `json:"type"`
-	Server     string                    `json:"server"`
-	Session    string                    `json:"session,omitempty"`
-	PeriodMS   int64                     `json:"period_ms"`
-	Categories [trafficCategories]string `json:"categories"`
-	Observed   [trafficCategories]uint64 `json:"observed"`
-	Exceeded   [trafficCategories]uint64 `json:"exceeded"`
-	Enforced   [trafficCategories]uint64 `json:"enforced"`
-	Malformed  [trafficCategories]uint64 `json:"malformed"`
-}
-
-// WriteDelta emits one compact JSON record and resets interval counters.
+	Type     string `json:"type"`
+	Server   string `json:"server"`
+	Session  string `json:"session,omitempty"`
+	PeriodMS int64  `json:"period_ms"`
+	TrafficCounters
+}
+
+// WriteDelta emits one compact JSON record with the counter change since the
+// previous call.
 func (m *TrafficMetrics) WriteDelta(output io.Writer, server, session string, period time.Duration) {
 	if m == nil {
 		return
 	}
-	record := trafficMetricRecord{
-		Type:       "traffic_protection_metrics",
-		Server:     server,
-		Session:    session,
-		PeriodMS:   period.Milliseconds(),
-		Categories: trafficCategoryNames,
-	}
+	m.deltaMu.Lock()
+	current := m.Counters()
+	delta := current
 	for i := range trafficCategories {
-		record.Observed[i] = m.observed[i].Swap(0)
-		record.Exceeded[i] = m.exceeded[i].Swap(0)
-		record.Enforced[i] = m.enforced[i].Swap(0)
-		record.Malformed[i] = m.malformed[i].Swap(0)
+		delta.Observed[i] -= m.reported.Observed[i]
+		delta.Exceeded[i] -= m.reported.Exceeded[i]
+		delta.Enforced[i] -= m.reported.Enforced[i]
+		delta.Malformed[i] -= m.reported.Malformed[i]
+	}
+	for i := range filterActions {
+		delta.Filtered[i] -= m.reported.Filtered[i]
+	}
+	m.reported = current
+	m.deltaMu.Unlock()
+
+	record := trafficMetricRecord{
+		Type:            "traffic_protection_metrics",
+		Server:          server,
+		Session:         session,
+		PeriodMS:        period.Milliseconds(),
+		TrafficCounters: delta,
 	}
 	raw, err := json.Marshal(record)
 	if err == nil {
@@ -195,18 +267,44 @@ func (m *TrafficMetrics) WriteDelta(output io.Writer, server, session string, pe
 	}
 }
 
+// Collect adds the server's cumulative traffic counters to r.
+func (m *TrafficMetrics) Collect(r *exposition.Registry, server string) {
+	c := m.Counters()
+	families := [...]struct {
+		name, help string
+		values     [trafficCategories]uint64
+	}{
+		{"gobds_traffic_observed_total", "Client packets observed by traffic protection.", c.Observed},
+		{"gobds_traffic_exceeded_total", "Client packets exceeding their rate limit.", c.Exceeded},
+		{"gobds_traffic_enforced_total", "Client packets dropped by rate limiting.", c.Enforced},
+		{"gobds_traffic_malformed_total", "Malformed client packets.", c.Malformed},
+	}
+	serverLabel := exposition.L("server", server)
+	for _, family := range families {
+		for i, category := range c.Categories {
+			r.Counter(family.name, family.help, family.values[i], serverLabel, exposition.L("category", category))
+		}
+	}
+	for i, action := range c.FilterActions {
+		r.Counter("gobds_chat_filter_actions_total", "Chat messages acted on by the chat filter.",
+			c.Filtered[i], serverLabel, exposition.L("action", action))
+	}
+}
+
 type trafficState struct {
-	config    TrafficConfig
+	config    atomic.Pointer[TrafficConfig]
 	buckets   [trafficCategories]tokenBucket
 	session   TrafficMetrics
 	aggregate *TrafficMetrics
+	audit     trafficAudit
+	// now is the clock buckets refill by. Replays set it to the capture time.
+	now func() time.Time
 }
 
-func newTrafficState(config TrafficConfig, aggregate *TrafficMetrics) trafficState {
+func newTrafficState(config TrafficConfig, aggregate *TrafficMetrics) *trafficState {
 	config = config.WithDefaults()
 	now := time.Now()
-	return trafficState{
-		config: config,
+	t := &trafficState{
 		buckets: [trafficCategories]tokenBucket{
 			newTokenBucket(config.Chat, now),
 			newTokenBucket(config.Commands, now),
@@ -215,12 +313,32 @@ func newTrafficState(config TrafficConfig, aggregate *TrafficMetrics) trafficSta
 			newTokenBucket(config.ItemStackRequests, now),
 		},
 		aggregate: aggregate,
+		now:       time.Now,
 	}
+	t.config.Store(&config)
+	return t
+}
+
+// limits returns the traffic limits currently in effect.
+func (t *trafficState) limits() *TrafficConfig {
+	return t.config.Load()
+}
+
+// reconfigure swaps the limits in place. Buckets keep their tokens so that a
+// reload cannot be used to reset a player's rate limit.
+func (t *trafficState) reconfigure(config TrafficConfig) {
+	config = config.WithDefaults()
+	t.config.Store(&config)
+	t.buckets[trafficChat].setLimit(config.Chat)
+	t.buckets[trafficCommand].setLimit(config.Commands)
+	t.buckets[trafficForm].setLimit(config.ModalFormResponses)
+	t.buckets[trafficInventory].setLimit(config.InventoryTransactions)
+	t.buckets[trafficStack].setLimit(config.ItemStackRequests)
 }
 
 func (t *trafficState) allow(category int) bool {
-	exceeded := !t.buckets[category].allow(time.Now())
-	enforced := exceeded && t.config.Enforce
+	exceeded := !t.buckets[category].allow(t.now())
+	enforced := exceeded && t.limits().Enforce
 	t.session.observe(category, exceeded, enforced)
 	t.aggregate.observe(category, exceeded, enforced)
 	return !enforced
@@ -230,3 +348,69 @@ func (t *trafficState) malformed(category int) {
 	t.session.malformedPacket(category)
 	t.aggregate.malformedPacket(category)
 }
+
+func (t *trafficState) filtered(action chatfilter.Action) {
+	t.session.filteredMessage(action)
+	t.aggregate.filteredMessage(action)
+}
+
+// trafficAuditWindow is how often at most dropped packets of one category are
+// recorded in the audit log for a session.
+const trafficAuditWindow = 10 * time.Second
+
+// trafficAudit counts the packets a session dropped that are not yet recorded
+// in the audit log, so that a flood is recorded as a few events rather than
+// one per packet.
+type trafficAudit struct {
+	mu       sync.Mutex
+	recorded [trafficCategories]time.Time
+	dropped  [trafficCategories]int
+}
+
+// drop counts a packet of category dropped at now. If the category was not
+// recorded within the last trafficAuditWindow, it returns the packets dropped
+// since it last was and ok is true.
+func (a *trafficAudit) drop(category int, now time.Time) (dropped int, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.dropped[category]++
+	if !a.recorded[category].IsZero() && now.Sub(a.recorded[category]) < trafficAuditWindow {
+		return 0, false
+	}
+	dropped = a.dropped[category]
+	a.dropped[category], a.recorded[category] = 0, now
+	return dropped, true
+}
+
+// flush returns the dropped packets of every category not yet recorded, and
+// forgets them.
+func (a *trafficAudit) flush() [trafficCategories]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	dropped := a.dropped
+	a.dropped = [trafficCategories]int{}
+	return dropped
+}
+
+// allowTraffic reports whether a client packet of category is within its rate
+// limit. Packets dropped by an enforced limit are recorded in the audit log, at
+// most once per category every trafficAuditWindow.
+func (s *Session) allowTraffic(category int) bool {
+	if s.traffic.allow(category) {
+		return true
+	}
+	if dropped, ok := s.traffic.audit.drop(category, s.traffic.now()); ok {
+		s.recordAudit(audit.Event{Type: audit.TypeTrafficEnforced, Action: trafficCategoryNames[category], Dropped: dropped})
+	}
+	return false
+}
+
+// flushTrafficAudit records the dropped packets not yet in the audit log. It is
+// called once the session ends.
+func (s *Session) flushTrafficAudit() {
+	for category, dropped := range s.traffic.audit.flush() {
+		if dropped > 0 {
+			s.recordAudit(audit.Event{Type: audit.TypeTrafficEnforced, Action: trafficCategoryNames[category], Dropped: dropped})
+		}
+	}
+}
@@ -4,8 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"io"
+	"log/slog"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/chatfilter"
+	"github.com/smell-of-curry/gobds/gobds/entity"
+	"github.com/smell-of-curry/gobds/gobds/util/exposition"
 )
 
 func TestCommandNameHandlesEmptyAndMalformedWithoutSlicing(t *testing.T) {
@@ -65,6 +75,35 @@ func TestTokenBucketObserveOnlyAndEnforcement(t *testing.T) {
 	}
 }
 
+func TestChatFilterActionsAreCounted(t *testing.T) {
+	aggregate := &TrafficMetrics{}
+	traffic := newTrafficState(DefaultTrafficConfig(), aggregate)
+	traffic.filtered(chatfilter.ActionNone)
+	traffic.filtered(chatfilter.ActionReplace)
+	traffic.filtered(chatfilter.ActionMute)
+	traffic.filtered(chatfilter.ActionMute)
+
+	counters := aggregate.Counters()
+	if counters.FilterActions != [filterActions]string{"replace", "drop", "warn", "mute"} ||
+		counters.Filtered != [filterActions]uint64{1, 0, 0, 2} {
+		t.Fatalf("unexpected counters: %+v", counters)
+	}
+	var output bytes.Buffer
+	traffic.session.WriteDelta(&output, "TEST", "xuid", time.Minute)
+	traffic.session.WriteDelta(&output, "TEST", "xuid", time.Minute)
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	var first, second trafficMetricRecord
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first.Filtered[3] != 2 || second.Filtered[3] != 0 {
+		t.Fatalf("unexpected deltas: %+v %+v", first.Filtered, second.Filtered)
+	}
+}
+
 func TestFormResponseBoundsAndStructure(t *testing.T) {
 	config := DefaultTrafficConfig()
 	config.MaxFormResponseBytes = 8
@@ -86,3 +125,83 @@ func TestFormResponseBoundsAndStructure(t *testing.T) {
 		}
 	}
 }
+
+func TestTrafficMetricsDeltaAndCumulativeCollect(t *testing.T) {
+	metrics := &TrafficMetrics{}
+	metrics.observe(trafficChat, true, false)
+	metrics.WriteDelta(io.Discard, "TEST", "", time.Minute)
+	metrics.observe(trafficChat, false, false)
+
+	var output bytes.Buffer
+	metrics.WriteDelta(&output, "TEST", "", time.Minute)
+	var record trafficMetricRecord
+	if err := json.Unmarshal(output.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Observed[trafficChat] != 1 || record.Exceeded[trafficChat] != 0 {
+		t.Fatalf("delta must only include changes since the previous write: %+v", record)
+	}
+
+	registry := exposition.NewRegistry()
+	metrics.Collect(registry, "TEST")
+	output.Reset()
+	if _, err := registry.WriteTo(&output); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`gobds_traffic_observed_total{server="TEST",category="chat"} 2`,
+		`gobds_traffic_exceeded_total{server="TEST",category="chat"} 1`,
+	} {
+		if !strings.Contains(output.String(), want+"\n") {
+			t.Fatalf("missing %q in:\n%s", want, output.String())
+		}
+	}
+}
+
+func TestEnforcedLimitsAndMalformedKicksAreAudited(t *testing.T) {
+	config := DefaultTrafficConfig()
+	config.Enforce = true
+	config.Chat = RateLimit{Rate: 0.001, Burst: 1}
+	config.MaxTextBytes = 16
+	recorder := &auditRecorder{}
+	identity := login.IdentityData{XUID: "1", DisplayName: "Steve"}
+	client := &replayConn{identityData: identity}
+	s := Config{
+		Client:         client,
+		Server:         &replayConn{identityData: identity},
+		ServerName:     "lobby",
+		Traffic:        config,
+		TrafficMetrics: &TrafficMetrics{},
+		Audit:          recorder,
+		EntityFactory:  entity.NewFactory(),
+		Log:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}.New()
+
+	chat := func() { _, _ = s.handlePacket(&packet.Text{TextType: packet.TextTypeChat, Message: "hi"}, client) }
+	for range 5 {
+		chat()
+	}
+	if len(recorder.events) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(recorder.events))
+	}
+	if e := recorder.events[0]; e.Type != audit.TypeTrafficEnforced || e.Action != "chat" || e.Dropped != 1 ||
+		e.Server != "lobby" || e.XUID != "1" || e.Name != "Steve" {
+		t.Fatalf("unexpected traffic event %+v", e)
+	}
+	later := time.Now().Add(trafficAuditWindow)
+	s.traffic.now = func() time.Time { return later }
+	chat()
+	if len(recorder.events) != 2 || recorder.events[1].Dropped != 4 {
+		t.Fatalf("drops within the window not counted in the next event: %+v", recorder.events)
+	}
+	chat()
+	s.flushTrafficAudit()
+	if len(recorder.events) != 3 || recorder.events[2].Dropped != 1 {
+		t.Fatalf("drops not recorded when the session ends: %+v", recorder.events)
+	}
+
+	_, _ = s.handlePacket(&packet.Text{TextType: packet.TextTypeChat, Message: strings.Repeat("a", 32)}, client)
+	if e := recorder.events[len(recorder.events)-1]; e.Type != audit.TypeKick || e.Reason != audit.KickMalformedPacket {
+		t.Fatalf("unexpected kick event %+v", e)
+	}
+}
@@ -81,12 +81,23 @@ func dimensionRangeByID(id int32, definitions []protocol.DimensionDefinition) (c
 	return cube.Range{}, false
 }
 
-func claimContains(c claim.PlayerClaim, x, z float32) bool {
+func claimContains(c claim.PlayerClaim, position mgl32.Vec3) bool {
 	minX := min(c.Location.Pos1.X, c.Location.Pos2.X)
 	maxX := max(c.Location.Pos1.X, c.Location.Pos2.X)
 	minZ := min(c.Location.Pos1.Z, c.Location.Pos2.Z)
 	maxZ := max(c.Location.Pos1.Z, c.Location.Pos2.Z)
-	return x >= minX && x <= maxX && z >= minZ && z <= maxZ
+	return position.X() >= minX && position.X() <= maxX &&
+		position.Z() >= minZ && position.Z() <= maxZ &&
+		claimSpansY(c, position.Y())
+}
+
+// claimSpansY reports whether y lies within the vertical bounds of c. A claim
+// without them spans every y.
+func claimSpansY(c claim.PlayerClaim, y float32) bool {
+	if c.Location.MinY != nil && y < *c.Location.MinY {
+		return false
+	}
+	return c.Location.MaxY == nil || y <= *c.Location.MaxY
 }
 
 // blockPosToVec3 ...
@@ -0,0 +1,62 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/smell-of-curry/gobds/gobds/ban"
+)
+
+const (
+	// proxyBanPrefix prefixes a JSON ban.Request sent by BDS scripts.
+	proxyBanPrefix = "[PROXY_SYSTEM][BAN]="
+	// proxyUnbanPrefix prefixes a JSON ban.Selector sent by BDS scripts.
+	proxyUnbanPrefix = "[PROXY_SYSTEM][UNBAN]="
+)
+
+// handleProxyBanMessage applies ban and unban requests that BDS scripts send
+// as object text. handled is false for any other message.
+func handleProxyBanMessage(s *Session, message string) (handled bool, err error) {
+	if raw, ok := strings.CutPrefix(message, proxyBanPrefix); ok {
+		return true, scriptBan(s, raw)
+	}
+	if raw, ok := strings.CutPrefix(message, proxyUnbanPrefix); ok {
+		return true, scriptUnban(s, raw)
+	}
+	return false, nil
+}
+
+func scriptBan(s *Session, raw string) error {
+	if s.bans == nil {
+		s.log.Warn("ignoring ban from server, bans are disabled")
+		return nil
+	}
+	var request ban.Request
+	if err := json.Unmarshal([]byte(raw), &request); err != nil {
+		return fmt.Errorf("parse ban request: %w", err)
+	}
+	if request.Issuer == "" {
+		request.Issuer = "server"
+	}
+	entry, err := request.Entry(time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = s.bans.Add(entry)
+	return err
+}
+
+func scriptUnban(s *Session, raw string) error {
+	if s.bans == nil {
+		s.log.Warn("ignoring unban from server, bans are disabled")
+		return nil
+	}
+	var selector ban.Selector
+	if err := json.Unmarshal([]byte(raw), &selector); err != nil {
+		return fmt.Errorf("parse unban request: %w", err)
+	}
+	_, err := s.bans.Remove(selector)
+	return err
+}
@@ -1,10 +1,13 @@
 package session
 
 import (
+	"math"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/smell-of-curry/gobds/gobds/audit"
 	"github.com/smell-of-curry/gobds/gobds/claim"
 )
 
@@ -41,16 +44,41 @@ const (
 	ClaimActionItemThrow
 	// ClaimActionItemDrop ...
 	ClaimActionItemDrop
+	// ClaimActionItemPickup ...
+	ClaimActionItemPickup
 )
 
 // ClaimActionPermitted evaluates claim policy without session or network state.
-func ClaimActionPermitted(cl claim.PlayerClaim, actor ClaimActor, action ClaimAction, data any) bool {
+// If cl is nested, parents holds the claims it is nested in, innermost first.
+func ClaimActionPermitted(cl claim.PlayerClaim, actor ClaimActor, action ClaimAction, data any, parents ...claim.PlayerClaim) bool {
 	if !validClaim(cl) || actor.XUID == "" {
 		return true
 	}
-	if claimOwnerOrTrusted(cl, actor) {
+	// Positions above or below a vertically bounded claim are outside it. For
+	// rendering, the position is on the dimension floor, so deny blocks are
+	// only painted under claims reaching down to it.
+	if actionData, ok := claimActionDataFrom(data); ok && !claimSpansY(cl, actionData.position.Y()) {
 		return true
 	}
+	lineage := append([]claim.PlayerClaim{cl}, parents...)
+	if claimTrustLevel(lineage, actor) >= requiredTrustLevel(action, data) {
+		return true
+	}
+	// A claim inheriting features also allows what its parent allows.
+	for _, cl := range lineage {
+		if claimFeaturesPermit(cl, action, data) {
+			return true
+		}
+		if !cl.InheritFeatures {
+			break
+		}
+	}
+	return false
+}
+
+// claimFeaturesPermit reports whether the features of cl let anyone perform
+// action.
+func claimFeaturesPermit(cl claim.PlayerClaim, action ClaimAction, data any) bool {
 	switch action {
 	case ClaimActionRender:
 		return handleClaimActionRender(cl, data)
@@ -70,6 +98,8 @@ func ClaimActionPermitted(cl claim.PlayerClaim, actor ClaimActor, action ClaimAc
 		return true
 	case ClaimActionItemDrop:
 		return claimActionItemDropPermitted(cl, data)
+	case ClaimActionItemPickup:
+		return claimActionItemPickupPermitted(cl, data)
 	}
 	return true
 }
@@ -95,6 +125,13 @@ func claimActionItemDropPermitted(cl claim.PlayerClaim, data any) bool {
 	return handleClaimActionInFeature(cl, data, claim.FeatureTypeDropItems)
 }
 
+func claimActionItemPickupPermitted(cl claim.PlayerClaim, data any) bool {
+	if cl.OwnerXUID == "*" {
+		return true
+	}
+	return handleClaimActionInFeature(cl, data, claim.FeatureTypePickupItems)
+}
+
 func adminClaimBlockInteractionAllowed(data any) bool {
 	actionData, ok := claimActionDataFrom(data)
 	if !ok {
@@ -112,72 +149,120 @@ func adminClaimBlockInteractionAllowed(data any) bool {
 }
 
 func (s *Session) claimActionPermitted(action ClaimAction, data any) bool {
-	if s.claimFactory == nil {
-		return true
+	permitted, denial := s.claimActionDecision(action, data)
+	if s.claimFactory != nil {
+		s.claimFactory.Metrics().Action(uint8(action), permitted)
 	}
-	metrics := s.claimFactory.Metrics()
-	if !s.claimPrefilter {
-		metrics.Action(uint8(action), true)
-		return true
+	if !permitted {
+		s.recordAudit(denial)
 	}
+	return permitted
+}
 
+// claimActionDecision decides action at the position of data against the
+// current claim snapshot. If the action is denied, it also returns the
+// TypeClaimDenied audit event describing the denial.
+func (s *Session) claimActionDecision(action ClaimAction, data any) (bool, audit.Event) {
+	if s.claimFactory == nil || !s.claimPrefilter.Load() {
+		return true, audit.Event{}
+	}
+	metrics := s.claimFactory.Metrics()
 	actionData, ok := claimActionDataFrom(data)
 	if !ok {
 		metrics.Reason(claim.QueryInvalid)
-		metrics.Action(uint8(action), true)
-		return true
+		return true, audit.Event{}
 	}
 	snapshot, status := s.claimFactory.Snapshot(time.Now())
 	if status != claim.QueryReady {
 		metrics.Reason(status)
-		metrics.Action(uint8(action), true)
-		return true
+		return true, audit.Event{}
 	}
 	dimension, ok := claimDimensionFromInt(s.Data().Dimension(), s.GameData().Dimensions)
 	if !ok {
 		metrics.Reason(claim.QueryUnknownDimension)
-		metrics.Action(uint8(action), true)
-		return true
+		return true, audit.Event{}
 	}
 	candidates := snapshot.Candidates(dimension, actionData.position.X(), actionData.position.Z())
 	metrics.Candidates(len(candidates))
-	matched, ambiguous := singleClaimAt(candidates, actionData.position.X(), actionData.position.Z())
+	matched, ambiguous := singleClaimAt(snapshot, candidates, actionData.position)
 	if ambiguous {
 		metrics.Reason(claim.QueryOverlap)
-		metrics.Action(uint8(action), true)
-		return true
+		return true, audit.Event{}
 	}
 	if matched == nil {
-		metrics.Action(uint8(action), true)
-		return true
+		return true, audit.Event{}
 	}
-	permitted := ClaimActionPermitted(
+	if ClaimActionPermitted(
 		*matched,
 		ClaimActor{XUID: s.IdentityData().XUID, Operator: s.Data().Operator()},
 		action,
 		data,
-	)
-	metrics.Action(uint8(action), permitted)
-	return permitted
+		claimParents(snapshot, matched)...,
+	) {
+		return true, audit.Event{}
+	}
+	return false, audit.Event{
+		Type:      audit.TypeClaimDenied,
+		Dimension: dimension,
+		Position:  auditPosition(actionData.position),
+		Action:    claim.ActionName(uint8(action)),
+		Target:    actionData.typeID,
+		Claim: &audit.ClaimDecision{
+			ID:         matched.ID,
+			Owner:      matched.OwnerXUID,
+			Status:     status.String(),
+			Generation: snapshot.Generation,
+		},
+	}
 }
 
-func singleClaimAt(candidates []*claim.PlayerClaim, x, z float32) (*claim.PlayerClaim, bool) {
-	var matched *claim.PlayerClaim
+// auditPosition returns the position of the block containing pos.
+func auditPosition(pos mgl32.Vec3) *[3]int32 {
+	return &[3]int32{
+		int32(math.Floor(float64(pos.X()))),
+		int32(math.Floor(float64(pos.Y()))),
+		int32(math.Floor(float64(pos.Z()))),
+	}
+}
+
+// singleClaimAt returns the claim deciding actions at position. Of claims
+// nested in each other, the innermost decides. Claims that overlap without
+// being nested are ambiguous.
+func singleClaimAt(snapshot *claim.Snapshot, candidates []*claim.PlayerClaim, position mgl32.Vec3) (*claim.PlayerClaim, bool) {
+	var matched []*claim.PlayerClaim
 	for _, candidate := range candidates {
-		if !claimContains(*candidate, x, z) {
-			continue
+		if claimContains(*candidate, position) {
+			matched = append(matched, candidate)
 		}
-		if matched != nil {
-			return nil, true
+	}
+	switch len(matched) {
+	case 0:
+		return nil, false
+	case 1:
+		return matched[0], false
+	}
+	for _, innermost := range matched {
+		// Claims fit inside their parents, so every other match must be a
+		// parent of the innermost one.
+		if len(claimParents(snapshot, innermost)) == len(matched)-1 {
+			return innermost, false
 		}
-		matched = candidate
 	}
-	return matched, false
+	return nil, true
+}
+
+// claimParents returns the claims cl is nested in, innermost first.
+func claimParents(snapshot *claim.Snapshot, cl *claim.PlayerClaim) []claim.PlayerClaim {
+	var parents []claim.PlayerClaim
+	for parent, ok := snapshot.Parent(cl); ok; parent, ok = snapshot.Parent(parent) {
+		parents = append(parents, *parent)
+	}
+	return parents
 }
 
 // handleClaimActionRender ...
 func handleClaimActionRender(cl claim.PlayerClaim, data any) (permitted bool) {
-	position, ok := data.(mgl32.Vec3)
+	actionData, ok := claimActionDataFrom(data)
 	if !ok {
 		return true
 	}
@@ -186,7 +271,7 @@ func handleClaimActionRender(cl claim.PlayerClaim, data any) (permitted bool) {
 			continue
 		}
 		pos1, pos2 := featureBounds(cl, feature)
-		if insideVector3(position, pos1, pos2) {
+		if insideVector3(actionData.position, pos1, pos2) {
 			return true
 		}
 	}
@@ -235,16 +320,60 @@ func featureAllowsType(feature claim.Feature, featureType, typeID string) bool {
 		return feature.BlockTypeIDs == nil || slices.Contains(feature.BlockTypeIDs, typeID)
 	case claim.FeatureTypeEntityInteractable, claim.FeatureTypeEntityHurt:
 		return feature.EntityTypeIDs == nil || slices.Contains(feature.EntityTypeIDs, typeID)
-	case claim.FeatureTypeDropItems:
+	case claim.FeatureTypeDropItems, claim.FeatureTypePickupItems:
 		return feature.ItemTypeIDs == nil || slices.Contains(feature.ItemTypeIDs, typeID)
 	default:
 		return true
 	}
 }
 
-// claimOwnerOrTrusted ...
-func claimOwnerOrTrusted(cl claim.PlayerClaim, actor ClaimActor) bool {
-	return cl.OwnerXUID == actor.XUID || slices.Contains(cl.TrustedXUIDS, actor.XUID) || actor.Operator
+// claimTrustLevel returns how far lineage[0], the claim deciding the action,
+// followed by the claims it is nested in, trusts actor. The owners of those
+// claims keep full access to the claims nested in them, and a claim
+// inheriting trusts also trusts the players its parent trusts.
+func claimTrustLevel(lineage []claim.PlayerClaim, actor ClaimActor) claim.TrustLevel {
+	if actor.Operator {
+		return claim.TrustManager
+	}
+	for _, cl := range lineage {
+		if cl.OwnerXUID == actor.XUID {
+			return claim.TrustManager
+		}
+	}
+	level := claim.TrustNone
+	for _, cl := range lineage {
+		level = max(level, cl.TrustLevelOf(actor.XUID))
+		if !cl.InheritTrusts {
+			break
+		}
+	}
+	return level
+}
+
+// requiredTrustLevel returns the trust level a player needs to perform action
+// regardless of the claim's features.
+func requiredTrustLevel(action ClaimAction, data any) claim.TrustLevel {
+	switch action {
+	case ClaimActionBlockInteract:
+		if actionData, ok := claimActionDataFrom(data); ok && accessBlock(actionData.typeID) {
+			return claim.TrustAccess
+		}
+		return claim.TrustContainer
+	case ClaimActionItemDrop:
+		return claim.TrustAccess
+	case ClaimActionEntityInteract, ClaimActionItemPickup:
+		return claim.TrustContainer
+	default:
+		return claim.TrustBuild
+	}
+}
+
+// accessBlock reports whether typeID is a block that access trust lets
+// players use: doors, trapdoors, fence gates, buttons, levers and beds.
+func accessBlock(typeID string) bool {
+	_, name, _ := strings.Cut(typeID, ":")
+	return strings.HasSuffix(name, "door") || strings.HasSuffix(name, "fence_gate") ||
+		strings.HasSuffix(name, "button") || name == "lever" || name == "bed"
 }
 
 func validClaim(cl claim.PlayerClaim) bool {
@@ -11,8 +11,11 @@ import (
 	"github.com/df-mc/dragonfly/server/world"
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/smell-of-curry/gobds/gobds/audit"
 	gblock "github.com/smell-of-curry/gobds/gobds/block"
 	"github.com/smell-of-curry/gobds/gobds/claim"
+	"github.com/smell-of-curry/gobds/gobds/entity"
 	"github.com/smell-of-curry/gobds/gobds/service"
 )
 
@@ -155,7 +158,7 @@ func TestClaimActionObserveOnlyRecordsForwardedWithoutLookup(t *testing.T) {
 		time.Minute,
 		slog.New(slog.NewTextHandler(io.Discard, nil)),
 	)
-	s := &Session{claimFactory: factory, claimPrefilter: false}
+	s := &Session{claimFactory: factory}
 	if !s.claimActionPermitted(ClaimActionBlockBreak, "malformed") {
 		t.Fatal("disabled prefilter must preserve forwarding")
 	}
@@ -310,7 +313,7 @@ func TestClaimsAtHandlesReversedAndOverlappingClaims(t *testing.T) {
 	if len(candidates) != 2 {
 		t.Fatalf("expected both overlapping claims, got %d", len(candidates))
 	}
-	if matched, ambiguous := singleClaimAt(candidates, 7, 7); matched != nil || !ambiguous {
+	if matched, ambiguous := singleClaimAt(snapshot, candidates, mgl32.Vec3{7, 0, 7}); matched != nil || !ambiguous {
 		t.Fatal("overlap must be ambiguous so proxy can pass through")
 	}
 	first.OwnerXUID = "stranger"
@@ -324,6 +327,83 @@ func TestClaimsAtHandlesReversedAndOverlappingClaims(t *testing.T) {
 	}
 }
 
+func TestVerticallyBoundedClaimsStackWithoutOverlap(t *testing.T) {
+	islandFloor, mineTop := float32(100), float32(99)
+	island, mine := testClaim(), testClaim()
+	island.ID, island.Location.MinY = "island", &islandFloor
+	mine.ID, mine.OwnerXUID, mine.Location.MaxY = "mine", "miner", &mineTop
+	snapshot, err := claim.BuildSnapshot(map[string]claim.PlayerClaim{"island": island, "mine": mine}, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates := snapshot.Candidates("minecraft:overworld", 5, 5)
+	for position, want := range map[mgl32.Vec3]string{
+		{5, 120, 5}: "island",
+		{5, 100, 5}: "island",
+		{5, 99, 5}:  "mine",
+		{5, -64, 5}: "mine",
+	} {
+		matched, ambiguous := singleClaimAt(snapshot, candidates, position)
+		if ambiguous || matched == nil || matched.ID != want {
+			t.Fatalf("claim at %v = %+v (ambiguous %v), want %s", position, matched, ambiguous, want)
+		}
+	}
+
+	miner := ClaimActor{XUID: "miner"}
+	for _, action := range []ClaimAction{ClaimActionBlockBreak, ClaimActionBlockPlace, ClaimActionBlockInteract} {
+		if !ClaimActionPermitted(island, miner, action, mgl32.Vec3{5, 99, 5}) {
+			t.Fatalf("action %d below the island must not be decided by it", action)
+		}
+		if ClaimActionPermitted(island, miner, action, mgl32.Vec3{5, 100, 5}) {
+			t.Fatalf("action %d on the island floor must be denied", action)
+		}
+	}
+	if !ClaimActionPermitted(island, miner, ClaimActionRender, mgl32.Vec3{5, -64, 5}) {
+		t.Fatal("deny blocks must not be painted under a claim above the dimension floor")
+	}
+	if ClaimActionPermitted(mine, ClaimActor{XUID: "stranger"}, ClaimActionRender, mgl32.Vec3{5, -64, 5}) {
+		t.Fatal("deny blocks must be painted under a claim reaching the dimension floor")
+	}
+}
+
+func TestNestedClaimsResolveToInnermost(t *testing.T) {
+	claimAt := func(id, parent string, from, to float32) claim.PlayerClaim {
+		cl := testClaim()
+		cl.ID, cl.ParentID = id, parent
+		cl.Location.Pos1 = claim.Vector2{X: from, Z: from}
+		cl.Location.Pos2 = claim.Vector2{X: to, Z: to}
+		return cl
+	}
+	snapshot, err := claim.BuildSnapshot(map[string]claim.PlayerClaim{
+		"town":  claimAt("town", "", 0, 15),
+		"plot":  claimAt("plot", "town", 2, 9),
+		"room":  claimAt("room", "plot", 4, 5),
+		"stall": claimAt("stall", "town", 8, 12),
+	}, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates := snapshot.Candidates("minecraft:overworld", 0, 0)
+	for position, want := range map[mgl32.Vec3]string{
+		{1, 64, 1}:   "town",
+		{3, 64, 3}:   "plot",
+		{4, 64, 5}:   "room",
+		{11, 64, 11}: "stall",
+	} {
+		matched, ambiguous := singleClaimAt(snapshot, candidates, position)
+		if ambiguous || matched == nil || matched.ID != want {
+			t.Fatalf("claim at %v = %+v (ambiguous %v), want %s", position, matched, ambiguous, want)
+		}
+	}
+	if matched, ambiguous := singleClaimAt(snapshot, candidates, mgl32.Vec3{9, 64, 9}); matched != nil || !ambiguous {
+		t.Fatal("overlapping claims nested in the same parent must stay ambiguous")
+	}
+	room, _ := singleClaimAt(snapshot, candidates, mgl32.Vec3{4, 64, 4})
+	if parents := claimParents(snapshot, room); len(parents) != 2 || parents[0].ID != "plot" || parents[1].ID != "town" {
+		t.Fatalf("unexpected room parents %+v", parents)
+	}
+}
+
 func claimActionsPermitted(claims []claim.PlayerClaim, actor ClaimActor, action ClaimAction, data any) bool {
 	for _, cl := range claims {
 		if !ClaimActionPermitted(cl, actor, action, data) {
@@ -345,3 +425,58 @@ func testClaim() claim.PlayerClaim {
 		},
 	}
 }
+
+func TestClaimDenialsAreAudited(t *testing.T) {
+	factory := claim.NewFactory(
+		service.Config{},
+		"TEST",
+		time.Minute,
+		time.Minute,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	err := factory.Publish(map[string]claim.PlayerClaim{
+		"home": {
+			ID:        "home",
+			OwnerXUID: "owner",
+			Location: claim.Location{
+				Dimension: "minecraft:overworld",
+				Pos1:      claim.Vector2{X: 0, Z: 0},
+				Pos2:      claim.Vector2{X: 15, Z: 15},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &auditRecorder{}
+	identity := login.IdentityData{XUID: "1", DisplayName: "Steve"}
+	s := Config{
+		Client:         &replayConn{identityData: identity},
+		Server:         &replayConn{identityData: identity},
+		ServerName:     "lobby",
+		ClaimPrefilter: true,
+		ClaimFactory:   factory,
+		Audit:          recorder,
+		EntityFactory:  entity.NewFactory(),
+		Log:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}.New()
+
+	if !s.claimActionPermitted(ClaimActionBlockBreak, mgl32.Vec3{40, 64, 40}) || len(recorder.events) != 0 {
+		t.Fatal("actions outside claims must be permitted without an audit event")
+	}
+	if s.claimActionPermitted(ClaimActionItemDrop, claimActionData{position: mgl32.Vec3{4.5, 63.9, 5.5}, typeID: "minecraft:diamond"}) {
+		t.Fatal("item drop by a stranger must be denied")
+	}
+	if len(recorder.events) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(recorder.events))
+	}
+	e := recorder.events[0]
+	if e.Type != audit.TypeClaimDenied || e.Action != "item_drop" || e.Target != "minecraft:diamond" ||
+		e.Server != "lobby" || e.XUID != "1" || e.Dimension != "minecraft:overworld" ||
+		*e.Position != [3]int32{4, 63, 5} {
+		t.Fatalf("unexpected claim denial %+v", e)
+	}
+	if *e.Claim != (audit.ClaimDecision{ID: "home", Owner: "owner", Status: "ready", Generation: 1}) {
+		t.Fatalf("unexpected claim decision %+v", e.Claim)
+	}
+}
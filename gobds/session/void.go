@@ -0,0 +1,66 @@
+package session
+
+import (
+	"bytes"
+	"math"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// voidRadius is the radius, in chunks, of the empty area sent around players
+// held on the proxy. The client only leaves the loading screen once the chunks
+// around it are loaded.
+const voidRadius = 2
+
+// voidPayloads caches the network payload of an all-air chunk per dimension.
+var voidPayloads sync.Map
+
+// SendVoid surrounds a player at position with empty chunks of dimension. It
+// is used for players held on the proxy with no backend world to show.
+func SendVoid(conn Conn, dimension int32, position mgl32.Vec3) {
+	r, ok := dimensionRangeByID(dimension, nil)
+	if !ok {
+		return
+	}
+	payload := voidPayload(dimension, r)
+	centerX := int32(math.Floor(float64(position.X()))) >> 4
+	centerZ := int32(math.Floor(float64(position.Z()))) >> 4
+
+	_ = conn.WritePacket(&packet.NetworkChunkPublisherUpdate{
+		Position: protocol.BlockPos{int32(position.X()), int32(position.Y()), int32(position.Z())},
+		Radius:   voidRadius << 4,
+	})
+	for x := -int32(voidRadius); x <= voidRadius; x++ {
+		for z := -int32(voidRadius); z <= voidRadius; z++ {
+			_ = conn.WritePacket(&packet.LevelChunk{
+				Position:      protocol.ChunkPos{centerX + x, centerZ + z},
+				Dimension:     dimension,
+				SubChunkCount: uint32((r.Height() + 15) >> 4),
+				RawPayload:    payload,
+			})
+		}
+	}
+}
+
+// voidPayload returns the network payload of an all-air chunk with range r.
+func voidPayload(dimension int32, r cube.Range) []byte {
+	if payload, ok := voidPayloads.Load(dimension); ok {
+		return payload.([]byte)
+	}
+	data := chunk.Encode(chunk.New(world.DefaultBlockRegistry, r), chunk.NetworkEncoding)
+	buf := bytes.NewBuffer(nil)
+	for _, sub := range data.SubChunks {
+		_, _ = buf.Write(sub)
+	}
+	_, _ = buf.Write(data.Biomes)
+	// Border block count.
+	_ = buf.WriteByte(0)
+	voidPayloads.Store(dimension, buf.Bytes())
+	return buf.Bytes()
+}
@@ -1,6 +1,9 @@
 package gobds
 
-import "github.com/sandertv/gophertunnel/minecraft"
+import (
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/text"
+)
 
 // proxyStatusProvider is a minecraft.ServerStatusProvider that reports the
 // proxy's own live player count and a statically configured capacity/name
@@ -22,6 +25,9 @@ type proxyStatusProvider struct {
 	name string
 	// maxPlayers is the capacity advertised in the server list.
 	maxPlayers int
+	// offlineMOTD and maintenanceMOTD replace name while the backends of srv
+	// are all down or all draining.
+	offlineMOTD, maintenanceMOTD string
 }
 
 // newProxyStatusProvider creates a proxyStatusProvider for the server passed.
@@ -29,7 +35,13 @@ type proxyStatusProvider struct {
 // srv is the server whose sessions are counted, name is the MOTD shown in the
 // list, and maxPlayers is the advertised capacity.
 func newProxyStatusProvider(srv *Server, name string, maxPlayers int) *proxyStatusProvider {
-	return &proxyStatusProvider{srv: srv, name: name, maxPlayers: maxPlayers}
+	return &proxyStatusProvider{
+		srv:             srv,
+		name:            name,
+		maxPlayers:      maxPlayers,
+		offlineMOTD:     text.Colourf("<red>Offline</red>"),
+		maintenanceMOTD: text.Colourf("<yellow>Maintenance</yellow>"),
+	}
 }
 
 // ServerStatus reports the current status of the proxy.
@@ -42,7 +54,9 @@ func newProxyStatusProvider(srv *Server, name string, maxPlayers int) *proxyStat
 // playerCount is the listener's live connection count, or negative to request
 // the server's tracked session count.
 // The second parameter (the caller's max players) is intentionally ignored.
-// It returns the status advertised in the server list.
+// It returns the status advertised in the server list. The name is replaced
+// while the server cannot take players, so the list tells players before they
+// try to join.
 func (p *proxyStatusProvider) ServerStatus(playerCount, _ int) minecraft.ServerStatus {
 	count := playerCount
 	if count < 0 {
@@ -51,8 +65,15 @@ func (p *proxyStatusProvider) ServerStatus(playerCount, _ int) minecraft.ServerS
 	if count < 0 {
 		count = 0
 	}
+	name := p.name
+	switch availabilityOf(p.srv.Backends) {
+	case offline:
+		name = p.offlineMOTD
+	case maintenance:
+		name = p.maintenanceMOTD
+	}
 	return minecraft.ServerStatus{
-		ServerName:  p.name,
+		ServerName:  name,
 		PlayerCount: count,
 		MaxPlayers:  p.maxPlayers,
 	}
@@ -16,6 +16,8 @@ import (
 	"github.com/sandertv/gophertunnel/minecraft"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
 	"github.com/sandertv/gophertunnel/minecraft/resource"
+	"github.com/smell-of-curry/gobds/gobds/audit"
+	"github.com/smell-of-curry/gobds/gobds/ban"
 	"github.com/smell-of-curry/gobds/gobds/claim"
 	"github.com/smell-of-curry/gobds/gobds/cmd"
 	"github.com/smell-of-curry/gobds/gobds/infra"
@@ -41,6 +43,26 @@ type UserConfig struct {
 
 		SentryDSN string
 	}
+	Bans struct {
+		Enabled bool
+		// Path is the JSON file bans are persisted to.
+		Path string
+	}
+	Queue struct {
+		// Enabled holds players in a queue while their server is full instead
+		// of disconnecting them.
+		Enabled bool
+		// UpdateInterval is how often queued players are told their position.
+		UpdateInterval string
+		// ReservationTimeout is how long a slot is held for an admitted
+		// player to reconnect before it is given to the next in line.
+		ReservationTimeout string
+		// WhitelistPriority is the queue priority of whitelisted players.
+		WhitelistPriority int
+		// RolePriorities maps roles from the authentication service to queue
+		// priorities. Higher priorities are admitted first.
+		RolePriorities map[string]int
+	}
 	Border struct {
 		Enabled    bool
 		MinX, MinZ int32
@@ -51,6 +73,21 @@ type UserConfig struct {
 		DenyRenderingEnabled bool
 		PollInterval         string
 		MaxSnapshotAge       string
+		// PersistEnabled saves every claim snapshot to PersistDirectory and
+		// loads it on start, so claims are enforced before the claim service
+		// first answers.
+		PersistEnabled   bool
+		PersistDirectory string
+		// PersistedMaxAge is how long after it was fetched a snapshot loaded
+		// from disk is trusted.
+		PersistedMaxAge string
+		// NotifyEnabled tells players when they enter or leave a claim, on
+		// the action bar or, with NotifyTitle, as a title.
+		NotifyEnabled bool
+		NotifyTitle   bool
+		// OutlineDuration is how long the border of a claim a player enters
+		// is outlined with particles. Borders are not outlined when empty.
+		OutlineDuration string
 	}
 	AFKTimer struct {
 		Enabled         bool
@@ -89,6 +126,71 @@ type UserConfig struct {
 		// blocks the detection API misclassifies.
 		WhitelistedCIDRs []string
 	}
+	Admin struct {
+		Enabled bool
+		// Address is the HTTP address the admin API listens on. Keep it on a
+		// loopback or private interface; the key is the only protection.
+		Address string
+		Key     string
+	}
+	Metrics struct {
+		Enabled bool
+		// Address is the HTTP address serving /metrics to Prometheus scrapers.
+		Address string
+		// Key, if set, must be sent by scrapers as a bearer token.
+		Key string
+	}
+	Reload struct {
+		// WatchFile reloads the configuration whenever config.toml changes on
+		// disk. SIGHUP always triggers a reload.
+		WatchFile bool
+	}
+	Reconnect struct {
+		// Enabled holds players in limbo while their backend restarts or
+		// crashes, and reattaches them once it is back.
+		Enabled bool
+		// Timeout is how long players are held before they are disconnected.
+		Timeout string
+		// RetryInterval is the delay between attempts to reach the backend.
+		RetryInterval string
+	}
+	HealthCheck struct {
+		// Enabled pings every backend in the background and stops sending
+		// players to those that do not answer.
+		Enabled bool
+		// Interval is the delay between pings of a backend.
+		Interval string
+		// Timeout is how long a ping waits for an answer.
+		Timeout string
+		// FailureThreshold is the number of unanswered pings in a row after
+		// which a backend is considered down.
+		FailureThreshold int
+	}
+	Capture struct {
+		// Enabled allows packet captures to be started through the admin API
+		// and for the XUIDs below.
+		Enabled bool
+		// Directory is where capture files are written.
+		Directory string
+		// MaxSizeMB is the size at which a capture is stopped.
+		MaxSizeMB int
+		// XUIDs are captured from the moment they join.
+		XUIDs []string
+	}
+	Audit struct {
+		// Enabled writes audit events to Path instead of the proxy log.
+		Enabled bool
+		// Path is the audit log file. Rotated files are kept next to it.
+		Path string
+		// MaxSizeMB is the size at which the audit log is rotated.
+		MaxSizeMB int
+		// MaxAge is how long the audit log is written to before it is
+		// rotated.
+		MaxAge string
+		// MaxFiles is how many rotated audit logs are kept. Older ones are
+		// deleted.
+		MaxFiles int
+	}
 	TrafficProtection session.TrafficConfig
 	DuplicateXUID     struct {
 		Enabled bool
@@ -237,22 +339,191 @@ func (c UserConfig) afkTimer() *infra.AFKTimer {
 	}
 }
 
-// whiteList returns new Whitelist instance.
-func (c UserConfig) whiteList(log *slog.Logger) *whitelist.Whitelist {
+// whiteList returns new Whitelist instance, or nil if the whitelist is
+// disabled.
+func (c UserConfig) whiteList() (*whitelist.Whitelist, error) {
 	if !c.Network.Whitelisted {
-		return nil
+		return nil, nil
 	}
 	conf, err := whitelist.ReadConfig(c.Network.WhitelistPath)
 	if err != nil {
-		log.Error("failed to read whitelist config", "err", err)
+		return nil, err
+	}
+	return whitelist.NewWhitelist(conf.Entries), nil
+}
+
+// banStore loads the ban store, or returns nil if bans are disabled.
+func (c UserConfig) banStore(log *slog.Logger) (*ban.Store, error) {
+	if !c.Bans.Enabled {
+		return nil, nil
+	}
+	return ban.NewStore(c.Bans.Path, log)
+}
+
+// claimPersistence returns the directory claim snapshots are saved in and how
+// long a restored snapshot is trusted. The directory is empty if persistence
+// is disabled.
+func (c UserConfig) claimPersistence() (string, time.Duration, error) {
+	if !c.Claims.PersistEnabled {
+		return "", 0, nil
+	}
+	maxAge, err := positiveDuration(c.Claims.PersistedMaxAge, claim.DefaultPersistedMaxAge)
+	if err != nil {
+		return "", 0, fmt.Errorf("persisted max age: %w", err)
+	}
+	directory := c.Claims.PersistDirectory
+	if directory == "" {
+		directory = "claims"
+	}
+	return directory, maxAge, nil
+}
+
+// claimNotifyConfig returns the claim notification settings, or nil if
+// notifications are disabled.
+func (c UserConfig) claimNotifyConfig() (*session.ClaimNotifyConfig, error) {
+	if !c.Claims.NotifyEnabled {
+		return nil, nil
+	}
+	conf := &session.ClaimNotifyConfig{Title: c.Claims.NotifyTitle}
+	if c.Claims.OutlineDuration != "" {
+		outline, err := positiveDuration(c.Claims.OutlineDuration, 0)
+		if err != nil {
+			return nil, fmt.Errorf("outline duration: %w", err)
+		}
+		conf.Outline = outline
+	}
+	return conf, nil
+}
+
+// queueConfig returns the join queue configuration, or nil if disabled.
+func (c UserConfig) queueConfig() (*QueueConfig, error) {
+	if !c.Queue.Enabled {
+		return nil, nil
+	}
+	updateInterval, err := positiveDuration(c.Queue.UpdateInterval, defaultQueueUpdateInterval)
+	if err != nil {
+		return nil, fmt.Errorf("update interval: %w", err)
+	}
+	reservationTimeout, err := positiveDuration(c.Queue.ReservationTimeout, defaultReservationTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("reservation timeout: %w", err)
+	}
+	return &QueueConfig{
+		UpdateInterval:     updateInterval,
+		ReservationTimeout: reservationTimeout,
+		WhitelistPriority:  c.Queue.WhitelistPriority,
+		RolePriorities:     c.Queue.RolePriorities,
+	}, nil
+}
+
+// reconnectConfig returns the backend reconnect configuration, or nil if
+// disabled.
+func (c UserConfig) reconnectConfig() (*session.ReconnectConfig, error) {
+	if !c.Reconnect.Enabled {
+		return nil, nil
+	}
+	timeout, err := positiveDuration(c.Reconnect.Timeout, 2*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("timeout: %w", err)
+	}
+	retryInterval, err := positiveDuration(c.Reconnect.RetryInterval, 3*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("retry interval: %w", err)
+	}
+	return &session.ReconnectConfig{Timeout: timeout, RetryInterval: retryInterval}, nil
+}
+
+// healthCheckConfig returns the backend health check configuration, or nil if
+// disabled.
+func (c UserConfig) healthCheckConfig() (*HealthCheckConfig, error) {
+	if !c.HealthCheck.Enabled {
+		return nil, nil
+	}
+	interval, err := positiveDuration(c.HealthCheck.Interval, defaultHealthCheckInterval)
+	if err != nil {
+		return nil, fmt.Errorf("interval: %w", err)
+	}
+	timeout, err := positiveDuration(c.HealthCheck.Timeout, defaultHealthCheckTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("timeout: %w", err)
+	}
+	threshold := c.HealthCheck.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	return &HealthCheckConfig{Interval: interval, Timeout: timeout, FailureThreshold: threshold}, nil
+}
+
+// captureConfig returns the packet capture configuration, or nil if disabled.
+func (c UserConfig) captureConfig() *CaptureConfig {
+	if !c.Capture.Enabled {
 		return nil
 	}
-	return whitelist.NewWhitelist(conf.Entries)
+	maxSize := c.Capture.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = defaultCaptureMaxSize
+	}
+	directory := c.Capture.Directory
+	if directory == "" {
+		directory = "captures"
+	}
+	return &CaptureConfig{Directory: directory, MaxBytes: int64(maxSize) << 20, XUIDs: c.Capture.XUIDs}
 }
 
-// dialerFunc returns a dialer func for a specific server.
-func (c UserConfig) dialerFunc(remoteAddress string, log *slog.Logger) DialerFunc {
-	return func(identityData login.IdentityData, clientData login.ClientData, ctx context.Context) (session.Conn, error) {
+const (
+	// defaultAuditMaxSize is the default audit log rotation size in
+	// megabytes.
+	defaultAuditMaxSize = 64
+	// defaultAuditMaxAge is the default audit log rotation age.
+	defaultAuditMaxAge = 24 * time.Hour
+	// defaultAuditMaxFiles is the default number of rotated audit logs kept.
+	defaultAuditMaxFiles = 30
+)
+
+// auditSink returns the audit log file, or a sink writing to log if the audit
+// log is disabled.
+func (c UserConfig) auditSink(log *slog.Logger) (audit.Sink, error) {
+	if !c.Audit.Enabled {
+		return audit.NewLogger(log), nil
+	}
+	maxAge, err := positiveDuration(c.Audit.MaxAge, defaultAuditMaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("max age: %w", err)
+	}
+	maxSize := c.Audit.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = defaultAuditMaxSize
+	}
+	maxFiles := c.Audit.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultAuditMaxFiles
+	}
+	path := c.Audit.Path
+	if path == "" {
+		path = "audit/audit.jsonl"
+	}
+	return audit.NewFile(path, int64(maxSize)<<20, maxAge, maxFiles, log), nil
+}
+
+// adminConfig returns the admin API configuration, or nil if disabled.
+func (c UserConfig) adminConfig() *AdminConfig {
+	if !c.Admin.Enabled {
+		return nil
+	}
+	return &AdminConfig{Address: c.Admin.Address, Key: c.Admin.Key}
+}
+
+// metricsConfig returns the metrics endpoint configuration, or nil if disabled.
+func (c UserConfig) metricsConfig() *MetricsConfig {
+	if !c.Metrics.Enabled {
+		return nil
+	}
+	return &MetricsConfig{Address: c.Metrics.Address, Key: c.Metrics.Key}
+}
+
+// dialerFunc returns a dialer func for the backends of every server.
+func (c UserConfig) dialerFunc(log *slog.Logger) DialerFunc {
+	return func(address string, identityData login.IdentityData, clientData login.ClientData, ctx context.Context) (session.Conn, error) {
 		d := minecraft.Dialer{
 			ClientData:   clientData,
 			IdentityData: identityData,
@@ -263,7 +534,7 @@ func (c UserConfig) dialerFunc(remoteAddress string, log *slog.Logger) DialerFun
 			ErrorLog:            log,
 			KeepXBLIdentityData: true,
 		}
-		return d.DialContext(ctx, "raknet", remoteAddress)
+		return d.DialContext(ctx, "raknet", address)
 	}
 }
 
@@ -304,9 +575,10 @@ func DefaultConfig() UserConfig {
 			MOTD:          "Some server",
 			MaxPlayers:    85,
 			ClaimService: struct {
-				Enabled bool
-				URL     string
-				Key     string
+				Enabled   bool
+				URL       string
+				Key       string
+				StreamURL string
 			}{
 				Enabled: false,
 				URL:     "http://127.0.0.1:8080/fetch/claims",
@@ -322,11 +594,26 @@ func DefaultConfig() UserConfig {
 	c.Network.MaxRenderDistance = 16
 	c.Network.FlushRate = 20
 
+	c.Bans.Enabled = true
+	c.Bans.Path = "bans.json"
+
+	c.Queue.Enabled = false
+	c.Queue.UpdateInterval = defaultQueueUpdateInterval.String()
+	c.Queue.ReservationTimeout = defaultReservationTimeout.String()
+	c.Queue.WhitelistPriority = 10
+	c.Queue.RolePriorities = map[string]int{}
+
 	c.Border.Enabled = false
 	c.Claims.PrefilterEnabled = false
 	c.Claims.DenyRenderingEnabled = false
 	c.Claims.PollInterval = claim.DefaultPollInterval.String()
 	c.Claims.MaxSnapshotAge = claim.DefaultMaxSnapshotAge.String()
+	c.Claims.PersistEnabled = false
+	c.Claims.PersistDirectory = "claims"
+	c.Claims.PersistedMaxAge = claim.DefaultPersistedMaxAge.String()
+	c.Claims.NotifyEnabled = false
+	c.Claims.NotifyTitle = false
+	c.Claims.OutlineDuration = "5s"
 
 	c.AFKTimer.Enabled = true
 	c.AFKTimer.TimeoutDuration = "10m"
@@ -338,6 +625,26 @@ func DefaultConfig() UserConfig {
 	c.Resources.PacksRequired = false
 	c.Resources.CommandPath = "resources/commands.json"
 
+	c.Reconnect.Enabled = false
+	c.Reconnect.Timeout = "2m"
+	c.Reconnect.RetryInterval = "3s"
+
+	c.HealthCheck.Enabled = false
+	c.HealthCheck.Interval = defaultHealthCheckInterval.String()
+	c.HealthCheck.Timeout = defaultHealthCheckTimeout.String()
+	c.HealthCheck.FailureThreshold = defaultFailureThreshold
+
+	c.Capture.Enabled = false
+	c.Capture.Directory = "captures"
+	c.Capture.MaxSizeMB = defaultCaptureMaxSize
+	c.Capture.XUIDs = []string{}
+
+	c.Audit.Enabled = false
+	c.Audit.Path = "audit/audit.jsonl"
+	c.Audit.MaxSizeMB = defaultAuditMaxSize
+	c.Audit.MaxAge = defaultAuditMaxAge.String()
+	c.Audit.MaxFiles = defaultAuditMaxFiles
+
 	c.AuthenticationService.Enabled = false
 	c.AuthenticationService.URL = "http://127.0.0.1:8080/authentication"
 	c.AuthenticationService.Key = defaultKey
@@ -347,6 +654,15 @@ func DefaultConfig() UserConfig {
 	// Megalink S.R.L. (Argentina) — residential ISP flagged as proxy by ip-api.
 	c.VPNService.WhitelistedCIDRs = []string{"45.230.64.0/22"}
 
+	c.Admin.Enabled = false
+	c.Admin.Address = "127.0.0.1:8081"
+	c.Admin.Key = defaultKey
+
+	c.Metrics.Enabled = false
+	c.Metrics.Address = "127.0.0.1:9100"
+
+	c.Reload.WatchFile = false
+
 	c.TrafficProtection = session.DefaultTrafficConfig()
 	c.DuplicateXUID.Enabled = false
 
@@ -354,9 +670,12 @@ func DefaultConfig() UserConfig {
 	return c
 }
 
+// configPath is the file ReadConfig loads and reloads watch.
+const configPath = "./config.toml"
+
 // ReadConfig ...
 func ReadConfig() (UserConfig, error) {
-	g := gophig.NewGophig[UserConfig]("./config.toml", gophig.TOMLMarshaler{}, os.ModePerm)
+	g := gophig.NewGophig[UserConfig](configPath, gophig.TOMLMarshaler{}, os.ModePerm)
 	_, err := g.LoadConf()
 	if os.IsNotExist(err) {
 		err = g.SaveConf(DefaultConfig())
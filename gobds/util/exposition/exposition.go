@@ -0,0 +1,166 @@
+// Package exposition writes metrics in the Prometheus text exposition format.
+package exposition
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the HTTP content type of the text written by Registry.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Label is one name/value pair attached to a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// L ...
+func L(name, value string) Label {
+	return Label{Name: name, Value: value}
+}
+
+type sample struct {
+	suffix string
+	labels []Label
+	value  float64
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+// Registry groups samples by metric family so that each family is written
+// once, even when several servers contribute samples to it. A Registry is
+// meant to be filled and written by a single scrape and is not safe for
+// concurrent use.
+type Registry struct {
+	families []*family
+	byName   map[string]*family
+}
+
+// NewRegistry ...
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*family)}
+}
+
+func (r *Registry) family(name, help, kind string) *family {
+	if f, ok := r.byName[name]; ok {
+		return f
+	}
+	f := &family{name: name, help: help, kind: kind}
+	r.byName[name] = f
+	r.families = append(r.families, f)
+	return f
+}
+
+// Counter adds a cumulative counter sample. The name should end in _total.
+func (r *Registry) Counter(name, help string, value uint64, labels ...Label) {
+	f := r.family(name, help, "counter")
+	f.samples = append(f.samples, sample{labels: labels, value: float64(value)})
+}
+
+// Gauge adds a gauge sample.
+func (r *Registry) Gauge(name, help string, value float64, labels ...Label) {
+	f := r.family(name, help, "gauge")
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+// Histogram adds a histogram from per-bucket (non-cumulative) counts. counts
+// must have one more entry than bounds; the last entry is the +Inf bucket.
+func (r *Registry) Histogram(name, help string, bounds []float64, counts []uint64, sum float64, labels ...Label) {
+	if len(counts) != len(bounds)+1 {
+		return
+	}
+	f := r.family(name, help, "histogram")
+	var cumulative uint64
+	for i, count := range counts {
+		cumulative += count
+		bound := math.Inf(1)
+		if i < len(bounds) {
+			bound = bounds[i]
+		}
+		f.samples = append(f.samples, sample{
+			suffix: "_bucket",
+			labels: append(append([]Label(nil), labels...), L("le", formatFloat(bound))),
+			value:  float64(cumulative),
+		})
+	}
+	f.samples = append(f.samples,
+		sample{suffix: "_sum", labels: labels, value: sum},
+		sample{suffix: "_count", labels: labels, value: float64(cumulative)},
+	)
+}
+
+// WriteTo writes every family in registration order.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	out := &countingWriter{w: w}
+	buf := bufio.NewWriter(out)
+	for _, f := range r.families {
+		_, _ = buf.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+		_, _ = buf.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+		for _, s := range f.samples {
+			_, _ = buf.WriteString(f.name + s.suffix)
+			writeLabels(buf, s.labels)
+			_, _ = buf.WriteString(" " + formatFloat(s.value) + "\n")
+		}
+	}
+	err := buf.Flush()
+	return out.n, err
+}
+
+func writeLabels(buf *bufio.Writer, labels []Label) {
+	if len(labels) == 0 {
+		return
+	}
+	_ = buf.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			_ = buf.WriteByte(',')
+		}
+		_, _ = buf.WriteString(label.Name + `="` + escapeLabel(label.Value) + `"`)
+	}
+	_ = buf.WriteByte('}')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
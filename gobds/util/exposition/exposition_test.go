@@ -0,0 +1,46 @@
+package exposition
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistryGroupsFamiliesAcrossCallers(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("gobds_test_total", "Test counter.", 1, L("server", "A"))
+	r.Gauge("gobds_test_gauge", "Test gauge.", 0.5)
+	r.Counter("gobds_test_total", "Test counter.", 2, L("server", `B"\`))
+	r.Histogram("gobds_test_seconds", "Test histogram.", []float64{0.001, 0.01}, []uint64{1, 2, 3}, 1.5, L("server", "A"))
+
+	var out bytes.Buffer
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP gobds_test_total Test counter.
+# TYPE gobds_test_total counter
+gobds_test_total{server="A"} 1
+gobds_test_total{server="B\"\\"} 2
+# HELP gobds_test_gauge Test gauge.
+# TYPE gobds_test_gauge gauge
+gobds_test_gauge 0.5
+# HELP gobds_test_seconds Test histogram.
+# TYPE gobds_test_seconds histogram
+gobds_test_seconds_bucket{server="A",le="0.001"} 1
+gobds_test_seconds_bucket{server="A",le="0.01"} 3
+gobds_test_seconds_bucket{server="A",le="+Inf"} 6
+gobds_test_seconds_sum{server="A"} 1.5
+gobds_test_seconds_count{server="A"} 6
+`
+	if out.String() != want {
+		t.Fatalf("unexpected exposition:\n%s", out.String())
+	}
+}
+
+func TestHistogramRejectsMismatchedBuckets(t *testing.T) {
+	r := NewRegistry()
+	r.Histogram("gobds_bad_seconds", "Bad.", []float64{1}, []uint64{1}, 0)
+	var out bytes.Buffer
+	if _, err := r.WriteTo(&out); err != nil || out.Len() != 0 {
+		t.Fatalf("mismatched histogram must be skipped, got %q err=%v", out.String(), err)
+	}
+}
@@ -2,7 +2,9 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
+	"os"
 	"time"
 
 	"github.com/avast/retry-go/v4"
@@ -11,6 +13,21 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:], os.Stdout); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "replay:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "claim" {
+		if err := runClaim(os.Args[2:], os.Stdout); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "claim:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Throttle high-volume "backend unreachable" spam (per-packet "handle
 	// packet: ... connection refused" / "error dialing connection") that floods
 	// the log whenever a BDS server is down or restarting. All other logs pass
@@ -43,6 +60,7 @@ func main() {
 		panic(err)
 	}
 	g.CloseOnProgramEnd()
+	g.ReloadOnChange()
 
 	err = retry.Do(
 		g.Listen,
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	_ "github.com/smell-of-curry/gobds/gobds/block"
+	"github.com/smell-of-curry/gobds/gobds/capture"
+	"github.com/smell-of-curry/gobds/gobds/claim"
+	"github.com/smell-of-curry/gobds/gobds/service"
+	"github.com/smell-of-curry/gobds/gobds/session"
+)
+
+// runReplay implements `gobds replay`: it feeds a packet capture back through
+// the session handlers and prints what they did with each packet.
+func runReplay(args []string, output io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(output)
+	claimsPath := flags.String("claims", "", "claim service response `file` to replay against instead of no claims")
+	verbose := flags.Bool("v", false, "print every packet and handler logs, not only packets that were dropped or answered")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(output, "usage: gobds replay [-claims file] [-v] capture")
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected one capture file")
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	r, err := capture.NewReader(f)
+	if err != nil {
+		return err
+	}
+	header := r.Header()
+
+	level := slog.LevelError
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	var claims *claim.Factory
+	if *claimsPath != "" {
+		if claims, err = replayClaims(*claimsPath, header.Server, log); err != nil {
+			return err
+		}
+	}
+
+	world.DefaultBlockRegistry.Finalize()
+	session.SetupRuntimeIDs()
+
+	_, _ = fmt.Fprintf(output, "replaying %s (%s) on %s, captured %s\n",
+		header.Name, header.XUID, header.Server, header.Started.Format(time.RFC3339))
+	var total, dropped, failed int
+	err = session.Replay(r, claims, log, func(result session.ReplayResult) {
+		total++
+		if !result.Forwarded {
+			dropped++
+		}
+		if result.Err != nil {
+			failed++
+		}
+		answered := len(result.ToClient) > 0 || len(result.ToServer) > 0
+		if !*verbose && result.Forwarded && !answered {
+			return
+		}
+		verdict := "forwarded"
+		switch {
+		case result.Err != nil:
+			verdict = "failed: " + result.Err.Error()
+		case !result.Forwarded:
+			verdict = "dropped"
+		}
+		_, _ = fmt.Fprintf(output, "%10.3fs %-11s %-28s %s\n",
+			result.Offset.Seconds(), result.Direction, packetName(result.Packet), verdict)
+		for _, pk := range result.ToClient {
+			_, _ = fmt.Fprintf(output, "%12s -> client %s\n", "", packetName(pk))
+		}
+		for _, pk := range result.ToServer {
+			_, _ = fmt.Fprintf(output, "%12s -> server %s\n", "", packetName(pk))
+		}
+	})
+	_, _ = fmt.Fprintf(output, "%d packets, %d dropped, %d failed\n", total, dropped, failed)
+	return err
+}
+
+// replayClaims loads a saved claim service response into a claim factory.
+func replayClaims(path, server string, log *slog.Logger) (*claim.Factory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	claims, err := claim.DecodeClaims(f)
+	if err != nil {
+		return nil, err
+	}
+	// The snapshot must not go stale while the replay runs.
+	factory := claim.NewFactory(service.Config{}, server, claim.DefaultPollInterval, 24*time.Hour, log)
+	if err = factory.Publish(claims); err != nil {
+		return nil, err
+	}
+	return factory, nil
+}
+
+// packetName returns the type name of pk.
+func packetName(pk packet.Packet) string {
+	if unknown, ok := pk.(*packet.Unknown); ok {
+		return fmt.Sprintf("Unknown(%d)", unknown.PacketID)
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", pk), "*packet.")
+}